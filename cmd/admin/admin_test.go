@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB points the commands at an empty in-memory database
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	sqlDB, _ := database.DB()
+	sqlDB.SetMaxOpenConns(1)
+	openDB = func(db.Config) (*gorm.DB, error) { return database, nil }
+	return database
+}
+
+// runAdmin runs a command and returns its standard output
+func runAdmin(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := runAdmin(t, "", args...)
+	if err != nil {
+		t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestAdmin_MigrateAndUsers(t *testing.T) {
+	database := setupDB(t)
+
+	if _, err := runAdmin(t, "", "migrate", "status"); err == nil {
+		t.Error("Expected an empty database to need migrations")
+	}
+	mustRun(t, "migrate", "up")
+	mustRun(t, "migrate", "status")
+
+	// The first admin joins the default organization with a generated password
+	var created userResult
+	out := mustRun(t, "users", "create", "-email", "ops@example.com", "-name", "Ops", "-role", "admin", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("Error decoding %q: %v", out, err)
+	}
+	if created.Organization != "default" || created.Role != models.RoleAdmin || created.Password == "" {
+		t.Errorf("Expected an admin of the default organization with a generated password, got %+v", created)
+	}
+	var user models.User
+	database.First(&user, created.ID)
+	if !user.CheckPassword(created.Password) {
+		t.Error("Expected the generated password to be set")
+	}
+
+	if _, err := runAdmin(t, "", "users", "create", "-email", "ops@example.com", "-name", "Again", "-password", "another-pass-1"); err == nil {
+		t.Error("Expected a duplicate email to fail")
+	}
+
+	// Reset lifts a lockout
+	locked := time.Now().Add(time.Hour)
+	database.Model(&user).Updates(map[string]interface{}{"failed_login_attempts": 5, "locked_until": locked})
+	if _, err := runAdmin(t, "new-password-42\n", "users", "reset-password", "-email", "ops@example.com", "-password-stdin"); err != nil {
+		t.Fatalf("Error resetting password: %v", err)
+	}
+	user = models.User{}
+	database.First(&user, created.ID)
+	if !user.CheckPassword("new-password-42") || user.FailedLoginAttempts != 0 || user.LockedUntil != nil {
+		t.Errorf("Expected the new password and no lockout, got %+v", user)
+	}
+
+	// Deactivating needs -yes
+	if _, err := runAdmin(t, "", "users", "deactivate", "-id", "1"); !errors.Is(err, errNotConfirmed) {
+		t.Errorf("Expected errNotConfirmed, got %v", err)
+	}
+	database.First(&user, created.ID)
+	if !user.IsActive {
+		t.Fatal("Expected the user to stay active without -yes")
+	}
+	mustRun(t, "users", "deactivate", "-email", "ops@example.com", "-yes")
+	database.First(&user, created.ID)
+	if user.IsActive {
+		t.Error("Expected the user to be deactivated")
+	}
+
+	result, err := audit.Verify()
+	if err != nil || !result.Valid || result.EntriesChecked != 3 {
+		t.Errorf("Expected a valid audit chain of 3 entries, got %+v, %v", result, err)
+	}
+
+	// A modified entry breaks the chain
+	mustRun(t, "audit", "verify")
+	database.Model(&models.AuditLog{}).Where("id = ?", 2).Update("action", "tampered")
+	if out, err := runAdmin(t, "", "audit", "verify", "-o", "json"); err == nil || !strings.Contains(out, `"first_invalid_id": 2`) {
+		t.Errorf("Expected entry 2 to be reported as broken, got %q, %v", out, err)
+	}
+}
+
+func TestAdmin_DevicesAndSignals(t *testing.T) {
+	database := setupDB(t)
+	mustRun(t, "migrate", "up")
+
+	org, err := findOrganization(database, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := models.Device{Name: "press-1", AuthToken: "old-token", IsActive: true, OrganizationID: &org.ID}
+	database.Create(&device)
+	signal := models.Signal{DeviceID: device.ID, Name: "temperature", SignalType: "analogic"}
+	database.Create(&signal)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 48; i++ {
+		value := float64(i)
+		// Received on two days
+		database.Create(&models.SignalValue{SignalID: signal.ID, Value: &value,
+			Timestamp: start.Add(time.Duration(i) * time.Hour), CreatedAt: start.Add(time.Duration(i) * time.Hour)})
+	}
+	database.Create(&models.DeviceUsage{DeviceID: device.ID, Day: "2024-01-01", ValueCount: 100})
+
+	out := mustRun(t, "devices", "list")
+	if !strings.Contains(out, "press-1") || !strings.Contains(out, "default") || strings.Contains(out, "old-token") {
+		t.Errorf("Expected the device without its token, got:\n%s", out)
+	}
+
+	var rotated deviceResult
+	out = mustRun(t, "devices", "rotate-token", "-id", "1", "-yes", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &rotated); err != nil || rotated.AuthToken == "" || rotated.AuthToken == "old-token" {
+		t.Errorf("Expected a new token, got %q, %v", out, err)
+	}
+	mustRun(t, "devices", "disable", "-id", "1", "-yes")
+	database.First(&device, device.ID)
+	if device.IsActive || device.AuthToken != rotated.AuthToken {
+		t.Errorf("Expected a disabled device with the new token, got %+v", device)
+	}
+
+	// Purge the first 12 hours
+	if _, err := runAdmin(t, "", "signals", "purge", "-id", "1"); err == nil {
+		t.Error("Expected a range or -all to be required")
+	}
+	if _, err := runAdmin(t, "", "signals", "purge", "-id", "1", "-to", "2024-01-01T12:00:00Z"); !errors.Is(err, errNotConfirmed) {
+		t.Errorf("Expected errNotConfirmed, got %v", err)
+	}
+	var purged purgeResult
+	out = mustRun(t, "signals", "purge", "-id", "1", "-to", "2024-01-01T12:00:00Z", "-yes", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &purged); err != nil || purged.Deleted != 12 {
+		t.Errorf("Expected 12 deleted values, got %q, %v", out, err)
+	}
+
+	// Counts are recomputed from the 36 values left
+	var usage []usageResult
+	out = mustRun(t, "signals", "recompute-aggregates", "-yes", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &usage); err != nil {
+		t.Fatalf("Error decoding %q: %v", out, err)
+	}
+	var stored []models.DeviceUsage
+	database.Order("day").Find(&stored)
+	if len(stored) != 2 || stored[0].ValueCount != 12 || stored[1].ValueCount != 24 || len(usage) != 2 {
+		t.Errorf("Expected 12 and 24 values per day, got %+v (changes %+v)", stored, usage)
+	}
+
+	out = mustRun(t, "db", "stats")
+	if !strings.Contains(strings.Join(strings.Fields(out), " "), "signal_values 36") || !strings.Contains(out, "2024-01-01T12:00:00Z") {
+		t.Errorf("Expected 36 values from noon on, got:\n%s", out)
+	}
+
+	result, err := audit.Verify()
+	if err != nil || !result.Valid || result.EntriesChecked != 3 {
+		t.Errorf("Expected a valid audit chain of 3 entries, got %+v, %v", result, err)
+	}
+}
+
+func TestAdmin_MigrateLegacy(t *testing.T) {
+	database := setupDB(t)
+	mustRun(t, "migrate", "up")
+
+	// The readings table of the first schema; sqlite stores the arrays as JSON
+	database.Exec(`CREATE TABLE readings (id INTEGER PRIMARY KEY, userid INTEGER, timestamp DATETIME,
+		value REAL, torquevalues TEXT, asmtimes TEXT, motionwastes TEXT, setvalue REAL, created_at DATETIME)`)
+	insert := `INSERT INTO readings (id, userid, timestamp, value, torquevalues, asmtimes, motionwastes, setvalue, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	database.Exec(insert, 1, 99, "2020-03-01 08:00:00", 12.5, "[1.5,3,4.25]", "[1200,800]", "[10,0]", 12, "2020-03-01 08:00:01")
+	database.Exec(insert, 2, nil, "2020-03-01 08:01:00", 11, "[]", nil, nil, nil, nil)
+	database.Exec(insert, 3, nil, nil, 13, "not json", nil, nil, 12, "2020-03-01 08:02:00")
+	database.Exec(insert, 4, nil, nil, 14, nil, nil, nil, nil, nil)
+
+	// A dry run reports the signals it would create without writing
+	var report legacyResult
+	out := mustRun(t, "migrate", "legacy", "-dry-run", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Error decoding %q: %v", out, err)
+	}
+	if len(report.Tables) != 1 || report.Tables[0].Pending != 4 || len(report.Tables[0].Signals) != 5 {
+		t.Errorf("Expected 4 pending rows and 5 new signals, got %+v", report)
+	}
+	var devices int64
+	database.Model(&models.Device{}).Count(&devices)
+	if devices != 0 || database.Migrator().HasTable(&legacyCheckpoint{}) {
+		t.Error("Expected the dry run not to write")
+	}
+
+	out = mustRun(t, "migrate", "legacy", "-batch", "2", "-torque-interval", "0.01", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Error decoding %q: %v", out, err)
+	}
+	table := report.Tables[0]
+	// Row 3 has an invalid torque curve; row 4 has no timestamp
+	if table.Converted != 4 || table.Pending != 0 || table.Skipped != 2 || !table.Reconciled {
+		t.Errorf("Expected 4 reconciled rows with 2 skipped fields, got %+v", table)
+	}
+
+	var device models.Device
+	database.Where("name = ?", "Legacy readings").First(&device)
+	if device.ID == 0 || device.IsActive || device.AuthToken == "" {
+		t.Errorf("Expected an inactive legacy device, got %+v", device)
+	}
+	var torque models.Signal
+	database.Where("device_id = ? AND name = ?", device.ID, "legacy_torquevalues").First(&torque)
+	var curve models.SignalValue
+	database.Where("signal_id = ?", torque.ID).First(&curve)
+	if torque.SignalType != "waveform" || len(curve.Samples) != 3 || curve.Samples[2] != 4.25 ||
+		curve.SampleInterval == nil || *curve.SampleInterval != 0.01 || curve.UserID != nil {
+		t.Errorf("Expected the torque curve without the missing user, got %+v %+v", torque, curve)
+	}
+	var values int64
+	database.Model(&models.SignalValue{}).Count(&values)
+	// Values 1, 2 and 3, setpoints 1 and 3, one torque curve, asm times and motion wastes
+	if values != 8 {
+		t.Errorf("Expected 8 values, got %d", values)
+	}
+
+	// A second run resumes after the checkpoint
+	database.Exec(insert, 5, nil, "2020-03-02 08:00:00", 15, nil, nil, nil, nil, nil)
+	out = mustRun(t, "migrate", "legacy", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Error decoding %q: %v", out, err)
+	}
+	if table := report.Tables[0]; table.Converted != 1 || table.Migrated != 5 || !table.Reconciled {
+		t.Errorf("Expected only the new row to be converted, got %+v", table)
+	}
+	database.Model(&models.Device{}).Count(&devices)
+	if devices != 1 {
+		t.Errorf("Expected the legacy device to be reused, got %d devices", devices)
+	}
+
+	// Missing values fail the reconciliation
+	database.Where("signal_id = ?", torque.ID).Delete(&models.SignalValue{})
+	if out, err := runAdmin(t, "", "migrate", "legacy"); err == nil || !strings.Contains(out, "mismatch") {
+		t.Errorf("Expected a reconciliation error, got %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"data-storage/internal/audit"
+)
+
+// auditVerify checks the hash chains of every organization and reports the first broken
+// entry. The API only tells organization admins whether their organization's chain is valid.
+func auditVerify(e *env, args []string) error {
+	if _, err := e.parse(e.flags(), args); err != nil {
+		return err
+	}
+	result, err := audit.Verify()
+	if err != nil {
+		return err
+	}
+
+	status, firstInvalid := "valid", "-"
+	if !result.Valid {
+		status = "invalid: " + result.Reason
+		firstInvalid = strconv.FormatUint(uint64(*result.FirstInvalidID), 10)
+	}
+	row := []string{fmt.Sprint(result.EntriesChecked), firstInvalid, status}
+	if err := e.print(result, []string{"ENTRIES CHECKED", "FIRST INVALID ID", "STATUS"}, [][]string{row}); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errors.New("the audit log chain is broken")
+	}
+	return nil
+}
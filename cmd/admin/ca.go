@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"data-storage/internal/pki"
+)
+
+// caResult is the output of ca init
+type caResult struct {
+	CertFile    string    `json:"cert_file"`
+	KeyFile     string    `json:"key_file"`
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// caInit writes a new CA certificate and key to the files the API loads them from. Existing
+// files are never overwritten, since losing the key means no more certificates can be issued
+// by that CA.
+func caInit(e *env, args []string) error {
+	fs := e.flags()
+	certFile := fs.String("cert", e.cfg.DeviceCA.CertFile, "CA certificate file to create (default DEVICE_CA_CERT)")
+	keyFile := fs.String("key", e.cfg.DeviceCA.KeyFile, "CA key file to create (default DEVICE_CA_KEY)")
+	commonName := fs.String("cn", "Data Storage Device CA", "common name of the CA")
+	validity := fs.Duration("validity", 10*365*24*time.Hour, "lifetime of the CA; issued certificates never outlive it")
+	if err := e.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *certFile == "" || *keyFile == "" {
+		return errors.New("-cert and -key are required when DEVICE_CA_CERT and DEVICE_CA_KEY are not set")
+	}
+	if *validity <= 0 {
+		return errors.New("-validity must be positive")
+	}
+	for _, path := range []string{*certFile, *keyFile} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	certPEM, keyPEM, err := pki.GenerateCA(*commonName, *validity)
+	if err != nil {
+		return err
+	}
+	// The key is created first and exclusively, so a concurrent run cannot replace it
+	if err := writeNewFile(*keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+	if err := writeNewFile(*certFile, certPEM, 0o644); err != nil {
+		return err
+	}
+
+	cert, err := pki.ParseCertificate(string(certPEM))
+	if err != nil {
+		return err
+	}
+	return e.printCA(*certFile, *keyFile, cert)
+}
+
+func (e *env) printCA(certFile, keyFile string, cert *x509.Certificate) error {
+	result := caResult{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		Subject:     cert.Subject.String(),
+		Fingerprint: pki.Fingerprint(cert),
+		NotAfter:    cert.NotAfter,
+	}
+	return e.print(result, []string{"CERT FILE", "KEY FILE", "SUBJECT", "FINGERPRINT", "NOT AFTER"}, [][]string{{
+		result.CertFile, result.KeyFile, result.Subject, result.Fingerprint, formatTime(&result.NotAfter),
+	}})
+}
+
+// writeNewFile writes data to a file that must not exist yet
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func migrateStatus(e *env, args []string) error {
+	database, err := e.parse(e.flags(), args)
+	if err != nil {
+		return err
+	}
+	statuses, err := db.SchemaStatus(database)
+	if err != nil {
+		return err
+	}
+	if err := e.printSchema(statuses); err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if !s.Migrated() {
+			return errors.New("the schema is not up to date; run migrate up or start the API")
+		}
+	}
+	return nil
+}
+
+func migrateUp(e *env, args []string) error {
+	database, err := e.parse(e.flags(), args)
+	if err != nil {
+		return err
+	}
+	if err := db.Setup(database); err != nil {
+		return err
+	}
+	statuses, err := db.SchemaStatus(database)
+	if err != nil {
+		return err
+	}
+	return e.printSchema(statuses)
+}
+
+func (e *env) printSchema(statuses []db.TableStatus) error {
+	rows := make([][]string, 0, len(statuses))
+	for _, s := range statuses {
+		status := "ok"
+		switch {
+		case !s.Exists:
+			status = "missing"
+		case len(s.MissingColumns) > 0:
+			status = "missing columns: " + strings.Join(s.MissingColumns, ", ")
+		}
+		rows = append(rows, []string{s.Model, s.Table, status})
+	}
+	return e.print(statuses, []string{"MODEL", "TABLE", "STATUS"}, rows)
+}
+
+// tableStats is the size of one table. PostgreSQL row counts are the planner's estimates,
+// which are cheap on large tables; SQLite rows are counted.
+type tableStats struct {
+	Table     string `json:"table"`
+	Rows      int64  `json:"rows"`
+	Estimated bool   `json:"estimated"`
+	Bytes     *int64 `json:"bytes,omitempty"` // Including indexes; PostgreSQL only
+}
+
+// statsResult is the output of db stats
+type statsResult struct {
+	Dialect       string       `json:"dialect"`
+	DatabaseBytes *int64       `json:"database_bytes,omitempty"`
+	Tables        []tableStats `json:"tables"`
+	OldestValue   *time.Time   `json:"oldest_value,omitempty"`
+	NewestValue   *time.Time   `json:"newest_value,omitempty"`
+}
+
+func dbStats(e *env, args []string) error {
+	database, err := e.parse(e.flags(), args)
+	if err != nil {
+		return err
+	}
+	statuses, err := db.SchemaStatus(database)
+	if err != nil {
+		return err
+	}
+
+	result := statsResult{Dialect: database.Dialector.Name(), Tables: []tableStats{}}
+	postgres := result.Dialect == "postgres"
+	if postgres {
+		var size int64
+		if err := database.Raw("SELECT pg_database_size(current_database())").Scan(&size).Error; err != nil {
+			return err
+		}
+		result.DatabaseBytes = &size
+	}
+	for _, s := range statuses {
+		if !s.Exists {
+			continue
+		}
+		stats := tableStats{Table: s.Table, Estimated: postgres}
+		if postgres {
+			var row struct {
+				Rows  int64
+				Bytes int64
+			}
+			err = database.Raw(`SELECT GREATEST(reltuples, 0)::bigint AS rows, pg_total_relation_size(oid) AS bytes
+				FROM pg_class WHERE oid = to_regclass(?)`, s.Table).Scan(&row).Error
+			stats.Rows, stats.Bytes = row.Rows, &row.Bytes
+		} else {
+			err = database.Table(s.Table).Count(&stats.Rows).Error
+		}
+		if err != nil {
+			return err
+		}
+		result.Tables = append(result.Tables, stats)
+	}
+
+	if result.OldestValue, err = valueTimestamp(database, "ASC"); err != nil {
+		return err
+	}
+	if result.NewestValue, err = valueTimestamp(database, "DESC"); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(result.Tables)+3)
+	for _, t := range result.Tables {
+		count := strconv.FormatInt(t.Rows, 10)
+		if t.Estimated {
+			count = "~" + count
+		}
+		rows = append(rows, []string{t.Table, count, formatBytes(t.Bytes)})
+	}
+	if result.DatabaseBytes != nil {
+		rows = append(rows, []string{"(database)", "", formatBytes(result.DatabaseBytes)})
+	}
+	if err := e.print(result, []string{"TABLE", "ROWS", "SIZE"}, rows); err != nil {
+		return err
+	}
+	if e.format == "table" {
+		fmt.Fprintf(e.stdout, "\nSignal values from %s to %s\n", formatTime(result.OldestValue), formatTime(result.NewestValue))
+	}
+	return nil
+}
+
+// valueTimestamp returns the oldest or newest signal value timestamp, using its index
+func valueTimestamp(database *gorm.DB, order string) (*time.Time, error) {
+	var values []models.SignalValue
+	if err := database.Select("timestamp").Order("timestamp " + order).Limit(1).Find(&values).Error; err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return &values[0].Timestamp, nil
+}
+
+func formatBytes(n *int64) string {
+	if n == nil {
+		return "-"
+	}
+	const unit = 1024
+	if *n < unit {
+		return strconv.FormatInt(*n, 10) + " B"
+	}
+	value, suffix := float64(*n), "KMGTPE"
+	i := -1
+	for value >= unit && i < len(suffix)-1 {
+		value /= unit
+		i++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + string(suffix[i]) + "iB"
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// deviceResult is the output of the device commands; the token is only shown when rotated
+type deviceResult struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	DeviceType   string    `json:"device_type,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	Organization string    `json:"organization,omitempty"`
+	IsActive     bool      `json:"is_active"`
+	Signals      int64     `json:"signals"`
+	CreatedAt    time.Time `json:"created_at"`
+	AuthToken    string    `json:"auth_token,omitempty"`
+}
+
+// printDevices prints the devices as a table, or v as JSON
+func (e *env) printDevices(v interface{}, results []deviceResult) error {
+	header := []string{"ID", "NAME", "TYPE", "LOCATION", "ORGANIZATION", "ACTIVE", "SIGNALS", "CREATED"}
+	showToken := len(results) == 1 && results[0].AuthToken != ""
+	if showToken {
+		header = append(header, "AUTH TOKEN")
+	}
+	rows := make([][]string, 0, len(results))
+	for _, d := range results {
+		row := []string{strconv.FormatUint(uint64(d.ID), 10), d.Name, orDash(d.DeviceType), orDash(d.Location),
+			orDash(d.Organization), strconv.FormatBool(d.IsActive), strconv.FormatInt(d.Signals, 10), formatTime(&d.CreatedAt)}
+		if showToken {
+			row = append(row, d.AuthToken)
+		}
+		rows = append(rows, row)
+	}
+	return e.print(v, header, rows)
+}
+
+func devicesList(e *env, args []string) error {
+	fs := e.flags()
+	org := fs.String("org", "", "only devices of this organization ID or slug")
+	deviceType := fs.String("type", "", "only devices of this type")
+	inactive := fs.Bool("inactive", false, "only disabled devices")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	query := database.Order("id")
+	if *org != "" {
+		organization, err := findOrganization(database, *org)
+		if err != nil {
+			return err
+		}
+		query = query.Where("organization_id = ?", organization.ID)
+	}
+	if *deviceType != "" {
+		query = query.Where("device_type = ?", *deviceType)
+	}
+	if *inactive {
+		query = query.Where("is_active = ?", false)
+	}
+	var devices []models.Device
+	if err := query.Find(&devices).Error; err != nil {
+		return err
+	}
+
+	results, err := deviceResults(database, devices)
+	if err != nil {
+		return err
+	}
+	return e.printDevices(results, results)
+}
+
+func devicesRotateToken(e *env, args []string) error {
+	fs := e.destructiveFlags()
+	id := fs.Uint("id", 0, "device ID (required)")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	device, err := findDevice(database, *id)
+	if err != nil {
+		return err
+	}
+	if err := e.confirm("replace the auth token of device %d (%s); it is rejected until the device uses the new one",
+		device.ID, device.Name); err != nil {
+		return err
+	}
+
+	token, err := auth.GenerateDeviceToken()
+	if err != nil {
+		return err
+	}
+	before := *device
+	device.AuthToken = token
+	if err := database.Model(device).Update("auth_token", token).Error; err != nil {
+		return err
+	}
+	if err := audit.RecordSystem(actorType, device.OrganizationID, audit.ActionUpdate, "device", device.ID, before, device); err != nil {
+		return err
+	}
+
+	results, err := deviceResults(database, []models.Device{*device})
+	if err != nil {
+		return err
+	}
+	results[0].AuthToken = token
+	return e.printDevices(results[0], results)
+}
+
+func devicesDisable(e *env, args []string) error {
+	fs := e.destructiveFlags()
+	id := fs.Uint("id", 0, "device ID (required)")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	device, err := findDevice(database, *id)
+	if err != nil {
+		return err
+	}
+	if !device.IsActive {
+		return errors.New("the device is already disabled")
+	}
+	if err := e.confirm("disable device %d (%s); its requests are rejected until it is enabled again", device.ID, device.Name); err != nil {
+		return err
+	}
+
+	before := *device
+	device.IsActive = false
+	if err := database.Model(device).Update("is_active", false).Error; err != nil {
+		return err
+	}
+	if err := audit.RecordSystem(actorType, device.OrganizationID, audit.ActionUpdate, "device", device.ID, before, device); err != nil {
+		return err
+	}
+
+	results, err := deviceResults(database, []models.Device{*device})
+	if err != nil {
+		return err
+	}
+	return e.printDevices(results[0], results)
+}
+
+func findDevice(database *gorm.DB, id uint) (*models.Device, error) {
+	if id == 0 {
+		return nil, errors.New("-id is required")
+	}
+	var device models.Device
+	err := database.First(&device, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("device not found")
+	}
+	return &device, err
+}
+
+// deviceResults adds the organization slug and signal count of each device
+func deviceResults(database *gorm.DB, devices []models.Device) ([]deviceResult, error) {
+	ids := make([]uint, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+
+	var counts []struct {
+		DeviceID uint
+		Count    int64
+	}
+	err := database.Model(&models.Signal{}).Select("device_id, COUNT(*) AS count").
+		Where("device_id IN ?", ids).Group("device_id").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	signals := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		signals[c.DeviceID] = c.Count
+	}
+
+	var orgs []models.Organization
+	if err := database.Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	slugs := make(map[uint]string, len(orgs))
+	for _, o := range orgs {
+		slugs[o.ID] = o.Slug
+	}
+
+	results := make([]deviceResult, len(devices))
+	for i, d := range devices {
+		results[i] = deviceResult{
+			ID:         d.ID,
+			Name:       d.Name,
+			DeviceType: d.DeviceType,
+			Location:   d.Location,
+			IsActive:   d.IsActive,
+			Signals:    signals[d.ID],
+			CreatedAt:  d.CreatedAt,
+		}
+		if d.OrganizationID != nil {
+			results[i].Organization = slugs[*d.OrganizationID]
+		}
+	}
+	return results, nil
+}
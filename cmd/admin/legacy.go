@@ -0,0 +1,588 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// legacyTables are the tables the pre-device schema can leave behind: readings, when
+// migration 002 never ran, and signals_old, the renamed readings table set aside by 003
+var legacyTables = []string{"readings", "signals_old"}
+
+// legacyColumn is a column of the legacy readings converted into the values of one signal
+type legacyColumn struct {
+	name        string // Name of the signal on the device
+	signalType  string
+	description string
+}
+
+// Legacy columns
+var (
+	legacyValue        = legacyColumn{"legacy_value", "analogic", "Value of the legacy reading"}
+	legacyDigitalValue = legacyColumn{"legacy_digital_value", "digital", "Value of the legacy digital reading"}
+	legacySetValue     = legacyColumn{"legacy_setvalue", "analogic", "Setpoint of the legacy reading (setvalue)"}
+	legacyTorque       = legacyColumn{"legacy_torquevalues", "waveform", "Torque curve of the legacy reading (torquevalues)"}
+	legacyAsmTimes     = legacyColumn{"legacy_asmtimes", "waveform", "Assembly times of the legacy reading (asmtimes), one sample per step"}
+	legacyMotionWastes = legacyColumn{"legacy_motionwastes", "waveform", "Motion wastes of the legacy reading (motionwastes), one sample per step"}
+)
+
+// legacyCheckpoint records how far the conversion of a legacy table got, so an interrupted
+// run resumes after the last converted batch
+type legacyCheckpoint struct {
+	SourceTable string `gorm:"primaryKey;size:64"`
+	LastID      uint   `gorm:"not null"`
+	Rows        int64  `gorm:"not null"` // Rows converted
+	Values      int64  `gorm:"not null"` // Signal values created
+	Skipped     int64  `gorm:"not null"` // Legacy fields that could not be converted
+	UpdatedAt   time.Time
+}
+
+func (legacyCheckpoint) TableName() string {
+	return "legacy_migrations"
+}
+
+// legacyRow is a row of a legacy table. Columns missing from the table are nil, and
+// arrays are read as JSON.
+type legacyRow struct {
+	ID           uint
+	UserID       *uint
+	DeviceID     *uint
+	Timestamp    *time.Time
+	CreatedAt    *time.Time
+	Value        *float64
+	SetValue     *float64
+	TorqueValues *string
+	AsmTimes     *string
+	MotionWastes *string
+	SignalType   *string
+}
+
+// legacySignalResult is the reconciliation of one signal: the values converted from the
+// legacy rows against the values stored
+type legacySignalResult struct {
+	DeviceID uint   `json:"device_id,omitempty"` // Zero for a device a dry run would create
+	Device   string `json:"device"`
+	SignalID uint   `json:"signal_id,omitempty"` // Zero for a signal a dry run would create
+	Signal   string `json:"signal"`
+	Expected int64  `json:"expected"`
+	Stored   int64  `json:"stored"`
+}
+
+// legacyTableResult is the outcome of the conversion of one legacy table
+type legacyTableResult struct {
+	Table      string               `json:"table"`
+	Rows       int64                `json:"rows"`      // Rows in the legacy table
+	Migrated   int64                `json:"migrated"`  // Rows converted by this and earlier runs
+	Pending    int64                `json:"pending"`   // Rows still to convert
+	Converted  int64                `json:"converted"` // Rows converted by this run
+	Skipped    int64                `json:"skipped"`   // Legacy fields that could not be converted
+	Signals    []legacySignalResult `json:"signals"`
+	Reconciled bool                 `json:"reconciled"` // Every row converted and every expected value stored
+}
+
+// legacyResult is the output of migrate legacy
+type legacyResult struct {
+	DryRun bool                `json:"dry_run"`
+	Tables []legacyTableResult `json:"tables"`
+}
+
+// legacyMigration converts the tables of one run
+type legacyMigration struct {
+	e              *env
+	db             *gorm.DB
+	org            *models.Organization
+	dryRun         bool
+	torqueInterval float64
+	users          map[uint]bool             // Whether a legacy user ID still exists
+	devices        map[string]*models.Device // By legacyDeviceKey
+	targets        map[string]*legacyTarget  // By legacyDeviceKey and signal name
+}
+
+// legacyTarget is the device and signal the values of a legacy column go to
+type legacyTarget struct {
+	device *models.Device
+	signal *models.Signal
+	column legacyColumn
+}
+
+// convertedValue is a signal value converted from a legacy row, with the key of its target
+type convertedValue struct {
+	target string
+	value  models.SignalValue
+}
+
+// migrateLegacy converts the readings of the pre-device schema into devices, signals and
+// signal values
+func migrateLegacy(e *env, args []string) error {
+	fs := e.flags()
+	dryRun := fs.Bool("dry-run", false, "report what would be converted without changing anything")
+	org := fs.String("org", "", "organization ID or slug of created devices (default the only organization)")
+	batchSize := fs.Int("batch", 500, "legacy rows converted per transaction")
+	torqueInterval := fs.Float64("torque-interval", 1, "seconds between torque samples, which legacy rows do not record")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return errors.New("-batch must be positive")
+	}
+	if *torqueInterval <= 0 {
+		return errors.New("-torque-interval must be positive")
+	}
+
+	organization, err := findOrganization(database, *org)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		if err := database.AutoMigrate(&legacyCheckpoint{}); err != nil {
+			return err
+		}
+	}
+
+	m := &legacyMigration{
+		e:              e,
+		db:             database,
+		org:            organization,
+		dryRun:         *dryRun,
+		torqueInterval: *torqueInterval,
+		users:          make(map[uint]bool),
+		devices:        make(map[string]*models.Device),
+		targets:        make(map[string]*legacyTarget),
+	}
+	result := legacyResult{DryRun: *dryRun, Tables: []legacyTableResult{}}
+	for _, table := range legacyTables {
+		if !database.Migrator().HasTable(table) {
+			continue
+		}
+		tableResult, err := m.migrateTable(table, *batchSize)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		result.Tables = append(result.Tables, tableResult)
+	}
+
+	if err := e.printLegacy(result); err != nil {
+		return err
+	}
+	if !*dryRun {
+		for _, t := range result.Tables {
+			if !t.Reconciled {
+				return fmt.Errorf("%s did not reconcile; compare the expected and stored values", t.Table)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *env) printLegacy(result legacyResult) error {
+	if e.format == "table" && len(result.Tables) == 0 {
+		fmt.Fprintln(e.stdout, "No legacy tables found")
+		return nil
+	}
+	var rows [][]string
+	for _, t := range result.Tables {
+		for _, s := range t.Signals {
+			status := "ok"
+			switch {
+			case s.SignalID == 0:
+				status = "new"
+			case result.DryRun:
+				status = "exists"
+			case s.Stored != s.Expected:
+				status = "mismatch"
+			}
+			rows = append(rows, []string{t.Table, s.Device, s.Signal,
+				strconv.FormatInt(s.Expected, 10), strconv.FormatInt(s.Stored, 10), status})
+		}
+	}
+	if err := e.print(result, []string{"TABLE", "DEVICE", "SIGNAL", "EXPECTED", "STORED", "STATUS"}, rows); err != nil {
+		return err
+	}
+	if e.format == "table" {
+		for _, t := range result.Tables {
+			fmt.Fprintf(e.stdout, "\n%s: %d rows, %d migrated (%d by this run), %d pending, %d fields skipped",
+				t.Table, t.Rows, t.Migrated, t.Converted, t.Pending, t.Skipped)
+			if !result.DryRun {
+				if t.Reconciled {
+					fmt.Fprint(e.stdout, "; reconciled")
+				} else {
+					fmt.Fprint(e.stdout, "; NOT reconciled")
+				}
+			}
+			fmt.Fprintln(e.stdout)
+		}
+	}
+	return nil
+}
+
+// migrateTable converts the rows of a table after its checkpoint in batches, then
+// reconciles every converted row with the stored values
+func (m *legacyMigration) migrateTable(table string, batchSize int) (legacyTableResult, error) {
+	result := legacyTableResult{Table: table, Signals: []legacySignalResult{}}
+	query, err := m.selectRows(table)
+	if err != nil {
+		return result, err
+	}
+	if err := m.db.Table(table).Count(&result.Rows).Error; err != nil {
+		return result, err
+	}
+
+	checkpoint := legacyCheckpoint{SourceTable: table}
+	if m.db.Migrator().HasTable(&legacyCheckpoint{}) {
+		if err := m.db.Where(&checkpoint).FirstOrInit(&checkpoint).Error; err != nil {
+			return result, err
+		}
+	}
+
+	for !m.dryRun {
+		var rows []legacyRow
+		if err := query().Where("id > ?", checkpoint.LastID).Order("id").Limit(batchSize).Scan(&rows).Error; err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		var values []models.SignalValue
+		var skipped int64
+		for _, row := range rows {
+			converted, rowSkipped, err := m.convert(table, row)
+			if err != nil {
+				return result, err
+			}
+			for _, c := range converted {
+				values = append(values, c.value)
+			}
+			skipped += rowSkipped
+		}
+
+		checkpoint.LastID = rows[len(rows)-1].ID
+		checkpoint.Rows += int64(len(rows))
+		checkpoint.Values += int64(len(values))
+		checkpoint.Skipped += skipped
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if len(values) > 0 {
+				if err := tx.Omit("Signal", "User").CreateInBatches(values, 100).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Save(&checkpoint).Error
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Converted += int64(len(rows))
+		fmt.Fprintf(m.e.stderr, "%s: converted %d of %d rows\n", table, checkpoint.Rows, result.Rows)
+	}
+
+	if !m.dryRun && result.Converted > 0 {
+		summary := map[string]interface{}{"source": table, "rows": result.Converted, "last_id": checkpoint.LastID}
+		if err := audit.RecordSystem(actorType, &m.org.ID, audit.ActionCreate, "signal_values", 0, nil, summary); err != nil {
+			return result, err
+		}
+	}
+
+	// Reconcile: convert the migrated rows again, or every row in a dry run, and count the
+	// values each signal should hold
+	var rows []legacyRow
+	reconcile := query()
+	if !m.dryRun {
+		reconcile = reconcile.Where("id <= ?", checkpoint.LastID)
+	}
+	expected := make(map[string]int64)
+	var order []string
+	err = reconcile.Order("id").FindInBatches(&rows, 1000, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			values, skipped, err := m.convert(table, row)
+			if err != nil {
+				return err
+			}
+			result.Skipped += skipped
+			for _, v := range values {
+				if _, ok := expected[v.target]; !ok {
+					order = append(order, v.target)
+				}
+				expected[v.target]++
+			}
+			if row.ID <= checkpoint.LastID {
+				result.Migrated++
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return result, err
+	}
+	result.Pending = result.Rows - result.Migrated
+
+	result.Reconciled = result.Pending == 0
+	for _, key := range order {
+		target := m.targets[key]
+		s := legacySignalResult{Device: target.device.Name, DeviceID: target.device.ID, Signal: target.column.name, Expected: expected[key]}
+		if target.signal.ID != 0 {
+			s.SignalID = target.signal.ID
+			if err := m.db.Model(&models.SignalValue{}).Where("signal_id = ?", target.signal.ID).Count(&s.Stored).Error; err != nil {
+				return result, err
+			}
+		}
+		if s.Stored != s.Expected {
+			result.Reconciled = false
+		}
+		result.Signals = append(result.Signals, s)
+	}
+	return result, nil
+}
+
+// selectRows returns a query for the rows of a legacy table, reading the columns it has
+func (m *legacyMigration) selectRows(table string) (func() *gorm.DB, error) {
+	migrator := m.db.Migrator()
+	column := func(alias string, names ...string) string {
+		for _, name := range names {
+			if migrator.HasColumn(table, name) {
+				return name + " AS " + alias
+			}
+		}
+		return "NULL AS " + alias
+	}
+	array := func(alias, name string) string {
+		if !migrator.HasColumn(table, name) {
+			return "NULL AS " + alias
+		}
+		if m.db.Dialector.Name() == "postgres" {
+			return "array_to_json(" + name + ")::text AS " + alias
+		}
+		return name + " AS " + alias
+	}
+	if !migrator.HasColumn(table, "id") {
+		return nil, errors.New("the table has no id column")
+	}
+	selects := []string{
+		"id",
+		column("user_id", "user_id", "userid"),
+		column("device_id", "device_id"),
+		column("timestamp", "timestamp"),
+		column("created_at", "created_at"),
+		column("value", "value"),
+		column("set_value", "setvalue"),
+		array("torque_values", "torquevalues"),
+		array("asm_times", "asmtimes"),
+		array("motion_wastes", "motionwastes"),
+		column("signal_type", "signal_type"),
+	}
+	return func() *gorm.DB {
+		return m.db.Table(table).Select(selects)
+	}, nil
+}
+
+// convert returns the signal values of a legacy row and the number of fields that could
+// not be converted. Targets are created as needed unless this is a dry run.
+func (m *legacyMigration) convert(table string, row legacyRow) ([]convertedValue, int64, error) {
+	timestamp := row.Timestamp
+	if timestamp == nil {
+		timestamp = row.CreatedAt
+	}
+	if timestamp == nil {
+		fmt.Fprintf(m.e.stderr, "%s %d: skipped, no timestamp\n", table, row.ID)
+		return nil, 1, nil
+	}
+
+	userID, err := m.userID(row.UserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var values []convertedValue
+	var skipped int64
+	add := func(column legacyColumn, value models.SignalValue) error {
+		key, target, err := m.target(table, row, column)
+		if err != nil {
+			return err
+		}
+		value.SignalID = target.signal.ID
+		value.UserID = userID
+		value.Timestamp = *timestamp
+		value.Metadata = models.JSONB{"legacy_table": table, "legacy_id": row.ID}
+		values = append(values, convertedValue{target: key, value: value})
+		return nil
+	}
+	samples := func(column legacyColumn, data *string, interval float64) error {
+		if data == nil {
+			return nil
+		}
+		var decoded []float64
+		if err := json.Unmarshal([]byte(*data), &decoded); err != nil {
+			fmt.Fprintf(m.e.stderr, "%s %d: skipped %s, %v\n", table, row.ID, column.name, err)
+			skipped++
+			return nil
+		}
+		if len(decoded) == 0 {
+			return nil
+		}
+		return add(column, models.SignalValue{Samples: decoded, SampleInterval: &interval})
+	}
+
+	if row.Value != nil {
+		if row.SignalType != nil && *row.SignalType == "digital" {
+			on := *row.Value != 0
+			err = add(legacyDigitalValue, models.SignalValue{DigitalValue: &on})
+		} else {
+			err = add(legacyValue, models.SignalValue{Value: row.Value})
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if row.SetValue != nil {
+		if err := add(legacySetValue, models.SignalValue{Value: row.SetValue}); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := samples(legacyTorque, row.TorqueValues, m.torqueInterval); err != nil {
+		return nil, 0, err
+	}
+	if err := samples(legacyAsmTimes, row.AsmTimes, 1); err != nil {
+		return nil, 0, err
+	}
+	if err := samples(legacyMotionWastes, row.MotionWastes, 1); err != nil {
+		return nil, 0, err
+	}
+	return values, skipped, nil
+}
+
+// userID returns the legacy user when it still exists
+func (m *legacyMigration) userID(id *uint) (*uint, error) {
+	if id == nil {
+		return nil, nil
+	}
+	exists, ok := m.users[*id]
+	if !ok {
+		var count int64
+		if err := m.db.Model(&models.User{}).Where("id = ?", *id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		exists = count > 0
+		m.users[*id] = exists
+	}
+	if !exists {
+		return nil, nil
+	}
+	return id, nil
+}
+
+// legacyDeviceKey identifies the device of a legacy row: its device_id, or the device
+// standing in for a table without devices
+func legacyDeviceKey(table string, row legacyRow) string {
+	if row.DeviceID != nil {
+		return "device:" + strconv.FormatUint(uint64(*row.DeviceID), 10)
+	}
+	return "table:" + table
+}
+
+// target finds or creates the device and signal for a column of a legacy row. A dry run
+// only finds them, standing in unsaved records for missing ones.
+func (m *legacyMigration) target(table string, row legacyRow, column legacyColumn) (string, *legacyTarget, error) {
+	deviceKey := legacyDeviceKey(table, row)
+	key := deviceKey + "/" + column.name
+	if target, ok := m.targets[key]; ok {
+		return key, target, nil
+	}
+
+	device, ok := m.devices[deviceKey]
+	if !ok {
+		var err error
+		if device, err = m.device(table, row); err != nil {
+			return "", nil, err
+		}
+		m.devices[deviceKey] = device
+	}
+	signal := &models.Signal{}
+	if device.ID != 0 {
+		err := m.db.Where("device_id = ? AND name = ?", device.ID, column.name).First(signal).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, err
+		}
+	}
+	if signal.ID == 0 {
+		signal = &models.Signal{
+			DeviceID:       device.ID,
+			OrganizationID: device.OrganizationID,
+			Name:           column.name,
+			SignalType:     column.signalType,
+			Direction:      "input",
+			SensorName:     table,
+			Description:    column.description,
+			IsActive:       true,
+		}
+		if !m.dryRun {
+			if err := m.db.Omit("Device").Create(signal).Error; err != nil {
+				return "", nil, err
+			}
+			if err := audit.RecordSystem(actorType, signal.OrganizationID, audit.ActionCreate, "signal", signal.ID, nil, signal); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	target := &legacyTarget{device: device, signal: signal, column: column}
+	m.targets[key] = target
+	return key, target, nil
+}
+
+// device finds the device of a legacy row, or creates an inactive one named after the
+// table or the missing device ID
+func (m *legacyMigration) device(table string, row legacyRow) (*models.Device, error) {
+	name := "Legacy " + table
+	if row.DeviceID != nil {
+		var device models.Device
+		err := m.db.First(&device, *row.DeviceID).Error
+		if err == nil {
+			return &device, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		name = fmt.Sprintf("Legacy device %d", *row.DeviceID)
+	}
+
+	var device models.Device
+	err := m.db.Where("name = ? AND device_type = ? AND organization_id = ?", name, "legacy", m.org.ID).First(&device).Error
+	if err == nil {
+		return &device, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	device = models.Device{
+		Name:           name,
+		Description:    "Created by migrate legacy for readings of the pre-device schema",
+		DeviceType:     "legacy",
+		OrganizationID: &m.org.ID,
+	}
+	if m.dryRun {
+		return &device, nil
+	}
+	if device.AuthToken, err = auth.GenerateDeviceToken(); err != nil {
+		return nil, err
+	}
+	// Legacy devices only hold history; they cannot authenticate until enabled
+	if err := m.db.Create(&device).Error; err != nil {
+		return nil, err
+	}
+	if err := m.db.Model(&device).Update("is_active", false).Error; err != nil {
+		return nil, err
+	}
+	device.IsActive = false
+	if err := audit.RecordSystem(actorType, device.OrganizationID, audit.ActionCreate, "device", device.ID, nil, device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
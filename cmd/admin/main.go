@@ -0,0 +1,240 @@
+// Command admin performs operational tasks directly on the database: managing users and
+// devices, purging signal history, and inspecting the schema and database size.
+//
+//	go run ./cmd/admin users create -email ops@example.com -name Ops -role admin
+//	go run ./cmd/admin devices list -o json
+//	go run ./cmd/admin signals purge -id 7 -to 2024-01-01 -yes
+//
+// It reads the same configuration as the API: the file named by CONFIG_FILE and the
+// environment variables overriding it, such as DB_*. Changes are written to the audit
+// log with the actor type "admin".
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/config"
+	"data-storage/internal/db"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+)
+
+// command is a subcommand of a group, e.g. "create" of "users"
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var groups = map[string]map[string]command{
+	"users": {
+		"create":         {"Create a user and add them to an organization", usersCreate},
+		"reset-password": {"Set a new password and lift a login lockout", usersResetPassword},
+		"deactivate":     {"Deactivate a user so they can no longer log in", usersDeactivate},
+	},
+	"devices": {
+		"list":         {"List devices", devicesList},
+		"rotate-token": {"Replace a device's auth token", devicesRotateToken},
+		"disable":      {"Disable a device so its token is rejected", devicesDisable},
+	},
+	"signals": {
+		"purge":                {"Delete the values of a signal in a time range", signalsPurge},
+		"recompute-aggregates": {"Rebuild the daily value counts of devices from stored values", signalsRecompute},
+	},
+	"migrate": {
+		"status": {"Compare the database schema to the models", migrateStatus},
+		"up":     {"Create missing tables and columns, as the API does on startup", migrateUp},
+		"legacy": {"Convert the readings of the pre-device schema into devices, signals and signal values", migrateLegacy},
+	},
+	"db": {
+		"stats": {"Show table sizes and the range of stored signal values", dbStats},
+	},
+	"ca": {
+		"init": {"Create the self-signed CA that issues device certificates", caInit},
+	},
+	"audit": {
+		"verify": {"Check the hash chain of the audit log and show the first broken entry", auditVerify},
+	},
+}
+
+// openDB connects to the database; tests replace it
+var openDB = db.Open
+
+// actorType identifies the admin command in the audit log
+const actorType = "admin"
+
+// errNotConfirmed is returned by destructive commands run without -yes
+var errNotConfirmed = errors.New("not confirmed")
+
+func main() {
+	// Load environment variables
+	godotenv.Load()
+
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errNotConfirmed) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) < 2 {
+		printUsage(stderr)
+		return flag.ErrHelp
+	}
+	cmd, ok := groups[args[0]][args[1]]
+	if !ok {
+		printUsage(stderr)
+		return fmt.Errorf("unknown command %q", strings.Join(args[:2], " "))
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+	// The audit chain and password policy must match the API's
+	audit.Init(cfg.Audit)
+	if err := auth.InitPasswordPolicy(cfg.Password); err != nil {
+		return err
+	}
+
+	e := &env{name: args[0] + " " + args[1], cfg: cfg, stdin: stdin, stdout: stdout, stderr: stderr}
+	return cmd.run(e, args[2:])
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: admin <group> <command> [flags]")
+	fmt.Fprintln(w, "Run a command with -h for its flags.")
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, group := range names {
+		fmt.Fprintf(w, "\n%s\n", group)
+		commands := make([]string, 0, len(groups[group]))
+		for name := range groups[group] {
+			commands = append(commands, name)
+		}
+		sort.Strings(commands)
+		for _, name := range commands {
+			fmt.Fprintf(w, "  %-22s %s\n", name, groups[group][name].usage)
+		}
+	}
+}
+
+// env is the state shared by the commands
+type env struct {
+	name   string
+	cfg    config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	format string
+	yes    bool
+}
+
+// flags returns the flag set of the command with the -o output flag
+func (e *env) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(e.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.StringVar(&e.format, "o", "table", "output format: table or json")
+	return fs
+}
+
+// destructiveFlags returns the flag set of a command that needs -yes to make changes
+func (e *env) destructiveFlags() *flag.FlagSet {
+	fs := e.flags()
+	fs.BoolVar(&e.yes, "yes", false, "confirm the change")
+	return fs
+}
+
+// parseFlags parses the flags of a command that does not use the database
+func (e *env) parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if e.format != "table" && e.format != "json" {
+		return fmt.Errorf("-o must be table or json")
+	}
+	return nil
+}
+
+// parse parses the flags and connects to the database
+func (e *env) parse(fs *flag.FlagSet, args []string) (*gorm.DB, error) {
+	if err := e.parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	database, err := openDB(e.cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	// The audit log writes through the shared connection
+	db.DB = database
+	return database, nil
+}
+
+// confirm describes what a destructive command would do and stops it unless -yes is set
+func (e *env) confirm(format string, args ...interface{}) error {
+	if e.yes {
+		return nil
+	}
+	fmt.Fprintf(e.stderr, "This would %s. Run again with -yes to confirm.\n", fmt.Sprintf(format, args...))
+	return errNotConfirmed
+}
+
+// print writes v as JSON, or the rows as a table under the header
+func (e *env) print(v interface{}, header []string, rows [][]string) error {
+	if e.format == "json" {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// parseTime parses an RFC 3339 time or a UTC date
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
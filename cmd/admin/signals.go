@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize bounds the rows deleted per statement, so a large purge does not hold
+// locks on the whole table for its duration
+const purgeBatchSize = 10000
+
+// purgeResult is the output of signals purge
+type purgeResult struct {
+	SignalID uint       `json:"signal_id"`
+	Signal   string     `json:"signal"`
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Deleted  int64      `json:"deleted"`
+}
+
+func signalsPurge(e *env, args []string) error {
+	fs := e.destructiveFlags()
+	id := fs.Uint("id", 0, "signal ID (required)")
+	fromFlag := fs.String("from", "", "first timestamp to delete, inclusive (RFC 3339 or YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "timestamp to delete up to, exclusive (RFC 3339 or YYYY-MM-DD)")
+	all := fs.Bool("all", false, "delete every value of the signal")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *id == 0 {
+		return errors.New("-id is required")
+	}
+	if *fromFlag == "" && *toFlag == "" && !*all {
+		return errors.New("-from, -to or -all is required")
+	}
+	var from, to *time.Time
+	if *fromFlag != "" {
+		t, err := parseTime(*fromFlag)
+		if err != nil {
+			return err
+		}
+		from = &t
+	}
+	if *toFlag != "" {
+		t, err := parseTime(*toFlag)
+		if err != nil {
+			return err
+		}
+		to = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return errors.New("-from must be before -to")
+	}
+
+	var signal models.Signal
+	if err := database.First(&signal, *id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("signal not found")
+		}
+		return err
+	}
+
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("signal_id = ?", signal.ID)
+		if from != nil {
+			tx = tx.Where("timestamp >= ?", *from)
+		}
+		if to != nil {
+			tx = tx.Where("timestamp < ?", *to)
+		}
+		return tx
+	}
+	var count int64
+	if err := database.Model(&models.SignalValue{}).Scopes(scope).Count(&count).Error; err != nil {
+		return err
+	}
+	result := purgeResult{SignalID: signal.ID, Signal: signal.Name, From: from, To: to}
+	if count == 0 {
+		return e.printPurge(result)
+	}
+	if err := e.confirm("delete %d values of signal %d (%s) %s", count, signal.ID, signal.Name, describeRange(from, to)); err != nil {
+		return err
+	}
+
+	for {
+		batch := database.Model(&models.SignalValue{}).Select("id").Scopes(scope).Limit(purgeBatchSize)
+		deleted := database.Where("id IN (?)", batch).Delete(&models.SignalValue{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		result.Deleted += deleted.RowsAffected
+		if deleted.RowsAffected < purgeBatchSize {
+			break
+		}
+		fmt.Fprintf(e.stderr, "Deleted %d of %d values\n", result.Deleted, count)
+	}
+
+	purged := map[string]interface{}{"signal_id": signal.ID, "from": from, "to": to, "count": result.Deleted}
+	if err := audit.RecordSystem(actorType, signal.OrganizationID, audit.ActionDelete, "signal_values", signal.ID, purged, nil); err != nil {
+		return err
+	}
+	return e.printPurge(result)
+}
+
+func (e *env) printPurge(result purgeResult) error {
+	return e.print(result, []string{"SIGNAL ID", "SIGNAL", "FROM", "TO", "DELETED"}, [][]string{{
+		strconv.FormatUint(uint64(result.SignalID), 10), result.Signal,
+		formatTime(result.From), formatTime(result.To), strconv.FormatInt(result.Deleted, 10),
+	}})
+}
+
+func describeRange(from, to *time.Time) string {
+	switch {
+	case from != nil && to != nil:
+		return fmt.Sprintf("from %s to %s", formatTime(from), formatTime(to))
+	case from != nil:
+		return "from " + formatTime(from) + " on"
+	case to != nil:
+		return "before " + formatTime(to)
+	default:
+		return "of all time"
+	}
+}
+
+// usageResult is one recomputed daily value count
+type usageResult struct {
+	DeviceID   uint   `json:"device_id"`
+	Day        string `json:"day"`
+	Previous   int64  `json:"previous"`
+	ValueCount int64  `json:"value_count"`
+}
+
+// signalsRecompute rebuilds the daily value counts behind ingestion quotas (device_usages)
+// from the values stored in signal_values, by the day each was received. Values deleted
+// since they were received no longer count.
+func signalsRecompute(e *env, args []string) error {
+	fs := e.destructiveFlags()
+	deviceID := fs.Uint("device", 0, "only this device")
+	fromFlag := fs.String("from", "", "first day, inclusive (YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "last day, inclusive (YYYY-MM-DD)")
+	database, err := e.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range []string{*fromFlag, *toFlag} {
+		if _, err := time.Parse(time.DateOnly, day); day != "" && err != nil {
+			return fmt.Errorf("invalid day %q: use YYYY-MM-DD", day)
+		}
+	}
+
+	// Day on which each value was received, in UTC like the quota days
+	dayExpr := "strftime('%Y-%m-%d', signal_values.created_at)"
+	if database.Dialector.Name() == "postgres" {
+		dayExpr = "to_char(signal_values.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+	countQuery := database.Table("signal_values").
+		Select("signals.device_id AS device_id, " + dayExpr + " AS day, COUNT(*) AS value_count").
+		Joins("JOIN signals ON signals.id = signal_values.signal_id").
+		Group("signals.device_id, " + dayExpr)
+	usageQuery := database.Model(&models.DeviceUsage{})
+	if *deviceID != 0 {
+		countQuery = countQuery.Where("signals.device_id = ?", *deviceID)
+		usageQuery = usageQuery.Where("device_id = ?", *deviceID)
+	}
+	if *fromFlag != "" {
+		countQuery = countQuery.Where(dayExpr+" >= ?", *fromFlag)
+		usageQuery = usageQuery.Where("day >= ?", *fromFlag)
+	}
+	if *toFlag != "" {
+		countQuery = countQuery.Where(dayExpr+" <= ?", *toFlag)
+		usageQuery = usageQuery.Where("day <= ?", *toFlag)
+	}
+
+	var counted []models.DeviceUsage
+	if err := countQuery.Scan(&counted).Error; err != nil {
+		return err
+	}
+	var existing []models.DeviceUsage
+	if err := usageQuery.Find(&existing).Error; err != nil {
+		return err
+	}
+
+	// Merge both sides: days with stored counts but no values drop to zero
+	type key struct {
+		device uint
+		day    string
+	}
+	merged := map[key]*usageResult{}
+	var results []*usageResult
+	get := func(device uint, day string) *usageResult {
+		k := key{device, day}
+		if merged[k] == nil {
+			merged[k] = &usageResult{DeviceID: device, Day: day}
+			results = append(results, merged[k])
+		}
+		return merged[k]
+	}
+	for _, u := range existing {
+		get(u.DeviceID, u.Day).Previous = u.ValueCount
+	}
+	for _, u := range counted {
+		get(u.DeviceID, u.Day).ValueCount = u.ValueCount
+	}
+
+	var changed []usageResult
+	for _, r := range results {
+		if r.Previous != r.ValueCount {
+			changed = append(changed, *r)
+		}
+	}
+	if len(changed) > 0 {
+		if err := e.confirm("change %d of %d daily value counts", len(changed), len(results)); err != nil {
+			e.printUsage(changed)
+			return err
+		}
+		err := database.Transaction(func(tx *gorm.DB) error {
+			for _, r := range changed {
+				usage := models.DeviceUsage{DeviceID: r.DeviceID, Day: r.Day}
+				if err := tx.Where(&usage).Attrs(models.DeviceUsage{ValueCount: 0}).FirstOrCreate(&usage).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&usage).UpdateColumn("value_count", r.ValueCount).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if changed == nil {
+		changed = []usageResult{}
+	}
+	return e.printUsage(changed)
+}
+
+func (e *env) printUsage(results []usageResult) error {
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, []string{strconv.FormatUint(uint64(r.DeviceID), 10), r.Day,
+			strconv.FormatInt(r.Previous, 10), strconv.FormatInt(r.ValueCount, 10)})
+	}
+	return e.print(results, []string{"DEVICE ID", "DAY", "PREVIOUS", "VALUE COUNT"}, rows)
+}
@@ -1,81 +1,193 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"data-storage/internal/api"
+	"data-storage/internal/attendance"
+	"data-storage/internal/audit"
 	"data-storage/internal/auth"
+	"data-storage/internal/background"
+	"data-storage/internal/config"
 	"data-storage/internal/db"
 	"data-storage/internal/handlers"
+	"data-storage/internal/logging"
+	"data-storage/internal/metrics"
+	"data-storage/internal/notify"
+	"data-storage/internal/pki"
+	"data-storage/internal/ratelimit"
+	"data-storage/internal/tenant"
 
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 func main() {
+	configPath := flag.String("config", "", "YAML configuration file (default CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	flag.Parse()
+
 	// Load environment variables
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Println("No .env file found")
+		fatal("Failed to load configuration", err)
+	}
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			fatal("Failed to print configuration", err)
+		}
+		os.Stdout.Write(out)
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	// Structured logging is configured first so every later log line uses it
+	logging.Init(cfg.Logging)
+	if envErr != nil {
+		slog.Info("No .env file found")
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if cfg.Auth.JWTSecret == "" || cfg.Auth.JWTSecret == auth.DefaultJWTSecret {
+		slog.Warn("Using the default JWT secret, which is only allowed in development. Set JWT_SECRET in production!")
+	}
+	auth.Init(cfg.Auth)
+	metrics.Init(cfg.Metrics)
+
 	// Initialize database connection
-	dbConfig := db.LoadConfigFromEnv()
-	_, err = db.InitDB(dbConfig)
+	database, err := db.InitDB(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-
-	r := mux.NewRouter()
-
-	// Public endpoints
-	r.HandleFunc("/auth/login", handlers.LoginHandler).Methods("POST")
-
-	// User authenticated endpoints
-	r.HandleFunc("/auth/register-device", auth.RequireUserAuth(handlers.RegisterDeviceHandler)).Methods("POST")
-	r.HandleFunc("/users", auth.RequireUserAuth(handlers.UsersHandler))
-	r.HandleFunc("/users/{id}", auth.RequireUserAuth(handlers.UserHandler))
-	r.HandleFunc("/devices", auth.RequireUserAuth(handlers.DevicesHandler))
-	r.HandleFunc("/devices/{id}", auth.RequireUserAuth(handlers.DeviceHandler))
-	
-	// Signal configurations (requires user auth)
-	r.HandleFunc("/signals", auth.RequireUserAuth(handlers.SignalsHandler))
-	r.HandleFunc("/signals/{id}", auth.RequireUserAuth(handlers.SignalHandler))
-	r.HandleFunc("/devices/{device_id}/signals", auth.RequireUserAuth(handlers.DeviceSignalsHandler)).Methods("GET")
-	
-	// Signal values - GET requires user auth, POST allows both user and device auth
-	r.HandleFunc("/signal-values", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			auth.RequireAnyAuth(handlers.CreateSignalValue)(w, r)
-		} else {
-			auth.RequireUserAuth(handlers.SignalValuesHandler)(w, r)
-		}
-	})
-	r.HandleFunc("/signal-values/{id}", auth.RequireUserAuth(handlers.SignalValueHandler))
-	r.HandleFunc("/signals/{signal_id}/values", auth.RequireUserAuth(handlers.SignalValuesBySignalHandler)).Methods("GET")
+		fatal("Failed to initialize database", err)
+	}
+	if err := metrics.RegisterDB(database); err != nil {
+		fatal("Failed to register database metrics", err)
+	}
+
+	// Initialize login lockout and password policy
+	auth.InitLockout(cfg.Lockout)
+	auth.StartLockoutCleanup(10 * time.Minute)
+	if err := auth.InitPasswordPolicy(cfg.Password); err != nil {
+		fatal("Failed to initialize password policy", err)
+	}
+
+	// Initialize password reset delivery
+	auth.InitReset(cfg.PasswordReset)
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		fatal("Failed to initialize notifier", err)
+	}
+	notify.Init(notifier)
+
+	audit.Init(cfg.Audit)
+	tenant.Init(cfg.Organizations)
+	attendance.Init(cfg.Attendance)
+	if err := pki.Init(cfg.DeviceCA); err != nil {
+		fatal("Failed to load device CA", err)
+	}
 
-	// Legacy endpoints for backward compatibility
-	r.HandleFunc("/readings", auth.RequireAnyAuth(handlers.ReadingsHandler))
-	r.HandleFunc("/readings/{user_id}", handlers.UserReadingsHandler)
-	r.HandleFunc("/users/rfid/{rfid}", handlers.GetUserByRFIDHandler)
+	// Initialize rate limiting and quotas
+	ratelimit.Init(cfg.RateLimit)
+	ratelimit.StartCleanup(10 * time.Minute)
+
+	r := api.NewRouter()
 
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
-		Debug:          true,
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", logging.RequestIDHeader},
+		ExposedHeaders:   []string{logging.RequestIDHeader},
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+		Debug:            cfg.Server.CORS.Debug,
 	})
 
-	handler := c.Handler(r)
+	// Metrics wrap the rate limit so rejected requests are counted too
+	handler := c.Handler(logging.Middleware(metrics.Middleware(r, ratelimit.Handler(r))))
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	tlsConfig := cfg.Server.TLS
+	if tlsConfig.Enabled() {
+		srv.TLSConfig = &tls.Config{MinVersion: tlsConfig.Version()}
+		if tlsConfig.ClientCertificates {
+			// Certificates are matched against the registered fingerprints rather than a CA,
+			// so any certificate is accepted by the handshake
+			srv.TLSConfig.ClientAuth = tls.RequestClientCert
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", cfg.Server.Port, "env", cfg.Env, "tls", tlsConfig.Enabled())
+		if tlsConfig.Enabled() {
+			serverErr <- srv.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
+		} else {
+			serverErr <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("Server failed", err)
+	case <-ctx.Done():
+	}
+
+	shutdown(srv, cfg.Server)
+}
+
+// shutdown fails the readiness probe, waits the drain delay for load balancers to notice,
+// then stops accepting connections and waits up to the shutdown timeout for in-flight
+// requests and background workers before closing the database pool
+func shutdown(srv *http.Server, cfg config.ServerConfig) {
+	slog.Info("Shutting down...")
+	handlers.StartDraining()
+
+	if cfg.ShutdownDrainDelay > 0 {
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Error draining HTTP requests", "error", err)
+	}
+	if err := background.Shutdown(ctx); err != nil {
+		slog.Error("Error waiting for background workers", "error", err)
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
 	}
 
-	log.Printf("Server starting on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	slog.Info("Server stopped")
 }
 
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
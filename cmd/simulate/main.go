@@ -0,0 +1,296 @@
+// Command simulate provisions virtual devices and streams generated signal values to a
+// running API, in real time or accelerated, reporting throughput and latency percentiles
+// to load-test ingestion.
+//
+//	go run ./cmd/simulate -devices 50 -signals sine,toggle -speed 60 -duration 1h
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"data-storage/pkg/client"
+
+	"github.com/joho/godotenv"
+)
+
+// deviceType marks the devices created by the simulator
+const deviceType = "simulator"
+
+type options struct {
+	url         string
+	email       string
+	password    string
+	devices     int
+	signals     string
+	config      string
+	dropout     float64
+	spike       float64
+	interval    time.Duration
+	speed       float64
+	start       string
+	duration    time.Duration
+	concurrency int
+	retries     int
+	report      time.Duration
+	prefix      string
+	seed        uint64
+}
+
+// simSignal is one signal of one simulated device
+type simSignal struct {
+	id        uint
+	device    *client.Client // Authenticated with the device's token
+	generator *generator
+}
+
+// job is one value to send
+type job struct {
+	device *client.Client
+	value  client.SignalValue
+}
+
+func main() {
+	// Credentials may come from a .env file
+	godotenv.Load()
+
+	var opts options
+	flag.StringVar(&opts.url, "url", envOr("API_URL", "http://localhost:8080"), "API base URL (API_URL)")
+	flag.StringVar(&opts.email, "email", os.Getenv("API_EMAIL"), "email of the user provisioning the devices (API_EMAIL)")
+	flag.StringVar(&opts.password, "password", os.Getenv("API_PASSWORD"), "password of the user (API_PASSWORD)")
+	flag.IntVar(&opts.devices, "devices", 10, "number of virtual devices")
+	flag.StringVar(&opts.signals, "signals", "sine,random-walk,step,toggle", "signal profiles of every device: sine, random-walk, step, toggle")
+	flag.StringVar(&opts.config, "config", "", "JSON file of signal profiles, instead of -signals")
+	flag.Float64Var(&opts.dropout, "dropout", 0, "probability that a sample is not sent")
+	flag.Float64Var(&opts.spike, "spike", 0, "probability that an analogic sample is out of range")
+	flag.DurationVar(&opts.interval, "interval", time.Second, "simulated time between samples of a signal")
+	flag.Float64Var(&opts.speed, "speed", 1, "simulated seconds per real second; 0 sends as fast as possible")
+	flag.StringVar(&opts.start, "start", "", "simulated start time, RFC 3339 or relative to now such as -24h (default now)")
+	flag.DurationVar(&opts.duration, "duration", 0, "simulated time to run for (default until interrupted)")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "requests in flight")
+	flag.IntVar(&opts.retries, "retries", 0, "retries of a failed request; retried requests count as one")
+	flag.DurationVar(&opts.report, "report", 5*time.Second, "interval of progress reports")
+	flag.StringVar(&opts.prefix, "prefix", "sim", "prefix of the device names")
+	flag.Uint64Var(&opts.seed, "seed", 0, "random seed, for repeatable values (default random)")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(opts options) error {
+	if opts.email == "" || opts.password == "" {
+		return fmt.Errorf("-email and -password (or API_EMAIL and API_PASSWORD) are required to provision devices")
+	}
+	if opts.devices < 1 || opts.concurrency < 1 || opts.interval <= 0 || opts.speed < 0 || opts.retries < 0 {
+		return fmt.Errorf("-devices, -concurrency and -interval must be positive, -speed and -retries not negative")
+	}
+	profiles, err := loadProfiles(opts.config, opts.signals, opts.dropout, opts.spike)
+	if err != nil {
+		return err
+	}
+	start, err := parseStart(opts.start, time.Now())
+	if err != nil {
+		return err
+	}
+	if opts.seed == 0 {
+		opts.seed = uint64(time.Now().UnixNano())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Connections are shared by all devices, so there are enough idle ones for every worker
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.concurrency
+	httpClient := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	signals, err := provision(ctx, opts, profiles, start, httpClient)
+	if err != nil {
+		return err
+	}
+	log.Printf("Provisioned %d devices with %d signals each; sending a sample of every signal each %s of simulated time",
+		opts.devices, len(profiles), opts.interval)
+
+	return simulate(ctx, opts, signals, start)
+}
+
+// provision registers the devices and creates their signals
+func provision(ctx context.Context, opts options, profiles []Profile, start time.Time, httpClient *http.Client) ([]simSignal, error) {
+	admin := client.New(opts.url, client.WithHTTPClient(httpClient))
+	if _, err := admin.Login(ctx, opts.email, opts.password, 0); err != nil {
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+	retry := client.RetryPolicy{MaxAttempts: opts.retries + 1, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+	var signals []simSignal
+	for i := 1; i <= opts.devices; i++ {
+		registered, err := admin.RegisterDevice(ctx, client.RegisterDeviceRequest{
+			Name:        fmt.Sprintf("%s-%03d", opts.prefix, i),
+			Description: "Virtual device of the simulator",
+			DeviceType:  deviceType,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("registering device %d: %w", i, err)
+		}
+		device := client.New(opts.url,
+			client.WithDeviceToken(registered.AuthToken),
+			client.WithHTTPClient(httpClient),
+			client.WithRetry(retry),
+			client.WithUserAgent("data-storage-simulator"),
+		)
+
+		for j, profile := range profiles {
+			s := client.Signal{
+				DeviceID:    registered.Device.ID,
+				Name:        profile.Name,
+				SignalType:  client.SignalAnalogic,
+				Unit:        profile.Unit,
+				Description: fmt.Sprintf("Simulated %s signal", profile.Kind),
+			}
+			if profile.digital() {
+				s.SignalType = client.SignalDigital
+			} else {
+				// Limits make the API reject spikes, like a real out-of-range reading
+				s.MinValue, s.MaxValue = &profile.Min, &profile.Max
+			}
+			created, err := admin.CreateSignal(ctx, s)
+			if err != nil {
+				return nil, fmt.Errorf("creating signal %s of device %d: %w", profile.Name, i, err)
+			}
+			seed := opts.seed + uint64(i*len(profiles)+j)
+			signals = append(signals, simSignal{id: created.ID, device: device, generator: newGenerator(profile, start, seed)})
+		}
+	}
+	return signals, nil
+}
+
+// simulate sends a sample of every signal for each interval of simulated time until the
+// duration has passed or ctx is cancelled, then waits for the requests in flight
+func simulate(ctx context.Context, opts options, signals []simSignal, start time.Time) error {
+	realStart := time.Now()
+	results := newStats(realStart)
+	jobs := make(chan job, opts.concurrency)
+
+	// Requests in flight complete after an interrupt so they are counted
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sent := time.Now()
+				_, err := j.device.CreateSignalValue(context.WithoutCancel(ctx), j.value)
+				results.record(time.Since(sent), err)
+			}
+		}()
+	}
+
+	var (
+		simMu   sync.Mutex
+		simTime = start
+	)
+	reporterDone := make(chan struct{})
+	stopReports := make(chan struct{})
+	go func() {
+		defer close(reporterDone)
+		ticker := time.NewTicker(opts.report)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopReports:
+				return
+			case now := <-ticker.C:
+				simMu.Lock()
+				current := simTime
+				simMu.Unlock()
+				log.Print(results.report(now, current))
+			}
+		}
+	}()
+
+	// Tick k is due at k intervals of simulated time, divided by the speed in real time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var lag time.Duration
+ticks:
+	for k := 0; opts.duration == 0 || time.Duration(k)*opts.interval <= opts.duration; k++ {
+		t := start.Add(time.Duration(k) * opts.interval)
+		if opts.speed > 0 {
+			due := realStart.Add(time.Duration(float64(time.Duration(k)*opts.interval) / opts.speed))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					break ticks
+				case <-timer.C:
+				}
+			} else {
+				lag = max(lag, -wait)
+			}
+		}
+		simMu.Lock()
+		simTime = t
+		simMu.Unlock()
+
+		for _, s := range signals {
+			sample, ok := s.generator.next(t)
+			if !ok {
+				results.drop()
+				continue
+			}
+			if sample.spike {
+				results.spike()
+			}
+			value := client.SignalValue{SignalID: s.id, Timestamp: t, Value: sample.value, DigitalValue: sample.digital}
+			select {
+			case <-ctx.Done():
+				break ticks
+			case jobs <- job{device: s.device, value: value}:
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(stopReports)
+	<-reporterDone
+
+	fmt.Println()
+	fmt.Print(results.summary(time.Now()))
+	if opts.speed > 0 && lag > opts.interval {
+		fmt.Printf("Behind schedule by up to %s: the API or -concurrency could not keep up with -speed\n", lag.Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+// parseStart parses an RFC 3339 time or a duration relative to now
+func parseStart(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	offset, err := time.ParseDuration(strings.TrimPrefix(value, "+"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-start must be an RFC 3339 time or a duration such as -24h: %q", value)
+	}
+	return now.Add(offset), nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
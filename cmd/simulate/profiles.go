@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+// Profile kinds
+const (
+	kindSine       = "sine"
+	kindRandomWalk = "random-walk"
+	kindStep       = "step"
+	kindToggle     = "toggle"
+)
+
+// Profile describes how the values of one signal of every simulated device evolve
+type Profile struct {
+	Name    string   `json:"name"` // Signal name, defaults to the kind
+	Kind    string   `json:"kind"` // sine, random-walk, step or toggle
+	Unit    string   `json:"unit,omitempty"`
+	Min     float64  `json:"min"`               // Range of normal values, also the signal's limits
+	Max     float64  `json:"max"`               //
+	Period  duration `json:"period,omitempty"`  // Sine period, or the mean time between steps and toggles
+	Noise   float64  `json:"noise,omitempty"`   // Standard deviation added to sine values
+	Step    float64  `json:"step,omitempty"`    // Largest change of a random walk per sample
+	Dropout float64  `json:"dropout,omitempty"` // Probability that a sample is not sent
+	Spike   float64  `json:"spike,omitempty"`   // Probability that a sample is out of range (rejected by the API)
+}
+
+// defaultProfiles are used for the kinds given with -signals
+var defaultProfiles = map[string]Profile{
+	kindSine:       {Kind: kindSine, Name: "temperature", Unit: "°C", Min: 20, Max: 80, Period: duration(10 * time.Minute), Noise: 0.5},
+	kindRandomWalk: {Kind: kindRandomWalk, Name: "pressure", Unit: "bar", Min: 0, Max: 10, Step: 0.2},
+	kindStep:       {Kind: kindStep, Name: "speed", Unit: "rpm", Min: 0, Max: 3000, Period: duration(5 * time.Minute)},
+	kindToggle:     {Kind: kindToggle, Name: "running", Period: duration(2 * time.Minute)},
+}
+
+// loadProfiles reads profiles from a JSON file, or takes the defaults of a comma-separated
+// list of kinds. dropout and spike apply to profiles that don't set their own.
+func loadProfiles(path, kinds string, dropout, spike float64) ([]Profile, error) {
+	var profiles []Profile
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	} else {
+		for _, kind := range strings.Split(kinds, ",") {
+			profile, ok := defaultProfiles[strings.TrimSpace(kind)]
+			if !ok {
+				return nil, fmt.Errorf("unknown signal profile %q (use sine, random-walk, step or toggle)", kind)
+			}
+			profiles = append(profiles, profile)
+		}
+	}
+
+	names := map[string]bool{}
+	for i := range profiles {
+		p := &profiles[i]
+		if p.Name == "" {
+			p.Name = p.Kind
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("duplicate signal name %q", p.Name)
+		}
+		names[p.Name] = true
+		if p.Dropout == 0 {
+			p.Dropout = dropout
+		}
+		if p.Spike == 0 {
+			p.Spike = spike
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("signal %s: %w", p.Name, err)
+		}
+	}
+	return profiles, nil
+}
+
+func (p *Profile) validate() error {
+	switch p.Kind {
+	case kindSine, kindStep, kindToggle:
+		if p.Period <= 0 {
+			return fmt.Errorf("%s needs a period", p.Kind)
+		}
+	case kindRandomWalk:
+		if p.Step <= 0 {
+			return fmt.Errorf("random-walk needs a step")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", p.Kind)
+	}
+	if p.Kind != kindToggle && p.Max <= p.Min {
+		return fmt.Errorf("max must be greater than min")
+	}
+	if p.Dropout < 0 || p.Dropout > 1 || p.Spike < 0 || p.Spike > 1 {
+		return fmt.Errorf("dropout and spike must be probabilities between 0 and 1")
+	}
+	return nil
+}
+
+// digital reports whether the profile produces digital values
+func (p *Profile) digital() bool {
+	return p.Kind == kindToggle
+}
+
+// sample is one generated value; exactly one of value and digital is set
+type sample struct {
+	value   *float64
+	digital *bool
+	spike   bool // Out of range on purpose
+}
+
+// generator produces the values of one signal of one device. It is not safe for
+// concurrent use.
+type generator struct {
+	profile Profile
+	rng     *rand.Rand
+	start   time.Time
+	phase   float64 // Sine offset so devices don't move in lockstep
+
+	level    float64   // Current random walk or step level
+	on       bool      // Current toggle state
+	nextStep time.Time // Next step or toggle
+}
+
+func newGenerator(profile Profile, start time.Time, seed uint64) *generator {
+	g := &generator{
+		profile: profile,
+		rng:     rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		start:   start,
+	}
+	g.phase = g.rng.Float64() * 2 * math.Pi
+	g.level = profile.Min + g.rng.Float64()*(profile.Max-profile.Min)
+	g.on = g.rng.IntN(2) == 1
+	g.nextStep = start.Add(g.jitter())
+	return g
+}
+
+// next returns the sample at simulated time t, or false when the sample is dropped
+func (g *generator) next(t time.Time) (sample, bool) {
+	p := &g.profile
+	dropped := g.rng.Float64() < p.Dropout
+
+	if p.digital() {
+		for !t.Before(g.nextStep) {
+			g.on = !g.on
+			g.nextStep = g.nextStep.Add(g.jitter())
+		}
+		on := g.on
+		return sample{digital: &on}, !dropped
+	}
+
+	var v float64
+	switch p.Kind {
+	case kindSine:
+		mid, amplitude := (p.Max+p.Min)/2, (p.Max-p.Min)/2
+		elapsed := t.Sub(g.start).Seconds() / time.Duration(p.Period).Seconds()
+		v = clamp(mid+amplitude*math.Sin(2*math.Pi*elapsed+g.phase)+g.rng.NormFloat64()*p.Noise, p.Min, p.Max)
+	case kindRandomWalk:
+		g.level += (g.rng.Float64()*2 - 1) * p.Step
+		// Reflect at the bounds
+		if g.level > p.Max {
+			g.level = 2*p.Max - g.level
+		}
+		if g.level < p.Min {
+			g.level = 2*p.Min - g.level
+		}
+		v = clamp(g.level, p.Min, p.Max)
+	case kindStep:
+		for !t.Before(g.nextStep) {
+			// Four evenly spaced levels, like a machine's speed settings
+			g.level = p.Min + float64(g.rng.IntN(4))*(p.Max-p.Min)/3
+			g.nextStep = g.nextStep.Add(g.jitter())
+		}
+		v = g.level
+	}
+
+	s := sample{value: &v}
+	if g.rng.Float64() < p.Spike {
+		span := (p.Max - p.Min) * (0.1 + g.rng.Float64()*0.4)
+		if g.rng.IntN(2) == 0 {
+			v = p.Max + span
+		} else {
+			v = p.Min - span
+		}
+		s.spike = true
+	}
+	return s, !dropped
+}
+
+// jitter returns the period ±25%, so steps and toggles of different devices drift apart
+func (g *generator) jitter() time.Duration {
+	period := float64(g.profile.Period)
+	return time.Duration(period * (0.75 + g.rng.Float64()*0.5))
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// duration is a time.Duration written as a string ("90s", "10m") in JSON
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations are strings such as \"90s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
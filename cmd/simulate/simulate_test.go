@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerator_StaysInRange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for kind, profile := range defaultProfiles {
+		if profile.digital() {
+			continue
+		}
+		t.Run(kind, func(t *testing.T) {
+			g := newGenerator(profile, start, 1)
+			for i := 0; i < 10000; i++ {
+				s, ok := g.next(start.Add(time.Duration(i) * time.Second))
+				if !ok || s.value == nil || s.digital != nil || s.spike {
+					t.Fatalf("Expected an analogic sample, got %+v, %v", s, ok)
+				}
+				if *s.value < profile.Min || *s.value > profile.Max {
+					t.Fatalf("Sample %d out of range: %v", i, *s.value)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_DropoutsSpikesAndToggles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	profile := defaultProfiles[kindRandomWalk]
+	profile.Dropout, profile.Spike = 0.1, 0.05
+	g := newGenerator(profile, start, 2)
+
+	var dropped, spikes int
+	for i := 0; i < 10000; i++ {
+		s, ok := g.next(start.Add(time.Duration(i) * time.Second))
+		if !ok {
+			dropped++
+		}
+		if s.spike {
+			spikes++
+			if *s.value >= profile.Min && *s.value <= profile.Max {
+				t.Fatalf("Expected a spike out of range, got %v", *s.value)
+			}
+		}
+	}
+	if dropped < 800 || dropped > 1200 || spikes < 350 || spikes > 650 {
+		t.Errorf("Expected about 1000 dropouts and 500 spikes, got %d and %d", dropped, spikes)
+	}
+
+	// A toggle every 2 minutes ±25% flips 25 to 40 times an hour
+	toggle := newGenerator(defaultProfiles[kindToggle], start, 3)
+	var flips int
+	var last bool
+	for i := 0; i < 3600; i++ {
+		s, _ := toggle.next(start.Add(time.Duration(i) * time.Second))
+		if i > 0 && *s.digital != last {
+			flips++
+		}
+		last = *s.digital
+	}
+	if flips < 25 || flips > 40 {
+		t.Errorf("Expected 25 to 40 toggles, got %d", flips)
+	}
+}
+
+func TestHistogram_Percentiles(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want time.Duration
+	}{{50, 500 * time.Millisecond}, {90, 900 * time.Millisecond}, {99, 990 * time.Millisecond}, {100, time.Second}} {
+		got := h.percentile(tt.p)
+		// Within the 5% bucket width, never below the exact value
+		if got < tt.want || float64(got) > float64(tt.want)*bucketGrowth {
+			t.Errorf("p%v: expected about %s, got %s", tt.p, tt.want, got)
+		}
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"":                     now,
+		"-24h":                 now.Add(-24 * time.Hour),
+		"+1h":                  now.Add(time.Hour),
+		"2024-05-01T00:00:00Z": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseStart(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseStart(%q) = %v, %v; expected %v", value, got, err, want)
+		}
+	}
+	if _, err := parseStart("yesterday", now); err == nil {
+		t.Error("Expected an error for an invalid start")
+	}
+}
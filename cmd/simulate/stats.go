@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"data-storage/pkg/client"
+)
+
+// Outcomes of a request
+const (
+	outcomeStored      = "stored"
+	outcomeRejected    = "rejected"     // Validation errors, expected for spikes
+	outcomeRateLimited = "rate_limited" // Rate limits and quotas
+	outcomeFailed      = "failed"       // Server and network errors
+)
+
+// Latencies are counted in buckets growing by 5%, from 100µs to about a minute
+const (
+	bucketBase   = 100 * time.Microsecond
+	bucketGrowth = 1.05
+	bucketCount  = 280
+)
+
+// histogram counts latencies in exponential buckets. Percentiles are exact to within
+// the bucket width, without keeping every sample of a long run.
+type histogram struct {
+	counts [bucketCount]uint64
+	total  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	if d <= bucketBase {
+		return 0
+	}
+	i := int(math.Log(float64(d)/float64(bucketBase))/math.Log(bucketGrowth)) + 1
+	return min(i, bucketCount-1)
+}
+
+// bucketUpper returns the largest latency counted in bucket i
+func bucketUpper(i int) time.Duration {
+	return time.Duration(float64(bucketBase) * math.Pow(bucketGrowth, float64(i)))
+}
+
+func (h *histogram) add(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.total++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.max = max(h.max, other.max)
+}
+
+// percentile returns the latency below which p (0-100) percent of requests completed
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return min(bucketUpper(i), h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// stats collects the outcomes of all requests. The current window is reported and
+// merged into the totals every report interval.
+type stats struct {
+	mu       sync.Mutex
+	started  time.Time
+	window   histogram
+	windowAt time.Time
+	outcomes map[string]int
+	codes    map[string]int // Error codes of unsuccessful requests
+	total    histogram
+	dropped  int // Samples not sent because of dropouts
+	spikes   int // Out-of-range samples sent
+}
+
+func newStats(now time.Time) *stats {
+	return &stats{started: now, windowAt: now, outcomes: map[string]int{}, codes: map[string]int{}}
+}
+
+// record adds the result of one request
+func (s *stats) record(latency time.Duration, err error) {
+	outcome, code := classify(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.window.add(latency)
+	s.outcomes[outcome]++
+	if code != "" {
+		s.codes[code]++
+	}
+}
+
+func (s *stats) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+func (s *stats) spike() {
+	s.mu.Lock()
+	s.spikes++
+	s.mu.Unlock()
+}
+
+func classify(err error) (outcome, code string) {
+	if err == nil {
+		return outcomeStored, ""
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return outcomeFailed, "network"
+	}
+	switch {
+	case apiErr.StatusCode == 429:
+		return outcomeRateLimited, apiErr.Code
+	case apiErr.StatusCode >= 500:
+		return outcomeFailed, apiErr.Code
+	default:
+		return outcomeRejected, apiErr.Code
+	}
+}
+
+// report returns one line for the requests since the last report and starts a new window
+func (s *stats) report(now time.Time, simulated time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := now.Sub(s.windowAt)
+	line := fmt.Sprintf("%s  sim %s  %7.1f req/s  p50 %-8s p90 %-8s p99 %-8s max %-8s  %s",
+		now.Sub(s.started).Truncate(time.Second), simulated.Format(time.DateTime),
+		rate(s.window.total, elapsed),
+		round(s.window.percentile(50)), round(s.window.percentile(90)), round(s.window.percentile(99)), round(s.window.max),
+		s.countsLocked())
+	s.total.merge(&s.window)
+	s.window = histogram{}
+	s.windowAt = now
+	return line
+}
+
+// summary returns the report of the whole run
+func (s *stats) summary(now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total.merge(&s.window)
+	s.window = histogram{}
+	h := &s.total
+
+	var b strings.Builder
+	elapsed := now.Sub(s.started)
+	fmt.Fprintf(&b, "Requests:   %d in %s (%.1f req/s)\n", h.total, elapsed.Truncate(time.Millisecond), rate(h.total, elapsed))
+	fmt.Fprintf(&b, "Outcomes:   %s\n", s.countsLocked())
+	fmt.Fprintf(&b, "Samples:    %d dropped, %d out of range\n", s.dropped, s.spikes)
+	fmt.Fprintf(&b, "Latency:    mean %s  p50 %s  p90 %s  p95 %s  p99 %s  p99.9 %s  max %s\n",
+		round(h.mean()), round(h.percentile(50)), round(h.percentile(90)), round(h.percentile(95)),
+		round(h.percentile(99)), round(h.percentile(99.9)), round(h.max))
+	if len(s.codes) > 0 {
+		codes := make([]string, 0, len(s.codes))
+		for code := range s.codes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		b.WriteString("Errors:    ")
+		for _, code := range codes {
+			fmt.Fprintf(&b, " %s=%d", code, s.codes[code])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (s *stats) countsLocked() string {
+	return fmt.Sprintf("%s=%d %s=%d %s=%d %s=%d",
+		outcomeStored, s.outcomes[outcomeStored], outcomeRejected, s.outcomes[outcomeRejected],
+		outcomeRateLimited, s.outcomes[outcomeRateLimited], outcomeFailed, s.outcomes[outcomeFailed])
+}
+
+func rate(n uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,6 @@
+package api
+
+import "data-storage/internal/logging"
+
+// logger reports errors of the documentation endpoints
+var logger = logging.Logger("api")
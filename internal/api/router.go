@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/auth"
+	"data-storage/internal/handlers"
+	"data-storage/internal/metrics"
+	"data-storage/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+)
+
+// Authenticated requests are also rate limited per user or device
+func userAuth(next http.HandlerFunc) http.HandlerFunc {
+	return auth.RequireUserAuth(ratelimit.LimitByClient(next))
+}
+
+func anyAuth(next http.HandlerFunc) http.HandlerFunc {
+	return auth.RequireAnyAuth(ratelimit.LimitByClient(next))
+}
+
+func deviceAuth(next http.HandlerFunc) http.HandlerFunc {
+	return auth.RequireDeviceAuth(ratelimit.LimitByClient(next))
+}
+
+// NewRouter registers every API route. Each route declares its methods, and every method
+// must be documented in spec.go; TestSpecCoversRoutes fails otherwise. Wrap the router in
+// metrics.Middleware, outside any other middleware, to record its requests.
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = apierror.NotFoundHandler
+	r.MethodNotAllowedHandler = apierror.MethodNotAllowedHandler
+
+	// Liveness and readiness probes
+	r.HandleFunc("/healthz", handlers.HealthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", handlers.ReadyzHandler).Methods("GET")
+
+	// Prometheus metrics (set METRICS_TOKEN to require a bearer token)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// API documentation
+	r.HandleFunc("/openapi.json", SpecHandler).Methods("GET")
+	r.HandleFunc("/docs", DocsHandler).Methods("GET")
+
+	// Public endpoints
+	r.HandleFunc("/auth/login", ratelimit.LimitLogin(handlers.LoginHandler)).Methods("POST")
+	r.HandleFunc("/auth/forgot-password", ratelimit.LimitLogin(handlers.ForgotPasswordHandler)).Methods("POST")
+	r.HandleFunc("/auth/reset-password", ratelimit.LimitLogin(handlers.ResetPasswordHandler)).Methods("POST")
+	r.HandleFunc("/auth/accept-invitation", ratelimit.LimitLogin(handlers.AcceptInvitationHandler)).Methods("POST")
+
+	// User authenticated endpoints
+	r.HandleFunc("/auth/change-password", userAuth(handlers.ChangePasswordHandler)).Methods("POST")
+	r.HandleFunc("/auth/switch-org", userAuth(handlers.SwitchOrgHandler)).Methods("POST")
+	r.HandleFunc("/auth/register-device", userAuth(handlers.RegisterDeviceHandler)).Methods("POST")
+	r.HandleFunc("/users", userAuth(handlers.UsersHandler)).Methods("GET", "POST")
+	r.HandleFunc("/users/{id}", userAuth(handlers.UserHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/devices", userAuth(handlers.DevicesHandler)).Methods("GET", "POST")
+	r.HandleFunc("/devices/{id}", userAuth(handlers.DeviceHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/devices/{id}/quota", userAuth(handlers.DeviceQuotaHandler)).Methods("GET")
+	r.HandleFunc("/devices/{id}/move", userAuth(handlers.MoveDeviceHandler)).Methods("POST")
+	r.HandleFunc("/devices/{id}/certificates", userAuth(handlers.DeviceCertificatesHandler)).Methods("GET", "POST")
+	r.HandleFunc("/devices/{id}/certificates/issue", userAuth(handlers.IssueDeviceCertificateHandler)).Methods("POST")
+	r.HandleFunc("/devices/{id}/certificates/{certificate_id}/revoke", userAuth(handlers.RevokeDeviceCertificateHandler)).Methods("POST")
+	r.HandleFunc("/devices/{id}/sessions", userAuth(handlers.OperatorSessionsHandler)).Methods("GET")
+	r.HandleFunc("/devices/{id}/badge-scans", userAuth(handlers.BadgeScansHandler)).Methods("GET")
+
+	// Operator badge scans (requires device auth)
+	r.HandleFunc("/devices/{id}/badge", deviceAuth(handlers.BadgeHandler)).Methods("POST")
+
+	// Organizations and memberships (requires user auth)
+	r.HandleFunc("/orgs", userAuth(handlers.OrganizationsHandler)).Methods("GET", "POST")
+	r.HandleFunc("/orgs/{id}", userAuth(handlers.OrganizationHandler)).Methods("GET", "PUT")
+	r.HandleFunc("/orgs/{id}/members", userAuth(handlers.OrgMembersHandler)).Methods("GET")
+	r.HandleFunc("/orgs/{id}/members/{user_id}", userAuth(handlers.OrgMemberHandler)).Methods("PUT", "DELETE")
+	r.HandleFunc("/orgs/{id}/invitations", userAuth(handlers.OrgInvitationsHandler)).Methods("GET", "POST")
+	r.HandleFunc("/orgs/{id}/invitations/{invitation_id}", userAuth(handlers.OrgInvitationHandler)).Methods("DELETE")
+
+	// Shift calendar, attendance and OEE reports (requires user auth)
+	r.HandleFunc("/shifts", userAuth(handlers.ShiftsHandler)).Methods("GET", "POST")
+	r.HandleFunc("/shifts/{id}", userAuth(handlers.ShiftHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/reports/attendance", userAuth(handlers.AttendanceReportHandler)).Methods("GET")
+	r.HandleFunc("/reports/oee", userAuth(handlers.OEEReportHandler)).Methods("GET")
+
+	// Assembly cycles - GET requires user auth, POST allows both user and device auth
+	r.HandleFunc("/cycles", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			anyAuth(handlers.CyclesHandler)(w, r)
+		} else {
+			userAuth(handlers.CyclesHandler)(w, r)
+		}
+	}).Methods("GET", "POST")
+	r.HandleFunc("/cycles/{id}", userAuth(handlers.CycleHandler)).Methods("GET", "DELETE")
+
+	// Signal configurations (requires user auth)
+	r.HandleFunc("/signals", userAuth(handlers.SignalsHandler)).Methods("GET", "POST")
+	r.HandleFunc("/signals/{id}", userAuth(handlers.SignalHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/devices/{device_id}/signals", userAuth(handlers.DeviceSignalsHandler)).Methods("GET")
+
+	// Signal values - GET requires user auth, POST allows both user and device auth
+	r.HandleFunc("/signal-values", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			anyAuth(handlers.CreateSignalValue)(w, r)
+		} else {
+			userAuth(handlers.SignalValuesHandler)(w, r)
+		}
+	}).Methods("GET", "POST")
+	r.HandleFunc("/signal-values/{id}", userAuth(handlers.SignalValueHandler)).Methods("GET", "DELETE")
+	r.HandleFunc("/signal-values/{id}/waveform", userAuth(handlers.WaveformHandler)).Methods("GET")
+	r.HandleFunc("/signal-values/{id}/waveform/stats", userAuth(handlers.WaveformStatsHandler)).Methods("GET")
+	r.HandleFunc("/signals/{signal_id}/values", userAuth(handlers.SignalValuesBySignalHandler)).Methods("GET")
+	r.HandleFunc("/signals/{signal_id}/stats", userAuth(handlers.SignalStatsHandler)).Methods("GET")
+	r.HandleFunc("/signals/{signal_id}/series", userAuth(handlers.SeriesHandler)).Methods("GET")
+	r.HandleFunc("/series", userAuth(handlers.AlignedSeriesHandler)).Methods("GET")
+	r.HandleFunc("/signals/{signal_id}/states", userAuth(handlers.SignalStatesHandler)).Methods("GET")
+	r.HandleFunc("/signals/{signal_id}/edges", userAuth(handlers.SignalEdgesHandler)).Methods("GET")
+
+	// Audit log
+	r.HandleFunc("/audit", userAuth(handlers.AuditLogsHandler)).Methods("GET")
+	r.HandleFunc("/audit/verify", userAuth(handlers.AuditVerifyHandler)).Methods("GET")
+
+	// Legacy endpoints for backward compatibility
+	r.HandleFunc("/readings", anyAuth(handlers.ReadingsHandler)).Methods("GET", "POST")
+	r.HandleFunc("/readings/{user_id}", userAuth(handlers.UserReadingsHandler)).Methods("GET")
+	r.HandleFunc("/users/rfid/{rfid}", deviceAuth(handlers.GetUserByRFIDHandler)).Methods("GET")
+
+	return r
+}
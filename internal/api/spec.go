@@ -0,0 +1,382 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/digital"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+	"data-storage/internal/oee"
+	"data-storage/internal/openapi"
+	"data-storage/internal/ratelimit"
+	"data-storage/internal/series"
+	"data-storage/internal/waveform"
+)
+
+// Security schemes. Operations list the schemes they accept; any one of them is enough.
+const (
+	schemeUser    = "userJWT"
+	schemeDevice  = "deviceToken"
+	schemeMetrics = "metricsToken"
+)
+
+var (
+	public       []string
+	userOnly     = []string{schemeUser}
+	deviceOnly   = []string{schemeDevice}
+	userOrDevice = []string{schemeUser, schemeDevice}
+)
+
+// ReadingRequest is the body of the legacy POST /readings endpoint
+type ReadingRequest struct {
+	SignalID     uint     `json:"signal_id" validate:"required"`
+	UserID       uint     `json:"user_id,omitempty"`
+	Value        *float64 `json:"value,omitempty"`
+	DigitalValue *bool    `json:"digital_value,omitempty"`
+}
+
+// endpoint documents one method of a route registered in NewRouter
+type endpoint struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Auth        []string
+	Params      []openapi.Parameter // Query parameters, and path parameters that are not integers
+	Body        interface{}         // Request body type, nil when the operation has none
+	Status      int                 // Success status, 200 when zero
+	Response    interface{}         // Success body type, nil for empty responses
+	ContentType string              // Success content type, application/json when empty
+}
+
+func query(name, typ, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+func enumQuery(name, description string, values ...string) openapi.Parameter {
+	p := query(name, "string", description)
+	p.Schema.Enum = values
+	return p
+}
+
+var dateRange = []openapi.Parameter{
+	query("from_date", "string", "Only entries at or after this timestamp (RFC 3339)"),
+	query("to_date", "string", "Only entries at or before this timestamp (RFC 3339)"),
+}
+
+var includeSamples = query("include_samples", "boolean", "Include the samples of waveform values (default false)")
+
+var offset = query("offset", "integer", "Number of entries to skip, to page through results")
+
+// valueFillParams fill the gaps between the values of a page of a value list
+var valueFillParams = []openapi.Parameter{
+	enumQuery("fill", "Fill the gaps between values longer than gap_threshold with a value every gap_threshold", series.FillModes...),
+	query("fill_value", "number", "Value of the constant fill"),
+	query("gap_threshold", "string", "Fill the spans without values longer than this duration; needs a fill"),
+}
+
+// functionParams apply a function to the values of a series
+var functionParams = []openapi.Parameter{
+	enumQuery("function", "Function of the values: the change (difference), change per unit (derivative), counter increase counting drops as resets (increase, rate), cumulative area (integral) or smoothing (moving_average, ema)", series.Functions...),
+	query("unit", "string", "Time unit of derivative, rate and integral, such as 1h; a second by default"),
+	query("window", "integer", "Values averaged by moving_average, or the span of ema without an alpha"),
+	query("alpha", "number", "Smoothing factor of ema, greater than 0 and at most 1"),
+}
+
+func limit(defaultLimit, maxLimit int) openapi.Parameter {
+	return query("limit", "integer", "Maximum number of entries (default "+strconv.Itoa(defaultLimit)+", max "+strconv.Itoa(maxLimit)+")")
+}
+
+var tags = []openapi.Tag{
+	{Name: "Health", Description: "Probes, metrics and documentation"},
+	{Name: "Authentication", Description: "Login, passwords and tokens"},
+	{Name: "Users"},
+	{Name: "Devices"},
+	{Name: "Organizations", Description: "Organizations, members and invitations"},
+	{Name: "Signals", Description: "Signal configurations"},
+	{Name: "Signal Values"},
+	{Name: "Cycles", Description: "Assembly cycles of stations"},
+	{Name: "Reports", Description: "Shift calendar, attendance and OEE"},
+	{Name: "Audit"},
+	{Name: "Legacy", Description: "Endpoints kept for backward compatibility"},
+}
+
+var endpoints = []endpoint{
+	// Health
+	{Method: "GET", Path: "/healthz", Tag: "Health", Summary: "Liveness probe", Auth: public, Response: handlers.HealthResponse{}},
+	{Method: "GET", Path: "/readyz", Tag: "Health", Summary: "Readiness probe", Description: "Fails with 503 when the database is unreachable or the server is shutting down.", Auth: public, Response: handlers.HealthResponse{}},
+	{Method: "GET", Path: "/metrics", Tag: "Health", Summary: "Prometheus metrics", Description: "Requires the metrics token when METRICS_TOKEN is set.", Auth: []string{schemeMetrics}, ContentType: "text/plain"},
+	{Method: "GET", Path: "/openapi.json", Tag: "Health", Summary: "This OpenAPI document", Auth: public, Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", Tag: "Health", Summary: "Interactive API documentation", Auth: public, ContentType: "text/html"},
+
+	// Authentication
+	{Method: "POST", Path: "/auth/login", Tag: "Authentication", Summary: "Log in with email and password", Auth: public, Body: handlers.LoginRequest{}, Response: handlers.LoginResponse{}},
+	{Method: "POST", Path: "/auth/forgot-password", Tag: "Authentication", Summary: "Request a password reset email", Description: "Always accepted, whether or not the email belongs to a user.", Auth: public, Body: handlers.ForgotPasswordRequest{}, Status: http.StatusAccepted, Response: map[string]string{}},
+	{Method: "POST", Path: "/auth/reset-password", Tag: "Authentication", Summary: "Set a new password with a reset token", Auth: public, Body: handlers.ResetPasswordRequest{}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/auth/accept-invitation", Tag: "Authentication", Summary: "Accept an organization invitation", Description: "Creates the user when the invited email has no account yet, then logs in.", Auth: public, Body: handlers.AcceptInvitationRequest{}, Response: handlers.LoginResponse{}},
+	{Method: "POST", Path: "/auth/change-password", Tag: "Authentication", Summary: "Change the password of the current user", Auth: userOnly, Body: handlers.ChangePasswordRequest{}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/auth/switch-org", Tag: "Authentication", Summary: "Get a token for another organization of the current user", Auth: userOnly, Body: handlers.SwitchOrgRequest{}, Response: handlers.LoginResponse{}},
+	{Method: "POST", Path: "/auth/register-device", Tag: "Authentication", Summary: "Register a device and get its auth token", Auth: userOnly, Body: handlers.RegisterDeviceRequest{}, Status: http.StatusCreated, Response: handlers.RegisterDeviceResponse{}},
+
+	// Users
+	{Method: "GET", Path: "/users", Tag: "Users", Summary: "List users of the organization", Auth: userOnly, Response: []models.User{}},
+	{Method: "POST", Path: "/users", Tag: "Users", Summary: "Create a user", Auth: userOnly, Body: handlers.CreateUserRequest{}, Status: http.StatusCreated, Response: models.User{}},
+	{Method: "GET", Path: "/users/{id}", Tag: "Users", Summary: "Get a user", Auth: userOnly, Response: models.User{}},
+	{Method: "PUT", Path: "/users/{id}", Tag: "Users", Summary: "Update a user", Description: "Users may edit themselves, but not their password (use POST /auth/change-password) and, unless organization admins, not is_active. Admins may edit users that only belong to their organization.", Auth: userOnly, Body: handlers.UpdateUserRequest{}, Response: models.User{}},
+	{Method: "DELETE", Path: "/users/{id}", Tag: "Users", Summary: "Delete a user", Auth: userOnly, Status: http.StatusNoContent},
+
+	// Devices
+	{Method: "GET", Path: "/devices", Tag: "Devices", Summary: "List devices", Auth: userOnly, Params: []openapi.Parameter{
+		query("user_id", "integer", "Only devices of this user"),
+		query("active", "boolean", "Only active or inactive devices"),
+	}, Response: []models.Device{}},
+	{Method: "POST", Path: "/devices", Tag: "Devices", Summary: "Create a device", Auth: userOnly, Body: models.Device{}, Status: http.StatusCreated, Response: models.Device{}},
+	{Method: "GET", Path: "/devices/{id}", Tag: "Devices", Summary: "Get a device", Auth: userOnly, Response: models.Device{}},
+	{Method: "PUT", Path: "/devices/{id}", Tag: "Devices", Summary: "Update a device", Auth: userOnly, Body: models.Device{}, Response: models.Device{}},
+	{Method: "DELETE", Path: "/devices/{id}", Tag: "Devices", Summary: "Delete a device", Auth: userOnly, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/devices/{id}/quota", Tag: "Devices", Summary: "Get the ingestion quota usage of a device", Auth: userOnly, Params: []openapi.Parameter{
+		query("days", "integer", "Number of past days of usage history (default 7, max 90)"),
+	}, Response: ratelimit.QuotaStatus{}},
+	{Method: "POST", Path: "/devices/{id}/move", Tag: "Devices", Summary: "Move a device to another organization", Auth: userOnly, Body: handlers.MoveDeviceRequest{}, Response: models.Device{}},
+	{Method: "GET", Path: "/devices/{id}/certificates", Tag: "Devices", Summary: "List the client certificates of a device", Auth: userOnly, Params: []openapi.Parameter{
+		query("revoked", "boolean", "false to only list certificates that are not revoked"),
+	}, Response: []models.DeviceCertificate{}},
+	{Method: "POST", Path: "/devices/{id}/certificates", Tag: "Devices", Summary: "Register a client certificate of a device", Description: "Send the PEM certificate or only its SHA-256 fingerprint. Requires the organization admin role.", Auth: userOnly, Body: handlers.RegisterCertificateRequest{}, Status: http.StatusCreated, Response: models.DeviceCertificate{}},
+	{Method: "POST", Path: "/devices/{id}/certificates/issue", Tag: "Devices", Summary: "Issue a client certificate from the built-in CA", Description: "Signs the CSR, or generates a key pair and returns its private key once. Fails with 501 when no device CA is configured. Requires the organization admin role.", Auth: userOnly, Body: handlers.IssueCertificateRequest{}, Status: http.StatusCreated, Response: handlers.IssueCertificateResponse{}},
+	{Method: "POST", Path: "/devices/{id}/certificates/{certificate_id}/revoke", Tag: "Devices", Summary: "Revoke a client certificate", Description: "Requires the organization admin role.", Auth: userOnly, Body: handlers.RevokeCertificateRequest{}, Response: models.DeviceCertificate{}},
+	{Method: "GET", Path: "/devices/{id}/sessions", Tag: "Devices", Summary: "List the operator sessions of a device", Description: "Newest first. The date range selects sessions overlapping it.", Auth: userOnly, Params: append([]openapi.Parameter{
+		query("open", "boolean", "true to only list the open session"),
+		query("user_id", "string", "Comma-separated IDs of the operators whose sessions to list"),
+		limit(100, 1000), offset,
+	}, dateRange...), Response: []models.OperatorSession{}},
+	{Method: "GET", Path: "/devices/{id}/badge-scans", Tag: "Devices", Summary: "List the badge scans of a device", Description: "Newest first, including rejected scans.", Auth: userOnly, Params: append([]openapi.Parameter{
+		enumQuery("result", "Only scans with this result", models.BadgeSessionStarted, models.BadgeSessionEnded, models.BadgeSessionOpen, models.BadgeUnknown, models.BadgeInactive, models.BadgeNoSession),
+		query("user_id", "string", "Comma-separated IDs of the users whose scans to list"),
+		limit(100, 1000), offset,
+	}, dateRange...), Response: []models.BadgeScan{}},
+	{Method: "POST", Path: "/devices/{id}/badge", Tag: "Devices", Summary: "Scan an operator badge at a device", Description: "Starts or ends the operator session of the device; signal values it records while a session is open are attributed to the operator. A toggle ends the operator's own session and otherwise starts one, ending another operator's session. Unknown badges (404), inactive users (403) and logouts without a session (409) are recorded and rejected. Returns 201 when a session starts.", Auth: deviceOnly, Body: handlers.BadgeRequest{}, Response: handlers.BadgeResponse{}},
+
+	// Organizations
+	{Method: "GET", Path: "/orgs", Tag: "Organizations", Summary: "List organizations of the current user", Auth: userOnly, Response: []handlers.OrganizationWithRole{}},
+	{Method: "POST", Path: "/orgs", Tag: "Organizations", Summary: "Create an organization", Description: "The creator becomes its admin.", Auth: userOnly, Body: handlers.OrganizationRequest{}, Status: http.StatusCreated, Response: handlers.OrganizationWithRole{}},
+	{Method: "GET", Path: "/orgs/{id}", Tag: "Organizations", Summary: "Get an organization", Auth: userOnly, Response: handlers.OrganizationWithRole{}},
+	{Method: "PUT", Path: "/orgs/{id}", Tag: "Organizations", Summary: "Update an organization", Auth: userOnly, Body: handlers.OrganizationRequest{}, Response: handlers.OrganizationWithRole{}},
+	{Method: "GET", Path: "/orgs/{id}/members", Tag: "Organizations", Summary: "List members", Auth: userOnly, Response: []models.Membership{}},
+	{Method: "PUT", Path: "/orgs/{id}/members/{user_id}", Tag: "Organizations", Summary: "Change the role of a member", Auth: userOnly, Body: handlers.MemberRoleRequest{}, Response: models.Membership{}},
+	{Method: "DELETE", Path: "/orgs/{id}/members/{user_id}", Tag: "Organizations", Summary: "Remove a member", Auth: userOnly, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/orgs/{id}/invitations", Tag: "Organizations", Summary: "List pending invitations", Auth: userOnly, Response: []models.OrgInvitation{}},
+	{Method: "POST", Path: "/orgs/{id}/invitations", Tag: "Organizations", Summary: "Invite someone by email", Auth: userOnly, Body: handlers.InvitationRequest{}, Status: http.StatusCreated, Response: models.OrgInvitation{}},
+	{Method: "DELETE", Path: "/orgs/{id}/invitations/{invitation_id}", Tag: "Organizations", Summary: "Revoke an invitation", Auth: userOnly, Status: http.StatusNoContent},
+
+	// Reports
+	{Method: "GET", Path: "/shifts", Tag: "Reports", Summary: "List the shifts of the calendar", Auth: userOnly, Params: []openapi.Parameter{
+		query("active", "boolean", "Only active (true) or inactive (false) shifts"),
+	}, Response: []models.Shift{}},
+	{Method: "POST", Path: "/shifts", Tag: "Reports", Summary: "Create a shift", Description: "Requires the organization admin role.", Auth: userOnly, Body: handlers.ShiftRequest{}, Status: http.StatusCreated, Response: models.Shift{}},
+	{Method: "GET", Path: "/shifts/{id}", Tag: "Reports", Summary: "Get a shift", Auth: userOnly, Response: models.Shift{}},
+	{Method: "PUT", Path: "/shifts/{id}", Tag: "Reports", Summary: "Replace a shift", Description: "Requires the organization admin role.", Auth: userOnly, Body: handlers.ShiftRequest{}, Response: models.Shift{}},
+	{Method: "DELETE", Path: "/shifts/{id}", Tag: "Reports", Summary: "Delete a shift", Description: "Requires the organization admin role.", Auth: userOnly, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/reports/attendance", Tag: "Reports", Summary: "Report operator time per device and shift", Description: "Derives working time from operator sessions. Sessions without a badge-out, or ended only by the next operator badging in, count up to the session timeout. Time outside every active shift is reported without a shift. With format=csv the rows are returned as text/csv.", Auth: userOnly, Params: []openapi.Parameter{
+		query("from_date", "string", "Start of the range, RFC 3339 or YYYY-MM-DD (required)"),
+		query("to_date", "string", "End of the range, exclusive, at most 93 days after from_date (required)"),
+		query("group_by", "string", "Comma-separated dimensions among operator, device and shift (default all)"),
+		query("session_timeout", "string", "Longest time a session counts, e.g. 8h (default OPERATOR_SESSION_TIMEOUT)"),
+		query("device_id", "integer", "Only sessions at this device"),
+		query("user_id", "integer", "Only sessions of this operator"),
+		enumQuery("format", "Response format (default json)", "json", "csv"),
+	}, Response: handlers.AttendanceReport{}},
+	{Method: "GET", Path: "/reports/oee", Tag: "Reports", Summary: "Report OEE per device and shift", Description: "Availability is the time spent in cycles over the planned production time, which is the active shifts or, without shifts, the whole range. Performance is the ideal cycle time over the actual one and quality the share of passed cycles; OEE is their product. Cycles count in the period they start in; where shifts overlap, the time and its cycles count for the shift that started first. With format=csv the rows are returned as text/csv.", Auth: userOnly, Params: []openapi.Parameter{
+		query("from_date", "string", "Start of the range, RFC 3339 or YYYY-MM-DD (required)"),
+		query("to_date", "string", "End of the range, exclusive, at most 93 days after from_date (required)"),
+		enumQuery("group_by", "A row per device, or per device and shift occurrence (default device)", oee.ByDevice, oee.ByShift),
+		query("device_id", "string", "Comma-separated IDs of the active devices to report (default every active device)"),
+		query("ideal_cycle_time", "number", "Ideal cycle time in seconds of cycles recorded without a target_cycle_time"),
+		enumQuery("format", "Response format (default json)", "json", "csv"),
+	}, Response: handlers.OEEReport{}},
+
+	// Cycles
+	{Method: "GET", Path: "/cycles", Tag: "Cycles", Summary: "List assembly cycles", Description: "Newest first.", Auth: userOnly, Params: append([]openapi.Parameter{
+		query("device_id", "integer", "Only cycles of this device"),
+		query("user_id", "integer", "Only cycles of this operator"),
+		enumQuery("result", "Only cycles with this result", models.CyclePass, models.CycleFail),
+		limit(1000, 10000),
+		offset,
+	}, dateRange...), Response: []models.Cycle{}},
+	{Method: "POST", Path: "/cycles", Tag: "Cycles", Summary: "Record an assembly cycle", Description: "Devices record their own cycles with their device token; users name the device_id. Without a user_id the cycle is attributed to the operator badged in at the device, then to the device's user.", Auth: userOrDevice, Body: handlers.CycleRequest{}, Status: http.StatusCreated, Response: models.Cycle{}},
+	{Method: "GET", Path: "/cycles/{id}", Tag: "Cycles", Summary: "Get an assembly cycle", Auth: userOnly, Response: models.Cycle{}},
+	{Method: "DELETE", Path: "/cycles/{id}", Tag: "Cycles", Summary: "Delete an assembly cycle", Auth: userOnly, Status: http.StatusNoContent},
+
+	// Signals
+	{Method: "GET", Path: "/signals", Tag: "Signals", Summary: "List signals", Auth: userOnly, Params: []openapi.Parameter{
+		query("device_id", "integer", "Only signals of this device"),
+		enumQuery("signal_type", "Only signals of this type", "digital", "analogic", "waveform"),
+		enumQuery("direction", "Only signals in this direction", "input", "output"),
+		query("active", "boolean", "Only active or inactive signals"),
+	}, Response: []models.Signal{}},
+	{Method: "POST", Path: "/signals", Tag: "Signals", Summary: "Create a signal", Auth: userOnly, Body: models.Signal{}, Status: http.StatusCreated, Response: models.Signal{}},
+	{Method: "GET", Path: "/signals/{id}", Tag: "Signals", Summary: "Get a signal", Auth: userOnly, Response: models.Signal{}},
+	{Method: "PUT", Path: "/signals/{id}", Tag: "Signals", Summary: "Update a signal", Auth: userOnly, Body: models.Signal{}, Response: models.Signal{}},
+	{Method: "DELETE", Path: "/signals/{id}", Tag: "Signals", Summary: "Delete a signal", Auth: userOnly, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/devices/{device_id}/signals", Tag: "Signals", Summary: "List signals of a device", Auth: userOnly, Params: []openapi.Parameter{
+		enumQuery("signal_type", "Only signals of this type", "digital", "analogic", "waveform"),
+		enumQuery("direction", "Only signals in this direction", "input", "output"),
+	}, Response: []models.Signal{}},
+
+	// Signal values
+	{Method: "GET", Path: "/signal-values", Tag: "Signal Values", Summary: "List signal values", Description: "Returns the stored values, newest first. With a fill or function and a single signal_id, the gaps between the values of the page longer than gap_threshold get a value every gap_threshold, marked filled and without an ID; fill=null leaves them empty to mark the gaps. With a function, each value is then replaced by the function of the values of the page, taken in time order; the oldest value of a page has no previous one to compare with. Digital values only take the null and previous fills and no function, and waveform signals return 422. Bucketing is only done by GET /signals/{signal_id}/series and GET /series; their bucket and aggregate parameters are rejected with 400 here.", Auth: userOnly, Params: append(append([]openapi.Parameter{
+		query("signal_id", "integer", "Only values of this signal"),
+		query("device_id", "integer", "Only values of signals of this device"),
+		query("user_id", "integer", "Only values recorded for this user"),
+		includeSamples,
+		limit(1000, 10000),
+		offset,
+	}, dateRange...), append(valueFillParams, functionParams...)...), Response: []models.SignalValue{}},
+	{Method: "POST", Path: "/signal-values", Tag: "Signal Values", Summary: "Record a signal value", Description: "Devices post values with their device token. Without a user_id the value is attributed to the operator badged in at the device, then to the device's user. Waveform signals take samples and sample_interval instead of value; every sample must be within the signal's range.", Auth: userOrDevice, Body: models.SignalValue{}, Status: http.StatusCreated, Response: models.SignalValue{}},
+	{Method: "GET", Path: "/signal-values/{id}", Tag: "Signal Values", Summary: "Get a signal value", Auth: userOnly, Response: models.SignalValue{}},
+	{Method: "DELETE", Path: "/signal-values/{id}", Tag: "Signal Values", Summary: "Delete a signal value", Auth: userOnly, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/signal-values/{id}/waveform", Tag: "Signal Values", Summary: "Get the curve of a waveform value", Description: "Returns 422 for values of other signal types.", Auth: userOnly, Params: []openapi.Parameter{
+		query("max_points", "integer", "Downsample to at most this many points; all samples when omitted or 0"),
+		enumQuery("method", "Downsampling method, lttb by default", waveform.Methods...),
+	}, Response: handlers.WaveformResponse{}},
+	{Method: "GET", Path: "/signal-values/{id}/waveform/stats", Tag: "Signal Values", Summary: "Get the statistics of a waveform value", Description: "Peak, minimum, mean, final value and area of the curve. Returns 422 for values of other signal types.", Auth: userOnly, Response: handlers.WaveformStatsResponse{}},
+	{Method: "GET", Path: "/signals/{signal_id}/values", Tag: "Signal Values", Summary: "List values of a signal", Description: "Returns the stored values, newest first. With a fill, the gaps between the values of the page longer than gap_threshold get a value every gap_threshold, marked filled and without an ID; fill=null leaves them empty to mark the gaps. With a function, each value is then replaced by the function of the values of the page, taken in time order; the oldest value of a page has no previous one to compare with. Digital values only take the null and previous fills and no function, and waveform signals return 422. Bucketing is only done by GET /signals/{signal_id}/series and GET /series; their bucket and aggregate parameters are rejected with 400 here.", Auth: userOnly, Params: append(append([]openapi.Parameter{
+		includeSamples,
+		limit(1000, 10000),
+		offset,
+	}, dateRange...), append(valueFillParams, functionParams...)...), Response: []models.SignalValue{}},
+	{Method: "GET", Path: "/signals/{signal_id}/stats", Tag: "Signal Values", Summary: "Get the statistics of a signal", Description: "Count, mean, sample standard deviation, percentiles and the first minimum and maximum of the values in the range; digital values count as 1 and 0. For analogic signals with a min_value or max_value, the capability indices Cp (both limits) and Cpk use them as specification limits and the standard deviation of the whole range. Returns 422 for waveform signals.", Auth: userOnly, Params: append([]openapi.Parameter{
+		query("compare", "string", "Comma-separated IDs of other signals to summarize alongside, at most 20 signals in all"),
+	}, dateRange...), Response: handlers.SignalStatsResponse{}},
+	{Method: "GET", Path: "/signals/{signal_id}/series", Tag: "Signal Values", Summary: "Get the values of a signal for charts", Description: "Raw values from from_date (inclusive) to to_date (exclusive) in time order, or with a bucket the aggregate of each bucket from from_date. Digital values read as 1 and 0 and only take the null and previous fills and no function. The function applies after aggregation and filling. Raw values stop at the limit: the response is then marked truncated, and to is moved back to the first value left out, where the next request can start. Returns 422 for waveform signals.", Auth: userOnly, Params: append([]openapi.Parameter{
+		query("from_date", "string", "Start of the range (RFC 3339 or YYYY-MM-DD)"),
+		query("to_date", "string", "End of the range (RFC 3339 or YYYY-MM-DD)"),
+		query("bucket", "string", "Aggregate the values per bucket of this duration, such as 30s, 5m or 1h"),
+		enumQuery("aggregate", "Aggregate of the values in a bucket, avg by default", series.Aggregates...),
+		enumQuery("fill", "Fill empty buckets, or the gaps of raw values every gap_threshold; without it empty buckets are left out", series.FillModes...),
+		query("fill_value", "number", "Value of the constant fill"),
+		query("gap_threshold", "string", "Mark the spans without values longer than this duration as gaps"),
+		limit(1000, 10000),
+	}, functionParams...), Response: handlers.SeriesResponse{}},
+	{Method: "GET", Path: "/series", Tag: "Signal Values", Summary: "Get several signals aligned on the same buckets", Description: "A row per bucket from from_date with a value per signal, in the order of signal_ids. Without a fill, only buckets where some signal has values are returned. Digital values read as 1 and 0, only take the null and previous fills and no function; waveform signals return 422.", Auth: userOnly, Params: append([]openapi.Parameter{
+		query("signal_ids", "string", "Comma-separated IDs of the signals, at most 20"),
+		query("from_date", "string", "Start of the range (RFC 3339 or YYYY-MM-DD)"),
+		query("to_date", "string", "End of the range, exclusive (RFC 3339 or YYYY-MM-DD)"),
+		query("bucket", "string", "Duration of the buckets, such as 30s, 5m or 1h"),
+		enumQuery("aggregate", "Aggregate of the values in a bucket, avg by default", series.Aggregates...),
+		enumQuery("fill", "Fill the empty buckets of each signal", series.FillModes...),
+		query("fill_value", "number", "Value of the constant fill"),
+		query("gap_threshold", "string", "List the gaps of each signal longer than this duration"),
+		enumQuery("format", "Response format, json by default; csv has a column per signal", "json", "csv"),
+	}, functionParams...), Response: handlers.AlignedSeriesResponse{}},
+	{Method: "GET", Path: "/signals/{signal_id}/states", Tag: "Signal Values", Summary: "Get the time a digital signal spent on and off", Description: "Each value holds until the next one, starting from the last value before from_date; time before any known value is unknown. The range ends now when to_date is in the future. Totals, longest runs and buckets cover the whole range; state, min_duration and max_duration only filter the listed intervals. Returns 422 for other signal types.", Auth: userOnly, Params: []openapi.Parameter{
+		query("from_date", "string", "Start of the range (RFC 3339 or YYYY-MM-DD)"),
+		query("to_date", "string", "End of the range, exclusive (RFC 3339 or YYYY-MM-DD)"),
+		enumQuery("state", "Only list the intervals in this state", "on", "off"),
+		query("min_duration", "string", "Only list the intervals lasting at least this duration, such as 10m"),
+		query("max_duration", "string", "Only list the intervals lasting at most this duration"),
+		query("bucket", "string", "Also return the time on and off per bucket of this duration, such as 1h"),
+		limit(1000, 10000),
+		offset,
+	}, Response: handlers.StatesResponse{}},
+	{Method: "GET", Path: "/signals/{signal_id}/edges", Tag: "Signal Values", Summary: "List the rising and falling edges of a digital signal", Description: "Changes of state between consecutive values in time order, comparing the first value with the last one before from_date. The rising and falling counts cover the whole range. Returns 422 for other signal types.", Auth: userOnly, Params: []openapi.Parameter{
+		query("from_date", "string", "Start of the range (RFC 3339 or YYYY-MM-DD)"),
+		query("to_date", "string", "End of the range, exclusive (RFC 3339 or YYYY-MM-DD)"),
+		enumQuery("edge", "Only list the edges of this kind", digital.Rising, digital.Falling),
+		limit(1000, 10000),
+		offset,
+	}, Response: handlers.EdgesResponse{}},
+
+	// Audit
+	{Method: "GET", Path: "/audit", Tag: "Audit", Summary: "List audit log entries", Description: "Requires the organization admin role.", Auth: userOnly, Params: append([]openapi.Parameter{
+		enumQuery("actor_type", "Only entries of this actor type", "user", "device", "anonymous", "admin"),
+		query("actor_id", "integer", "Only entries of this actor"),
+		query("action", "string", "Only entries with this action"),
+		query("resource_type", "string", "Only entries for this resource type"),
+		query("resource_id", "integer", "Only entries for this resource"),
+		limit(100, 1000),
+		offset,
+	}, dateRange...), Response: []models.AuditLog{}},
+	{Method: "GET", Path: "/audit/verify", Tag: "Audit", Summary: "Verify the audit log hash chain", Description: "The chain spans every organization, so only the outcome is returned; run the admin CLI's audit verify for the first broken entry. Requires the organization admin role.", Auth: userOnly, Response: handlers.AuditVerifyResponse{}},
+
+	// Legacy
+	{Method: "GET", Path: "/readings", Tag: "Legacy", Summary: "List signal values", Description: "Use GET /signal-values instead.", Auth: userOrDevice, Params: []openapi.Parameter{
+		limit(1000, 10000),
+	}, Response: []models.SignalValue{}},
+	{Method: "POST", Path: "/readings", Tag: "Legacy", Summary: "Record a signal value", Description: "Use POST /signal-values instead.", Auth: userOrDevice, Body: ReadingRequest{}, Status: http.StatusCreated, Response: models.SignalValue{}},
+	{Method: "GET", Path: "/readings/{user_id}", Tag: "Legacy", Summary: "List signal values of a user", Description: "Use GET /signal-values?user_id= instead.", Auth: userOnly, Response: []models.SignalValue{}},
+	{Method: "GET", Path: "/users/rfid/{rfid}", Tag: "Legacy", Summary: "Find a user by RFID badge", Description: "Only finds active users of the device's organization and records the lookup as a badge scan of the device. Use POST /devices/{id}/badge instead.", Auth: deviceOnly, Params: []openapi.Parameter{
+		{Name: "rfid", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}},
+	}, Response: models.User{}},
+}
+
+// Spec returns the OpenAPI document of the API, built once from the endpoint table
+var Spec = sync.OnceValue(buildSpec)
+
+func buildSpec() *openapi.Document {
+	b := openapi.NewBuilder(openapi.Info{
+		Title:       "Data Storage API",
+		Description: "Stores devices, signal configurations and signal values. Errors are returned as application/problem+json.",
+		Version:     "1.0.0",
+	})
+	for _, tag := range tags {
+		b.AddTag(tag.Name, tag.Description)
+	}
+
+	b.AddSecurityScheme(schemeUser, &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "User token from /auth/login. It carries the active organization and role.",
+	})
+	b.AddSecurityScheme(schemeDevice, &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "Device auth token from /auth/register-device or the device record. When the server serves TLS, devices may instead present a registered client certificate and no Authorization header.",
+	})
+	b.AddSecurityScheme(schemeMetrics, &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "Value of METRICS_TOKEN, when set.",
+	})
+
+	problem := &openapi.Response{
+		Description: "Error",
+		Content:     map[string]*openapi.MediaType{apierror.ContentType: {Schema: b.Schema(apierror.Problem{})}},
+	}
+
+	for _, e := range endpoints {
+		op := &openapi.Operation{
+			Tags:        []string{e.Tag},
+			Summary:     e.Summary,
+			Description: e.Description,
+			Parameters:  e.Params,
+			Responses:   map[string]*openapi.Response{"default": problem},
+		}
+		for _, scheme := range e.Auth {
+			op.Security = append(op.Security, openapi.SecurityRequirement{scheme: {}})
+		}
+		if e.Body != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(b.Schema(e.Body))}
+		}
+
+		status := e.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &openapi.Response{Description: http.StatusText(status)}
+		switch {
+		case e.ContentType != "":
+			success.Content = map[string]*openapi.MediaType{e.ContentType: {Schema: &openapi.Schema{Type: "string"}}}
+		case e.Response != nil:
+			success.Content = openapi.JSON(b.Schema(e.Response))
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		b.Add(e.Method, e.Path, op)
+	}
+	return b.Document()
+}
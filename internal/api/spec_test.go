@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSpecCoversRoutes(t *testing.T) {
+	spec := Spec()
+	registered := map[string]bool{}
+
+	err := NewRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("Route %s must declare its methods", path)
+			return nil
+		}
+		for _, method := range methods {
+			if !spec.Has(method, path) {
+				t.Errorf("Route %s %s is not documented in the OpenAPI spec", method, path)
+			}
+		}
+		registered[path] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path := range spec.Paths {
+		if !registered[path] {
+			t.Errorf("Documented path %s is not registered", path)
+		}
+	}
+}
+
+func TestSpecReferencesResolve(t *testing.T) {
+	rec := httptest.NewRecorder()
+	SpecHandler(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rec.Code != 200 {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"User", "Device", "Signal", "SignalValue", "Problem", "LoginRequest"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("Expected a %s schema", name)
+		}
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("Unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
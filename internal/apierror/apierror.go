@@ -0,0 +1,141 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"data-storage/internal/logging"
+	"data-storage/internal/validate"
+
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of problem responses (RFC 9457)
+const ContentType = "application/problem+json"
+
+// Machine-readable error codes. Clients should branch on the code, not on the detail text.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeDuplicate          = "duplicate"
+	CodeReference          = "reference_violation"
+	CodeConstraint         = "constraint_violation"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeRateLimited        = "rate_limited"
+	CodeAccountLocked      = "account_locked"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeInternal           = "internal_error"
+	CodeUnavailable        = "unavailable"
+)
+
+// statusCodes is the default code of each status, used by Error
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   CodeValidation,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+var logger = logging.Logger("api")
+
+// Problem is the body of every error response
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Code      string          `json:"code"`
+	Detail    string          `json:"detail,omitempty"`
+	Instance  string          `json:"instance,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Errors    validate.Errors `json:"errors,omitempty"`
+}
+
+// Write sends a problem response with an explicit code
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// Error replaces http.Error: it sends a problem response with the default code of the status
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	write(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// Validation reports all invalid fields of a request at once
+func Validation(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	write(w, r, Problem{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidation,
+		Detail: "The request contains invalid fields",
+		Errors: errs,
+	})
+}
+
+// Database maps a GORM error to a response. resource names the affected record (e.g.
+// "device") in messages. Errors the client cannot fix are logged and reported without
+// details, so database internals never reach the response.
+func Database(w http.ResponseWriter, r *http.Request, err error, resource string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		Write(w, r, http.StatusNotFound, CodeNotFound, capitalize(resource)+" not found")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		Write(w, r, http.StatusConflict, CodeDuplicate, capitalize(resource)+" with the same unique fields already exists")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		Write(w, r, http.StatusConflict, CodeReference, capitalize(resource)+" references a missing record or is still referenced")
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		Write(w, r, http.StatusBadRequest, CodeConstraint, capitalize(resource)+" has a value that is not allowed")
+	default:
+		logger.ErrorContext(r.Context(), "Database error", "resource", resource, "method", r.Method, "path", r.URL.Path, "error", err)
+		Write(w, r, http.StatusInternalServerError, CodeInternal, "Error processing "+resource)
+	}
+}
+
+// NotFoundHandler and MethodNotAllowedHandler replace the router's plain text defaults
+var (
+	NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, "No route matches "+r.URL.Path, http.StatusNotFound)
+	})
+	MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	})
+)
+
+func write(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = logging.RequestID(r.Context())
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,78 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"data-storage/internal/validate"
+
+	"gorm.io/gorm"
+)
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ContentType, ct)
+	}
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("Invalid problem body: %v", err)
+	}
+	return p
+}
+
+func TestError_DefaultCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, httptest.NewRequest("GET", "/devices/9", nil), "Device not found", http.StatusNotFound)
+
+	p := decode(t, rec)
+	if rec.Code != http.StatusNotFound || p.Status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d / %d", rec.Code, p.Status)
+	}
+	if p.Code != CodeNotFound || p.Title != "Not Found" || p.Detail != "Device not found" || p.Instance != "/devices/9" {
+		t.Errorf("Unexpected problem: %+v", p)
+	}
+}
+
+func TestValidation_ListsFields(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Validation(rec, httptest.NewRequest("POST", "/signals", nil), validate.Errors{
+		{Field: "name", Code: validate.CodeRequired, Message: "name is required"},
+		{Field: "direction", Code: validate.CodeOneOf, Message: "direction must be one of input, output"},
+	})
+
+	p := decode(t, rec)
+	if rec.Code != http.StatusBadRequest || p.Code != CodeValidation || len(p.Errors) != 2 {
+		t.Errorf("Unexpected validation problem: %d %+v", rec.Code, p)
+	}
+}
+
+func TestDatabase_MapsErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{gorm.ErrRecordNotFound, http.StatusNotFound, CodeNotFound},
+		{gorm.ErrDuplicatedKey, http.StatusConflict, CodeDuplicate},
+		{gorm.ErrForeignKeyViolated, http.StatusConflict, CodeReference},
+		{gorm.ErrCheckConstraintViolated, http.StatusBadRequest, CodeConstraint},
+		{errors.New(`pq: relation "users" does not exist`), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		Database(rec, httptest.NewRequest("POST", "/users", nil), tt.err, "user")
+
+		p := decode(t, rec)
+		if rec.Code != tt.status || p.Code != tt.code {
+			t.Errorf("%v: expected %d %s, got %d %s", tt.err, tt.status, tt.code, rec.Code, p.Code)
+		}
+		if tt.status == http.StatusInternalServerError && p.Detail != "Error processing user" {
+			t.Errorf("Expected database details to be hidden, got %q", p.Detail)
+		}
+	}
+}
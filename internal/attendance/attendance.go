@@ -0,0 +1,216 @@
+// Package attendance derives operator working time from operator sessions: it caps sessions
+// without a badge-out, splits them into the shift windows of the organization's calendar and
+// aggregates them per operator, device and shift.
+package attendance
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"data-storage/internal/models"
+)
+
+// Config controls how sessions are derived
+type Config struct {
+	// SessionTimeout is the longest a session counts; sessions without a badge-out, or closed
+	// only when the next operator badged in, end this long after they started
+	SessionTimeout time.Duration `yaml:"session_timeout" env:"OPERATOR_SESSION_TIMEOUT"`
+}
+
+func DefaultConfig() Config {
+	return Config{SessionTimeout: 12 * time.Hour}
+}
+
+var config = DefaultConfig()
+
+// Init sets the configuration
+func Init(cfg Config) {
+	config = cfg
+}
+
+// SessionTimeout returns the configured session timeout
+func SessionTimeout() time.Duration {
+	return config.SessionTimeout
+}
+
+// weekdays names the days of a shift calendar, indexed by time.Weekday
+var weekdays = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseClock parses a time of day in 24-hour HH:MM format into the offset from midnight
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("must be a time of day in HH:MM format")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseWeekdays parses a comma-separated list of days (mon, tue, ...). An empty list means
+// every day.
+func ParseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(s) == "" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for i, day := range weekdays {
+			if name == day {
+				days[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return days, fmt.Errorf("unknown day %q, use %s", name, strings.Join(weekdays[:], ", "))
+		}
+	}
+	return days, nil
+}
+
+// Schedule is a parsed shift definition
+type Schedule struct {
+	Shift    models.Shift
+	start    time.Duration
+	end      time.Duration
+	days     [7]bool
+	location *time.Location
+}
+
+// NewSchedule parses the times, days and time zone of a shift
+func NewSchedule(shift models.Shift) (*Schedule, error) {
+	s := &Schedule{Shift: shift, location: time.UTC}
+	var err error
+	if s.start, err = ParseClock(shift.StartTime); err != nil {
+		return nil, fmt.Errorf("start_time %w", err)
+	}
+	if s.end, err = ParseClock(shift.EndTime); err != nil {
+		return nil, fmt.Errorf("end_time %w", err)
+	}
+	if s.days, err = ParseWeekdays(shift.Weekdays); err != nil {
+		return nil, fmt.Errorf("weekdays: %w", err)
+	}
+	if shift.Timezone != "" {
+		if s.location, err = time.LoadLocation(shift.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", shift.Timezone)
+		}
+	}
+	return s, nil
+}
+
+// Window is one occurrence of a shift
+type Window struct {
+	Shift *models.Shift
+	Start time.Time
+	End   time.Time
+}
+
+// Windows returns the occurrences of the shifts overlapping [from, to), ordered by start. A
+// shift that ends at or before its start time ends on the next day; the days of the
+// calendar are the days a shift starts on.
+func Windows(schedules []*Schedule, from, to time.Time) []Window {
+	var windows []Window
+	for _, s := range schedules {
+		// Start a day early for overnight shifts running into the range
+		local := from.In(s.location)
+		day := time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, s.location)
+		for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+			if !s.days[day.Weekday()] {
+				continue
+			}
+			start := at(day, s.start)
+			end := at(day, s.end)
+			if !end.After(start) {
+				end = at(day.AddDate(0, 0, 1), s.end)
+			}
+			if end.After(from) && start.Before(to) {
+				windows = append(windows, Window{Shift: &s.Shift, Start: start, End: end})
+			}
+		}
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows
+}
+
+// at returns the wall clock time offset from midnight of day, so that shifts keep their
+// local times across daylight saving changes
+func at(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// Interval is a session, or a part of one, with its effective end
+type Interval struct {
+	Session  *models.OperatorSession
+	Start    time.Time
+	End      time.Time
+	TimedOut bool    // The session was capped by the timeout
+	Window   *Window // The shift occurrence, nil for time outside every shift
+}
+
+// Effective returns the counted interval of a session: open sessions end now, and no
+// session counts longer than timeout
+func Effective(session *models.OperatorSession, now time.Time, timeout time.Duration) Interval {
+	interval := Interval{Session: session, Start: session.StartedAt, End: now}
+	if session.EndedAt != nil {
+		interval.End = *session.EndedAt
+	}
+	if limit := session.StartedAt.Add(timeout); timeout > 0 && interval.End.After(limit) {
+		interval.End = limit
+		interval.TimedOut = true
+	}
+	if interval.End.Before(interval.Start) {
+		interval.End = interval.Start
+	}
+	return interval
+}
+
+// Split clips the interval to [from, to) and divides it among the shift windows it overlaps.
+// Time outside every window becomes intervals without a window; time in overlapping windows
+// counts for each of them.
+func Split(interval Interval, windows []Window, from, to time.Time) []Interval {
+	start, end := later(interval.Start, from), earlier(interval.End, to)
+	if !end.After(start) {
+		return nil
+	}
+
+	var parts []Interval
+	covered := start // Start of the time not yet covered by a window
+	for i := range windows {
+		w := &windows[i]
+		partStart, partEnd := later(start, w.Start), earlier(end, w.End)
+		if !partEnd.After(partStart) {
+			continue
+		}
+		if partStart.After(covered) {
+			parts = append(parts, part(interval, covered, partStart, nil))
+		}
+		parts = append(parts, part(interval, partStart, partEnd, w))
+		covered = later(covered, partEnd)
+	}
+	if end.After(covered) {
+		parts = append(parts, part(interval, covered, end, nil))
+	}
+	return parts
+}
+
+func part(interval Interval, start, end time.Time, window *Window) Interval {
+	interval.Start, interval.End, interval.Window = start, end, window
+	return interval
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
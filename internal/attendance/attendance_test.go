@@ -0,0 +1,145 @@
+package attendance
+
+import (
+	"testing"
+	"time"
+
+	"data-storage/internal/models"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func schedule(t *testing.T, shift models.Shift) *Schedule {
+	t.Helper()
+	s, err := NewSchedule(shift)
+	if err != nil {
+		t.Fatalf("Error parsing shift %s: %v", shift.Name, err)
+	}
+	return s
+}
+
+func TestWindows(t *testing.T) {
+	day := schedule(t, models.Shift{ID: 1, Name: "Day", StartTime: "06:00", EndTime: "14:00", Timezone: "Europe/Rome"})
+	night := schedule(t, models.Shift{ID: 2, Name: "Night", StartTime: "22:00", EndTime: "06:00", Weekdays: "mon,tue,wed,thu,fri", Timezone: "Europe/Rome"})
+
+	// Monday 4 March 2024; the Sunday night shift does not exist
+	windows := Windows([]*Schedule{day, night}, utc("2024-03-04T00:00:00Z"), utc("2024-03-05T00:00:00Z"))
+	if len(windows) != 2 {
+		t.Fatalf("Expected 2 windows, got %d: %v", len(windows), windows)
+	}
+	if windows[0].Shift.Name != "Day" || !windows[0].Start.Equal(utc("2024-03-04T05:00:00Z")) || !windows[0].End.Equal(utc("2024-03-04T13:00:00Z")) {
+		t.Errorf("Unexpected day window %v - %v", windows[0].Start, windows[0].End)
+	}
+	if windows[1].Shift.Name != "Night" || !windows[1].Start.Equal(utc("2024-03-04T21:00:00Z")) || !windows[1].End.Equal(utc("2024-03-05T05:00:00Z")) {
+		t.Errorf("Unexpected night window %v - %v", windows[1].Start, windows[1].End)
+	}
+
+	// Shifts keep their local times across the change to summer time on 31 March 2024
+	every := schedule(t, models.Shift{ID: 3, Name: "Night", StartTime: "22:00", EndTime: "06:00", Timezone: "Europe/Rome"})
+	windows = Windows([]*Schedule{every}, utc("2024-03-30T12:00:00Z"), utc("2024-03-31T12:00:00Z"))
+	if len(windows) != 1 || windows[0].End.Sub(windows[0].Start) != 7*time.Hour {
+		t.Errorf("Expected one 7 hour night shift, got %v", windows)
+	}
+}
+
+func TestNewSchedule_Invalid(t *testing.T) {
+	for _, shift := range []models.Shift{
+		{StartTime: "6:00pm", EndTime: "14:00"},
+		{StartTime: "06:00", EndTime: "24:00"},
+		{StartTime: "06:00", EndTime: "14:00", Weekdays: "monday"},
+		{StartTime: "06:00", EndTime: "14:00", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := NewSchedule(shift); err == nil {
+			t.Errorf("Expected an error for %+v", shift)
+		}
+	}
+}
+
+func TestEffective(t *testing.T) {
+	now := utc("2024-03-04T20:00:00Z")
+	open := &models.OperatorSession{StartedAt: utc("2024-03-04T00:00:00Z")}
+	if iv := Effective(open, now, 12*time.Hour); !iv.TimedOut || !iv.End.Equal(utc("2024-03-04T12:00:00Z")) {
+		t.Errorf("Expected the open session to end after the timeout, got %v (timed out %v)", iv.End, iv.TimedOut)
+	}
+	if iv := Effective(open, utc("2024-03-04T08:00:00Z"), 12*time.Hour); iv.TimedOut || !iv.End.Equal(utc("2024-03-04T08:00:00Z")) {
+		t.Errorf("Expected the open session to end now, got %v", iv.End)
+	}
+
+	ended := utc("2024-03-04T02:00:00Z")
+	closed := &models.OperatorSession{StartedAt: utc("2024-03-04T00:00:00Z"), EndedAt: &ended}
+	if iv := Effective(closed, now, 12*time.Hour); iv.TimedOut || !iv.End.Equal(ended) {
+		t.Errorf("Expected the session to end at its badge-out, got %v", iv.End)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	day := schedule(t, models.Shift{ID: 1, Name: "Day", StartTime: "06:00", EndTime: "14:00"})
+	from, to := utc("2024-03-04T00:00:00Z"), utc("2024-03-05T00:00:00Z")
+	windows := Windows([]*Schedule{day}, from, to)
+
+	session := &models.OperatorSession{StartedAt: utc("2024-03-04T05:00:00Z")}
+	iv := Interval{Session: session, Start: session.StartedAt, End: utc("2024-03-04T15:30:00Z")}
+	parts := Split(iv, windows, from, to)
+	want := []struct {
+		start, end string
+		shift      bool
+	}{
+		{"2024-03-04T05:00:00Z", "2024-03-04T06:00:00Z", false},
+		{"2024-03-04T06:00:00Z", "2024-03-04T14:00:00Z", true},
+		{"2024-03-04T14:00:00Z", "2024-03-04T15:30:00Z", false},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("Expected %d parts, got %d", len(want), len(parts))
+	}
+	for i, w := range want {
+		if !parts[i].Start.Equal(utc(w.start)) || !parts[i].End.Equal(utc(w.end)) || (parts[i].Window != nil) != w.shift {
+			t.Errorf("Part %d: expected %s - %s (shift %v), got %v - %v", i, w.start, w.end, w.shift, parts[i].Start, parts[i].End)
+		}
+	}
+
+	// Parts outside the range are dropped
+	if parts := Split(iv, windows, utc("2024-03-04T10:00:00Z"), utc("2024-03-04T12:00:00Z")); len(parts) != 1 || parts[0].End.Sub(parts[0].Start) != 2*time.Hour {
+		t.Errorf("Expected one clipped part, got %v", parts)
+	}
+}
+
+func TestReport(t *testing.T) {
+	if _, err := NewReport([]string{"operator", "station"}); err == nil {
+		t.Error("Expected an unknown dimension to be rejected")
+	}
+
+	alice := &models.User{Name: "Alice", Matricula: "M001"}
+	a1 := &models.OperatorSession{ID: 1, UserID: 1, DeviceID: 1, User: alice}
+	a2 := &models.OperatorSession{ID: 2, UserID: 1, DeviceID: 2, User: alice}
+	b1 := &models.OperatorSession{ID: 3, UserID: 2, DeviceID: 1, User: &models.User{Name: "Bob", Matricula: "M002"}}
+	start := utc("2024-03-04T06:00:00Z")
+	interval := func(session *models.OperatorSession, hours int, timedOut bool) Interval {
+		return Interval{Session: session, Start: start, End: start.Add(time.Duration(hours) * time.Hour), TimedOut: timedOut}
+	}
+
+	report, err := NewReport([]string{ByOperator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Add(interval(a1, 2, false), 10)
+	report.Add(interval(a1, 1, false), 5) // A second part of the same session
+	report.Add(interval(a2, 3, true), 1)
+	report.Add(interval(b1, 4, false), 7)
+
+	rows := report.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("Expected a row per operator, got %d", len(rows))
+	}
+	if r := rows[0]; r.Matricula != "M001" || r.Seconds != 6*3600 || r.Sessions != 2 || r.TimedOut != 1 || r.Values != 16 || r.DeviceID != 0 {
+		t.Errorf("Unexpected row for M001: %+v", r)
+	}
+	if r := rows[1]; r.Matricula != "M002" || r.Seconds != 4*3600 || r.Sessions != 1 || r.Values != 7 {
+		t.Errorf("Unexpected row for M002: %+v", r)
+	}
+}
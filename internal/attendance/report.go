@@ -0,0 +1,148 @@
+package attendance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dimensions a report is grouped by
+const (
+	ByOperator = "operator"
+	ByDevice   = "device"
+	ByShift    = "shift"
+)
+
+// Row aggregates the time of one operator at one device during one shift occurrence. Fields
+// of dimensions the report is not grouped by are empty.
+type Row struct {
+	UserID     uint       `json:"user_id,omitempty"`
+	Matricula  string     `json:"matricula,omitempty"`
+	Operator   string     `json:"operator,omitempty"`
+	DeviceID   uint       `json:"device_id,omitempty"`
+	Device     string     `json:"device,omitempty"`
+	ShiftID    uint       `json:"shift_id,omitempty"` // Zero for time outside every shift
+	Shift      string     `json:"shift,omitempty"`
+	ShiftStart *time.Time `json:"shift_start,omitempty"`
+	ShiftEnd   *time.Time `json:"shift_end,omitempty"`
+	Seconds    int64      `json:"duration_seconds"`
+	Sessions   int        `json:"sessions"`
+	TimedOut   int        `json:"timed_out_sessions"` // Sessions capped by the timeout
+	Values     int64      `json:"values"`             // Signal values attributed to the operator
+
+	duration time.Duration
+	sessions map[uint]bool
+	timedOut map[uint]bool
+}
+
+type rowKey struct {
+	userID, deviceID, shiftID uint
+	shiftStart                time.Time
+}
+
+// Report aggregates session intervals into rows
+type Report struct {
+	byOperator, byDevice, byShift bool
+	rows                          map[rowKey]*Row
+}
+
+// NewReport returns an empty report grouped by the dimensions, or by all of them when none
+// are given
+func NewReport(groupBy []string) (*Report, error) {
+	r := &Report{rows: map[rowKey]*Row{}}
+	if len(groupBy) == 0 {
+		groupBy = []string{ByOperator, ByDevice, ByShift}
+	}
+	for _, dimension := range groupBy {
+		switch strings.TrimSpace(dimension) {
+		case ByOperator:
+			r.byOperator = true
+		case ByDevice:
+			r.byDevice = true
+		case ByShift:
+			r.byShift = true
+		default:
+			return nil, fmt.Errorf("unknown dimension %q, use %s, %s or %s", dimension, ByOperator, ByDevice, ByShift)
+		}
+	}
+	return r, nil
+}
+
+// Add counts an interval and the signal values produced during it
+func (r *Report) Add(interval Interval, values int64) {
+	session := interval.Session
+	var key rowKey
+	if r.byOperator {
+		key.userID = session.UserID
+	}
+	if r.byDevice {
+		key.deviceID = session.DeviceID
+	}
+	if r.byShift && interval.Window != nil {
+		key.shiftID = interval.Window.Shift.ID
+		key.shiftStart = interval.Window.Start
+	}
+
+	row, ok := r.rows[key]
+	if !ok {
+		row = &Row{UserID: key.userID, DeviceID: key.deviceID, sessions: map[uint]bool{}, timedOut: map[uint]bool{}}
+		if r.byOperator && session.User != nil {
+			row.Matricula = session.User.Matricula
+			row.Operator = session.User.Name
+		}
+		if r.byDevice && session.Device != nil {
+			row.Device = session.Device.Name
+		}
+		if r.byShift && interval.Window != nil {
+			row.ShiftID = interval.Window.Shift.ID
+			row.Shift = interval.Window.Shift.Name
+			start, end := interval.Window.Start, interval.Window.End
+			row.ShiftStart, row.ShiftEnd = &start, &end
+		}
+		r.rows[key] = row
+	}
+
+	row.duration += interval.End.Sub(interval.Start)
+	row.Values += values
+	row.sessions[session.ID] = true
+	if interval.TimedOut {
+		row.timedOut[session.ID] = true
+	}
+}
+
+// Rows returns the rows ordered by shift start, time outside shifts first, then by operator
+// and device
+func (r *Report) Rows() []Row {
+	rows := make([]Row, 0, len(r.rows))
+	for _, row := range r.rows {
+		row.Seconds = int64(row.duration.Round(time.Second) / time.Second)
+		row.Sessions = len(row.sessions)
+		row.TimedOut = len(row.timedOut)
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if sa, sb := startOf(a), startOf(b); !sa.Equal(sb) {
+			return sa.Before(sb)
+		}
+		if a.ShiftID != b.ShiftID {
+			return a.ShiftID < b.ShiftID
+		}
+		if a.Matricula != b.Matricula {
+			return a.Matricula < b.Matricula
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return rows
+}
+
+func startOf(row Row) time.Time {
+	if row.ShiftStart == nil {
+		return time.Time{}
+	}
+	return *row.ShiftStart
+}
@@ -0,0 +1,375 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-storage/internal/auth"
+	"data-storage/internal/db"
+	"data-storage/internal/logging"
+	"data-storage/internal/models"
+	"data-storage/internal/tenant"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Config controls the audit log
+type Config struct {
+	// HMACKey, when set, keys the hash chain so it cannot be recomputed without the key
+	HMACKey string `yaml:"hmac_key" env:"AUDIT_HMAC_KEY" secret:"true"`
+	// ValueCreates records every ingested signal value. Each entry takes the lock of its
+	// organization's hash chain, which serializes the ingestion of an organization;
+	// high-volume deployments may turn it off and lose that record.
+	ValueCreates bool `yaml:"value_creates" env:"AUDIT_VALUE_CREATES"`
+}
+
+func DefaultConfig() Config {
+	return Config{ValueCreates: true}
+}
+
+var config = DefaultConfig()
+
+var logger = logging.Logger("audit")
+
+// Init sets the audit configuration
+func Init(cfg Config) {
+	config = cfg
+}
+
+// RecordsValueCreates reports whether signal value creation is audited
+func RecordsValueCreates() bool {
+	return config.ValueCreates
+}
+
+// ignoredFields are left out of diffs: relations and bookkeeping timestamps
+var ignoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"device":     true,
+	"devices":    true,
+	"user":       true,
+	"signal":     true,
+	"signals":    true,
+	"values":     true,
+}
+
+// redactedFields are recorded as changed without their values
+var redactedFields = map[string]bool{
+	"auth_token": true,
+	"password":   true,
+}
+
+const redacted = "[REDACTED]"
+
+// Each organization has its own hash chain, and entries without an organization another.
+// chainLocks holds a *sync.Mutex per chain, serializing appends within this process; Postgres
+// additionally takes an advisory lock per chain.
+var chainLocks sync.Map
+
+// advisoryLockKey identifies the audit chain locks in pg_advisory_xact_lock, in the high 32
+// bits of the key of each chain
+const advisoryLockKey = 7_242_001
+
+// chainKey identifies the chain of an organization; 0 is the chain of entries without one
+func chainKey(orgID *uint) uint {
+	if orgID == nil {
+		return 0
+	}
+	return *orgID
+}
+
+// chain narrows a query to the entries of the chain of an organization
+func chain(tx *gorm.DB, orgID *uint) *gorm.DB {
+	if orgID == nil {
+		return tx.Where("organization_id IS NULL")
+	}
+	return tx.Where("organization_id = ?", *orgID)
+}
+
+// Actor returns who performed the request, as set by the auth middleware
+func Actor(r *http.Request) (string, *uint) {
+	var header string
+	actorType := r.Header.Get("X-Auth-Type")
+	switch actorType {
+	case "user":
+		header = "X-User-ID"
+	case "device":
+		header = "X-Device-ID"
+	default:
+		return "anonymous", nil
+	}
+
+	id, err := strconv.ParseUint(r.Header.Get(header), 10, 32)
+	if err != nil {
+		return actorType, nil
+	}
+	actorID := uint(id)
+	return actorType, &actorID
+}
+
+// Record appends an entry for a change made by the request's actor. before is nil for
+// creates and after is nil for deletes. Failures are logged and do not fail the request.
+func Record(r *http.Request, action, resourceType string, resourceID uint, before, after interface{}) {
+	actorType, actorID := Actor(r)
+	RecordAs(r, actorType, actorID, action, resourceType, resourceID, before, after)
+}
+
+// RecordAs appends an entry for an explicitly identified actor, e.g. a user identified
+// by a password reset token rather than the auth middleware
+func RecordAs(r *http.Request, actorType string, actorID *uint, action, resourceType string,
+	resourceID uint, before, after interface{}) {
+	changes, err := Diff(before, after)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error computing audit diff",
+			"resource_type", resourceType, "resource_id", resourceID, "error", err)
+		return
+	}
+
+	entry := models.AuditLog{
+		Timestamp:    time.Now().UTC().Truncate(time.Microsecond),
+		ActorType:    actorType,
+		ActorID:      actorID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      changes,
+		IP:           auth.ClientIP(r),
+	}
+	if orgID, ok := tenant.OrganizationFrom(r.Context()); ok {
+		entry.OrganizationID = &orgID
+	}
+
+	if err := appendEntry(&entry); err != nil {
+		logger.ErrorContext(r.Context(), "Error writing audit log",
+			"resource_type", resourceType, "resource_id", resourceID, "error", err)
+	}
+}
+
+// RecordSystem appends an entry for a change made outside the API, such as by the admin
+// command, whose actorType has no ID. Unlike Record, failures are returned to the caller.
+func RecordSystem(actorType string, orgID *uint, action, resourceType string, resourceID uint,
+	before, after interface{}) error {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return fmt.Errorf("error computing audit diff: %w", err)
+	}
+
+	entry := models.AuditLog{
+		Timestamp:      time.Now().UTC().Truncate(time.Microsecond),
+		OrganizationID: orgID,
+		ActorType:      actorType,
+		Action:         action,
+		ResourceType:   resourceType,
+		ResourceID:     resourceID,
+		Changes:        changes,
+	}
+	return appendEntry(&entry)
+}
+
+// appendEntry links the entry to the previous one of its organization's chain and stores it
+func appendEntry(entry *models.AuditLog) error {
+	key := chainKey(entry.OrganizationID)
+	lock, _ := chainLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", int64(advisoryLockKey)<<32|int64(key)).Error; err != nil {
+				return err
+			}
+		}
+
+		var last models.AuditLog
+		result := chain(tx, entry.OrganizationID).Select("hash").Order("id DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		entry.PrevHash = last.Hash
+		entryHash, err := ComputeHash(entry)
+		if err != nil {
+			return err
+		}
+		entry.Hash = entryHash
+
+		return tx.Create(entry).Error
+	})
+}
+
+// ComputeHash returns the chain hash of an entry, covering its content and the previous hash
+func ComputeHash(entry *models.AuditLog) (string, error) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return "", err
+	}
+
+	actorID := ""
+	if entry.ActorID != nil {
+		actorID = strconv.FormatUint(uint64(*entry.ActorID), 10)
+	}
+
+	var h hash.Hash
+	if config.HMACKey != "" {
+		h = hmac.New(sha256.New, []byte(config.HMACKey))
+	} else {
+		h = sha256.New()
+	}
+
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%d\n%s\n%s\n",
+		entry.PrevHash,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		entry.ActorType,
+		actorID,
+		entry.Action,
+		entry.ResourceID,
+		entry.ResourceType,
+		entry.IP,
+	)
+	h.Write(changes)
+	// Entries written before multi-tenancy have no organization and hash as they did then
+	if entry.OrganizationID != nil {
+		fmt.Fprintf(h, "\norg:%d", *entry.OrganizationID)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyResult reports the outcome of a chain verification
+type VerifyResult struct {
+	Valid          bool   `json:"valid"`
+	EntriesChecked int64  `json:"entries_checked"`
+	FirstInvalidID *uint  `json:"first_invalid_id,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// Verify walks the chains of every organization and checks every link and hash
+func Verify() (*VerifyResult, error) {
+	return verify(db.GetDB())
+}
+
+// VerifyOrganization walks the chain of an organization and checks every link and hash
+func VerifyOrganization(orgID uint) (*VerifyResult, error) {
+	return verify(chain(db.GetDB(), &orgID))
+}
+
+// verify checks the links and hashes of the entries of the query, whole chains in id order
+func verify(query *gorm.DB) (*VerifyResult, error) {
+	result := &VerifyResult{Valid: true}
+	prevHashes := map[uint]string{} // Last hash of each chain
+
+	var batch []models.AuditLog
+	err := query.Order("id ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			result.EntriesChecked++
+			key := chainKey(entry.OrganizationID)
+			prevHash := prevHashes[key]
+
+			if entry.PrevHash != prevHash {
+				result.fail(entry.ID, "previous hash does not match the preceding entry of the organization")
+				return errStop
+			}
+
+			expected, err := ComputeHash(entry)
+			if err != nil {
+				return err
+			}
+			if !hmac.Equal([]byte(expected), []byte(entry.Hash)) {
+				result.fail(entry.ID, "entry content does not match its hash")
+				return errStop
+			}
+			prevHashes[key] = entry.Hash
+		}
+		return nil
+	}).Error
+	if err != nil && err != errStop {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+var errStop = fmt.Errorf("stop")
+
+func (v *VerifyResult) fail(id uint, reason string) {
+	v.Valid = false
+	v.FirstInvalidID = &id
+	v.Reason = reason
+}
+
+// Diff returns the fields that differ between two snapshots as {"field": {"old": x, "new": y}}
+func Diff(before, after interface{}) (models.JSONB, error) {
+	oldFields, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := models.JSONB{}
+	for key, oldValue := range oldFields {
+		newValue, ok := newFields[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = change(key, oldValue, newValue)
+		}
+	}
+	for key, newValue := range newFields {
+		if _, ok := oldFields[key]; !ok {
+			changes[key] = change(key, nil, newValue)
+		}
+	}
+	return changes, nil
+}
+
+func change(key string, oldValue, newValue interface{}) map[string]interface{} {
+	if redactedFields[key] {
+		if oldValue != nil {
+			oldValue = redacted
+		}
+		if newValue != nil {
+			newValue = redacted
+		}
+	}
+	return map[string]interface{}{"old": oldValue, "new": newValue}
+}
+
+// toMap converts a model to its JSON fields, dropping ignored ones
+func toMap(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key := range fields {
+		if ignoredFields[key] {
+			delete(fields, key)
+		}
+	}
+	return fields, nil
+}
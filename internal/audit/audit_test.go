@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"data-storage/internal/models"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.Device{ID: 1, Name: "Sensor", Location: "Room 1", AuthToken: "old-token"}
+	after := models.Device{ID: 1, Name: "Sensor", Location: "Room 2", AuthToken: "new-token"}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changed fields, got %v", changes)
+	}
+
+	location := changes["location"].(map[string]interface{})
+	if location["old"] != "Room 1" || location["new"] != "Room 2" {
+		t.Errorf("Unexpected location change: %v", location)
+	}
+
+	// Secrets are recorded as changed without their values
+	token := changes["auth_token"].(map[string]interface{})
+	if token["old"] != redacted || token["new"] != redacted {
+		t.Errorf("auth_token should be redacted, got %v", token)
+	}
+}
+
+func TestDiff_CreateAndDelete(t *testing.T) {
+	device := &models.Device{ID: 3, Name: "Sensor"}
+
+	created, err := Diff(nil, device)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if created["name"].(map[string]interface{})["old"] != nil {
+		t.Error("Created fields should have no old value")
+	}
+
+	deleted, err := Diff(device, nil)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if deleted["name"].(map[string]interface{})["new"] != nil {
+		t.Error("Deleted fields should have no new value")
+	}
+}
+
+func TestComputeHash_DetectsChanges(t *testing.T) {
+	actorID := uint(5)
+	entry := &models.AuditLog{
+		Timestamp:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		ActorType:    "user",
+		ActorID:      &actorID,
+		Action:       ActionUpdate,
+		ResourceType: "signal",
+		ResourceID:   9,
+		Changes:      models.JSONB{"max_value": map[string]interface{}{"old": 10.0, "new": 100.0}},
+		PrevHash:     "abc",
+	}
+
+	original, err := ComputeHash(entry)
+	if err != nil {
+		t.Fatalf("ComputeHash failed: %v", err)
+	}
+
+	entry.Changes = models.JSONB{"max_value": map[string]interface{}{"old": 10.0, "new": 50.0}}
+	tampered, _ := ComputeHash(entry)
+	if tampered == original {
+		t.Error("Changing the entry should change its hash")
+	}
+
+	entry.Changes = models.JSONB{"max_value": map[string]interface{}{"old": 10.0, "new": 100.0}}
+	entry.PrevHash = "abd"
+	relinked, _ := ComputeHash(entry)
+	if relinked == original {
+		t.Error("Changing the previous hash should change the hash")
+	}
+}
@@ -4,29 +4,51 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"log"
+	"net"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"data-storage/internal/apierror"
 	"data-storage/internal/db"
+	"data-storage/internal/logging"
+	"data-storage/internal/metrics"
 	"data-storage/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
-var jwtSecret []byte
+// DefaultJWTSecret signs tokens when no secret is configured. It is public, so the
+// configuration only accepts it in development mode.
+const DefaultJWTSecret = "your-secret-key-change-in-production"
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key-change-in-production"
-		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable in production!")
+// Config holds the token signing and client IP settings
+type Config struct {
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	// TrustProxyHeaders enables reading the client IP from X-Real-IP/X-Forwarded-For (set by nginx)
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS"`
+}
+
+func DefaultConfig() Config {
+	return Config{JWTSecret: DefaultJWTSecret}
+}
+
+var jwtSecret = []byte(DefaultJWTSecret)
+
+var logger = logging.Logger("auth")
+
+var trustProxyHeaders bool
+
+// Init sets the signing secret and proxy header handling. An empty secret falls back to
+// DefaultJWTSecret.
+func Init(cfg Config) {
+	if cfg.JWTSecret == "" {
+		cfg.JWTSecret = DefaultJWTSecret
 	}
-	jwtSecret = []byte(secret)
+	jwtSecret = []byte(cfg.JWTSecret)
+	trustProxyHeaders = cfg.TrustProxyHeaders
 }
 
 type Claims struct {
@@ -34,6 +56,7 @@ type Claims struct {
 	Email    string `json:"email"`
 	UserType string `json:"user_type"` // "user" or "device"
 	DeviceID uint   `json:"device_id,omitempty"`
+	OrgID    uint   `json:"org_id,omitempty"` // Active organization of a user token
 	jwt.RegisteredClaims
 }
 
@@ -47,13 +70,19 @@ func GenerateDeviceToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// GenerateJWT generates a JWT token for a user
+// GenerateJWT generates a JWT token for a user that is not bound to an organization
 func GenerateJWT(userID uint, email string) (string, error) {
+	return GenerateOrgJWT(userID, email, 0)
+}
+
+// GenerateOrgJWT generates a JWT token for a user acting in an organization
+func GenerateOrgJWT(userID uint, email string, orgID uint) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		UserID:   userID,
 		Email:    email,
 		UserType: "user",
+		OrgID:    orgID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -92,62 +121,96 @@ func AuthenticateDevice(authToken string) (*models.Device, error) {
 	return &device, nil
 }
 
+// ClientIP returns the IP address of the client that issued the request
+func ClientIP(r *http.Request) string {
+	if trustProxyHeaders {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			return realIP
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // Middleware: RequireUserAuth requires a valid JWT token
 func RequireUserAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMissingHeader)
+			apierror.Error(w, r, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMalformedHeader)
+			apierror.Error(w, r, "Invalid authorization header format", http.StatusUnauthorized)
 			return
 		}
 
 		claims, err := ValidateJWT(parts[1])
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthInvalidToken)
+			apierror.Error(w, r, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
 		if claims.UserType != "user" {
-			http.Error(w, "Invalid token type", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthInvalidToken)
+			apierror.Error(w, r, "Invalid token type", http.StatusUnauthorized)
 			return
 		}
 
 		// Store user info in request context (can be accessed in handlers)
 		r.Header.Set("X-User-ID", strconv.FormatUint(uint64(claims.UserID), 10))
 		r.Header.Set("X-User-Email", claims.Email)
+		r.Header.Set("X-Auth-Type", "user")
 
+		r, ok := withUserOrganization(w, r, claims)
+		if !ok {
+			return
+		}
 		next(w, r)
 	}
 }
 
-// Middleware: RequireDeviceAuth requires a valid device auth token
+// Middleware: RequireDeviceAuth requires a valid device auth token or client certificate
 func RequireDeviceAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if certificateAuth(w, r, next) {
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMissingHeader)
+			apierror.Error(w, r, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMalformedHeader)
+			apierror.Error(w, r, "Invalid authorization header format", http.StatusUnauthorized)
 			return
 		}
 
 		device, err := AuthenticateDevice(parts[1])
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
-				http.Error(w, "Invalid device token", http.StatusUnauthorized)
+				metrics.AuthFailed(metrics.AuthInvalidDeviceToken)
+				apierror.Error(w, r, "Invalid device token", http.StatusUnauthorized)
 			} else {
-				log.Printf("Error authenticating device: %v", err)
-				http.Error(w, "Authentication error", http.StatusInternalServerError)
+				logger.ErrorContext(r.Context(), "Error authenticating device", "error", err)
+				apierror.Error(w, r, "Authentication error", http.StatusInternalServerError)
 			}
 			return
 		}
@@ -157,23 +220,34 @@ func RequireDeviceAuth(next http.HandlerFunc) http.HandlerFunc {
 		if device.UserID != nil {
 			r.Header.Set("X-Device-User-ID", strconv.FormatUint(uint64(*device.UserID), 10))
 		}
+		r.Header.Set("X-Auth-Type", "device")
 
+		r, ok := withDeviceOrganization(w, r, device)
+		if !ok {
+			return
+		}
 		next(w, r)
 	}
 }
 
-// Middleware: RequireAnyAuth accepts either user JWT or device token
+// Middleware: RequireAnyAuth accepts a user JWT, a device token or a device client certificate
 func RequireAnyAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if certificateAuth(w, r, next) {
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMissingHeader)
+			apierror.Error(w, r, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			metrics.AuthFailed(metrics.AuthMalformedHeader)
+			apierror.Error(w, r, "Invalid authorization header format", http.StatusUnauthorized)
 			return
 		}
 
@@ -185,7 +259,9 @@ func RequireAnyAuth(next http.HandlerFunc) http.HandlerFunc {
 			r.Header.Set("X-User-ID", strconv.FormatUint(uint64(claims.UserID), 10))
 			r.Header.Set("X-User-Email", claims.Email)
 			r.Header.Set("X-Auth-Type", "user")
-			next(w, r)
+			if r, ok := withUserOrganization(w, r, claims); ok {
+				next(w, r)
+			}
 			return
 		}
 
@@ -197,11 +273,13 @@ func RequireAnyAuth(next http.HandlerFunc) http.HandlerFunc {
 				r.Header.Set("X-Device-User-ID", strconv.FormatUint(uint64(*device.UserID), 10))
 			}
 			r.Header.Set("X-Auth-Type", "device")
-			next(w, r)
+			if r, ok := withDeviceOrganization(w, r, device); ok {
+				next(w, r)
+			}
 			return
 		}
 
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		metrics.AuthFailed(metrics.AuthInvalidToken)
+		apierror.Error(w, r, "Invalid or expired token", http.StatusUnauthorized)
 	}
 }
-
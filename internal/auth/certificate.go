@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/db"
+	"data-storage/internal/metrics"
+	"data-storage/internal/models"
+	"data-storage/internal/pki"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCertificate is returned for client certificates that are unknown, revoked or
+// expired, or that belong to an inactive device
+var ErrInvalidCertificate = errors.New("invalid device certificate")
+
+// clientCertificate returns the TLS client certificate of the request, if it has one
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// AuthenticateDeviceCertificate returns the active device a registered, unrevoked client
+// certificate belongs to. The TLS handshake has already proven the client holds its key.
+func AuthenticateDeviceCertificate(cert *x509.Certificate) (*models.Device, error) {
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, ErrInvalidCertificate
+	}
+
+	var record models.DeviceCertificate
+	err := db.GetDB().Where("fingerprint = ? AND revoked_at IS NULL", pki.Fingerprint(cert)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCertificate
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var device models.Device
+	err = db.GetDB().Where("id = ? AND is_active = ?", record.DeviceID, true).First(&device).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCertificate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// certificateAuth authenticates a device by its TLS client certificate when the request has
+// no Authorization header, which takes precedence. It returns false, without writing a
+// response, when the request is not authenticated by certificate.
+func certificateAuth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) bool {
+	cert := clientCertificate(r)
+	if cert == nil || r.Header.Get("Authorization") != "" {
+		return false
+	}
+
+	device, err := AuthenticateDeviceCertificate(cert)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCertificate) {
+			metrics.AuthFailed(metrics.AuthInvalidDeviceCert)
+			apierror.Error(w, r, "Invalid device certificate", http.StatusUnauthorized)
+		} else {
+			logger.ErrorContext(r.Context(), "Error authenticating device certificate", "error", err)
+			apierror.Error(w, r, "Authentication error", http.StatusInternalServerError)
+		}
+		return true
+	}
+
+	r.Header.Set("X-Device-ID", strconv.FormatUint(uint64(device.ID), 10))
+	if device.UserID != nil {
+		r.Header.Set("X-Device-User-ID", strconv.FormatUint(uint64(*device.UserID), 10))
+	}
+	r.Header.Set("X-Auth-Type", "device")
+
+	if r, ok := withDeviceOrganization(w, r, device); ok {
+		next(w, r)
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+	"data-storage/internal/pki"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// issueCertificate returns a client certificate from a throwaway CA
+func issueCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	certPEM, keyPEM, err := pki.GenerateCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+	os.WriteFile(certFile, certPEM, 0o600)
+	os.WriteFile(keyFile, keyPEM, 0o600)
+	ca, err := pki.LoadCA(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := pki.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Issue("device", key.Public(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRequireAnyAuth_Certificate(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard, TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := database.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Setup(database); err != nil {
+		t.Fatal(err)
+	}
+
+	org := models.Organization{Name: "Plant", Slug: "plant"}
+	database.Create(&org)
+	device := models.Device{Name: "press-1", AuthToken: "token", IsActive: true, OrganizationID: &org.ID}
+	database.Create(&device)
+	cert := issueCertificate(t)
+	record := models.DeviceCertificate{DeviceID: device.ID, OrganizationID: &org.ID, Fingerprint: pki.Fingerprint(cert)}
+	database.Create(&record)
+
+	var seen string
+	handler := RequireAnyAuth(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("X-Device-ID") + "/" + r.Header.Get("X-Org-ID")
+	})
+	call := func(cert *x509.Certificate, authorization string) int {
+		req := httptest.NewRequest("POST", "/signal-values", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		seen = ""
+		handler(w, req)
+		return w.Code
+	}
+
+	if code := call(cert, ""); code != http.StatusOK || seen != fmt.Sprintf("%d/%d", device.ID, org.ID) {
+		t.Errorf("Expected the registered certificate to authenticate device %d of org %d, got %d %q", device.ID, org.ID, code, seen)
+	}
+	if code := call(issueCertificate(t), ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown certificate to be rejected, got %d", code)
+	}
+	// The Authorization header takes precedence over the certificate
+	if code := call(cert, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected the invalid token to be checked, got %d", code)
+	}
+	if code := call(nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a request without credentials to be rejected, got %d", code)
+	}
+
+	// Revoked certificates and disabled devices are rejected
+	now := time.Now()
+	database.Model(&record).Update("revoked_at", &now)
+	if code := call(cert, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked certificate to be rejected, got %d", code)
+	}
+	database.Model(&record).Update("revoked_at", nil)
+	database.Model(&device).Update("is_active", false)
+	if code := call(cert, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected the certificate of a disabled device to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"data-storage/internal/background"
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// LockoutConfig controls progressive lockout after failed logins. Once the
+// threshold is reached, every further failure doubles the lockout duration,
+// starting at BaseDuration and capped at MaxDuration.
+type LockoutConfig struct {
+	AccountThreshold int           `yaml:"account_threshold" env:"LOGIN_LOCKOUT_THRESHOLD"`
+	IPThreshold      int           `yaml:"ip_threshold" env:"LOGIN_IP_LOCKOUT_THRESHOLD"`
+	BaseDuration     time.Duration `yaml:"base_duration" env:"LOGIN_LOCKOUT_BASE"`
+	MaxDuration      time.Duration `yaml:"max_duration" env:"LOGIN_LOCKOUT_MAX"`
+	// FailureWindow is how long failures from an IP, or for an email without an account, are
+	// remembered without a new one
+	FailureWindow time.Duration `yaml:"failure_window" env:"LOGIN_LOCKOUT_WINDOW"`
+}
+
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		AccountThreshold: 5,
+		IPThreshold:      20,
+		BaseDuration:     time.Minute,
+		MaxDuration:      time.Hour,
+		FailureWindow:    time.Hour,
+	}
+}
+
+var lockoutConfig = DefaultLockoutConfig()
+
+// InitLockout sets the lockout configuration and clears tracked IP and unknown account failures
+func InitLockout(cfg LockoutConfig) {
+	lockoutConfig = cfg
+	ipFailures.reset()
+	unknownAccounts.reset()
+}
+
+// lockoutDuration returns how long to lock after the given number of consecutive failures
+func lockoutDuration(failures int, threshold int, cfg LockoutConfig) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := cfg.BaseDuration
+	for i := threshold; i < failures && d < cfg.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxDuration {
+		d = cfg.MaxDuration
+	}
+	return d
+}
+
+// AccountLockedFor returns how long the account stays locked, or 0 if it is not locked
+func AccountLockedFor(user *models.User, now time.Time) time.Duration {
+	if user.LockedUntil == nil || !user.LockedUntil.After(now) {
+		return 0
+	}
+	return user.LockedUntil.Sub(now)
+}
+
+// RecordAccountFailure counts a failed login for the user and locks the account once
+// the threshold is reached. The counter is incremented in the database, so concurrent
+// failures are all counted, and a lockout never shortens one set by a later failure.
+func RecordAccountFailure(user *models.User, now time.Time) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var failures int
+		err := tx.Raw("UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ? RETURNING failed_login_attempts", user.ID).
+			Scan(&failures).Error
+		if err != nil {
+			return err
+		}
+		user.FailedLoginAttempts = failures
+		d := lockoutDuration(failures, lockoutConfig.AccountThreshold, lockoutConfig)
+		if d == 0 {
+			return nil
+		}
+		lockedUntil := now.Add(d)
+		user.LockedUntil = &lockedUntil
+		return tx.Model(&models.User{}).Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", user.ID, lockedUntil).
+			Update("locked_until", lockedUntil).Error
+	})
+}
+
+// dummyHash is compared with the password of logins for unknown accounts
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// CheckUnknownAccountPassword spends the time of a password check on a login for an
+// unknown account, so its response time does not reveal that the account does not exist
+func CheckUnknownAccountPassword(password string) {
+	bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+}
+
+// UnknownAccountLockedFor returns how long logins for an email without an account stay
+// locked, or 0. Unknown accounts lock like real ones, so lockouts do not reveal which
+// emails have an account.
+func UnknownAccountLockedFor(email string, now time.Time) time.Duration {
+	return unknownAccounts.lockedFor(email, now)
+}
+
+// RecordUnknownAccountFailure counts a failed login for an email without an account
+func RecordUnknownAccountFailure(email string, now time.Time) {
+	unknownAccounts.record(email, now, lockoutConfig.AccountThreshold)
+}
+
+// RecordAccountSuccess clears the user's failed login counter
+func RecordAccountSuccess(user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+	return db.GetDB().Model(user).Select("failed_login_attempts", "locked_until").Updates(user).Error
+}
+
+type trackedFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// failureTracker keeps failed login counts per key in memory
+type failureTracker struct {
+	mu      sync.Mutex
+	entries map[string]*trackedFailure
+}
+
+var (
+	ipFailures      = &failureTracker{entries: make(map[string]*trackedFailure)} // Per client IP
+	unknownAccounts = &failureTracker{entries: make(map[string]*trackedFailure)} // Per email without an account
+)
+
+func (t *failureTracker) reset() {
+	t.mu.Lock()
+	t.entries = make(map[string]*trackedFailure)
+	t.mu.Unlock()
+}
+
+func (t *failureTracker) lockedFor(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok || !entry.lockedUntil.After(now) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+func (t *failureTracker) record(key string, now time.Time, threshold int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > lockoutConfig.FailureWindow {
+		entry = &trackedFailure{}
+		t.entries[key] = entry
+	}
+	entry.count++
+	entry.lastFailure = now
+	if d := lockoutDuration(entry.count, threshold, lockoutConfig); d > 0 {
+		entry.lockedUntil = now.Add(d)
+	}
+}
+
+// cleanup drops the entries whose failures and lockouts have expired
+func (t *failureTracker) cleanup(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, entry := range t.entries {
+		if now.Sub(entry.lastFailure) > lockoutConfig.FailureWindow && !entry.lockedUntil.After(now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// IPLockedFor returns how long the IP stays locked, or 0 if it is not locked
+func IPLockedFor(ip string, now time.Time) time.Duration {
+	return ipFailures.lockedFor(ip, now)
+}
+
+// RecordIPFailure counts a failed login from the IP
+func RecordIPFailure(ip string, now time.Time) {
+	ipFailures.record(ip, now, lockoutConfig.IPThreshold)
+}
+
+// CleanupIPFailures drops IP and unknown account entries whose failures and lockouts have
+// expired
+func CleanupIPFailures(now time.Time) {
+	ipFailures.cleanup(now)
+	unknownAccounts.cleanup(now)
+}
+
+// StartLockoutCleanup periodically drops expired IP and unknown account entries until shutdown
+func StartLockoutCleanup(interval time.Duration) {
+	background.Every(interval, CleanupIPFailures)
+}
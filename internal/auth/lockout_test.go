@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestRecordAccountFailure_Concurrent(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard, TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := database.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Setup(database); err != nil {
+		t.Fatal(err)
+	}
+	InitLockout(LockoutConfig{AccountThreshold: 5, BaseDuration: time.Minute, MaxDuration: time.Hour, FailureWindow: time.Hour})
+	t.Cleanup(func() { InitLockout(DefaultLockoutConfig()) })
+
+	user := models.User{Name: "Admin", Email: "admin@example.com"}
+	database.Create(&user)
+
+	// Parallel guesses each read the user before any failure was recorded
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stale := user
+			if err := RecordAccountFailure(&stale, now); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var stored models.User
+	database.First(&stored, user.ID)
+	if stored.FailedLoginAttempts != 8 {
+		t.Errorf("Expected every failure to be counted, got %d", stored.FailedLoginAttempts)
+	}
+	// The eighth failure locks for 2^3 minutes, whatever order the lockouts were written in
+	if wait := AccountLockedFor(&stored, now); wait != 8*time.Minute {
+		t.Errorf("Expected an 8 minute lockout, got %v", wait)
+	}
+}
+
+func TestUnknownAccountLockout(t *testing.T) {
+	InitLockout(LockoutConfig{AccountThreshold: 2, BaseDuration: time.Minute, MaxDuration: time.Hour, FailureWindow: time.Hour})
+	t.Cleanup(func() { InitLockout(DefaultLockoutConfig()) })
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	RecordUnknownAccountFailure("nobody@example.com", now)
+	if UnknownAccountLockedFor("nobody@example.com", now) != 0 {
+		t.Error("Unknown account should not be locked below threshold")
+	}
+	RecordUnknownAccountFailure("nobody@example.com", now)
+	if UnknownAccountLockedFor("nobody@example.com", now) != time.Minute {
+		t.Error("Unknown account should be locked for one minute at threshold, like a real one")
+	}
+	if UnknownAccountLockedFor("other@example.com", now) != 0 {
+		t.Error("Other emails should not be locked")
+	}
+
+	CleanupIPFailures(now.Add(2 * time.Hour))
+	if len(unknownAccounts.entries) != 0 {
+		t.Error("Expired unknown account entries should be cleaned up")
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/db"
+	"data-storage/internal/logging"
+	"data-storage/internal/metrics"
+	"data-storage/internal/models"
+	"data-storage/internal/tenant"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoMembership is returned when a user does not belong to the requested organization
+var ErrNoMembership = errors.New("user is not a member of the organization")
+
+// FindMembership returns the user's membership in an active organization. When orgID is 0
+// the membership in the user's oldest organization is returned.
+func FindMembership(userID, orgID uint) (*models.Membership, error) {
+	query := db.GetDB().Preload("Organization").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id").
+		Where("memberships.user_id = ? AND organizations.is_active = ?", userID, true)
+	if orgID != 0 {
+		query = query.Where("memberships.organization_id = ?", orgID)
+	}
+
+	var membership models.Membership
+	if err := query.Order("memberships.organization_id ASC").First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoMembership
+		}
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// readOnlyMethods are the methods viewers may use
+var readOnlyMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// viewerWritablePaths act on the user's own account or memberships rather than on
+// organization data, so viewers may call them with any method. Routes below /orgs/
+// check the caller's role in the addressed organization themselves.
+var viewerWritablePaths = map[string]bool{
+	"/auth/change-password": true,
+	"/auth/switch-org":      true,
+	"/orgs":                 true,
+}
+
+func viewerMayWrite(path string) bool {
+	return viewerWritablePaths[path] || strings.HasPrefix(path, "/orgs/")
+}
+
+// withUserOrganization checks the user is still active and belongs to the token's organization,
+// and scopes the request to it. The role is read from the membership so changes apply immediately.
+func withUserOrganization(w http.ResponseWriter, r *http.Request, claims *Claims) (*http.Request, bool) {
+	if claims.OrgID == 0 {
+		metrics.AuthFailed(metrics.AuthNoOrganization)
+		apierror.Error(w, r, "Token is not bound to an organization, please log in again", http.StatusUnauthorized)
+		return r, false
+	}
+
+	// Deactivated users lose access at once rather than when their token expires
+	var active int64
+	if err := db.GetDB().Model(&models.User{}).Where("id = ? AND is_active = ?", claims.UserID, true).Count(&active).Error; err != nil {
+		logger.ErrorContext(r.Context(), "Error loading user", "error", err)
+		apierror.Error(w, r, "Authentication error", http.StatusInternalServerError)
+		return r, false
+	}
+	if active == 0 {
+		metrics.AuthFailed(metrics.AuthInactiveUser)
+		apierror.Error(w, r, "User is inactive", http.StatusUnauthorized)
+		return r, false
+	}
+
+	membership, err := FindMembership(claims.UserID, claims.OrgID)
+	if err != nil {
+		if errors.Is(err, ErrNoMembership) {
+			metrics.AuthFailed(metrics.AuthNoOrganization)
+			apierror.Error(w, r, "Not a member of this organization", http.StatusForbidden)
+		} else {
+			logger.ErrorContext(r.Context(), "Error loading membership", "error", err)
+			apierror.Error(w, r, "Authentication error", http.StatusInternalServerError)
+		}
+		return r, false
+	}
+
+	if membership.Role == models.RoleViewer && !readOnlyMethods[r.Method] && !viewerMayWrite(r.URL.Path) {
+		apierror.Error(w, r, "Viewers have read-only access", http.StatusForbidden)
+		return r, false
+	}
+
+	r.Header.Set("X-Org-ID", strconv.FormatUint(uint64(membership.OrganizationID), 10))
+	r.Header.Set("X-Org-Role", membership.Role)
+	logging.AddAttrs(r.Context(),
+		slog.String("auth_type", "user"),
+		slog.Uint64("user_id", uint64(claims.UserID)),
+		slog.Uint64("org_id", uint64(membership.OrganizationID)),
+	)
+	return r.WithContext(tenant.WithOrganization(r.Context(), membership.OrganizationID)), true
+}
+
+// withDeviceOrganization scopes the request to the device's organization
+func withDeviceOrganization(w http.ResponseWriter, r *http.Request, device *models.Device) (*http.Request, bool) {
+	if device.OrganizationID == nil {
+		metrics.AuthFailed(metrics.AuthNoOrganization)
+		apierror.Error(w, r, "Device is not assigned to an organization", http.StatusForbidden)
+		return r, false
+	}
+
+	r.Header.Set("X-Org-ID", strconv.FormatUint(uint64(*device.OrganizationID), 10))
+	r.Header.Del("X-Org-Role")
+	logging.AddAttrs(r.Context(),
+		slog.String("auth_type", "device"),
+		slog.Uint64("device_id", uint64(device.ID)),
+		slog.Uint64("org_id", uint64(*device.OrganizationID)),
+	)
+	return r.WithContext(tenant.WithOrganization(r.Context(), *device.OrganizationID)), true
+}
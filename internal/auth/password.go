@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // SHA-1 is only used to match the breached password list format
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes the rules a new password has to satisfy
+type PasswordPolicy struct {
+	MinLength     int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength     int    `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"` // bcrypt ignores everything past 72 bytes
+	RequireLetter bool   `yaml:"require_letter" env:"PASSWORD_REQUIRE_LETTER"`
+	RequireDigit  bool   `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	BreachedList  string `yaml:"breached_list" env:"PASSWORD_BREACHED_LIST"` // Path to a file with one breached password or SHA-1 hash per line
+
+	breached map[string]struct{} // Upper-case SHA-1 hex digests
+}
+
+// PasswordPolicyError lists every rule a password violated
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+var passwordPolicy = DefaultPasswordPolicy()
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MaxLength: 72}
+}
+
+// InitPasswordPolicy activates the policy, loading the breached password list if configured
+func InitPasswordPolicy(policy PasswordPolicy) error {
+	if policy.BreachedList != "" {
+		breached, err := loadBreachedList(policy.BreachedList)
+		if err != nil {
+			return fmt.Errorf("error loading breached password list: %w", err)
+		}
+		policy.breached = breached
+	}
+	passwordPolicy = policy
+	return nil
+}
+
+// loadBreachedList reads a file containing either plain passwords or SHA-1 hashes
+// (optionally in the "HASH:count" format used by Have I Been Pwned)
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	return breached, scanner.Err()
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s)) //nolint:gosec // see import comment
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Validate checks the password against the policy and returns a *PasswordPolicyError
+// describing all violations
+func (p PasswordPolicy) Validate(password string) error {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	if p.RequireLetter && !hasLetter {
+		violations = append(violations, "must contain a letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+
+	if p.breached != nil && password != "" {
+		if _, found := p.breached[sha1Hex(password)]; found {
+			violations = append(violations, "appears in a list of breached passwords")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// ValidatePassword checks the password against the active policy
+func ValidatePassword(password string) error {
+	return passwordPolicy.Validate(password)
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 72, RequireLetter: true, RequireDigit: true}
+
+	if err := policy.Validate("correct1horse"); err != nil {
+		t.Errorf("Valid password rejected: %v", err)
+	}
+
+	err := policy.Validate("")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Expected PasswordPolicyError, got %v", err)
+	}
+	// Length, letter and digit are all reported at once
+	if len(policyErr.Violations) != 3 {
+		t.Errorf("Expected 3 violations, got %v", policyErr.Violations)
+	}
+}
+
+func TestPasswordPolicy_BreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// Plain password plus the SHA-1 of "letmein123" in HIBP format
+	content := "# common passwords\npassword123\n" + sha1Hex("letmein123") + ":7\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	policy := PasswordPolicy{MinLength: 8, BreachedList: path}
+	breached, err := loadBreachedList(path)
+	if err != nil {
+		t.Fatalf("loadBreachedList failed: %v", err)
+	}
+	policy.breached = breached
+
+	for _, pw := range []string{"password123", "letmein123"} {
+		if err := policy.Validate(pw); err == nil {
+			t.Errorf("Breached password %q should be rejected", pw)
+		}
+	}
+	if err := policy.Validate("a-much-better-passphrase"); err != nil {
+		t.Errorf("Unlisted password rejected: %v", err)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	cfg := LockoutConfig{BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.failures, 5, cfg); got != tt.expected {
+			t.Errorf("lockoutDuration(%d) = %v, expected %v", tt.failures, got, tt.expected)
+		}
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	InitLockout(LockoutConfig{IPThreshold: 3, BaseDuration: time.Minute, MaxDuration: time.Hour, FailureWindow: time.Hour})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		RecordIPFailure("10.0.0.1", now)
+	}
+	if IPLockedFor("10.0.0.1", now) != 0 {
+		t.Error("IP should not be locked below threshold")
+	}
+
+	RecordIPFailure("10.0.0.1", now)
+	if IPLockedFor("10.0.0.1", now) != time.Minute {
+		t.Error("IP should be locked for one minute at threshold")
+	}
+	if IPLockedFor("10.0.0.1", now.Add(2*time.Minute)) != 0 {
+		t.Error("Lock should expire")
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ResetConfig controls password reset tokens
+type ResetConfig struct {
+	TTL time.Duration `yaml:"ttl" env:"PASSWORD_RESET_TTL"`
+	// URL is the reset page link sent to users; "{token}" is replaced with the token.
+	// When empty only the token itself is sent.
+	URL string `yaml:"url" env:"PASSWORD_RESET_URL"`
+}
+
+func DefaultResetConfig() ResetConfig {
+	return ResetConfig{TTL: time.Hour}
+}
+
+var resetConfig = DefaultResetConfig()
+
+// InitReset sets the password reset configuration
+func InitReset(cfg ResetConfig) {
+	resetConfig = cfg
+}
+
+// HashToken returns the SHA-256 hex digest of a token so it can be stored safely
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResetLink returns what is sent to the user to reset their password
+func ResetLink(token string) string {
+	if resetConfig.URL == "" {
+		return token
+	}
+	if strings.Contains(resetConfig.URL, "{token}") {
+		return strings.ReplaceAll(resetConfig.URL, "{token}", token)
+	}
+	return resetConfig.URL + token
+}
+
+// CreatePasswordReset issues a new reset token for the user, invalidating older ones.
+// Only the hash is stored; the returned token must be delivered to the user.
+func CreatePasswordReset(user *models.User, requestIP string, now time.Time) (string, error) {
+	token, err := GenerateDeviceToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Only the most recent token stays valid
+		err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: HashToken(token),
+			ExpiresAt: now.Add(resetConfig.TTL),
+			RequestIP: requestIP,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumePasswordReset sets a new password for the token's user and marks the token as used.
+// The password must already satisfy the password policy.
+func ConsumePasswordReset(token, newPassword string, now time.Time) (*models.User, error) {
+	var user models.User
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Claim the token atomically so it cannot be used twice concurrently
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		var resetToken models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", HashToken(token)).First(&resetToken).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("is_active = ?", true).First(&user, resetToken.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+
+		if err := user.SetPassword(newPassword); err != nil {
+			return err
+		}
+		// A successful reset also lifts any lockout
+		user.FailedLoginAttempts = 0
+		user.LockedUntil = nil
+
+		return tx.Model(&user).Select("password_hash", "failed_login_attempts", "locked_until").Updates(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,69 @@
+package background
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	wg sync.WaitGroup
+
+	// ctx is cancelled when shutdown starts; long-running workers return when it is done
+	ctx, cancel = context.WithCancel(context.Background())
+)
+
+// Context returns the context cancelled at shutdown
+func Context() context.Context {
+	return ctx
+}
+
+// Go runs fn in a goroutine that shutdown waits for
+func Go(fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Background task panicked", "panic", r)
+			}
+		}()
+		fn()
+	}()
+}
+
+// Every runs fn at the given interval until shutdown
+func Every(interval time.Duration, fn func(now time.Time)) {
+	Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	})
+}
+
+// Shutdown stops periodic workers and waits for all tasks to finish, or until the
+// deadline of waitCtx. Tasks still running at the deadline are abandoned.
+func Shutdown(waitCtx context.Context) error {
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-waitCtx.Done():
+		return waitCtx.Err()
+	}
+}
@@ -0,0 +1,47 @@
+package background
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Shutdown cancels the package context, so everything runs in a single test
+func TestShutdown(t *testing.T) {
+	var ticks atomic.Int32
+	Every(time.Millisecond, func(time.Time) { ticks.Add(1) })
+
+	var finished atomic.Bool
+	Go(func() {
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+	Go(func() { panic("boom") })
+
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("Expected workers to finish, got %v", err)
+	}
+	if !finished.Load() {
+		t.Error("Shutdown returned before the task finished")
+	}
+	if ticks.Load() == 0 {
+		t.Error("Periodic worker never ran")
+	}
+	if Context().Err() == nil {
+		t.Error("Expected the background context to be cancelled")
+	}
+
+	// Tasks still running at the deadline are abandoned
+	release := make(chan struct{})
+	defer close(release)
+	Go(func() { <-release })
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
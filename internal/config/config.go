@@ -0,0 +1,232 @@
+// Package config loads the settings of the API from defaults, an optional YAML file and
+// environment variables, in increasing order of precedence, and validates them at startup.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"data-storage/internal/attendance"
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/db"
+	"data-storage/internal/logging"
+	"data-storage/internal/metrics"
+	"data-storage/internal/notify"
+	"data-storage/internal/pki"
+	"data-storage/internal/ratelimit"
+	"data-storage/internal/tenant"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Config is the complete configuration. The yaml tags name the keys of the config file,
+// the env tags the environment variables overriding them.
+type Config struct {
+	// Env is "development" or "production"; development allows insecure defaults
+	Env string `yaml:"env" env:"APP_ENV"`
+
+	Server        ServerConfig        `yaml:"server"`
+	Database      db.Config           `yaml:"database"`
+	Auth          auth.Config         `yaml:"auth"`
+	Lockout       auth.LockoutConfig  `yaml:"lockout"`
+	Password      auth.PasswordPolicy `yaml:"password"`
+	PasswordReset auth.ResetConfig    `yaml:"password_reset"`
+	RateLimit     ratelimit.Config    `yaml:"rate_limit"`
+	Audit         audit.Config        `yaml:"audit"`
+	Organizations tenant.Config       `yaml:"organizations"`
+	Notifier      notify.Config       `yaml:"notifier"`
+	Logging       logging.Config      `yaml:"logging"`
+	Metrics       metrics.Config      `yaml:"metrics"`
+	DeviceCA      pki.Config          `yaml:"device_ca"`
+	Attendance    attendance.Config   `yaml:"attendance"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port string `yaml:"port" env:"PORT"`
+
+	// Timeouts of the http.Server; 0 disables a timeout
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+
+	// ShutdownDrainDelay is the time between failing /readyz and closing the listener
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+	// ShutdownTimeout bounds the wait for in-flight requests and background work
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+
+	CORS CORSConfig `yaml:"cors"`
+	TLS  TLSConfig  `yaml:"tls"`
+}
+
+// TLSConfig serves HTTPS directly instead of behind a TLS-terminating proxy
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+	// ClientCertificates asks clients for a certificate, so devices can authenticate with a
+	// registered one instead of a token
+	ClientCertificates bool   `yaml:"client_certificates" env:"TLS_CLIENT_CERTIFICATES"`
+	MinVersion         string `yaml:"min_version" env:"TLS_MIN_VERSION"` // "1.2" or "1.3"
+}
+
+// Enabled reports whether the server serves TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Version returns the tls package constant of MinVersion
+func (t TLSConfig) Version() uint16 {
+	if t.MinVersion == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // "*" allows any origin
+	AllowCredentials bool     `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           int      `yaml:"max_age" env:"CORS_MAX_AGE"` // Seconds browsers may cache preflight responses
+	Debug            bool     `yaml:"debug" env:"CORS_DEBUG"`     // Log every CORS decision
+}
+
+// Default returns the configuration used when nothing is set
+func Default() Config {
+	return Config{
+		Env: EnvProduction,
+		Server: ServerConfig{
+			Port:              "8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			CORS:              CORSConfig{AllowedOrigins: []string{"*"}},
+			TLS:               TLSConfig{ClientCertificates: true, MinVersion: "1.2"},
+		},
+		Database:      db.DefaultConfig(),
+		Auth:          auth.DefaultConfig(),
+		Lockout:       auth.DefaultLockoutConfig(),
+		Password:      auth.DefaultPasswordPolicy(),
+		PasswordReset: auth.DefaultResetConfig(),
+		RateLimit:     ratelimit.DefaultConfig(),
+		Audit:         audit.DefaultConfig(),
+		Organizations: tenant.DefaultConfig(),
+		Notifier:      notify.DefaultConfig(),
+		Logging:       logging.DefaultConfig(),
+		DeviceCA:      pki.DefaultConfig(),
+		Attendance:    attendance.DefaultConfig(),
+	}
+}
+
+// Load reads the configuration file at path, or at CONFIG_FILE when path is empty, over the
+// defaults and applies the environment variables. It does not validate the result.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error reading config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Development reports whether insecure defaults are allowed
+func (c Config) Development() bool {
+	return c.Env == EnvDevelopment
+}
+
+// Validate returns every invalid setting, joined
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvDevelopment || c.Env == EnvProduction, "env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env)
+	insecureSecret := c.Auth.JWTSecret == "" || c.Auth.JWTSecret == auth.DefaultJWTSecret
+	check(c.Development() || !insecureSecret, "auth.jwt_secret (JWT_SECRET) must be set outside development")
+
+	s := c.Server
+	check(s.Port != "", "server.port must be set")
+	check(s.ReadHeaderTimeout >= 0 && s.ReadTimeout >= 0 && s.WriteTimeout >= 0 && s.IdleTimeout >= 0,
+		"server timeouts must not be negative")
+	check(s.ShutdownDrainDelay >= 0, "server.shutdown_drain_delay must not be negative")
+	check(s.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(len(s.CORS.AllowedOrigins) > 0, "server.cors.allowed_origins must not be empty")
+	check(!s.CORS.AllowCredentials || !slices.Contains(s.CORS.AllowedOrigins, "*"),
+		"server.cors.allow_credentials cannot be combined with the \"*\" origin")
+	check(s.CORS.MaxAge >= 0, "server.cors.max_age must not be negative")
+	check((s.TLS.CertFile == "") == (s.TLS.KeyFile == ""), "server.tls.cert_file and server.tls.key_file must be set together")
+	check(s.TLS.MinVersion == "1.2" || s.TLS.MinVersion == "1.3", "server.tls.min_version must be \"1.2\" or \"1.3\", got %q", s.TLS.MinVersion)
+
+	d := c.Database
+	check(d.Port > 0 && d.Port <= 65535, "database.port must be between 1 and 65535, got %d", d.Port)
+	check(slices.Contains(db.SSLModes, d.SSLMode), "database.sslmode must be one of %v, got %q", db.SSLModes, d.SSLMode)
+	check(d.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(d.MaxOpenConns >= 0 && d.MaxIdleConns >= 0, "database pool sizes must not be negative")
+	check(d.ConnMaxLifetime >= 0 && d.ConnMaxIdleTime >= 0, "database connection lifetimes must not be negative")
+
+	l := c.Lockout
+	check(l.AccountThreshold > 0 && l.IPThreshold > 0, "lockout thresholds must be positive")
+	check(l.BaseDuration > 0 && l.MaxDuration >= l.BaseDuration,
+		"lockout.base_duration must be positive and at most lockout.max_duration")
+	check(l.FailureWindow > 0, "lockout.failure_window must be positive")
+
+	p := c.Password
+	check(p.MinLength >= 1, "password.min_length must be at least 1")
+	check(p.MaxLength <= 72, "password.max_length must be at most 72, the bcrypt limit")
+	check(p.MinLength <= p.MaxLength, "password.min_length must not exceed password.max_length")
+	check(c.PasswordReset.TTL > 0, "password_reset.ttl must be positive")
+	check(c.Organizations.InvitationTTL > 0, "organizations.invitation_ttl must be positive")
+
+	r := c.RateLimit
+	check(r.DevicePerMinute >= 0 && r.UserPerMinute >= 0 && r.IPPerMinute >= 0 && r.LoginPerMinute >= 0 && r.DeviceDailyQuota >= 0,
+		"rate limits must not be negative")
+
+	n := c.Notifier
+	check(n.Driver == "log" || n.Driver == "smtp", "notifier.driver must be \"log\" or \"smtp\", got %q", n.Driver)
+	check(n.Driver != "smtp" || (n.SMTPHost != "" && n.From != ""), "the smtp notifier needs notifier.smtp_host and notifier.from")
+	check(c.Development() || n.Driver != "log", "notifier.driver \"log\" writes reset links to the logs and is only allowed in development")
+
+	check(c.Logging.Format == "json" || c.Logging.Format == "text", "logging.format must be \"json\" or \"text\", got %q", c.Logging.Format)
+	check(c.Logging.SlowQueryThreshold >= 0, "logging.slow_query_threshold must not be negative")
+
+	check((c.DeviceCA.CertFile == "") == (c.DeviceCA.KeyFile == ""), "device_ca.cert_file and device_ca.key_file must be set together")
+	check(c.DeviceCA.Validity > 0, "device_ca.validity must be positive")
+	check(c.Attendance.SessionTimeout > 0, "attendance.session_timeout must be positive")
+
+	return errors.Join(errs...)
+}
+
+// YAML returns the configuration in the config file format, with secrets redacted
+func (c Config) YAML() ([]byte, error) {
+	redacted := c
+	redact(&redacted)
+	return yaml.Marshal(redacted)
+}
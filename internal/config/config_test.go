@@ -0,0 +1,155 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+env: development
+server:
+  port: "9000"
+  write_timeout: 1m
+  cors:
+    allowed_origins: [https://app.example.com]
+database:
+  host: db.internal
+  sslmode: verify-full
+  max_open_conns: 20
+logging:
+  level: warn
+  levels:
+    db: error
+`)
+	t.Setenv("PORT", "9100")
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("LOG_LEVELS", "db=debug, http=error")
+	t.Setenv("DB_SLOW_QUERY_THRESHOLD", "50ms")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading configuration: %v", err)
+	}
+	if cfg.Env != EnvDevelopment || cfg.Server.Port != "9100" || cfg.Server.WriteTimeout != time.Minute {
+		t.Errorf("Expected the file with the port from the environment, got %+v", cfg.Server)
+	}
+	if cfg.Server.ReadHeaderTimeout != 10*time.Second || cfg.Server.ShutdownTimeout != 30*time.Second {
+		t.Errorf("Expected unset values to keep their defaults, got %+v", cfg.Server)
+	}
+	if got := cfg.Server.CORS.AllowedOrigins; len(got) != 2 || got[1] != "https://b.example.com" {
+		t.Errorf("Unexpected CORS origins: %v", got)
+	}
+	if cfg.Database.Host != "db.internal" || cfg.Database.SSLMode != "verify-full" || cfg.Database.Port != 5432 {
+		t.Errorf("Unexpected database configuration: %+v", cfg.Database)
+	}
+	if cfg.Database.MaxOpenConns != 20 {
+		t.Errorf("Expected an empty variable to be ignored, got %d open connections", cfg.Database.MaxOpenConns)
+	}
+	if cfg.Logging.Level != slog.LevelWarn {
+		t.Errorf("Expected the file's log level, got %v", cfg.Logging.Level)
+	}
+	if cfg.Logging.Levels["db"] != slog.LevelDebug || cfg.Logging.Levels["http"] != slog.LevelError || len(cfg.Logging.Levels) != 2 {
+		t.Errorf("Expected the environment to replace subsystem levels, got %v", cfg.Logging.Levels)
+	}
+	if cfg.Logging.SlowQueryThreshold != 50*time.Millisecond {
+		t.Errorf("Expected 50ms slow query threshold, got %v", cfg.Logging.SlowQueryThreshold)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	if _, err := Load(writeFile(t, "server:\n  prot: 80\n")); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("Expected an unknown key to be rejected, got %v", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected a missing file to be rejected")
+	}
+
+	t.Setenv("DB_PORT", "five")
+	t.Setenv("LOG_LEVELS", "db")
+	_, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), "DB_PORT") || !strings.Contains(err.Error(), "LOG_LEVELS") {
+		t.Errorf("Expected both invalid variables to be reported, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// The default secret is only accepted in development
+	cfg := Default()
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "jwt_secret") {
+		t.Errorf("Expected the default JWT secret to be refused, got %v", err)
+	}
+	cfg.Env = EnvDevelopment
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid in development, got %v", err)
+	}
+
+	cfg = Default()
+	cfg.Auth.JWTSecret = "a-real-secret"
+	cfg.Server.CORS.AllowCredentials = true
+	cfg.Database.SSLMode = "on"
+	cfg.Password.MaxLength = 100
+	err := cfg.Validate()
+	for _, want := range []string{"allow_credentials", "sslmode", "max_length", "notifier.driver"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected a %s error, got %v", want, err)
+		}
+	}
+}
+
+func TestValidate_ProductionNotifier(t *testing.T) {
+	cfg := Default()
+	cfg.Env = EnvProduction
+	cfg.Auth.JWTSecret = "a-real-secret"
+	cfg.Notifier.Driver = "smtp"
+	cfg.Notifier.SMTPHost = "smtp.example.com"
+	cfg.Notifier.From = "noreply@example.com"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the smtp notifier to be valid in production, got %v", err)
+	}
+}
+
+func TestYAML_RedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = "jwt-secret"
+	cfg.Database.Password = "db-password"
+	cfg.Notifier.SMTPPassword = "smtp-password"
+
+	out, err := cfg.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"jwt-secret", "db-password", "smtp-password"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("Expected %s to be redacted:\n%s", secret, out)
+		}
+	}
+	if cfg.Auth.JWTSecret != "jwt-secret" {
+		t.Error("Expected the configuration itself to keep its secrets")
+	}
+
+	// The printed configuration loads back, apart from the secrets
+	var loaded Config
+	if err := yaml.Unmarshal(out, &loaded); err != nil {
+		t.Fatalf("Error loading printed configuration: %v", err)
+	}
+	if loaded.Database.Password != redactedValue || loaded.Metrics.Token != "" || loaded.Lockout.BaseDuration != time.Minute {
+		t.Errorf("Unexpected printed configuration:\n%s", out)
+	}
+}
@@ -1,72 +1,250 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"data-storage/internal/logging"
 	"data-storage/internal/models"
+	"data-storage/internal/tenant"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+// Config holds the PostgreSQL connection and pool settings
 type Config struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DBName   string
+	Host           string        `yaml:"host" env:"DB_HOST"`
+	Port           int           `yaml:"port" env:"DB_PORT"`
+	User           string        `yaml:"user" env:"DB_USER"`
+	Password       string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	DBName         string        `yaml:"name" env:"DB_NAME"`
+	SSLMode        string        `yaml:"sslmode" env:"DB_SSLMODE"`         // disable, allow, prefer, require, verify-ca or verify-full
+	SSLRootCert    string        `yaml:"sslrootcert" env:"DB_SSLROOTCERT"` // CA certificate for verify-ca and verify-full
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+
+	// Pool settings; 0 leaves the database/sql default (unlimited open connections and lifetimes)
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
 }
 
-func LoadConfigFromEnv() Config {
-	portStr := os.Getenv("DB_PORT")
-	port, _ := strconv.Atoi(portStr)
-	if port == 0 {
-		port = 5432
-	}
+// SSLModes are the sslmode values libpq accepts
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
 
+func DefaultConfig() Config {
 	return Config{
-		Host:     os.Getenv("DB_HOST"),
-		Port:     port,
-		User:     os.Getenv("DB_USER"),
-		Password: os.Getenv("DB_PASSWORD"),
-		DBName:   os.Getenv("DB_NAME"),
+		Port:           5432,
+		SSLMode:        "disable",
+		ConnectTimeout: 10 * time.Second,
+		MaxIdleConns:   2,
 	}
 }
 
-func InitDB(cfg Config) (*gorm.DB, error) {
-	// Build connection string
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName)
+// dsn builds the connection string, quoting values so passwords may contain spaces or quotes
+func (cfg Config) dsn() string {
+	params := [][2]string{
+		{"host", cfg.Host},
+		{"port", strconv.Itoa(cfg.Port)},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.DBName},
+		{"sslmode", cfg.SSLMode},
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, [2]string{"sslrootcert", cfg.SSLRootCert})
+	}
+	if cfg.ConnectTimeout > 0 {
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(int(cfg.ConnectTimeout.Seconds()))})
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p[1])
+		parts = append(parts, fmt.Sprintf("%s='%s'", p[0], value))
+	}
+	return strings.Join(parts, " ")
+}
 
+func InitDB(cfg Config) (*gorm.DB, error) {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	DB, err = Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Setup(DB); err != nil {
+		return nil, err
+	}
+	logging.Logger("db").Info("Database connection established and migrations completed")
+	return DB, nil
+}
+
+// Open connects to PostgreSQL without migrating the schema, for tools that inspect it
+// first. InitDB opens and sets up the connection for the API.
+func Open(cfg Config) (*gorm.DB, error) {
+	database, err := gorm.Open(postgres.Open(cfg.dsn()), &gorm.Config{
+		Logger: logging.NewGormLogger(),
+		// Report constraint violations as gorm.ErrDuplicatedKey etc. so handlers can map them to statuses
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return database, nil
+}
+
+// Setup prepares an open connection for the API: it registers the tenant callbacks, migrates
+// the schema and makes it the connection returned by GetDB. InitDB calls it for PostgreSQL;
+// tests call it with an SQLite connection.
+func Setup(database *gorm.DB) error {
+	// Scope queries made with an organization in their context
+	if err := tenant.Register(database); err != nil {
+		return fmt.Errorf("error registering tenant callbacks: %w", err)
+	}
+
 	// Auto-migrate the schema
-	err = DB.AutoMigrate(
-		&models.User{},
-		&models.Device{},
-		&models.Signal{},
-		&models.SignalValue{},
-	)
+	if err := database.AutoMigrate(schema...); err != nil {
+		return fmt.Errorf("error migrating database: %w", err)
+	}
+
+	if err := dropSignalTypeCheck(database); err != nil {
+		return fmt.Errorf("error updating signal type constraint: %w", err)
+	}
+
+	if err := backfillOrganizations(database); err != nil {
+		return fmt.Errorf("error backfilling organizations: %w", err)
+	}
+
+	DB = database
+	migrated.Store(true)
+	return nil
+}
+
+// schema lists the models migrated at startup
+var schema = []interface{}{
+	&models.Organization{},
+	&models.Membership{},
+	&models.OrgInvitation{},
+	&models.User{},
+	&models.Device{},
+	&models.Signal{},
+	&models.SignalValue{},
+	&models.DeviceUsage{},
+	&models.DeviceCertificate{},
+	&models.BadgeScan{},
+	&models.OperatorSession{},
+	&models.Shift{},
+	&models.Cycle{},
+	&models.PasswordResetToken{},
+	&models.AuditLog{},
+}
+
+// migrated is set once InitDB has migrated the schema, so every table of schema exists
+var migrated atomic.Bool
+
+// Ready reports whether the database is reachable and the schema is migrated. Probes run
+// often, so it only pings the database and trusts the migration of this process for the
+// tables.
+func Ready(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database not initialized")
+	}
+	sqlDB, err := DB.DB()
 	if err != nil {
-		return nil, fmt.Errorf("error migrating database: %w", err)
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
 	}
 
-	log.Println("Database connection established and migrations completed")
-	return DB, nil
+	if !migrated.Load() {
+		return errors.New("migrations not applied")
+	}
+	return nil
+}
+
+// Close closes the connection pool
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// dropSignalTypeCheck drops the signal type constraint of databases created before
+// waveform signals, which only allowed digital and analogic signals. AutoMigrate has added
+// its replacement.
+func dropSignalTypeCheck(db *gorm.DB) error {
+	// Named by AutoMigrate, and by PostgreSQL for the check of the SQL migrations
+	for _, legacy := range []string{"chk_signals_signal_type", "signals_signal_type_check"} {
+		if !db.Migrator().HasConstraint(&models.Signal{}, legacy) {
+			continue
+		}
+		if err := db.Migrator().DropConstraint(&models.Signal{}, legacy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillOrganizations moves data created before multi-tenancy into a default
+// organization. It only runs while no organization exists yet.
+func backfillOrganizations(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Organization{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		org := models.Organization{Name: "Default", Slug: "default", IsActive: true}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Device{}).Where("organization_id IS NULL").
+			Update("organization_id", org.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE signals SET organization_id =
+			(SELECT organization_id FROM devices WHERE devices.id = signals.device_id)
+			WHERE organization_id IS NULL`).Error; err != nil {
+			return err
+		}
+
+		// Existing users keep full access to existing data
+		return tx.Exec(`INSERT INTO memberships (organization_id, user_id, role, created_at, updated_at)
+			SELECT ?, id, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM users`,
+			org.ID, models.RoleAdmin).Error
+	})
 }
 
 func GetDB() *gorm.DB {
 	return DB
 }
-
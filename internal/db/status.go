@@ -0,0 +1,48 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// TableStatus describes how a model's table compares to the schema migrated by Setup
+type TableStatus struct {
+	Model          string   `json:"model"`
+	Table          string   `json:"table"`
+	Exists         bool     `json:"exists"`
+	MissingColumns []string `json:"missing_columns,omitempty"`
+}
+
+// Migrated reports whether the table has every column of its model
+func (s TableStatus) Migrated() bool {
+	return s.Exists && len(s.MissingColumns) == 0
+}
+
+// SchemaStatus compares the database to the models without changing it. Tables or columns
+// reported missing are created by Setup, which the API runs on startup.
+func SchemaStatus(database *gorm.DB) ([]TableStatus, error) {
+	migrator := database.Migrator()
+	statuses := make([]TableStatus, 0, len(schema))
+	for _, model := range schema {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("error parsing %T: %w", model, err)
+		}
+		status := TableStatus{
+			Model:  reflect.TypeOf(model).Elem().Name(),
+			Table:  stmt.Schema.Table,
+			Exists: migrator.HasTable(model),
+		}
+		if status.Exists {
+			for _, field := range stmt.Schema.Fields {
+				if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+					status.MissingColumns = append(status.MissingColumns, field.DBName)
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
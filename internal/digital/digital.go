@@ -0,0 +1,191 @@
+// Package digital analyses the values of digital signals as states: each value holds until
+// the next one, giving the intervals spent on and off and the edges between them.
+package digital
+
+import "time"
+
+// Edge kinds
+const (
+	Rising  = "rising"  // Off to on
+	Falling = "falling" // On to off
+)
+
+// Sample is a value of a digital signal
+type Sample struct {
+	Timestamp time.Time
+	On        bool
+}
+
+// Edge is a change of state
+type Edge struct {
+	Timestamp time.Time `json:"timestamp"`
+	Edge      string    `json:"edge"`
+}
+
+// Interval is a span spent in one state, clipped to the analysed range
+type Interval struct {
+	On           bool      `json:"on"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Duration     float64   `json:"duration"`                // Seconds
+	StartsBefore bool      `json:"starts_before,omitempty"` // The state began before the range
+	Open         bool      `json:"open,omitempty"`          // The state lasted past the range
+}
+
+// Edges returns the changes of state in the samples, in time order. The initial state, when
+// known, is the state before the first sample.
+func Edges(initial *bool, samples []Sample) []Edge {
+	edges := []Edge{}
+	state := initial
+	for i := range samples {
+		s := samples[i]
+		if state != nil && *state != s.On {
+			edge := Falling
+			if s.On {
+				edge = Rising
+			}
+			edges = append(edges, Edge{Timestamp: s.Timestamp, Edge: edge})
+		}
+		state = &samples[i].On
+	}
+	return edges
+}
+
+// Intervals returns the spans spent in each state from from to to, merging repeated values.
+// The initial state holds from from to the first sample; without it that time is unknown and
+// left out.
+func Intervals(initial *bool, samples []Sample, from, to time.Time) []Interval {
+	intervals := []Interval{}
+	add := func(on bool, start, end time.Time, startsBefore bool) {
+		if !end.After(start) {
+			return
+		}
+		if n := len(intervals); n > 0 && intervals[n-1].On == on && intervals[n-1].End.Equal(start) {
+			intervals[n-1].End = end
+			intervals[n-1].Duration = end.Sub(intervals[n-1].Start).Seconds()
+			return
+		}
+		intervals = append(intervals, Interval{On: on, Start: start, End: end, Duration: end.Sub(start).Seconds(), StartsBefore: startsBefore})
+	}
+
+	state, start := initial, from
+	for i := range samples {
+		s := samples[i]
+		if s.Timestamp.Before(from) || !s.Timestamp.Before(to) {
+			continue
+		}
+		if state != nil {
+			add(*state, start, s.Timestamp, initial != nil && state == initial)
+		}
+		state, start = &samples[i].On, s.Timestamp
+	}
+	if state != nil && to.After(start) {
+		add(*state, start, to, initial != nil && state == initial)
+		intervals[len(intervals)-1].Open = true
+	}
+	return intervals
+}
+
+// Summary is the time a digital signal spent in each state
+type Summary struct {
+	OnSeconds      float64   `json:"on_seconds"`
+	OffSeconds     float64   `json:"off_seconds"`
+	UnknownSeconds float64   `json:"unknown_seconds"` // Before the first known state
+	OnRatio        *float64  `json:"on_ratio"`        // Share of the known time spent on
+	Transitions    int       `json:"transitions"`
+	LongestOn      *Interval `json:"longest_on"`
+	LongestOff     *Interval `json:"longest_off"`
+}
+
+// Summarize totals the intervals of the range from from to to
+func Summarize(intervals []Interval, from, to time.Time) Summary {
+	var s Summary
+	for i := range intervals {
+		in := &intervals[i]
+		if in.On {
+			s.OnSeconds += in.Duration
+			if s.LongestOn == nil || in.Duration > s.LongestOn.Duration {
+				s.LongestOn = in
+			}
+		} else {
+			s.OffSeconds += in.Duration
+			if s.LongestOff == nil || in.Duration > s.LongestOff.Duration {
+				s.LongestOff = in
+			}
+		}
+		if i > 0 {
+			s.Transitions++
+		}
+	}
+	s.UnknownSeconds = to.Sub(from).Seconds() - s.OnSeconds - s.OffSeconds
+	if known := s.OnSeconds + s.OffSeconds; known > 0 {
+		ratio := s.OnSeconds / known
+		s.OnRatio = &ratio
+	}
+	return s
+}
+
+// Bucket is the time spent in each state within a bucket
+type Bucket struct {
+	Start      time.Time `json:"start"`
+	OnSeconds  float64   `json:"on_seconds"`
+	OffSeconds float64   `json:"off_seconds"`
+	OnRatio    *float64  `json:"on_ratio"` // Share of the known time spent on; nil when unknown
+}
+
+// Buckets splits the intervals into buckets of the given size from from to to
+func Buckets(intervals []Interval, from, to time.Time, size time.Duration) []Bucket {
+	var buckets []Bucket
+	i := 0
+	for start := from; start.Before(to); start = start.Add(size) {
+		end := start.Add(size)
+		if end.After(to) {
+			end = to
+		}
+		b := Bucket{Start: start}
+		// Intervals are in order and do not overlap
+		for ; i < len(intervals) && !intervals[i].End.After(start); i++ {
+		}
+		for j := i; j < len(intervals) && intervals[j].Start.Before(end); j++ {
+			overlap := minTime(intervals[j].End, end).Sub(maxTime(intervals[j].Start, start)).Seconds()
+			if intervals[j].On {
+				b.OnSeconds += overlap
+			} else {
+				b.OffSeconds += overlap
+			}
+		}
+		if known := b.OnSeconds + b.OffSeconds; known > 0 {
+			ratio := b.OnSeconds / known
+			b.OnRatio = &ratio
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// Filter returns the intervals in the given state (any when nil) lasting at least min and,
+// when max is positive, at most max
+func Filter(intervals []Interval, on *bool, min, max time.Duration) []Interval {
+	filtered := []Interval{}
+	for _, in := range intervals {
+		d := time.Duration(in.Duration * float64(time.Second))
+		if (on == nil || in.On == *on) && d >= min && (max <= 0 || d <= max) {
+			filtered = append(filtered, in)
+		}
+	}
+	return filtered
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
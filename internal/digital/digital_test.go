@@ -0,0 +1,107 @@
+package digital
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+func at(minutes int, on bool) Sample {
+	return Sample{Timestamp: minute(minutes), On: on}
+}
+
+func minute(minutes int) time.Time {
+	return start.Add(time.Duration(minutes) * time.Minute)
+}
+
+// motion is a motion sensor seen off before the range, on for 20 minutes with a repeated
+// value, then off, then on until the end of the hour
+var (
+	off    = false
+	motion = []Sample{at(10, true), at(20, true), at(30, false), at(45, true)}
+)
+
+func TestEdges(t *testing.T) {
+	edges := Edges(&off, motion)
+	if len(edges) != 3 || edges[0].Edge != Rising || edges[1].Edge != Falling || edges[2].Edge != Rising {
+		t.Fatalf("Expected rising, falling and rising edges, got %+v", edges)
+	}
+	if !edges[1].Timestamp.Equal(minute(30)) {
+		t.Errorf("Expected the falling edge at 08:30, got %v", edges[1].Timestamp)
+	}
+	if edges := Edges(nil, motion); len(edges) != 2 || edges[0].Edge != Falling {
+		t.Errorf("Expected no edge at the first value without an initial state, got %+v", edges)
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	intervals := Intervals(&off, motion, start, minute(60))
+	want := []struct {
+		on       bool
+		duration float64
+	}{{false, 600}, {true, 1200}, {false, 900}, {true, 900}}
+	if len(intervals) != len(want) {
+		t.Fatalf("Expected %d intervals, got %+v", len(want), intervals)
+	}
+	for i, w := range want {
+		if intervals[i].On != w.on || intervals[i].Duration != w.duration {
+			t.Errorf("Interval %d: expected %v for %vs, got %+v", i, w.on, w.duration, intervals[i])
+		}
+	}
+	if !intervals[0].StartsBefore || intervals[1].StartsBefore || !intervals[3].Open || intervals[2].Open {
+		t.Errorf("Expected the first interval to start before the range and the last to be open, got %+v", intervals)
+	}
+
+	unknown := Intervals(nil, motion, start, minute(60))
+	if len(unknown) != 3 || !unknown[0].Start.Equal(minute(10)) || unknown[0].StartsBefore {
+		t.Errorf("Expected the time before the first value to be left out, got %+v", unknown)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(Intervals(nil, motion, start, minute(60)), start, minute(60))
+	if s.OnSeconds != 2100 || s.OffSeconds != 900 || s.UnknownSeconds != 600 || s.Transitions != 2 {
+		t.Errorf("Expected 2100s on, 900s off, 600s unknown and 2 transitions, got %+v", s)
+	}
+	if s.OnRatio == nil || *s.OnRatio != 0.7 {
+		t.Errorf("Expected an on ratio of 0.7, got %v", s.OnRatio)
+	}
+	if s.LongestOn == nil || s.LongestOn.Duration != 1200 || s.LongestOff == nil || s.LongestOff.Duration != 900 {
+		t.Errorf("Expected longest runs of 1200s on and 900s off, got %+v and %+v", s.LongestOn, s.LongestOff)
+	}
+
+	if s := Summarize(nil, start, minute(60)); s.OnRatio != nil || s.LongestOn != nil || s.UnknownSeconds != 3600 {
+		t.Errorf("Expected an unknown hour, got %+v", s)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	buckets := Buckets(Intervals(&off, motion, start, minute(60)), start, minute(60), 20*time.Minute)
+	ratios := []float64{0.5, 0.5, 0.75}
+	if len(buckets) != len(ratios) {
+		t.Fatalf("Expected %d buckets, got %+v", len(ratios), buckets)
+	}
+	for i, ratio := range ratios {
+		if buckets[i].OnRatio == nil || *buckets[i].OnRatio != ratio {
+			t.Errorf("Bucket %d: expected an on ratio of %v, got %+v", i, ratio, buckets[i])
+		}
+	}
+
+	// The last bucket is cut at the end of the range
+	buckets = Buckets(Intervals(nil, motion, start, minute(50)), start, minute(50), 20*time.Minute)
+	if len(buckets) != 3 || buckets[0].OffSeconds != 0 || buckets[2].OnSeconds != 300 || buckets[2].OffSeconds != 300 {
+		t.Errorf("Expected the unknown time left out and a 10 minute last bucket, got %+v", buckets)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	intervals := Intervals(&off, motion, start, minute(60))
+	on := true
+	if got := Filter(intervals, &on, 16*time.Minute, 0); len(got) != 1 || got[0].Duration != 1200 {
+		t.Errorf("Expected the one on interval of at least 16 minutes, got %+v", got)
+	}
+	if got := Filter(intervals, nil, 0, 10*time.Minute); len(got) != 1 || got[0].Duration != 600 {
+		t.Errorf("Expected the one interval of at most 10 minutes, got %+v", got)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/models"
+	"data-storage/internal/series"
+	"data-storage/internal/validate"
+)
+
+// AlignedSignal is a column of an aligned series
+type AlignedSignal struct {
+	SignalID   uint         `json:"signal_id"`
+	Name       string       `json:"name"`
+	DeviceID   uint         `json:"device_id"`
+	Device     string       `json:"device"`
+	SignalType string       `json:"signal_type"`
+	Unit       string       `json:"unit,omitempty"`
+	Column     string       `json:"column"`         // Header of the signal's CSV column
+	Gaps       []series.Gap `json:"gaps,omitempty"` // Only with a gap_threshold
+}
+
+// AlignedRow is a bucket of an aligned series, with the value of each signal in the order of
+// the signals
+type AlignedRow struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Values    []*float64 `json:"values"`
+}
+
+// AlignedSeriesResponse is the values of several signals aggregated on the same buckets: a
+// row per bucket and a column per signal
+type AlignedSeriesResponse struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Bucket    float64         `json:"bucket"` // Seconds per bucket
+	Aggregate string          `json:"aggregate"`
+	Fill      string          `json:"fill,omitempty"`
+	Function  string          `json:"function,omitempty"`
+	Signals   []AlignedSignal `json:"signals"`
+	Rows      []AlignedRow    `json:"rows"`
+}
+
+// AlignedSeriesHandler aggregates the signals in signal_ids on the same buckets from from_date
+// to to_date and joins them on the bucket time, as JSON or CSV. Without a fill, only the
+// buckets where some signal has values are returned.
+func AlignedSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, ok := idsParam(w, r, "signal_ids")
+	if !ok {
+		return
+	}
+	q, ok := parseSeriesQuery(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	var errs validate.Errors
+	switch {
+	case len(ids) == 0:
+		errs.Add("signal_ids", validate.CodeRequired, "signal_ids is required")
+	case len(ids) > maxCompareSignals:
+		errs.Add("signal_ids", validate.CodeTooLarge, fmt.Sprintf("At most %d signals can be aligned", maxCompareSignals))
+	}
+	if q.bucket == 0 {
+		errs.Add("bucket", validate.CodeRequired, "bucket is required to align signals")
+	}
+	if format != "" && format != "json" && format != "csv" {
+		errs.Add("format", validate.CodeOneOf, "format must be one of json, csv")
+	}
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+
+	var signals []models.Signal
+	if result := orgDB(r).Preload("Device").Where("id IN ?", ids).Find(&signals); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signals")
+		return
+	}
+	byID := make(map[uint]models.Signal, len(signals))
+	for _, signal := range signals {
+		byID[signal.ID] = signal
+	}
+
+	response := AlignedSeriesResponse{From: q.from, To: q.to, Bucket: q.bucket.Seconds(), Aggregate: q.aggregate, Fill: q.fill,
+		Function: q.function.Name, Signals: make([]AlignedSignal, 0, len(ids)), Rows: []AlignedRow{}}
+	rows := make(map[time.Time]*AlignedRow)
+	columns := make(map[string]int)
+	for i, id := range ids {
+		signal, ok := byID[id]
+		if !ok {
+			apierror.Error(w, r, fmt.Sprintf("Signal %d not found", id), http.StatusNotFound)
+			return
+		}
+		if !q.supports(w, r, signal) {
+			return
+		}
+		points, err := q.load(r, signal)
+		if err != nil {
+			apierror.Database(w, r, err, "signal values")
+			return
+		}
+		points, gaps, err := q.shape(points)
+		if err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "gap_threshold", Code: validate.CodeTooLarge, Message: err.Error()}})
+			return
+		}
+
+		// Devices often share signal names; repeated columns get the signal ID
+		column := signal.Device.Name + "." + signal.Name
+		if columns[column]++; columns[column] > 1 {
+			column += "#" + strconv.FormatUint(uint64(signal.ID), 10)
+		}
+		response.Signals = append(response.Signals, AlignedSignal{
+			SignalID:   signal.ID,
+			Name:       signal.Name,
+			DeviceID:   signal.DeviceID,
+			Device:     signal.Device.Name,
+			SignalType: signal.SignalType,
+			Unit:       signal.Unit,
+			Column:     column,
+			Gaps:       gaps,
+		})
+
+		for _, p := range points {
+			row, ok := rows[p.Timestamp]
+			if !ok {
+				row = &AlignedRow{Timestamp: p.Timestamp, Values: make([]*float64, len(ids))}
+				rows[p.Timestamp] = row
+			}
+			row.Values[i] = p.Value
+		}
+	}
+	for _, row := range rows {
+		response.Rows = append(response.Rows, *row)
+	}
+	sort.Slice(response.Rows, func(i, j int) bool { return response.Rows[i].Timestamp.Before(response.Rows[j].Timestamp) })
+
+	if format == "csv" {
+		writeAlignedCSV(w, response)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeAlignedCSV writes the rows as a CSV attachment, with empty cells for missing values
+func writeAlignedCSV(w http.ResponseWriter, response AlignedSeriesResponse) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="series.csv"`)
+
+	cw := csv.NewWriter(w)
+	header := []string{"timestamp"}
+	for _, signal := range response.Signals {
+		header = append(header, signal.Column)
+	}
+	cw.Write(header)
+	for _, row := range response.Rows {
+		record := []string{row.Timestamp.Format(time.RFC3339)}
+		for _, value := range row.Values {
+			cell := ""
+			if value != nil {
+				cell = strconv.FormatFloat(*value, 'g', -1, 64)
+			}
+			record = append(record, cell)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+// setupAligned creates two devices named alike, each with a temperature signal, and values at
+// uneven times from 08:00, and returns the query of the two signals from 08:00 to 08:15
+func setupAligned(t *testing.T) (a *testAPI, first, second uint, query url.Values, start time.Time) {
+	t.Helper()
+	a = setupAPI(t)
+	start = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	var ids []uint
+	for i := 0; i < 2; i++ {
+		ids = append(ids, a.signal(models.Signal{DeviceID: a.device("press").ID, Name: "temperature", SignalType: "analogic"}).ID)
+	}
+	for _, v := range []struct {
+		signal  uint
+		minutes int
+		value   float64
+	}{{ids[0], 0, 10}, {ids[0], 1, 20}, {ids[0], 10, 30}, {ids[1], 5, 7}} {
+		a.value(v.signal, v.value, start.Add(time.Duration(v.minutes)*time.Minute))
+	}
+	query = with(dateRange(start, start.Add(15*time.Minute)), "signal_ids", idPath("%d,%d", ids[0], ids[1]), "bucket", "5m")
+	return a, ids[0], ids[1], query, start
+}
+
+// cells formats the values of a row, with - for missing ones
+func cells(values []*float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = "-"
+		if v != nil {
+			s[i] = fmt.Sprint(*v)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestAlignedSeries(t *testing.T) {
+	a, first, second, query, start := setupAligned(t)
+
+	// Repeated IDs are aligned once
+	var series handlers.AlignedSeriesResponse
+	repeated := with(query)
+	repeated.Set("signal_ids", idPath("%d,%d,%d", first, second, first))
+	a.must(http.MethodGet, "/series", repeated, nil, &series)
+	if len(series.Signals) != 2 {
+		t.Fatalf("Expected a column per signal, got %+v", series.Signals)
+	}
+	if series.Signals[0].Column != "press.temperature" || series.Signals[1].Column != idPath("press.temperature#%d", second) {
+		t.Errorf("Expected the repeated column name to get the signal ID, got %q and %q", series.Signals[0].Column, series.Signals[1].Column)
+	}
+	want := []string{"15 -", "- 7", "30 -"}
+	if len(series.Rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %+v", len(want), series.Rows)
+	}
+	for i, row := range series.Rows {
+		if !row.Timestamp.Equal(start.Add(time.Duration(i) * 5 * time.Minute)) {
+			t.Errorf("Row %d: expected the bucket at %v, got %v", i, start.Add(time.Duration(i)*5*time.Minute), row.Timestamp)
+		}
+		if got := cells(row.Values); got != want[i] {
+			t.Errorf("Row %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+
+	// The previous fill holds each signal's last value; before its first there is none
+	series = handlers.AlignedSeriesResponse{}
+	a.must(http.MethodGet, "/series", with(query, "fill", "previous"), nil, &series)
+	want = []string{"15 -", "15 7", "30 7"}
+	if len(series.Rows) != len(want) {
+		t.Fatalf("Expected %d filled rows, got %+v", len(want), series.Rows)
+	}
+	for i, row := range series.Rows {
+		if got := cells(row.Values); got != want[i] {
+			t.Errorf("Filled row %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestAlignedSeries_CSV(t *testing.T) {
+	a, _, second, query, _ := setupAligned(t)
+
+	req, _ := http.NewRequest(http.MethodGet, a.url+"/series?"+with(query, "format", "csv").Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error getting CSV: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("Expected a CSV, got %d %s: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	want := idPath("timestamp,press.temperature,press.temperature#%d\n", second) +
+		"2024-05-01T08:00:00Z,15,\n" +
+		"2024-05-01T08:05:00Z,,7\n" +
+		"2024-05-01T08:10:00Z,30,\n"
+	if string(body) != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, body)
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/attendance"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+)
+
+const (
+	// maxAttendanceRange limits the date range of one attendance report
+	maxAttendanceRange = 93 * 24 * time.Hour
+	// maxAttendanceSessions limits the operator sessions of one attendance report
+	maxAttendanceSessions = 10000
+)
+
+// AttendanceReport is the working time of operators in a date range
+type AttendanceReport struct {
+	From                  time.Time        `json:"from"`
+	To                    time.Time        `json:"to"`
+	SessionTimeoutSeconds int64            `json:"session_timeout_seconds"`
+	Rows                  []attendance.Row `json:"rows"`
+}
+
+// AttendanceReportHandler reports how long operators worked at each device per shift, from
+// their operator sessions. Sessions without a badge-out are capped by the session timeout.
+func AttendanceReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, ok := timeParam(w, r, "from_date")
+	if !ok {
+		return
+	}
+	to, ok := timeParam(w, r, "to_date")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	var errs validate.Errors
+	if !to.After(from) {
+		errs.Add("to_date", validate.CodeInvalid, "to_date must be after from_date")
+	} else if to.Sub(from) > maxAttendanceRange {
+		errs.Add("to_date", validate.CodeInvalid, "The date range must not exceed 93 days")
+	}
+	timeout := attendance.SessionTimeout()
+	if value := params.Get("session_timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			errs.Add("session_timeout", validate.CodeInvalid, "session_timeout must be a positive duration, e.g. 8h")
+		}
+	}
+	var groupBy []string
+	if value := params.Get("group_by"); value != "" {
+		groupBy = strings.Split(value, ",")
+	}
+	report, err := attendance.NewReport(groupBy)
+	if err != nil {
+		errs.Add("group_by", validate.CodeInvalid, err.Error())
+	}
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		errs.Add("format", validate.CodeOneOf, "format must be one of json, csv")
+	}
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+
+	// Occurrences of the active shifts in the range
+	var shifts []models.Shift
+	if result := orgDB(r).Where("is_active = ?", true).Order("id").Find(&shifts); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shifts")
+		return
+	}
+	schedules := make([]*attendance.Schedule, 0, len(shifts))
+	for _, shift := range shifts {
+		schedule, err := attendance.NewSchedule(shift)
+		if err != nil {
+			logger.WarnContext(r.Context(), "Skipping invalid shift", "shift_id", shift.ID, "error", err)
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+	windows := attendance.Windows(schedules, from, to)
+
+	// Sessions overlapping the range
+	query := orgDB(r).Preload("User").Preload("Device").
+		Where("started_at < ? AND (ended_at IS NULL OR ended_at > ?)", to, from)
+	if deviceID := params.Get("device_id"); deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if userID := params.Get("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	var sessions []models.OperatorSession
+	if result := query.Order("started_at, id").Limit(maxAttendanceSessions + 1).Find(&sessions); result.Error != nil {
+		apierror.Database(w, r, result.Error, "operator sessions")
+		return
+	}
+	if len(sessions) > maxAttendanceSessions {
+		apierror.Error(w, r, "The report covers too many sessions; narrow the date range or filter by device or user", http.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now()
+	var parts []attendance.Interval
+	for i := range sessions {
+		parts = append(parts, attendance.Split(attendance.Effective(&sessions[i], now, timeout), windows, from, to)...)
+	}
+	values, err := countSessionValues(r, parts, timeout)
+	if err != nil {
+		apierror.Database(w, r, err, "signal values")
+		return
+	}
+	for i, part := range parts {
+		report.Add(part, values[i])
+	}
+
+	rows := report.Rows()
+	if format == "csv" {
+		writeAttendanceCSV(w, rows)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AttendanceReport{
+		From:                  from,
+		To:                    to,
+		SessionTimeoutSeconds: int64(timeout / time.Second),
+		Rows:                  rows,
+	})
+}
+
+// countSessionValues counts the signal values each part's operator recorded at its device
+// during the part. It reads the values with one query per device and counts them in memory;
+// no part may last longer than maxPart.
+func countSessionValues(r *http.Request, parts []attendance.Interval, maxPart time.Duration) ([]int64, error) {
+	type operator struct{ deviceID, userID uint }
+	byOperator := make(map[operator][]int) // Indexes of the parts, ordered by start
+	spans := make(map[uint]*attendance.Interval)
+	var deviceIDs []uint
+	for i, part := range parts {
+		key := operator{part.Session.DeviceID, part.Session.UserID}
+		byOperator[key] = append(byOperator[key], i)
+		span, ok := spans[key.deviceID]
+		if !ok {
+			spans[key.deviceID] = &attendance.Interval{Start: part.Start, End: part.End}
+			deviceIDs = append(deviceIDs, key.deviceID)
+			continue
+		}
+		if part.Start.Before(span.Start) {
+			span.Start = part.Start
+		}
+		if part.End.After(span.End) {
+			span.End = part.End
+		}
+	}
+	for _, indexes := range byOperator {
+		sort.SliceStable(indexes, func(a, b int) bool { return parts[indexes[a]].Start.Before(parts[indexes[b]].Start) })
+	}
+
+	counts := make([]int64, len(parts))
+	for _, deviceID := range deviceIDs {
+		span := spans[deviceID]
+		rows, err := orgDB(r).Model(&models.SignalValue{}).Select("user_id, timestamp").
+			Where("user_id IS NOT NULL AND timestamp >= ? AND timestamp < ?", span.Start, span.End).
+			Where("signal_id IN (SELECT id FROM signals WHERE device_id = ?)", deviceID).
+			Rows()
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var value struct {
+				UserID    uint
+				Timestamp time.Time
+			}
+			if err := orgDB(r).ScanRows(rows, &value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// Parts of overlapping shifts may share the value; only parts that started less
+			// than maxPart before it can contain it
+			indexes := byOperator[operator{deviceID, value.UserID}]
+			j := sort.Search(len(indexes), func(j int) bool { return parts[indexes[j]].Start.After(value.Timestamp) }) - 1
+			for ; j >= 0 && value.Timestamp.Sub(parts[indexes[j]].Start) < maxPart; j-- {
+				if value.Timestamp.Before(parts[indexes[j]].End) {
+					counts[indexes[j]]++
+				}
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// writeAttendanceCSV writes the report rows as a CSV attachment
+func writeAttendanceCSV(w http.ResponseWriter, rows []attendance.Row) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="attendance.csv"`)
+
+	id := func(id uint) string {
+		if id == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"shift_id", "shift", "shift_start", "shift_end", "user_id", "matricula", "operator",
+		"device_id", "device", "sessions", "timed_out_sessions", "duration_seconds", "hours", "values"})
+	for _, row := range rows {
+		cw.Write([]string{
+			id(row.ShiftID), row.Shift, timestamp(row.ShiftStart), timestamp(row.ShiftEnd),
+			id(row.UserID), row.Matricula, row.Operator,
+			id(row.DeviceID), row.Device,
+			strconv.Itoa(row.Sessions), strconv.Itoa(row.TimedOut),
+			strconv.FormatInt(row.Seconds, 10), strconv.FormatFloat(float64(row.Seconds)/3600, 'f', 2, 64),
+			strconv.FormatInt(row.Values, 10),
+		})
+	}
+	cw.Flush()
+}
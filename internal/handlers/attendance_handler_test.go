@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+)
+
+func TestAttendance_CountsOperatorValues(t *testing.T) {
+	a, station, device, signal := setupBadge(t)
+
+	// Two shifts spanning every day overlap all the time, so each counts the session
+	for _, name := range []string{"A", "B"} {
+		a.must(http.MethodPost, "/shifts", nil, handlers.ShiftRequest{Name: name, StartTime: "00:00", EndTime: "00:00"}, nil)
+	}
+	from := time.Now().Add(-time.Hour)
+	send := func() {
+		t.Helper()
+		on := true
+		station.createValue(valueBody{SignalID: signal.ID, DigitalValue: &on})
+	}
+
+	// Only the values sent during the operator's session are theirs
+	send()
+	resp, _ := scan(station, device.ID, "operator-badge", "login")
+	operatorID := resp.Session.UserID
+	send()
+	send()
+	scan(station, device.ID, "operator-badge", "logout")
+	send()
+
+	var report handlers.AttendanceReport
+	a.must(http.MethodGet, "/reports/attendance", with(dateRange(from, time.Now().Add(time.Hour)), "group_by", "operator,shift"), nil, &report)
+	values := map[string]int64{}
+	for _, row := range report.Rows {
+		if row.UserID == operatorID {
+			values[row.Shift] += row.Values
+		}
+	}
+	if values["A"] != 2 || values["B"] != 2 || len(values) != 2 {
+		t.Errorf("Expected both shifts to count the operator's 2 values, got %v from %+v", values, report.Rows)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+	"data-storage/internal/tenant"
+)
+
+// AuditVerifyResponse is the outcome of the check of an organization's audit log chain. The
+// details are only logged and shown by the admin CLI.
+type AuditVerifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// AuditLogsHandler lists audit log entries, newest first. Requires the organization admin role.
+func AuditLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+
+	var entries []models.AuditLog
+	query := orgDB(r).Model(&models.AuditLog{})
+	params := r.URL.Query()
+
+	// Filter by actor
+	if actorType := params.Get("actor_type"); actorType != "" {
+		query = query.Where("actor_type = ?", actorType)
+	}
+	if actorID := params.Get("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+
+	// Filter by action and resource
+	if action := params.Get("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if resourceType := params.Get("resource_type"); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID := params.Get("resource_id"); resourceID != "" {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+
+	// Date range filters
+	if fromDate := params.Get("from_date"); fromDate != "" {
+		query = query.Where("timestamp >= ?", fromDate)
+	}
+	if toDate := params.Get("to_date"); toDate != "" {
+		query = query.Where("timestamp <= ?", toDate)
+	}
+
+	// Limit results
+	limit := params.Get("limit")
+	if limit == "" {
+		limit = "100"
+	}
+	limitInt, _ := strconv.Atoi(limit)
+	if limitInt <= 0 {
+		limitInt = 100
+	}
+	if limitInt > 1000 {
+		limitInt = 1000 // Max limit
+	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+
+	result := query.Order("id DESC").Limit(limitInt).Offset(offset).Find(&entries)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "audit logs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// AuditVerifyHandler checks the integrity of the audit log hash chain of the active
+// organization. Requires the organization admin role.
+func AuditVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+
+	orgID, ok := tenant.OrganizationFrom(r.Context())
+	if !ok {
+		apierror.Error(w, r, "Organization required", http.StatusForbidden)
+		return
+	}
+	result, err := audit.VerifyOrganization(orgID)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error verifying audit log", "error", err)
+		apierror.Error(w, r, "Error verifying audit log", http.StatusInternalServerError)
+		return
+	}
+	if !result.Valid {
+		logger.ErrorContext(r.Context(), "Audit log chain is broken", "organization_id", orgID, "first_invalid_id", *result.FirstInvalidID, "reason", result.Reason)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditVerifyResponse{Valid: result.Valid})
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"data-storage/internal/audit"
+	"data-storage/internal/db"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+func TestAudit_NeedsAdmin(t *testing.T) {
+	a := setupAPI(t)
+	a.user(handlers.CreateUserRequest{Name: "Member", Email: "member@example.com", Password: adminPassword})
+	member := a.login("member@example.com", adminPassword)
+
+	for _, path := range []string{"/audit", "/audit/verify"} {
+		if problem := member.call(http.MethodGet, path, nil, nil, nil); problem == nil || problem.Status != http.StatusForbidden {
+			t.Errorf("GET %s: expected members to be forbidden, got %+v", path, problem)
+		}
+	}
+
+	var entries []models.AuditLog
+	a.must(http.MethodGet, "/audit", nil, nil, &entries)
+	if len(entries) == 0 {
+		t.Error("Expected the admin to read the audit log")
+	}
+	var result handlers.AuditVerifyResponse
+	a.must(http.MethodGet, "/audit/verify", nil, nil, &result)
+	if !result.Valid {
+		t.Errorf("Expected a valid chain, got %+v", result)
+	}
+}
+
+func TestAudit_RecordsValueCreates(t *testing.T) {
+	a := setupAPI(t)
+	signal := a.signal(models.Signal{DeviceID: a.device("press-1").ID, Name: "torque", SignalType: "analogic"})
+	// created reports whether the creation of the value is in the audit log
+	created := func(valueID uint) bool {
+		t.Helper()
+		var entries []models.AuditLog
+		query := url.Values{"action": {audit.ActionCreate}, "resource_type": {"signal_value"}, "resource_id": {idPath("%d", valueID)}}
+		a.must(http.MethodGet, "/audit", query, nil, &entries)
+		return len(entries) == 1
+	}
+
+	// Audited by default
+	if value := a.value(signal.ID, 12.5, time.Now()); !created(value.ID) {
+		t.Errorf("Expected the value creation to be audited")
+	}
+
+	// Left out only when turned off
+	audit.Init(audit.Config{ValueCreates: false})
+	t.Cleanup(func() { audit.Init(audit.DefaultConfig()) })
+	if value := a.value(signal.ID, 12.5, time.Now()); created(value.ID) {
+		t.Errorf("Expected the value creation not to be audited")
+	}
+}
+
+func TestAudit_ChainPerOrganization(t *testing.T) {
+	a := setupAPI(t)
+	a.device("press-1")
+	var org handlers.OrganizationWithRole
+	a.must(http.MethodPost, "/orgs", nil, handlers.OrganizationRequest{Name: "Other plant"}, &org)
+	other := a.switchOrg(org.ID)
+	other.device("press-2")
+
+	// The chain of the new organization starts afresh after the entries of the first
+	var first models.AuditLog
+	db.GetDB().Where("organization_id = ?", org.ID).Order("id").First(&first)
+	if first.PrevHash != "" {
+		t.Errorf("Expected the first entry of the organization to start a chain, got %+v", first)
+	}
+
+	// A modified entry only breaks the chain of its organization
+	db.GetDB().Model(&models.AuditLog{}).Where("organization_id = ? AND resource_type = ?", org.ID, "device").Update("action", "tampered")
+	for _, tc := range []struct {
+		api   *testAPI
+		valid bool
+	}{{a, true}, {other, false}} {
+		var result handlers.AuditVerifyResponse
+		tc.api.must(http.MethodGet, "/audit/verify", nil, nil, &result)
+		if result.Valid != tc.valid {
+			t.Errorf("Expected the chain to be valid: %v, got %+v", tc.valid, result)
+		}
+	}
+}
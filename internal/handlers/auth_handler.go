@@ -2,27 +2,57 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
 	"data-storage/internal/auth"
 	"data-storage/internal/db"
+	"data-storage/internal/metrics"
 	"data-storage/internal/models"
+	"data-storage/internal/validate"
+
+	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email          string `json:"email" validate:"required"`
+	Password       string `json:"password" validate:"required"`
+	OrganizationID uint   `json:"organization_id,omitempty"` // Defaults to the user's oldest organization
 }
 
 type LoginResponse struct {
-	Token string       `json:"token"`
-	User  models.User  `json:"user"`
+	Token        string               `json:"token"`
+	User         models.User          `json:"user"`
+	Organization *models.Organization `json:"organization,omitempty"`
+	Role         string               `json:"role,omitempty"`
+}
+
+type SwitchOrgRequest struct {
+	OrganizationID uint `json:"organization_id" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+func (req *ChangePasswordRequest) Validate(errs *validate.Errors) {
+	if req.NewPassword == "" {
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		errs.Add("new_password", validate.CodeInvalid, "New password must be different from the current password")
+	} else {
+		checkPassword(errs, "new_password", req.NewPassword)
+	}
 }
 
 type RegisterDeviceRequest struct {
-	Name        string `json:"name"`
+	Name        string `json:"name" validate:"required,max=255"`
 	Description string `json:"description,omitempty"`
 	DeviceType  string `json:"device_type,omitempty"`
 	Location    string `json:"location,omitempty"`
@@ -36,35 +66,114 @@ type RegisterDeviceResponse struct {
 // LoginHandler handles user authentication
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Find user by email
+	now := time.Now()
+	clientIP := auth.ClientIP(r)
+
+	// Reject early while the client IP is locked out, before spending time on bcrypt
+	if wait := auth.IPLockedFor(clientIP, now); wait > 0 {
+		writeLockedOut(w, r, wait)
+		return
+	}
+
+	// Find user by email. Unknown accounts are answered like real ones: they take the time
+	// of a password check and lock after the same number of failures.
 	var user models.User
 	result := db.GetDB().Where("email = ? AND is_active = ?", req.Email, true).First(&user)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if wait := auth.UnknownAccountLockedFor(req.Email, now); wait > 0 {
+			writeLockedOut(w, r, wait)
+			return
+		}
+		auth.CheckUnknownAccountPassword(req.Password)
+		auth.RecordIPFailure(clientIP, now)
+		auth.RecordUnknownAccountFailure(req.Email, now)
+		metrics.AuthFailed(metrics.AuthInvalidCredentials)
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
 	if result.Error != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		apierror.Database(w, r, result.Error, "user")
+		return
+	}
+
+	if wait := auth.AccountLockedFor(&user, now); wait > 0 {
+		writeLockedOut(w, r, wait)
 		return
 	}
 
 	// Check password
 	if !user.CheckPassword(req.Password) {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		auth.RecordIPFailure(clientIP, now)
+		if err := auth.RecordAccountFailure(&user, now); err != nil {
+			logger.ErrorContext(r.Context(), "Error recording failed login", "error", err)
+		}
+		metrics.AuthFailed(metrics.AuthInvalidCredentials)
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
+
+	if err := auth.RecordAccountSuccess(&user); err != nil {
+		logger.ErrorContext(r.Context(), "Error resetting failed logins", "error", err)
+	}
+
+	writeOrgToken(w, r, &user, req.OrganizationID)
+}
+
+// SwitchOrgHandler issues a token for another organization the user belongs to
+func SwitchOrgHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.Header.Get("X-User-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SwitchOrgRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("is_active = ?", true).First(&user, userID).Error; err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeOrgToken(w, r, &user, req.OrganizationID)
+}
+
+// writeOrgToken responds with a token for the user's membership in the organization
+// (or their oldest organization when orgID is 0)
+func writeOrgToken(w http.ResponseWriter, r *http.Request, user *models.User, orgID uint) {
+	membership, err := auth.FindMembership(user.ID, orgID)
+	if err != nil {
+		if err == auth.ErrNoMembership {
+			apierror.Error(w, r, "Not a member of this organization", http.StatusForbidden)
+		} else {
+			logger.ErrorContext(r.Context(), "Error loading membership", "error", err)
+			apierror.Error(w, r, "Error loading membership", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID, user.Email)
+	token, err := auth.GenerateOrgJWT(user.ID, user.Email, membership.OrganizationID)
 	if err != nil {
-		log.Printf("Error generating JWT: %v", err)
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "Error generating JWT", "error", err)
+		apierror.Error(w, r, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
@@ -72,45 +181,113 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	user.PasswordHash = ""
 
 	response := LoginResponse{
-		Token: token,
-		User:  user,
+		Token:        token,
+		User:         *user,
+		Organization: membership.Organization,
+		Role:         membership.Role,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeLockedOut rejects a login attempt during a lockout
+func writeLockedOut(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	metrics.AuthFailed(metrics.AuthLockedOut)
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeAccountLocked, "Too many failed login attempts, try again later")
+}
+
+// ChangePasswordHandler changes the authenticated user's password after verifying the current one
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.Header.Get("X-User-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var user models.User
+	result := orgDB(r).Where("is_active = ?", true).First(&user, userID)
+	if result.Error != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	if wait := auth.AccountLockedFor(&user, now); wait > 0 {
+		writeLockedOut(w, r, wait)
+		return
+	}
+
+	// A wrong current password counts as a failed login
+	if !user.CheckPassword(req.CurrentPassword) {
+		if err := auth.RecordAccountFailure(&user, now); err != nil {
+			logger.ErrorContext(r.Context(), "Error recording failed login", "error", err)
+		}
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Current password is incorrect")
+		return
+	}
+
+	before := passwordChange{User: user}
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		logger.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		apierror.Error(w, r, "Error processing password", http.StatusInternalServerError)
+		return
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+
+	result = orgDB(r).Model(&user).Select("password_hash", "failed_login_attempts", "locked_until").Updates(&user)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "user")
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "user", user.ID, before, passwordChange{User: user, Password: "changed"})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // RegisterDeviceHandler allows authenticated users to register new devices
 func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Get user ID from auth middleware (set by RequireUserAuth)
 	userIDStr := r.Header.Get("X-User-ID")
 	if userIDStr == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
 	var req RegisterDeviceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// Generate device auth token
 	authToken, err := auth.GenerateDeviceToken()
 	if err != nil {
-		log.Printf("Error generating device token: %v", err)
-		http.Error(w, "Error generating device token", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "Error generating device token", "error", err)
+		apierror.Error(w, r, "Error generating device token", http.StatusInternalServerError)
 		return
 	}
 
@@ -125,13 +302,14 @@ func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 		IsActive:    true,
 	}
 
-	result := db.GetDB().Create(&device)
+	result := orgDB(r).Create(&device)
 	if result.Error != nil {
-		log.Printf("Error creating device: %v", result.Error)
-		http.Error(w, "Error creating device", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
+	audit.Record(r, audit.ActionCreate, "device", device.ID, nil, device)
+
 	response := RegisterDeviceResponse{
 		Device:    device,
 		AuthToken: authToken,
@@ -141,4 +319,3 @@ func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
-
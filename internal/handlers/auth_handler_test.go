@@ -0,0 +1,35 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"data-storage/internal/apierror"
+)
+
+func TestLogin_LockoutDoesNotRevealAccounts(t *testing.T) {
+	a := setupAPI(t)
+	withoutLoginLimit(t)
+
+	// The same wrong guesses get the same answers whether or not the account exists
+	outcomes := func(email string) []string {
+		t.Helper()
+		var codes []string
+		for i := 0; i < 6; i++ {
+			problem := a.tryLogin(email, "wrong-password")
+			if problem == nil {
+				t.Fatalf("Expected the login of %s to fail", email)
+			}
+			codes = append(codes, problem.Code)
+		}
+		return codes
+	}
+	known, unknown := outcomes(adminEmail), outcomes("nobody@example.com")
+	if known[4] != apierror.CodeInvalidCredentials || known[5] != apierror.CodeAccountLocked {
+		t.Errorf("Expected the account to lock after 5 failures, got %v", known)
+	}
+	for i := range known {
+		if known[i] != unknown[i] {
+			t.Errorf("Attempt %d: expected the same answer for both emails, got %s and %s", i+1, known[i], unknown[i])
+		}
+	}
+}
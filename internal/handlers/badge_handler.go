@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// BadgeRequest is an RFID badge scanned at a device. A toggle, the default, ends the
+// operator's open session or starts one, replacing the session of another operator.
+type BadgeRequest struct {
+	Rfid   string `json:"rfid" validate:"required,max=64"`
+	Action string `json:"action,omitempty" validate:"oneof=toggle login logout"`
+}
+
+// BadgeResponse is the recorded scan and the session it started or ended
+type BadgeResponse struct {
+	Scan    models.BadgeScan        `json:"scan"`
+	Session *models.OperatorSession `json:"session,omitempty"`
+}
+
+// BadgeHandler records a badge scan of the authenticated device and opens or closes the
+// operator session. Scans of unknown badges and inactive users are recorded and rejected.
+func BadgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("X-Device-ID") != mux.Vars(r)["id"] {
+		apierror.Error(w, r, "Device ID mismatch", http.StatusForbidden)
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	var req BadgeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	now := time.Now()
+	scan := models.BadgeScan{DeviceID: device.ID, Rfid: req.Rfid, ScannedAt: now}
+	user, ok := badgeUser(w, r, &scan)
+	if !ok {
+		return
+	}
+
+	var started, ended *models.OperatorSession
+	var endedBefore models.OperatorSession
+	err := orgDB(r).Transaction(func(tx *gorm.DB) error {
+		var open models.OperatorSession
+		err := tx.Where("device_id = ? AND ended_at IS NULL", device.ID).First(&open).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		isOpen := err == nil
+		sameUser := isOpen && open.UserID == user.ID
+
+		logout := req.Action == "logout" || (req.Action != "login" && sameUser)
+		switch {
+		case logout && !sameUser:
+			scan.Result = models.BadgeNoSession
+		case sameUser && !logout:
+			// Badging in again keeps the open session
+			scan.Result = models.BadgeSessionOpen
+			scan.SessionID = &open.ID
+			started = &open
+		default:
+			if isOpen {
+				reason := models.SessionEndedReplaced
+				if sameUser {
+					reason = models.SessionEndedBadge
+				}
+				endedBefore = open
+				open.EndedAt = &now
+				open.EndReason = reason
+				if err := tx.Model(&open).Select("ended_at", "end_reason").Updates(&open).Error; err != nil {
+					return err
+				}
+				ended = &open
+				scan.Result = models.BadgeSessionEnded
+				scan.SessionID = &open.ID
+			}
+			if !logout {
+				session := models.OperatorSession{DeviceID: device.ID, UserID: user.ID, StartedAt: now}
+				if err := tx.Create(&session).Error; err != nil {
+					return err
+				}
+				started = &session
+				scan.Result = models.BadgeSessionStarted
+				scan.SessionID = &session.ID
+			}
+		}
+		return tx.Create(&scan).Error
+	})
+	if err != nil {
+		apierror.Database(w, r, err, "operator session")
+		return
+	}
+
+	if ended != nil {
+		audit.Record(r, audit.ActionUpdate, "operator_session", ended.ID, endedBefore, *ended)
+	}
+	if scan.Result == models.BadgeSessionStarted {
+		audit.Record(r, audit.ActionCreate, "operator_session", started.ID, nil, *started)
+	}
+	if scan.Result == models.BadgeNoSession {
+		apierror.Error(w, r, "The user has no open session on the device", http.StatusConflict)
+		return
+	}
+
+	response := BadgeResponse{Scan: scan, Session: started}
+	if started == nil {
+		response.Session = ended
+	}
+	response.Session.User = user
+
+	w.Header().Set("Content-Type", "application/json")
+	if scan.Result == models.BadgeSessionStarted {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// badgeUser finds the active user of the organization holding the scanned badge. Scans of
+// unknown badges and inactive users are recorded and rejected: it writes the error response
+// and returns false.
+func badgeUser(w http.ResponseWriter, r *http.Request, scan *models.BadgeScan) (*models.User, bool) {
+	// Only members of the device's organization are found
+	var user models.User
+	err := orgDB(r).Where("rfid = ?", scan.Rfid).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		scan.Result = models.BadgeUnknown
+	case err != nil:
+		apierror.Database(w, r, err, "user")
+		return nil, false
+	case !user.IsActive:
+		scan.UserID = &user.ID
+		scan.Result = models.BadgeInactive
+	default:
+		scan.UserID = &user.ID
+		return &user, true
+	}
+	if err := orgDB(r).Create(scan).Error; err != nil {
+		apierror.Database(w, r, err, "badge scan")
+		return nil, false
+	}
+	if scan.Result == models.BadgeUnknown {
+		apierror.Error(w, r, "Unknown badge", http.StatusNotFound)
+	} else {
+		apierror.Error(w, r, "User is inactive", http.StatusForbidden)
+	}
+	return nil, false
+}
+
+// OperatorSessionsHandler lists the operator sessions of a device, newest first
+func OperatorSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	userIDs, ok := idsParam(w, r, "user_id")
+	if !ok {
+		return
+	}
+	from, to, ok := timeRangeParams(w, r)
+	if !ok {
+		return
+	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := orgDB(r).Preload("User").Where("device_id = ?", device.ID)
+	if r.URL.Query().Get("open") == "true" {
+		query = query.Where("ended_at IS NULL")
+	}
+	if len(userIDs) > 0 {
+		query = query.Where("user_id IN ?", userIDs)
+	}
+
+	// Sessions overlapping the date range
+	if from != nil {
+		query = query.Where("(ended_at IS NULL OR ended_at >= ?)", *from)
+	}
+	if to != nil {
+		query = query.Where("started_at <= ?", *to)
+	}
+
+	var sessions []models.OperatorSession
+	result := query.Order("started_at DESC, id DESC").Limit(limitParam(r, 100, 1000)).Offset(offset).Find(&sessions)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "operator sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// BadgeScansHandler lists the badge scans of a device, newest first
+func BadgeScansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	userIDs, ok := idsParam(w, r, "user_id")
+	if !ok {
+		return
+	}
+	from, to, ok := timeRangeParams(w, r)
+	if !ok {
+		return
+	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := orgDB(r).Where("device_id = ?", device.ID)
+	if result := r.URL.Query().Get("result"); result != "" {
+		query = query.Where("result = ?", result)
+	}
+	if len(userIDs) > 0 {
+		query = query.Where("user_id IN ?", userIDs)
+	}
+	if from != nil {
+		query = query.Where("scanned_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("scanned_at <= ?", *to)
+	}
+
+	var scans []models.BadgeScan
+	result := query.Order("scanned_at DESC, id DESC").Limit(limitParam(r, 100, 1000)).Offset(offset).Find(&scans)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "badge scans")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scans)
+}
+
+// openSessionOperator returns the operator badged in at the device, or nil
+func openSessionOperator(r *http.Request, deviceID uint) (*uint, error) {
+	var session models.OperatorSession
+	err := orgDB(r).Where("device_id = ? AND ended_at IS NULL", deviceID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session.UserID, nil
+}
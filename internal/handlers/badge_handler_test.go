@@ -0,0 +1,238 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+// setupBadge registers a device with a digital signal and two operators, one of them
+// inactive, and returns the API as the admin and as the device
+func setupBadge(t *testing.T) (a, station *testAPI, device models.Device, signal models.Signal) {
+	t.Helper()
+	a = setupAPI(t)
+	device, station = a.registerDevice("press-1")
+	signal = a.signal(models.Signal{DeviceID: device.ID, Name: "running", SignalType: "digital"})
+	a.user(handlers.CreateUserRequest{Name: "Operator", Email: "operator@example.com", Password: adminPassword, Rfid: "operator-badge"})
+	former := a.user(handlers.CreateUserRequest{Name: "Former", Email: "former@example.com", Password: adminPassword, Rfid: "former-badge"})
+	inactive := false
+	a.must(http.MethodPut, idPath("/users/%d", former.ID), nil, handlers.UpdateUserRequest{IsActive: &inactive}, nil)
+	return a, station, device, signal
+}
+
+// scan posts a badge scan and returns the response, or the HTTP status of the error
+func scan(station *testAPI, deviceID uint, rfid, action string) (*handlers.BadgeResponse, int) {
+	station.t.Helper()
+	var resp handlers.BadgeResponse
+	if problem := station.call(http.MethodPost, idPath("/devices/%d/badge", deviceID), nil, handlers.BadgeRequest{Rfid: rfid, Action: action}, &resp); problem != nil {
+		return nil, problem.Status
+	}
+	return &resp, http.StatusOK
+}
+
+// scans lists the badge scans of the device, newest first
+func scans(a *testAPI, deviceID uint) []models.BadgeScan {
+	a.t.Helper()
+	var list []models.BadgeScan
+	a.must(http.MethodGet, idPath("/devices/%d/badge-scans", deviceID), nil, nil, &list)
+	return list
+}
+
+func TestBadge_Sessions(t *testing.T) {
+	a, station, device, _ := setupBadge(t)
+
+	// A toggle starts a session, the same badge ends it
+	resp, status := scan(station, device.ID, "operator-badge", "")
+	if status != http.StatusOK || resp.Scan.Result != models.BadgeSessionStarted || resp.Session.EndedAt != nil {
+		t.Fatalf("Expected a started session, got %d %+v", status, resp)
+	}
+	first := resp.Session.ID
+	resp, _ = scan(station, device.ID, "operator-badge", "")
+	if resp.Scan.Result != models.BadgeSessionEnded || resp.Session.ID != first || resp.Session.EndReason != models.SessionEndedBadge {
+		t.Errorf("Expected the same badge to end session %d, got %+v", first, resp)
+	}
+
+	// Another operator replaces the open session
+	scan(station, device.ID, "operator-badge", "login")
+	resp, _ = scan(station, device.ID, "admin-badge", "")
+	if resp.Scan.Result != models.BadgeSessionStarted || resp.Session.User == nil || resp.Session.User.Email != adminEmail {
+		t.Fatalf("Expected a session of the admin, got %+v", resp)
+	}
+	var sessions []models.OperatorSession
+	a.must(http.MethodGet, idPath("/devices/%d/sessions", device.ID), nil, nil, &sessions)
+	if len(sessions) != 3 || sessions[0].EndedAt != nil || sessions[1].EndReason != models.SessionEndedReplaced {
+		t.Errorf("Expected the open admin session after a replaced one, got %+v", sessions)
+	}
+
+	// A login keeps the open session; a logout without one is a conflict
+	if resp, _ := scan(station, device.ID, "admin-badge", "login"); resp.Scan.Result != models.BadgeSessionOpen || resp.Session.ID != sessions[0].ID {
+		t.Errorf("Expected the login to keep session %d, got %+v", sessions[0].ID, resp)
+	}
+	if _, status := scan(station, device.ID, "operator-badge", "logout"); status != http.StatusConflict {
+		t.Errorf("Expected a logout without a session to be a conflict, got %d", status)
+	}
+	if got := scans(a, device.ID); got[0].Result != models.BadgeNoSession {
+		t.Errorf("Expected the rejected logout to be recorded, got %+v", got[0])
+	}
+}
+
+func TestBadge_Rejected(t *testing.T) {
+	a, station, device, _ := setupBadge(t)
+
+	if _, status := scan(station, device.ID, "stranger-badge", ""); status != http.StatusNotFound {
+		t.Errorf("Expected an unknown badge to be not found, got %d", status)
+	}
+	if _, status := scan(station, device.ID, "former-badge", ""); status != http.StatusForbidden {
+		t.Errorf("Expected an inactive user to be forbidden, got %d", status)
+	}
+	got := scans(a, device.ID)
+	if len(got) != 2 || got[0].Result != models.BadgeInactive || got[0].UserID == nil || got[1].Result != models.BadgeUnknown || got[1].UserID != nil {
+		t.Errorf("Expected the inactive and unknown scans to be recorded, got %+v", got)
+	}
+}
+
+func TestBadge_AttributesValuesToOperator(t *testing.T) {
+	_, station, device, signal := setupBadge(t)
+	send := func() models.SignalValue {
+		t.Helper()
+		on := true
+		value := station.createValue(valueBody{SignalID: signal.ID, DigitalValue: &on})
+		if value.UserID == nil {
+			t.Fatalf("Expected the value to be attributed, got %+v", value)
+		}
+		return value
+	}
+
+	// Without a session values go to the device's user, the admin who registered it, but
+	// the device can't name any user, not even that one
+	adminValue := send()
+	on := false
+	if problem := station.call(http.MethodPost, "/signal-values", nil, valueBody{SignalID: signal.ID, DigitalValue: &on, UserID: adminValue.UserID}, nil); !invalid(problem, "user_id") {
+		t.Errorf("Expected the device to be refused a user without a session, got %+v", problem)
+	}
+	resp, _ := scan(station, device.ID, "operator-badge", "")
+	operatorID := resp.Session.UserID
+	if *adminValue.UserID == operatorID {
+		t.Fatal("Expected the device's user not to be the operator")
+	}
+	if value := send(); *value.UserID != operatorID {
+		t.Errorf("Expected the value to be attributed to operator %d, got %d", operatorID, *value.UserID)
+	}
+
+	// The device can't attribute values to anyone but the badged operator
+	if problem := station.call(http.MethodPost, "/signal-values", nil, valueBody{SignalID: signal.ID, DigitalValue: &on, UserID: adminValue.UserID}, nil); !invalid(problem, "user_id") {
+		t.Errorf("Expected the device to be refused another user, got %+v", problem)
+	}
+	if explicit := station.createValue(valueBody{SignalID: signal.ID, DigitalValue: &on, UserID: &operatorID}); *explicit.UserID != operatorID {
+		t.Errorf("Expected the operator to be kept, got %+v", explicit)
+	}
+
+	scan(station, device.ID, "operator-badge", "")
+	if value := send(); *value.UserID != *adminValue.UserID {
+		t.Errorf("Expected values after the logout to go to the device's user, got %d", *value.UserID)
+	}
+}
+
+func TestBadge_RFIDLookup(t *testing.T) {
+	a, station, device, _ := setupBadge(t)
+
+	var user models.User
+	station.must(http.MethodGet, "/users/rfid/operator-badge", nil, nil, &user)
+	if user.Name != "Operator" {
+		t.Fatalf("Expected the operator by RFID, got %+v", user)
+	}
+	if problem := station.call(http.MethodGet, "/users/rfid/former-badge", nil, nil, nil); problem == nil {
+		t.Error("Expected inactive users not to be found")
+	}
+	if problem := station.call(http.MethodGet, "/users/rfid/stranger-badge", nil, nil, nil); problem == nil || problem.Status != http.StatusNotFound {
+		t.Errorf("Expected an unknown badge to be not found, got %+v", problem)
+	}
+	if problem := a.call(http.MethodGet, "/users/rfid/operator-badge", nil, nil, nil); problem == nil || problem.Status != http.StatusUnauthorized {
+		t.Errorf("Expected user tokens to be rejected, got %+v", problem)
+	}
+
+	got := scans(a, device.ID)
+	if len(got) != 3 || got[2].Result != models.BadgeLookup || got[2].UserID == nil || *got[2].UserID != user.ID {
+		t.Errorf("Expected the lookups to be recorded, got %+v", got)
+	}
+}
+
+func TestBadge_UserMustBeOrgMember(t *testing.T) {
+	a, station, device, signal := setupBadge(t)
+
+	// A user who only belongs to another organization
+	var other handlers.OrganizationWithRole
+	a.must(http.MethodPost, "/orgs", nil, handlers.OrganizationRequest{Name: "Other plant"}, &other)
+	outsider := a.switchOrg(other.ID).user(handlers.CreateUserRequest{Name: "Outsider", Email: "outsider@example.com", Password: adminPassword})
+
+	on := true
+	for name, caller := range map[string]*testAPI{"device": station, "user": a} {
+		if problem := caller.call(http.MethodPost, "/signal-values", nil, valueBody{SignalID: signal.ID, DigitalValue: &on, UserID: &outsider.ID}, nil); !invalid(problem, "user_id") {
+			t.Errorf("Expected the %s to be refused the outsider, got %+v", name, problem)
+		}
+	}
+	device.UserID = &outsider.ID
+	if problem := a.call(http.MethodPut, idPath("/devices/%d", device.ID), nil, device, nil); problem == nil || problem.Code != apierror.CodeValidation {
+		t.Errorf("Expected the device's user to be refused the outsider, got %+v", problem)
+	}
+
+	// Users may still attribute values to other members, e.g. when entering them by hand
+	var operator models.User
+	station.must(http.MethodGet, "/users/rfid/operator-badge", nil, nil, &operator)
+	if value := a.createValue(valueBody{SignalID: signal.ID, DigitalValue: &on, UserID: &operator.ID}); *value.UserID != operator.ID {
+		t.Errorf("Expected the value to be attributed to the operator, got %+v", value)
+	}
+}
+
+func TestBadge_ListFilters(t *testing.T) {
+	a, station, device, _ := setupBadge(t)
+	resp, _ := scan(station, device.ID, "operator-badge", "")
+	operatorID := resp.Session.UserID
+	scan(station, device.ID, "admin-badge", "")
+	scan(station, device.ID, "stranger-badge", "")
+
+	sessions, scansPath := idPath("/devices/%d/sessions", device.ID), idPath("/devices/%d/badge-scans", device.ID)
+	now := time.Now()
+	for _, tc := range []struct {
+		path  string
+		query url.Values
+		want  int
+	}{
+		{sessions, nil, 2},
+		{sessions, url.Values{"user_id": {fmt.Sprint(operatorID)}}, 1},
+		{sessions, url.Values{"open": {"true"}}, 1},
+		{sessions, dateRange(now.Add(time.Hour), now.Add(2*time.Hour)), 1}, // The open session
+		{scansPath, url.Values{"user_id": {fmt.Sprint(operatorID)}}, 1},
+		{scansPath, dateRange(now.Add(-time.Hour), now.Add(time.Hour)), 3},
+		{scansPath, dateRange(now.Add(time.Hour), now.Add(2*time.Hour)), 0},
+	} {
+		var list []map[string]any
+		a.must(http.MethodGet, tc.path, tc.query, nil, &list)
+		if len(list) != tc.want {
+			t.Errorf("GET %s?%s: expected %d entries, got %d", tc.path, tc.query.Encode(), tc.want, len(list))
+		}
+	}
+
+	// Bad IDs and dates are rejected rather than compared as text
+	for _, path := range []string{sessions, scansPath} {
+		for _, tc := range []struct {
+			query url.Values
+			field string
+		}{
+			{url.Values{"user_id": {"operator"}}, "user_id"},
+			{url.Values{"from_date": {"yesterday"}}, "from_date"},
+			{url.Values{"to_date": {"2024-13-01"}}, "to_date"},
+			{dateRange(now, now.Add(-time.Hour)), "to_date"},
+		} {
+			if problem := a.call(http.MethodGet, path, tc.query, nil, nil); !invalid(problem, tc.field) {
+				t.Errorf("GET %s?%s: expected a validation error for %s, got %+v", path, tc.query.Encode(), tc.field, problem)
+			}
+		}
+	}
+}
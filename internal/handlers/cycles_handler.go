@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// CycleRequest records an assembly cycle. Devices record their own cycles; users name the
+// device. Without a user_id the cycle is attributed to the operator badged in at the device,
+// then to the device's user.
+type CycleRequest struct {
+	DeviceID        uint         `json:"device_id,omitempty"`
+	UserID          *uint        `json:"user_id,omitempty"`
+	StartedAt       time.Time    `json:"started_at" validate:"required"`
+	EndedAt         *time.Time   `json:"ended_at,omitempty"`          // Defaults to the time the API receives the cycle
+	TargetCycleTime *float64     `json:"target_cycle_time,omitempty"` // Ideal cycle time in seconds
+	SetValue        *float64     `json:"set_value,omitempty"`
+	Value           *float64     `json:"value,omitempty"`
+	MotionWaste     *float64     `json:"motion_waste,omitempty" validate:"min=0"`
+	Result          string       `json:"result" validate:"required,oneof=pass fail"`
+	Metadata        models.JSONB `json:"metadata,omitempty"`
+}
+
+// Validate checks the cycle ends after it starts and the ideal cycle time is positive
+func (req *CycleRequest) Validate(errs *validate.Errors) {
+	if req.EndedAt != nil && !req.StartedAt.IsZero() && req.EndedAt.Before(req.StartedAt) {
+		errs.Add("ended_at", validate.CodeInvalid, "ended_at must not be before started_at")
+	}
+	if req.TargetCycleTime != nil && *req.TargetCycleTime <= 0 {
+		errs.Add("target_cycle_time", validate.CodeTooSmall, "target_cycle_time must be positive")
+	}
+}
+
+// CyclesHandler lists and records assembly cycles
+func CyclesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getCycles(w, r)
+	case "POST":
+		createCycle(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CycleHandler gets and deletes an assembly cycle
+func CycleHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if cycle := pathCycle(w, r); cycle != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(cycle)
+		}
+	case "DELETE":
+		deleteCycle(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pathCycle loads the cycle of the request path with its device and operator. On failure it
+// writes the error response and returns nil.
+func pathCycle(w http.ResponseWriter, r *http.Request) *models.Cycle {
+	cycleID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid cycle ID", http.StatusBadRequest)
+		return nil
+	}
+	var cycle models.Cycle
+	if result := orgDB(r).Preload("Device").Preload("User").First(&cycle, cycleID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "cycle")
+		return nil
+	}
+	return &cycle
+}
+
+func getCycles(w http.ResponseWriter, r *http.Request) {
+	query := orgDB(r).Preload("User")
+	params := r.URL.Query()
+	if deviceID := params.Get("device_id"); deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if userID := params.Get("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if result := params.Get("result"); result != "" {
+		query = query.Where("result = ?", result)
+	}
+	if fromDate := params.Get("from_date"); fromDate != "" {
+		query = query.Where("started_at >= ?", fromDate)
+	}
+	if toDate := params.Get("to_date"); toDate != "" {
+		query = query.Where("started_at <= ?", toDate)
+	}
+
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+
+	var cycles []models.Cycle
+	result := query.Order("started_at DESC, id DESC").Limit(limitParam(r, 1000, 10000)).Offset(offset).Find(&cycles)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "cycles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cycles)
+}
+
+func createCycle(w http.ResponseWriter, r *http.Request) {
+	var req CycleRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Devices record cycles for themselves only
+	if r.Header.Get("X-Auth-Type") == "device" {
+		authDeviceID, _ := strconv.ParseUint(r.Header.Get("X-Device-ID"), 10, 32)
+		if req.DeviceID != 0 && req.DeviceID != uint(authDeviceID) {
+			apierror.Error(w, r, "Device ID mismatch", http.StatusForbidden)
+			return
+		}
+		req.DeviceID = uint(authDeviceID)
+	}
+	if req.DeviceID == 0 {
+		apierror.Validation(w, r, validate.Errors{{Field: "device_id", Code: validate.CodeRequired, Message: "device_id is required"}})
+		return
+	}
+
+	var device models.Device
+	if result := orgDB(r).First(&device, req.DeviceID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "device")
+		return
+	}
+
+	if req.UserID != nil {
+		if !requireOrgMember(w, r, *req.UserID) {
+			return
+		}
+	} else {
+		operatorID, err := openSessionOperator(r, device.ID)
+		if err != nil {
+			apierror.Database(w, r, err, "operator session")
+			return
+		}
+		req.UserID = operatorID
+		if req.UserID == nil {
+			req.UserID = device.UserID
+		}
+	}
+
+	endedAt := time.Now()
+	if req.EndedAt != nil {
+		endedAt = *req.EndedAt
+	}
+	if endedAt.Before(req.StartedAt) {
+		apierror.Validation(w, r, validate.Errors{{Field: "started_at", Code: validate.CodeInvalid, Message: "started_at must not be in the future"}})
+		return
+	}
+
+	cycle := models.Cycle{
+		DeviceID:        device.ID,
+		UserID:          req.UserID,
+		StartedAt:       req.StartedAt,
+		EndedAt:         endedAt,
+		CycleTime:       endedAt.Sub(req.StartedAt).Seconds(),
+		TargetCycleTime: req.TargetCycleTime,
+		SetValue:        req.SetValue,
+		Value:           req.Value,
+		MotionWaste:     req.MotionWaste,
+		Result:          req.Result,
+		Metadata:        req.Metadata,
+	}
+	if result := orgDB(r).Create(&cycle); result.Error != nil {
+		apierror.Database(w, r, result.Error, "cycle")
+		return
+	}
+
+	audit.Record(r, audit.ActionCreate, "cycle", cycle.ID, nil, cycle)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cycle)
+}
+
+func deleteCycle(w http.ResponseWriter, r *http.Request) {
+	cycle := pathCycle(w, r)
+	if cycle == nil {
+		return
+	}
+
+	if result := orgDB(r).Delete(cycle); result.Error != nil {
+		apierror.Database(w, r, result.Error, "cycle")
+		return
+	}
+
+	audit.Record(r, audit.ActionDelete, "cycle", cycle.ID, *cycle, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
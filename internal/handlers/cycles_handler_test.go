@@ -0,0 +1,32 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+// cycle records a cycle of the device from start, lasting a minute
+func (a *testAPI) cycle(deviceID uint, start time.Time, result string, target *float64) models.Cycle {
+	a.t.Helper()
+	end := start.Add(time.Minute)
+	var cycle models.Cycle
+	a.must(http.MethodPost, "/cycles", nil, handlers.CycleRequest{DeviceID: deviceID, StartedAt: start, EndedAt: &end, Result: result, TargetCycleTime: target}, &cycle)
+	return cycle
+}
+
+func TestCycles_Audited(t *testing.T) {
+	a := setupAPI(t)
+	cycle := a.cycle(a.device("press-1").ID, time.Now().Add(-time.Minute), "pass", nil)
+	a.must(http.MethodDelete, idPath("/cycles/%d", cycle.ID), nil, nil, nil)
+
+	var entries []models.AuditLog
+	a.must(http.MethodGet, "/audit", url.Values{"resource_type": {"cycle"}, "resource_id": {idPath("%d", cycle.ID)}}, nil, &entries)
+	if len(entries) != 2 || entries[0].Action != "delete" || entries[1].Action != "create" {
+		t.Errorf("Expected the create and delete of the cycle to be audited, got %+v", entries)
+	}
+}
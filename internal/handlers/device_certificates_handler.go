@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+	"data-storage/internal/pki"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterCertificateRequest registers a client certificate of a device, either the PEM
+// certificate itself or only its SHA-256 fingerprint
+type RegisterCertificateRequest struct {
+	Certificate string `json:"certificate,omitempty"` // PEM encoded
+	Fingerprint string `json:"fingerprint,omitempty"` // Hex, optionally colon-separated
+}
+
+// Validate checks that exactly one of certificate and fingerprint is set
+func (req *RegisterCertificateRequest) Validate(errs *validate.Errors) {
+	if (req.Certificate == "") == (req.Fingerprint == "") {
+		errs.Add("certificate", validate.CodeRequired, "Either certificate or fingerprint is required")
+	}
+}
+
+// IssueCertificateRequest asks the built-in CA for a device certificate. Without a CSR a key
+// pair is generated and its private key returned once.
+type IssueCertificateRequest struct {
+	CSR          string `json:"csr,omitempty"` // PEM encoded certificate signing request
+	ValidityDays int    `json:"validity_days,omitempty" validate:"min=0,max=3650"`
+}
+
+// IssueCertificateResponse holds an issued certificate. The private key is only included
+// when it was generated by the server, and is not stored.
+type IssueCertificateResponse struct {
+	Certificate      models.DeviceCertificate `json:"certificate"`
+	CertificatePEM   string                   `json:"certificate_pem"`
+	PrivateKeyPEM    string                   `json:"private_key_pem,omitempty"`
+	CACertificatePEM string                   `json:"ca_certificate_pem"`
+}
+
+// RevokeCertificateRequest is the body of a certificate revocation
+type RevokeCertificateRequest struct {
+	Reason string `json:"reason,omitempty" validate:"max=255"`
+}
+
+// DeviceCertificatesHandler lists and registers the client certificates of a device
+func DeviceCertificatesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getDeviceCertificates(w, r)
+	case "POST":
+		registerDeviceCertificate(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pathDevice loads the device of the request path. On failure it writes the error
+// response and returns nil.
+func pathDevice(w http.ResponseWriter, r *http.Request) *models.Device {
+	deviceID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
+		return nil
+	}
+	var device models.Device
+	if result := orgDB(r).First(&device, deviceID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "device")
+		return nil
+	}
+	return &device
+}
+
+func getDeviceCertificates(w http.ResponseWriter, r *http.Request) {
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	query := orgDB(r).Where("device_id = ?", device.ID).Order("id")
+	if r.URL.Query().Get("revoked") == "false" {
+		query = query.Where("revoked_at IS NULL")
+	}
+	var certificates []models.DeviceCertificate
+	if result := query.Find(&certificates); result.Error != nil {
+		apierror.Database(w, r, result.Error, "device certificates")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificates)
+}
+
+func registerDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	var req RegisterCertificateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	certificate := models.DeviceCertificate{DeviceID: device.ID}
+	if req.Certificate != "" {
+		cert, err := pki.ParseCertificate(req.Certificate)
+		if err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "certificate", Code: validate.CodeInvalid, Message: err.Error()}})
+			return
+		}
+		if time.Now().After(cert.NotAfter) {
+			apierror.Validation(w, r, validate.Errors{{Field: "certificate", Code: validate.CodeInvalid, Message: "The certificate has expired"}})
+			return
+		}
+		describeCertificate(&certificate, cert)
+	} else {
+		fingerprint, err := pki.NormalizeFingerprint(req.Fingerprint)
+		if err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "fingerprint", Code: validate.CodeInvalid, Message: err.Error()}})
+			return
+		}
+		certificate.Fingerprint = fingerprint
+	}
+
+	if result := orgDB(r).Create(&certificate); result.Error != nil {
+		apierror.Database(w, r, result.Error, "device certificate")
+		return
+	}
+
+	audit.Record(r, audit.ActionCreate, "device_certificate", certificate.ID, nil, certificate)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(certificate)
+}
+
+// IssueDeviceCertificateHandler issues a client certificate for a device from the built-in CA
+func IssueDeviceCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	ca, err := pki.Authority()
+	if err != nil {
+		apierror.Error(w, r, "No device CA is configured; register a certificate instead", http.StatusNotImplemented)
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	var req IssueCertificateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var response IssueCertificateResponse
+	var publicKey crypto.PublicKey
+	if req.CSR != "" {
+		csr, err := pki.ParseCSR(req.CSR)
+		if err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "csr", Code: validate.CodeInvalid, Message: err.Error()}})
+			return
+		}
+		publicKey = csr.PublicKey
+	} else {
+		key, err := pki.GenerateKey()
+		if err == nil {
+			var keyPEM []byte
+			keyPEM, err = pki.EncodeKey(key)
+			response.PrivateKeyPEM = string(keyPEM)
+		}
+		if err != nil {
+			logger.ErrorContext(r.Context(), "Error generating device key", "error", err)
+			apierror.Error(w, r, "Error generating device key", http.StatusInternalServerError)
+			return
+		}
+		publicKey = key.Public()
+	}
+
+	// The subject names the device; the certificate is identified by its fingerprint
+	validity := time.Duration(req.ValidityDays) * 24 * time.Hour
+	cert, err := ca.Issue("device-"+strconv.FormatUint(uint64(device.ID), 10), publicKey, validity)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error issuing device certificate", "error", err)
+		apierror.Error(w, r, "Error issuing device certificate", http.StatusInternalServerError)
+		return
+	}
+
+	certificate := models.DeviceCertificate{DeviceID: device.ID, Issued: true}
+	describeCertificate(&certificate, cert)
+	if result := orgDB(r).Create(&certificate); result.Error != nil {
+		apierror.Database(w, r, result.Error, "device certificate")
+		return
+	}
+
+	audit.Record(r, audit.ActionCreate, "device_certificate", certificate.ID, nil, certificate)
+
+	response.Certificate = certificate
+	response.CertificatePEM = string(pki.EncodeCertificate(cert))
+	response.CACertificatePEM = ca.CertificatePEM()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeDeviceCertificateHandler revokes a client certificate; requests presenting it are
+// rejected from then on
+func RevokeDeviceCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	device := pathDevice(w, r)
+	if device == nil {
+		return
+	}
+	certificateID, err := strconv.ParseUint(mux.Vars(r)["certificate_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid certificate ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RevokeCertificateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var certificate models.DeviceCertificate
+	result := orgDB(r).Where("device_id = ?", device.ID).First(&certificate, certificateID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "device certificate")
+		return
+	}
+	if certificate.RevokedAt != nil {
+		apierror.Error(w, r, "The certificate is already revoked", http.StatusConflict)
+		return
+	}
+
+	before := certificate
+	now := time.Now()
+	certificate.RevokedAt = &now
+	certificate.RevocationReason = req.Reason
+	result = orgDB(r).Model(&certificate).Select("revoked_at", "revocation_reason").Updates(&certificate)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "device certificate")
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "device_certificate", certificate.ID, before, certificate)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certificate)
+}
+
+// describeCertificate copies the identifying fields of cert into the record
+func describeCertificate(record *models.DeviceCertificate, cert *x509.Certificate) {
+	record.Fingerprint = pki.Fingerprint(cert)
+	record.Subject = cert.Subject.String()
+	record.Issuer = cert.Issuer.String()
+	record.SerialNumber = cert.SerialNumber.Text(16)
+	record.NotBefore = &cert.NotBefore
+	record.NotAfter = &cert.NotAfter
+}
@@ -1,17 +1,18 @@
-﻿package handlers
+package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
 	"data-storage/internal/auth"
-	"data-storage/internal/db"
 	"data-storage/internal/models"
+	"data-storage/internal/ratelimit"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 )
 
 // DevicesHandler handles device CRUD operations
@@ -22,7 +23,7 @@ func DevicesHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		createDevice(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -36,13 +37,13 @@ func DeviceHandler(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteDevice(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func getAllDevices(w http.ResponseWriter, r *http.Request) {
 	var devices []models.Device
-	query := db.GetDB().Preload("User")
+	query := orgDB(r).Preload("User")
 
 	// Filter by user_id if provided
 	if userID := r.URL.Query().Get("user_id"); userID != "" {
@@ -57,8 +58,7 @@ func getAllDevices(w http.ResponseWriter, r *http.Request) {
 
 	result := query.Find(&devices)
 	if result.Error != nil {
-		log.Printf("Error fetching devices: %v", result.Error)
-		http.Error(w, "Error fetching devices", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "devices")
 		return
 	}
 
@@ -70,25 +70,20 @@ func getDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Device ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Device ID required", http.StatusBadRequest)
 		return
 	}
 
 	deviceID, err := strconv.ParseUint(deviceIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
 		return
 	}
 
 	var device models.Device
-	result := db.GetDB().Preload("User").First(&device, deviceID)
+	result := orgDB(r).Preload("User").First(&device, deviceID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Device not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching device: %v", result.Error)
-			http.Error(w, "Error fetching device", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
@@ -98,29 +93,37 @@ func getDevice(w http.ResponseWriter, r *http.Request) {
 
 func createDevice(w http.ResponseWriter, r *http.Request) {
 	var device models.Device
-	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &device, "name") {
+		return
+	}
+	if device.UserID != nil && !requireOrgMember(w, r, *device.UserID) {
+		return
+	}
+	if (device.RateLimitPerMinute != nil || device.DailyQuota != nil) && !requireOrgAdmin(w, r) {
 		return
 	}
+	device.RateLimitPerMinute = limitOverride(device.RateLimitPerMinute)
+	device.DailyQuota = limitOverride(device.DailyQuota)
 
 	// Generate auth token if not provided
 	if device.AuthToken == "" {
 		token, err := auth.GenerateDeviceToken()
 		if err != nil {
-			log.Printf("Error generating device token: %v", err)
-			http.Error(w, "Error generating device token", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "Error generating device token", "error", err)
+			apierror.Error(w, r, "Error generating device token", http.StatusInternalServerError)
 			return
 		}
 		device.AuthToken = token
 	}
 
-	result := db.GetDB().Create(&device)
+	result := orgDB(r).Create(&device)
 	if result.Error != nil {
-		log.Printf("Error creating device: %v", result.Error)
-		http.Error(w, "Error creating device", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
+	audit.Record(r, audit.ActionCreate, "device", device.ID, nil, device)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(device)
@@ -130,32 +133,32 @@ func updateDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Device ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Device ID required", http.StatusBadRequest)
 		return
 	}
 
 	deviceID, err := strconv.ParseUint(deviceIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
 		return
 	}
 
 	var device models.Device
-	result := db.GetDB().First(&device, deviceID)
+	result := orgDB(r).First(&device, deviceID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Device not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error fetching device", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
 	var updateData models.Device
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &updateData, "name") {
 		return
 	}
+	if updateData.UserID != nil && !requireOrgMember(w, r, *updateData.UserID) {
+		return
+	}
+
+	before := device
 
 	// Update fields (don't update auth_token or id)
 	device.Name = updateData.Name
@@ -167,43 +170,132 @@ func updateDevice(w http.ResponseWriter, r *http.Request) {
 		device.UserID = updateData.UserID
 	}
 
-	result = db.GetDB().Save(&device)
+	// Limit overrides are left alone when omitted or sent back unchanged; changing them takes
+	// an org admin, since members could otherwise lift their own devices' limits
+	rateLimitChanged := updateData.RateLimitPerMinute != nil && !equalLimit(updateData.RateLimitPerMinute, device.RateLimitPerMinute)
+	quotaChanged := updateData.DailyQuota != nil && !equalLimit(updateData.DailyQuota, device.DailyQuota)
+	if (rateLimitChanged || quotaChanged) && !requireOrgAdmin(w, r) {
+		return
+	}
+	if rateLimitChanged {
+		device.RateLimitPerMinute = limitOverride(updateData.RateLimitPerMinute)
+	}
+	if quotaChanged {
+		device.DailyQuota = limitOverride(updateData.DailyQuota)
+	}
+
+	result = orgDB(r).Save(&device)
 	if result.Error != nil {
-		log.Printf("Error updating device: %v", result.Error)
-		http.Error(w, "Error updating device", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
+	ratelimit.InvalidateDeviceLimit(device.ID)
+	audit.Record(r, audit.ActionUpdate, "device", device.ID, before, device)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(device)
 }
 
+// limitOverride stores a device limit override; 0 clears it so the global limit applies
+func limitOverride[T int | int64](limit *T) *T {
+	if limit == nil || *limit == 0 {
+		return nil
+	}
+	return limit
+}
+
+// equalLimit reports whether two limit overrides have the same effect
+func equalLimit[T int | int64](a, b *T) bool {
+	a, b = limitOverride(a), limitOverride(b)
+	return a == b || (a != nil && b != nil && *a == *b)
+}
+
 func deleteDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	deviceIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Device ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Device ID required", http.StatusBadRequest)
 		return
 	}
 
 	deviceID, err := strconv.ParseUint(deviceIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	// Load the device first so the audit log keeps its last state
+	var device models.Device
+	result := orgDB(r).First(&device, deviceID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
-	result := db.GetDB().Delete(&models.Device{}, deviceID)
+	result = orgDB(r).Delete(&device)
 	if result.Error != nil {
-		log.Printf("Error deleting device: %v", result.Error)
-		http.Error(w, "Error deleting device", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Device not found", http.StatusNotFound)
+		apierror.Error(w, r, "Device not found", http.StatusNotFound)
 		return
 	}
 
+	ratelimit.InvalidateDeviceLimit(device.ID)
+	audit.Record(r, audit.ActionDelete, "device", device.ID, device, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// DeviceQuotaHandler returns the device's daily ingestion quota and recent usage
+func DeviceQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceIDStr, ok := vars["id"]
+	if !ok {
+		apierror.Error(w, r, "Device ID required", http.StatusBadRequest)
+		return
+	}
+
+	deviceID, err := strconv.ParseUint(deviceIDStr, 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var device models.Device
+	result := orgDB(r).First(&device, deviceID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "device")
+		return
+	}
+
+	// Number of past days of usage to include
+	days := 7
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 0 {
+			apierror.Error(w, r, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		if days > 90 {
+			days = 90
+		}
+	}
+
+	status, err := ratelimit.GetQuotaStatus(&device, time.Now(), days)
+	if err != nil {
+		apierror.Database(w, r, err, "device quota")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
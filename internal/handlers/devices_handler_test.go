@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/db"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+	"data-storage/internal/ratelimit"
+)
+
+func TestDevices_Limits(t *testing.T) {
+	a := setupAPI(t)
+	device, station := a.registerDevice("press-1")
+	signal := a.signal(models.Signal{DeviceID: device.ID, Name: "temperature", SignalType: "analogic"})
+	send := func(v float64) *apierror.Problem {
+		t.Helper()
+		return station.call(http.MethodPost, "/signal-values", nil, valueBody{SignalID: signal.ID, Value: &v}, nil)
+	}
+
+	// A value the database fails to store doesn't use the device's quota
+	trigger := "CREATE TRIGGER reject_value BEFORE INSERT ON signal_values WHEN NEW.value = 13 BEGIN SELECT RAISE(ABORT, 'rejected'); END"
+	if err := db.GetDB().Exec(trigger).Error; err != nil {
+		t.Fatalf("Error creating trigger: %v", err)
+	}
+	if problem := send(13); problem == nil {
+		t.Fatal("Expected the rejected insert to fail")
+	}
+	if problem := send(1); problem != nil {
+		t.Fatalf("Error creating value: %+v", problem)
+	}
+	var status ratelimit.QuotaStatus
+	a.must(http.MethodGet, idPath("/devices/%d/quota", device.ID), nil, nil, &status)
+	if status.Used != 1 {
+		t.Errorf("Expected only the stored value to be counted, got %d", status.Used)
+	}
+
+	// A changed rate limit applies to the next request, not once the cached one expires
+	limit := 1
+	device.RateLimitPerMinute = &limit
+	a.must(http.MethodPut, idPath("/devices/%d", device.ID), nil, device, nil)
+	if problem := send(2); problem != nil {
+		t.Fatalf("Error creating value: %+v", problem)
+	}
+	if problem := send(3); problem == nil || problem.Code != apierror.CodeRateLimited {
+		t.Errorf("Expected the new limit to apply, got %+v", problem)
+	}
+}
+
+func TestDevices_LimitsNeedAdmin(t *testing.T) {
+	a := setupAPI(t)
+	a.user(handlers.CreateUserRequest{Name: "Member", Email: "member@example.com", Password: adminPassword})
+	member := a.login("member@example.com", adminPassword)
+
+	zero, limit := 0, 10
+	if problem := member.call(http.MethodPost, "/devices", nil, models.Device{Name: "press-2", RateLimitPerMinute: &zero}, nil); problem == nil || problem.Status != http.StatusForbidden {
+		t.Errorf("Expected members not to set limits on create, got %+v", problem)
+	}
+	var device models.Device
+	a.must(http.MethodPost, "/devices", nil, models.Device{Name: "press-1", RateLimitPerMinute: &limit}, &device)
+	path := idPath("/devices/%d", device.ID)
+
+	// Members may edit the device as long as they send the limits back unchanged
+	device.Location = "hall B"
+	if problem := member.call(http.MethodPut, path, nil, device, nil); problem != nil {
+		t.Errorf("Expected members to edit other fields, got %+v", problem)
+	}
+	device.RateLimitPerMinute = &zero
+	if problem := member.call(http.MethodPut, path, nil, device, nil); problem == nil || problem.Status != http.StatusForbidden {
+		t.Errorf("Expected members not to change limits, got %+v", problem)
+	}
+
+	// 0 restores the global limit instead of disabling it
+	var updated models.Device
+	if problem := a.call(http.MethodPut, path, nil, device, &updated); problem != nil || updated.RateLimitPerMinute != nil {
+		t.Errorf("Expected the override to be cleared, got %+v, %+v", updated, problem)
+	}
+}
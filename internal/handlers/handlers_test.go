@@ -0,0 +1,311 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"data-storage/internal/api"
+	"data-storage/internal/apierror"
+	"data-storage/internal/db"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+	"data-storage/internal/notify"
+	"data-storage/internal/ratelimit"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	adminEmail    = "admin@example.com"
+	adminPassword = "correct-horse-battery"
+)
+
+// testAPI calls the API routes on an in-memory database with the token of a user or device
+type testAPI struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+// setupAPI runs the API on an in-memory database with the organization "Plant" and its
+// admin, whose badge is "admin-badge", and returns the API as the admin
+func setupAPI(t *testing.T) *testAPI {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	sqlDB, _ := database.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Setup(database); err != nil {
+		t.Fatalf("Error setting up database: %v", err)
+	}
+	ratelimit.Init(ratelimit.DefaultConfig())
+
+	org := models.Organization{Name: "Plant", Slug: "plant"}
+	user := models.User{Name: "Admin", Email: adminEmail, Rfid: "admin-badge"}
+	if err := user.SetPassword(adminPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	membership := models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: models.RoleAdmin}
+	if err := database.Create(&membership).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(api.NewRouter())
+	t.Cleanup(server.Close)
+	return (&testAPI{t: t, url: server.URL}).login(adminEmail, adminPassword)
+}
+
+// login returns the API as the user
+func (a *testAPI) login(email, password string) *testAPI {
+	a.t.Helper()
+	var resp handlers.LoginResponse
+	a.anonymous().must(http.MethodPost, "/auth/login", nil, handlers.LoginRequest{Email: email, Password: password}, &resp)
+	return a.withToken(resp.Token)
+}
+
+// tryLogin logs in and returns the problem of a failed login, or nil
+func (a *testAPI) tryLogin(email, password string) *apierror.Problem {
+	a.t.Helper()
+	return a.anonymous().call(http.MethodPost, "/auth/login", nil, handlers.LoginRequest{Email: email, Password: password}, nil)
+}
+
+// switchOrg returns the API as the same user in another of the user's organizations
+func (a *testAPI) switchOrg(organizationID uint) *testAPI {
+	a.t.Helper()
+	var resp handlers.LoginResponse
+	a.must(http.MethodPost, "/auth/switch-org", nil, handlers.SwitchOrgRequest{OrganizationID: organizationID}, &resp)
+	return a.withToken(resp.Token)
+}
+
+// anonymous returns the API without a token
+func (a *testAPI) anonymous() *testAPI {
+	return a.withToken("")
+}
+
+func (a *testAPI) withToken(token string) *testAPI {
+	return &testAPI{t: a.t, url: a.url, token: token}
+}
+
+// call sends the request and decodes the response into out. It returns the problem of an
+// error response, or nil.
+func (a *testAPI) call(method, path string, query url.Values, body, out any) *apierror.Problem {
+	a.t.Helper()
+	var reader bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatalf("Error encoding %s %s: %v", method, path, err)
+		}
+		reader.Reset(data)
+	}
+	target := a.url + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, &reader)
+	if err != nil {
+		a.t.Fatalf("Error creating %s %s: %v", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		a.t.Fatalf("Error sending %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		problem := apierror.Problem{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(&problem)
+		return &problem
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			a.t.Fatalf("Error decoding %s %s: %v", method, path, err)
+		}
+	}
+	return nil
+}
+
+// must sends the request like call and fails the test on an error response
+func (a *testAPI) must(method, path string, query url.Values, body, out any) {
+	a.t.Helper()
+	if problem := a.call(method, path, query, body, out); problem != nil {
+		a.t.Fatalf("%s %s: %d %s: %s %v", method, path, problem.Status, problem.Code, problem.Detail, problem.Errors)
+	}
+}
+
+// user creates a user in the organization
+func (a *testAPI) user(req handlers.CreateUserRequest) models.User {
+	a.t.Helper()
+	var user models.User
+	a.must(http.MethodPost, "/users", nil, req, &user)
+	return user
+}
+
+// registerDevice registers a device and returns it with the API as the device
+func (a *testAPI) registerDevice(name string) (models.Device, *testAPI) {
+	a.t.Helper()
+	var resp handlers.RegisterDeviceResponse
+	a.must(http.MethodPost, "/auth/register-device", nil, handlers.RegisterDeviceRequest{Name: name}, &resp)
+	return resp.Device, a.withToken(resp.AuthToken)
+}
+
+// device creates a device of the admin
+func (a *testAPI) device(name string) models.Device {
+	a.t.Helper()
+	var device models.Device
+	a.must(http.MethodPost, "/devices", nil, models.Device{Name: name}, &device)
+	return device
+}
+
+// signal creates a signal
+func (a *testAPI) signal(signal models.Signal) models.Signal {
+	a.t.Helper()
+	a.must(http.MethodPost, "/signals", nil, signal, &signal)
+	return signal
+}
+
+// valueBody is the body of a new signal value; models.SignalValue would also send its
+// signal as an empty object
+type valueBody struct {
+	SignalID       uint       `json:"signal_id"`
+	UserID         *uint      `json:"user_id,omitempty"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	Value          *float64   `json:"value,omitempty"`
+	DigitalValue   *bool      `json:"digital_value,omitempty"`
+	Samples        []float64  `json:"samples,omitempty"`
+	SampleInterval *float64   `json:"sample_interval,omitempty"`
+}
+
+// value creates an analogic value
+func (a *testAPI) value(signalID uint, value float64, at time.Time) models.SignalValue {
+	a.t.Helper()
+	return a.createValue(valueBody{SignalID: signalID, Value: &value, Timestamp: &at})
+}
+
+// state creates a digital value
+func (a *testAPI) state(signalID uint, on bool, at time.Time) models.SignalValue {
+	a.t.Helper()
+	return a.createValue(valueBody{SignalID: signalID, DigitalValue: &on, Timestamp: &at})
+}
+
+func (a *testAPI) createValue(body valueBody) models.SignalValue {
+	a.t.Helper()
+	var value models.SignalValue
+	a.must(http.MethodPost, "/signal-values", nil, body, &value)
+	return value
+}
+
+// idPath formats a path with IDs
+func idPath(format string, ids ...uint) string {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// dateRange is the query of a date range
+func dateRange(from, to time.Time) url.Values {
+	return url.Values{"from_date": {from.Format(time.RFC3339)}, "to_date": {to.Format(time.RFC3339)}}
+}
+
+// with returns a copy of the query with the parameters added
+func with(q url.Values, pairs ...string) url.Values {
+	out := url.Values{}
+	for k, v := range q {
+		out[k] = append([]string(nil), v...)
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out.Add(pairs[i], pairs[i+1])
+	}
+	return out
+}
+
+// invalid reports whether the problem is a validation error whose first field is field
+func invalid(problem *apierror.Problem, field string) bool {
+	return problem != nil && problem.Code == apierror.CodeValidation && len(problem.Errors) > 0 && problem.Errors[0].Field == field
+}
+
+func near(got *float64, want float64) bool {
+	return got != nil && math.Abs(*got-want) < 1e-9
+}
+
+// mailbox collects the messages sent by the API
+type mailbox struct {
+	mu       sync.Mutex
+	messages []notify.Message
+	received chan notify.Message
+}
+
+// useMailbox sends the messages of the API to a mailbox for the rest of the test
+func useMailbox(t *testing.T) *mailbox {
+	box := &mailbox{received: make(chan notify.Message, 10)}
+	notify.Init(box)
+	t.Cleanup(func() { notify.Init(&notify.LogNotifier{}) })
+	return box
+}
+
+func (m *mailbox) Send(ctx context.Context, msg notify.Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, msg)
+	m.mu.Unlock()
+	m.received <- msg
+	return nil
+}
+
+// next waits for the next message
+func (m *mailbox) next(t *testing.T) notify.Message {
+	t.Helper()
+	select {
+	case msg := <-m.received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message sent")
+		return notify.Message{}
+	}
+}
+
+// sentTo returns the number of messages sent to the email
+func (m *mailbox) sentTo(email string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, msg := range m.messages {
+		if msg.To == email {
+			n++
+		}
+	}
+	return n
+}
+
+// withoutLoginLimit lifts the per-IP limit of the login endpoints for the rest of the test
+func withoutLoginLimit(t *testing.T) {
+	limits := ratelimit.DefaultConfig()
+	limits.LoginPerMinute = 0
+	ratelimit.Init(limits)
+	t.Cleanup(func() { ratelimit.Init(ratelimit.DefaultConfig()) })
+}
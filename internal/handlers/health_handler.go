@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"data-storage/internal/db"
+)
+
+// draining is set when shutdown starts so load balancers stop routing new requests here
+var draining atomic.Bool
+
+// StartDraining makes the readiness probe fail from now on
+func StartDraining() {
+	draining.Store(true)
+}
+
+// HealthResponse is the body of the liveness and readiness probes
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// HealthzHandler is the liveness probe: the process is up and serving requests
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadyzHandler is the readiness probe: the database is reachable, the schema is
+// migrated and the server is not shutting down
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	// The probe is public; the error can name the database host and user, so it is only logged
+	if err := db.Ready(ctx); err != nil {
+		logger.WarnContext(r.Context(), "Not ready", "error", err)
+		writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable"})
+		return
+	}
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ready"})
+}
+
+func writeHealth(w http.ResponseWriter, status int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,36 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"data-storage/internal/db"
+	"data-storage/internal/handlers"
+)
+
+func TestReady_HidesDatabaseErrors(t *testing.T) {
+	a := setupAPI(t)
+	var ready handlers.HealthResponse
+	a.anonymous().must(http.MethodGet, "/readyz", nil, nil, &ready)
+	if ready.Status != "ready" {
+		t.Errorf("Expected a ready server, got %+v", ready)
+	}
+
+	sqlDB, err := db.GetDB().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	resp, err := http.Get(a.url + "/readyz")
+	if err != nil {
+		t.Fatalf("Error calling readiness probe: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusServiceUnavailable || strings.TrimSpace(string(body)) != `{"status":"unavailable"}` {
+		t.Errorf("Expected only the unavailable status, got %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,6 @@
+package handlers
+
+import "data-storage/internal/logging"
+
+// logger is shared by all handlers; set its level with LOG_LEVELS=api=<level>
+var logger = logging.Logger("api")
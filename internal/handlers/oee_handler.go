@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/attendance"
+	"data-storage/internal/models"
+	"data-storage/internal/oee"
+	"data-storage/internal/validate"
+)
+
+// maxOEERange limits the date range of one OEE report
+const maxOEERange = 93 * 24 * time.Hour
+
+// OEEReport is the overall equipment effectiveness of devices in a date range
+type OEEReport struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	IdealCycleTime  *float64  `json:"ideal_cycle_time,omitempty"`
+	UnplannedCycles int64     `json:"unplanned_cycles"` // Cycles that started outside every shift, left out of the rows
+	Rows            []oee.Row `json:"rows"`
+}
+
+// OEEReportHandler reports availability, performance, quality and OEE per device, or per
+// device and shift, from the assembly cycles. Planned production time is the active shifts,
+// or the whole range when the organization has none. Where shifts overlap, the time and its
+// cycles count for the shift that started first.
+func OEEReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, ok := timeParam(w, r, "from_date")
+	if !ok {
+		return
+	}
+	to, ok := timeParam(w, r, "to_date")
+	if !ok {
+		return
+	}
+	deviceIDs, ok := idsParam(w, r, "device_id")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	var errs validate.Errors
+	if !to.After(from) {
+		errs.Add("to_date", validate.CodeInvalid, "to_date must be after from_date")
+	} else if to.Sub(from) > maxOEERange {
+		errs.Add("to_date", validate.CodeInvalid, "The date range must not exceed 93 days")
+	}
+	report, err := oee.NewReport(params.Get("group_by"))
+	if err != nil {
+		errs.Add("group_by", validate.CodeOneOf, err.Error())
+	}
+	var idealCycleTime *float64
+	if value := params.Get("ideal_cycle_time"); value != "" {
+		ideal, err := strconv.ParseFloat(value, 64)
+		if err != nil || ideal <= 0 {
+			errs.Add("ideal_cycle_time", validate.CodeInvalid, "ideal_cycle_time must be a positive number of seconds")
+		}
+		idealCycleTime = &ideal
+	}
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		errs.Add("format", validate.CodeOneOf, "format must be one of json, csv")
+	}
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+
+	var shifts []models.Shift
+	if result := orgDB(r).Where("is_active = ?", true).Order("id").Find(&shifts); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shifts")
+		return
+	}
+	schedules := make([]*attendance.Schedule, 0, len(shifts))
+	for _, shift := range shifts {
+		schedule, err := attendance.NewSchedule(shift)
+		if err != nil {
+			logger.WarnContext(r.Context(), "Skipping invalid shift", "shift_id", shift.ID, "error", err)
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+	periods := oee.Periods(schedules, from, to)
+
+	deviceQuery := orgDB(r).Where("is_active = ?", true)
+	if len(deviceIDs) > 0 {
+		deviceQuery = deviceQuery.Where("id IN ?", deviceIDs)
+	}
+	var devices []models.Device
+	if result := deviceQuery.Order("id").Find(&devices); result.Error != nil {
+		apierror.Database(w, r, result.Error, "devices")
+		return
+	}
+	deviceIDs = make([]uint, len(devices))
+	for i, device := range devices {
+		deviceIDs[i] = device.ID
+	}
+
+	// Cycles per device in each period; without an ideal_cycle_time parameter, cycles
+	// without a target cycle time leave the performance unknown
+	var totals []map[uint]oee.Totals
+	var unplanned int64
+	if len(devices) > 0 {
+		var err error
+		totals, unplanned, err = sumCycles(r, deviceIDs, periods, from, to, idealCycleTime)
+		if err != nil {
+			apierror.Database(w, r, err, "cycles")
+			return
+		}
+	}
+	for i, period := range periods {
+		for _, device := range devices {
+			var t oee.Totals
+			if totals != nil {
+				t = totals[i][device.ID]
+			}
+			t.PlannedSeconds = period.End.Sub(period.Start).Seconds()
+			report.Add(device, period, t)
+		}
+	}
+
+	rows := report.Rows()
+	if format == "csv" {
+		writeOEECSV(w, rows)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OEEReport{
+		From:            from,
+		To:              to,
+		IdealCycleTime:  idealCycleTime,
+		UnplannedCycles: unplanned,
+		Rows:            rows,
+	})
+}
+
+// sumCycles adds up the cycles of the devices per period, and counts the cycles that started
+// outside every period. It reads the cycles of [from, to) with one query, ordered by start,
+// and assigns them to the periods in one pass; the periods are ordered and don't overlap.
+func sumCycles(r *http.Request, deviceIDs []uint, periods []oee.Period, from, to time.Time, idealCycleTime *float64) ([]map[uint]oee.Totals, int64, error) {
+	totals := make([]map[uint]oee.Totals, len(periods))
+	for i := range totals {
+		totals[i] = make(map[uint]oee.Totals)
+	}
+
+	rows, err := orgDB(r).Model(&models.Cycle{}).
+		Select("device_id, started_at, cycle_time, target_cycle_time, motion_waste, result").
+		Where("device_id IN ? AND started_at >= ? AND started_at < ?", deviceIDs, from, to).
+		Order("started_at").
+		Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var unplanned int64
+	p := 0
+	for rows.Next() {
+		var cycle models.Cycle
+		if err := orgDB(r).ScanRows(rows, &cycle); err != nil {
+			return nil, 0, err
+		}
+		for p < len(periods) && !cycle.StartedAt.Before(periods[p].End) {
+			p++
+		}
+		if p == len(periods) || cycle.StartedAt.Before(periods[p].Start) {
+			unplanned++
+			continue
+		}
+
+		t := totals[p][cycle.DeviceID]
+		t.Cycles++
+		if cycle.Result == models.CyclePass {
+			t.GoodCycles++
+		}
+		t.RunSeconds += cycle.CycleTime
+		switch {
+		case cycle.TargetCycleTime != nil:
+			t.IdealSeconds += *cycle.TargetCycleTime
+		case idealCycleTime != nil:
+			t.IdealSeconds += *idealCycleTime
+		default:
+			t.WithoutIdeal++
+		}
+		if cycle.MotionWaste != nil {
+			t.MotionWasteSeconds += *cycle.MotionWaste
+		}
+		totals[p][cycle.DeviceID] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return totals, unplanned, nil
+}
+
+// writeOEECSV writes the report rows as a CSV attachment
+func writeOEECSV(w http.ResponseWriter, rows []oee.Row) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="oee.csv"`)
+
+	ratio := func(r *float64) string {
+		if r == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*r, 'f', 4, 64)
+	}
+	seconds := func(s float64) string {
+		return strconv.FormatFloat(s, 'f', 1, 64)
+	}
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"device_id", "device", "shift_id", "shift", "shift_start", "shift_end",
+		"planned_seconds", "run_seconds", "ideal_seconds", "cycles", "good_cycles", "motion_waste_seconds",
+		"availability", "performance", "quality", "oee"})
+	for _, row := range rows {
+		shiftID := ""
+		if row.ShiftID != 0 {
+			shiftID = strconv.FormatUint(uint64(row.ShiftID), 10)
+		}
+		cw.Write([]string{
+			strconv.FormatUint(uint64(row.DeviceID), 10), row.Device,
+			shiftID, row.Shift, timestamp(row.ShiftStart), timestamp(row.ShiftEnd),
+			seconds(row.PlannedSeconds), seconds(row.RunSeconds), seconds(row.IdealSeconds),
+			strconv.FormatInt(row.Cycles, 10), strconv.FormatInt(row.GoodCycles, 10), seconds(row.MotionWasteSeconds),
+			ratio(row.Availability), ratio(row.Performance), ratio(row.Quality), ratio(row.OEE),
+		})
+	}
+	cw.Flush()
+}
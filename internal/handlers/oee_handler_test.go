@@ -0,0 +1,120 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+)
+
+func TestOEE_OverlappingShifts(t *testing.T) {
+	a := setupAPI(t)
+	device := a.device("press-1")
+
+	// Day and Late overlap from 12:00 to 14:00
+	for _, shift := range []handlers.ShiftRequest{{Name: "Day", StartTime: "06:00", EndTime: "14:00"}, {Name: "Late", StartTime: "12:00", EndTime: "20:00"}} {
+		a.must(http.MethodPost, "/shifts", nil, shift, nil)
+	}
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for _, hour := range []int{7, 13, 15, 22} {
+		a.cycle(device.ID, day.Add(time.Duration(hour)*time.Hour), "pass", nil)
+	}
+
+	var report handlers.OEEReport
+	a.must(http.MethodGet, "/reports/oee", with(dateRange(day, day.Add(24*time.Hour)), "group_by", "shift"), nil, &report)
+	if len(report.Rows) != 2 {
+		t.Fatalf("Expected a row per shift, got %+v", report.Rows)
+	}
+	dayRow, late := report.Rows[0], report.Rows[1]
+	if dayRow.Shift != "Day" || dayRow.Cycles != 2 || dayRow.PlannedSeconds != 8*3600 {
+		t.Errorf("Expected Day to keep the overlap and its cycle, got %+v", dayRow)
+	}
+	if late.Shift != "Late" || late.Cycles != 1 || late.PlannedSeconds != 6*3600 {
+		t.Errorf("Expected Late to start when Day ends, got %+v", late)
+	}
+	if report.UnplannedCycles != 1 {
+		t.Errorf("Expected the 22:00 cycle to be unplanned, got %d", report.UnplannedCycles)
+	}
+}
+
+func TestOEE_SumsCyclesPerDevice(t *testing.T) {
+	a := setupAPI(t)
+	devices := []uint{a.device("press-1").ID, a.device("press-2").ID}
+	a.must(http.MethodPost, "/shifts", nil, handlers.ShiftRequest{Name: "Day", StartTime: "06:00", EndTime: "14:00"}, nil)
+
+	// Cycles of both devices interleaved over three days; one without a target cycle time
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	target := 50.0
+	for _, cycle := range []struct {
+		device int
+		at     time.Duration
+		result string
+		target *float64
+	}{
+		{0, 7 * time.Hour, "pass", &target},
+		{1, 8 * time.Hour, "fail", &target},
+		{0, 5 * time.Hour, "pass", &target}, // Before the shift
+		{0, 24*time.Hour + 9*time.Hour, "fail", &target},
+		{1, 48*time.Hour + 10*time.Hour, "pass", nil},
+		{0, 48*time.Hour + 13*time.Hour, "pass", &target},
+	} {
+		a.cycle(devices[cycle.device], day.Add(cycle.at), cycle.result, cycle.target)
+	}
+
+	report := func(pairs ...string) handlers.OEEReport {
+		t.Helper()
+		var report handlers.OEEReport
+		a.must(http.MethodGet, "/reports/oee", with(dateRange(day, day.Add(72*time.Hour)), pairs...), nil, &report)
+		return report
+	}
+
+	got := report()
+	if len(got.Rows) != 2 {
+		t.Fatalf("Expected a row per device, got %+v", got.Rows)
+	}
+	first, second := got.Rows[0], got.Rows[1]
+	if first.Cycles != 3 || first.GoodCycles != 2 || first.RunSeconds != 180 || first.IdealSeconds != 150 || first.PlannedSeconds != 3*8*3600 {
+		t.Errorf("Unexpected totals for press-1: %+v", first)
+	}
+	if second.Cycles != 2 || second.GoodCycles != 1 || second.WithoutIdeal != 1 || second.Performance != nil {
+		t.Errorf("Expected press-2 to have an unknown performance, got %+v", second)
+	}
+	if got.UnplannedCycles != 1 {
+		t.Errorf("Expected the 05:00 cycle to be unplanned, got %d", got.UnplannedCycles)
+	}
+
+	// The parameter stands in for missing target cycle times
+	if rows := report("ideal_cycle_time", "40").Rows; len(rows) != 2 || rows[1].WithoutIdeal != 0 || rows[1].IdealSeconds != 90 {
+		t.Errorf("Expected ideal_cycle_time to fill in, got %+v", rows)
+	}
+}
+
+func TestOEE_DeviceFilter(t *testing.T) {
+	a := setupAPI(t)
+	active, retired := a.device("press-1"), a.device("press-2")
+	retired.IsActive = false
+	a.must(http.MethodPut, idPath("/devices/%d", retired.ID), nil, retired, nil)
+	day := dateRange(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+
+	for _, tc := range []struct {
+		deviceID string
+		want     int
+	}{
+		{idPath("%d", active.ID), 1},
+		{idPath("%d", retired.ID), 0}, // Inactive devices are left out even when named
+		{idPath("%d,%d", active.ID, retired.ID), 1},
+	} {
+		var report handlers.OEEReport
+		a.must(http.MethodGet, "/reports/oee", with(day, "device_id", tc.deviceID), nil, &report)
+		if len(report.Rows) != tc.want {
+			t.Errorf("device_id=%s: expected %d rows, got %+v", tc.deviceID, tc.want, report.Rows)
+		}
+	}
+
+	for _, deviceID := range []string{"press-1", "1 OR 1=1", "0"} {
+		if problem := a.call(http.MethodGet, "/reports/oee", with(day, "device_id", deviceID), nil, nil); !invalid(problem, "device_id") {
+			t.Errorf("device_id=%s: expected a validation error, got %+v", deviceID, problem)
+		}
+	}
+}
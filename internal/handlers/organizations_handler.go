@@ -0,0 +1,709 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/background"
+	"data-storage/internal/db"
+	"data-storage/internal/metrics"
+	"data-storage/internal/models"
+	"data-storage/internal/notify"
+	"data-storage/internal/tenant"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"max=255"`
+	Slug string `json:"slug,omitempty" validate:"max=100"` // Derived from the name when empty
+}
+
+func (req *OrganizationRequest) Validate(errs *validate.Errors) {
+	if req.Name != "" && strings.TrimSpace(req.Name) == "" {
+		errs.Add("name", validate.CodeInvalid, "name must not be blank")
+	}
+	// The name is used in email subjects, where line breaks would start new headers
+	if strings.IndexFunc(req.Name, unicode.IsControl) >= 0 {
+		errs.Add("name", validate.CodeInvalid, "name must not contain control characters")
+	}
+}
+
+// OrganizationWithRole is an organization as seen by one of its members
+type OrganizationWithRole struct {
+	models.Organization
+	Role string `json:"role"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin member viewer"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"oneof=admin member viewer"` // Defaults to "member"
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Name     string `json:"name,omitempty"`     // Required when no account exists for the invited email
+	Password string `json:"password,omitempty"` // The existing account's password, or the new account's
+}
+
+type MoveDeviceRequest struct {
+	OrganizationID uint `json:"organization_id" validate:"required"`
+}
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns an organization name into a URL-friendly identifier
+func slugify(name string) string {
+	return strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// orgAccess loads the caller's membership in the organization from the {id} route variable,
+// requiring the admin role when adminOnly is set. The returned request is scoped to that
+// organization, which may differ from the token's active organization.
+func orgAccess(w http.ResponseWriter, r *http.Request, adminOnly bool) (*http.Request, *models.Membership, bool) {
+	orgID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid organization ID", http.StatusBadRequest)
+		return r, nil, false
+	}
+
+	userID, err := strconv.ParseUint(r.Header.Get("X-User-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return r, nil, false
+	}
+
+	membership, err := auth.FindMembership(uint(userID), uint(orgID))
+	if err != nil {
+		if errors.Is(err, auth.ErrNoMembership) {
+			apierror.Error(w, r, "Organization not found", http.StatusNotFound)
+		} else {
+			logger.ErrorContext(r.Context(), "Error loading membership", "error", err)
+			apierror.Error(w, r, "Error loading organization", http.StatusInternalServerError)
+		}
+		return r, nil, false
+	}
+
+	if adminOnly && membership.Role != models.RoleAdmin {
+		apierror.Error(w, r, "Organization admin role required", http.StatusForbidden)
+		return r, nil, false
+	}
+
+	return r.WithContext(tenant.WithOrganization(r.Context(), membership.OrganizationID)), membership, true
+}
+
+// OrganizationsHandler lists the caller's organizations and creates new ones
+func OrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getMyOrganizations(w, r)
+	case "POST":
+		createOrganization(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func getMyOrganizations(w http.ResponseWriter, r *http.Request) {
+	var memberships []models.Membership
+	result := db.GetDB().Preload("Organization").
+		Where("user_id = ?", r.Header.Get("X-User-ID")).
+		Order("organization_id ASC").
+		Find(&memberships)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "organizations")
+		return
+	}
+
+	orgs := make([]OrganizationWithRole, 0, len(memberships))
+	for _, m := range memberships {
+		if m.Organization != nil {
+			orgs = append(orgs, OrganizationWithRole{Organization: *m.Organization, Role: m.Role})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+func createOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseUint(r.Header.Get("X-User-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req OrganizationRequest
+	if !decodeJSON(w, r, &req, "name") {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Slug == "" {
+		req.Slug = req.Name
+	}
+	org := models.Organization{Name: req.Name, Slug: slugify(req.Slug), IsActive: true}
+	if org.Slug == "" {
+		apierror.Validation(w, r, validate.Errors{{
+			Field:   "slug",
+			Code:    validate.CodeInvalid,
+			Message: "slug must contain letters or digits",
+		}})
+		return
+	}
+
+	var existing int64
+	if err := db.GetDB().Model(&models.Organization{}).Where("slug = ?", org.Slug).Count(&existing).Error; err != nil {
+		logger.ErrorContext(r.Context(), "Error checking organization slug", "error", err)
+		apierror.Error(w, r, "Error creating organization", http.StatusInternalServerError)
+		return
+	}
+	if existing > 0 {
+		apierror.Write(w, r, http.StatusConflict, apierror.CodeDuplicate, "An organization with this slug already exists")
+		return
+	}
+
+	// The creator becomes the first admin
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{OrganizationID: org.ID, UserID: uint(userID), Role: models.RoleAdmin}).Error
+	})
+	if err != nil {
+		apierror.Database(w, r, err, "organization")
+		return
+	}
+
+	r = r.WithContext(tenant.WithOrganization(r.Context(), org.ID))
+	audit.Record(r, audit.ActionCreate, "organization", org.ID, nil, org)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(OrganizationWithRole{Organization: org, Role: models.RoleAdmin})
+}
+
+// OrganizationHandler reads and renames a single organization
+func OrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getOrganization(w, r)
+	case "PUT":
+		updateOrganization(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func getOrganization(w http.ResponseWriter, r *http.Request) {
+	_, membership, ok := orgAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OrganizationWithRole{Organization: *membership.Organization, Role: membership.Role})
+}
+
+func updateOrganization(w http.ResponseWriter, r *http.Request) {
+	r, membership, ok := orgAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req OrganizationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	org := *membership.Organization
+	before := org
+	if name := strings.TrimSpace(req.Name); name != "" {
+		org.Name = name
+	}
+
+	result := db.GetDB().Model(&org).Select("name").Updates(&org)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "organization")
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "organization", org.ID, before, org)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OrganizationWithRole{Organization: org, Role: membership.Role})
+}
+
+// OrgMembersHandler lists the members of an organization
+func OrgMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r, _, ok := orgAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	var members []models.Membership
+	result := orgDB(r).Preload("User").Order("user_id ASC").Find(&members)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "members")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// OrgMemberHandler changes a member's role or removes them from the organization
+func OrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r, _, ok := orgAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.ParseUint(mux.Vars(r)["user_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		removeMember(w, r, uint(userID))
+		return
+	}
+
+	var req MemberRoleRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var membership models.Membership
+	result := orgDB(r).Where("user_id = ?", userID).First(&membership)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "member")
+		return
+	}
+
+	if membership.Role == models.RoleAdmin && req.Role != models.RoleAdmin && !hasOtherAdmin(w, r, membership.UserID) {
+		return
+	}
+
+	before := membership
+	membership.Role = req.Role
+	result = orgDB(r).Model(&membership).Update("role", req.Role)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "member")
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "membership", membership.ID, before, membership)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(membership)
+}
+
+// hasOtherAdmin makes sure an organization never loses its last admin
+func hasOtherAdmin(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	var admins int64
+	err := orgDB(r).Model(&models.Membership{}).
+		Where("role = ? AND user_id <> ?", models.RoleAdmin, userID).
+		Count(&admins).Error
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error counting admins", "error", err)
+		apierror.Error(w, r, "Error updating member", http.StatusInternalServerError)
+		return false
+	}
+	if admins == 0 {
+		apierror.Error(w, r, "An organization needs at least one admin", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// removeMember deletes the user's membership in the request's organization
+func removeMember(w http.ResponseWriter, r *http.Request, userID uint) {
+	var membership models.Membership
+	result := orgDB(r).Where("user_id = ?", userID).First(&membership)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "member")
+		return
+	}
+
+	if membership.Role == models.RoleAdmin && !hasOtherAdmin(w, r, userID) {
+		return
+	}
+
+	result = orgDB(r).Delete(&membership)
+	if result.Error != nil {
+		logger.ErrorContext(r.Context(), "Error removing member", "error", result.Error)
+		apierror.Error(w, r, "Error removing member", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, audit.ActionDelete, "membership", membership.ID, membership, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OrgInvitationsHandler lists pending invitations and invites new members
+func OrgInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getInvitations(w, r)
+	case "POST":
+		createInvitation(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func getInvitations(w http.ResponseWriter, r *http.Request) {
+	r, _, ok := orgAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	var invitations []models.OrgInvitation
+	result := orgDB(r).Where("accepted_at IS NULL AND expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&invitations)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "invitations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func createInvitation(w http.ResponseWriter, r *http.Request) {
+	r, membership, ok := orgAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req InvitationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+
+	// Users already in the organization cannot be invited again
+	var members int64
+	err := orgDB(r).Model(&models.User{}).Where("email = ?", req.Email).Count(&members).Error
+	if err != nil {
+		apierror.Database(w, r, err, "invitation")
+		return
+	}
+	if members > 0 {
+		apierror.Error(w, r, "User is already a member of this organization", http.StatusConflict)
+		return
+	}
+
+	token, err := auth.GenerateDeviceToken()
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error generating invitation token", "error", err)
+		apierror.Error(w, r, "Error creating invitation", http.StatusInternalServerError)
+		return
+	}
+
+	invitation := models.OrgInvitation{
+		Email:       req.Email,
+		Role:        req.Role,
+		TokenHash:   auth.HashToken(token),
+		InvitedByID: &membership.UserID,
+		ExpiresAt:   time.Now().Add(tenant.InvitationTTL()),
+	}
+	if err := orgDB(r).Create(&invitation).Error; err != nil {
+		logger.ErrorContext(r.Context(), "Error creating invitation", "error", err)
+		apierror.Error(w, r, "Error creating invitation", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, audit.ActionCreate, "invitation", invitation.ID, nil, invitation)
+
+	org := *membership.Organization
+	background.Go(func() { sendInvitation(org, invitation, token) })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func sendInvitation(org models.Organization, invitation models.OrgInvitation, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	msg := notify.Message{
+		To:      invitation.Email,
+		Subject: "Invitation to " + org.Name,
+		Body: fmt.Sprintf("Hello,\n\nYou have been invited to join %s as %s. Use the following to accept:\n\n%s\n\n"+
+			"The invitation expires on %s.",
+			org.Name, invitation.Role, tenant.InvitationLink(token), invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+	}
+	if err := notify.Send(ctx, msg); err != nil {
+		logger.Error("Error sending invitation", "invitation_id", invitation.ID, "error", err)
+	}
+}
+
+// OrgInvitationHandler revokes a pending invitation
+func OrgInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r, _, ok := orgAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(mux.Vars(r)["invitation_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	var invitation models.OrgInvitation
+	result := orgDB(r).Where("accepted_at IS NULL").First(&invitation, invitationID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "invitation")
+		return
+	}
+
+	if err := orgDB(r).Delete(&invitation).Error; err != nil {
+		logger.ErrorContext(r.Context(), "Error revoking invitation", "error", err)
+		apierror.Error(w, r, "Error revoking invitation", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, audit.ActionDelete, "invitation", invitation.ID, invitation, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invitationError is a client error while accepting an invitation
+type invitationError struct {
+	status  int
+	code    string
+	message string
+	fields  validate.Errors // Invalid fields of the request, reported as a validation error
+
+	lockedFor   time.Duration // The account is locked out for this long
+	failedLogin bool          // The password of an existing account was wrong
+}
+
+func (e *invitationError) Error() string {
+	return e.message
+}
+
+// AcceptInvitationHandler joins the invited organization. Invitees with an account confirm
+// with their password; others create an account with a name and password.
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	now := time.Now()
+	var invitation models.OrgInvitation
+	var user models.User
+	var membership models.Membership
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Claim the invitation atomically so it cannot be used twice
+		result := tx.Model(&models.OrgInvitation{}).
+			Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", auth.HashToken(req.Token), now).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &invitationError{status: http.StatusBadRequest, code: apierror.CodeBadRequest, message: "Invalid or expired invitation"}
+		}
+		if err := tx.Where("token_hash = ?", auth.HashToken(req.Token)).First(&invitation).Error; err != nil {
+			return err
+		}
+
+		result = tx.Where("email = ?", invitation.Email).Limit(1).Find(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if wait := auth.AccountLockedFor(&user, now); wait > 0 {
+				return &invitationError{lockedFor: wait}
+			}
+			if !user.IsActive || !user.CheckPassword(req.Password) {
+				return &invitationError{status: http.StatusUnauthorized, code: apierror.CodeInvalidCredentials, message: "Invalid email or password",
+					failedLogin: user.IsActive}
+			}
+		} else {
+			var fields validate.Errors
+			if strings.TrimSpace(req.Name) == "" {
+				fields.Add("name", validate.CodeRequired, "name is required to create an account")
+			}
+			checkPassword(&fields, "password", req.Password)
+			if len(fields) > 0 {
+				return &invitationError{fields: fields}
+			}
+			user = models.User{Name: strings.TrimSpace(req.Name), Email: invitation.Email, IsActive: true}
+			if err := user.SetPassword(req.Password); err != nil {
+				return err
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		}
+
+		var existing int64
+		if err := tx.Model(&models.Membership{}).
+			Where("organization_id = ? AND user_id = ?", invitation.OrganizationID, user.ID).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return &invitationError{status: http.StatusConflict, code: apierror.CodeConflict, message: "Already a member of this organization"}
+		}
+
+		membership = models.Membership{OrganizationID: invitation.OrganizationID, UserID: user.ID, Role: invitation.Role}
+		return tx.Create(&membership).Error
+	})
+	if err != nil {
+		var invErr *invitationError
+		switch {
+		case errors.As(err, &invErr) && len(invErr.fields) > 0:
+			apierror.Validation(w, r, invErr.fields)
+		case errors.As(err, &invErr) && invErr.lockedFor > 0:
+			writeLockedOut(w, r, invErr.lockedFor)
+		case errors.As(err, &invErr):
+			// A wrong password counts as a failed login, recorded once the claim is rolled back
+			if invErr.failedLogin {
+				if err := auth.RecordAccountFailure(&user, now); err != nil {
+					logger.ErrorContext(r.Context(), "Error recording failed login", "error", err)
+				}
+				metrics.AuthFailed(metrics.AuthInvalidCredentials)
+			}
+			apierror.Write(w, r, invErr.status, invErr.code, invErr.message)
+		default:
+			apierror.Database(w, r, err, "invitation")
+		}
+		return
+	}
+
+	if err := auth.RecordAccountSuccess(&user); err != nil {
+		logger.ErrorContext(r.Context(), "Error resetting failed logins", "error", err)
+	}
+
+	r = r.WithContext(tenant.WithOrganization(r.Context(), invitation.OrganizationID))
+	audit.RecordAs(r, "user", &user.ID, audit.ActionCreate, "membership", membership.ID, nil, membership)
+
+	writeOrgToken(w, r, &user, invitation.OrganizationID)
+}
+
+// MoveDeviceHandler moves a device, its signals, their values, its certificates, operator
+// sessions and badge scans to another organization. The caller must be an admin of both
+// organizations.
+func MoveDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+
+	deviceID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MoveDeviceRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.Header.Get("X-User-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, err := auth.FindMembership(uint(userID), req.OrganizationID)
+	if err != nil || target.Role != models.RoleAdmin {
+		if err != nil && !errors.Is(err, auth.ErrNoMembership) {
+			logger.ErrorContext(r.Context(), "Error loading membership", "error", err)
+		}
+		apierror.Error(w, r, "Organization admin role required in the target organization", http.StatusForbidden)
+		return
+	}
+
+	var device models.Device
+	result := orgDB(r).First(&device, deviceID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "device")
+		return
+	}
+
+	before := device
+	device.OrganizationID = &req.OrganizationID
+
+	// The device belongs to the source organization, so the move runs unscoped
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&device).Update("organization_id", req.OrganizationID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Signal{}).Where("device_id = ?", device.ID).
+			Update("organization_id", req.OrganizationID).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.DeviceCertificate{}, &models.OperatorSession{}, &models.BadgeScan{}, &models.Cycle{}} {
+			if err := tx.Model(model).Where("device_id = ?", device.ID).
+				Update("organization_id", req.OrganizationID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Error moving device", "error", err)
+		apierror.Error(w, r, "Error moving device", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "device", device.ID, before, device)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+func TestOrganization_RejectsControlCharacters(t *testing.T) {
+	a := setupAPI(t)
+
+	// The name ends up in invitation email subjects
+	name := "Plant\r\nBcc: attacker@example.com"
+	if problem := a.call(http.MethodPost, "/orgs", nil, handlers.OrganizationRequest{Name: name, Slug: "plant-2"}, nil); problem == nil || problem.Code != apierror.CodeValidation {
+		t.Errorf("Expected a validation error on create, got %+v", problem)
+	}
+
+	var orgs []handlers.OrganizationWithRole
+	a.must(http.MethodGet, "/orgs", nil, nil, &orgs)
+	if len(orgs) != 1 {
+		t.Fatalf("Expected one organization, got %+v", orgs)
+	}
+	path := idPath("/orgs/%d", orgs[0].ID)
+	if problem := a.call(http.MethodPut, path, nil, handlers.OrganizationRequest{Name: name}, nil); problem == nil || problem.Code != apierror.CodeValidation {
+		t.Errorf("Expected a validation error on update, got %+v", problem)
+	}
+	a.must(http.MethodPut, path, nil, handlers.OrganizationRequest{Name: "Plant Nord"}, nil)
+}
+
+var invitationTokenPattern = regexp.MustCompile(`accept:\n\n(\S+)`)
+
+func TestAcceptInvitation_LocksOutWrongPasswords(t *testing.T) {
+	a := setupAPI(t)
+	withoutLoginLimit(t)
+	box := useMailbox(t)
+
+	inviteeEmail := "invitee@example.com"
+	a.user(handlers.CreateUserRequest{Name: "Invitee", Email: inviteeEmail, Password: adminPassword})
+	// invite returns the token sent for a new organization
+	invite := func(name string) string {
+		t.Helper()
+		var org handlers.OrganizationWithRole
+		a.must(http.MethodPost, "/orgs", nil, handlers.OrganizationRequest{Name: name}, &org)
+		a.must(http.MethodPost, idPath("/orgs/%d/invitations", org.ID), nil, handlers.InvitationRequest{Email: inviteeEmail, Role: models.RoleMember}, nil)
+		match := invitationTokenPattern.FindStringSubmatch(box.next(t).Body)
+		if match == nil {
+			t.Fatal("Expected an invitation token")
+		}
+		return match[1]
+	}
+	accept := func(token, password string) *apierror.Problem {
+		t.Helper()
+		return a.anonymous().call(http.MethodPost, "/auth/accept-invitation", nil, handlers.AcceptInvitationRequest{Token: token, Password: password}, nil)
+	}
+
+	// A wrong password leaves the invitation to be accepted, and the right one clears the count
+	token := invite("Plant Nord")
+	if problem := accept(token, "wrong-password"); problem == nil || problem.Code != apierror.CodeInvalidCredentials {
+		t.Fatalf("Expected invalid credentials, got %+v", problem)
+	}
+	if problem := accept(token, adminPassword); problem != nil {
+		t.Fatalf("Error accepting invitation: %+v", problem)
+	}
+
+	// Wrong passwords lock the account like failed logins do
+	token = invite("Plant Sud")
+	for i := 0; i < 5; i++ {
+		accept(token, "wrong-password")
+	}
+	if problem := accept(token, adminPassword); problem == nil || problem.Code != apierror.CodeAccountLocked {
+		t.Errorf("Expected the account to be locked, got %+v", problem)
+	}
+	if problem := a.tryLogin(inviteeEmail, adminPassword); problem == nil || problem.Code != apierror.CodeAccountLocked {
+		t.Errorf("Expected logins to be locked out too, got %+v", problem)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
+	"data-storage/internal/background"
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+	"data-storage/internal/notify"
+	"data-storage/internal/validate"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+func (req *ResetPasswordRequest) Validate(errs *validate.Errors) {
+	if req.NewPassword != "" {
+		checkPassword(errs, "new_password", req.NewPassword)
+	}
+}
+
+// forgotPasswordResponse is returned whether or not the email exists
+const forgotPasswordResponse = "If an account with that email exists, a password reset link has been sent"
+
+// ForgotPasswordHandler issues a password reset token and sends it to the user.
+// The response never reveals whether the email belongs to an account: the lookup, the
+// token and the delivery all happen in the background, so every request answers alike.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	requestIP := auth.ClientIP(r)
+	now := time.Now()
+	background.Go(func() { issuePasswordReset(email, requestIP, now) })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordResponse})
+}
+
+// issuePasswordReset creates a reset token for the active user with the email, if any,
+// and sends it to them
+func issuePasswordReset(email, requestIP string, now time.Time) {
+	var user models.User
+	result := db.GetDB().Where("email = ? AND is_active = ?", email, true).Limit(1).Find(&user)
+	if result.Error != nil {
+		logger.Error("Error fetching user for password reset", "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	token, err := auth.CreatePasswordReset(&user, requestIP, now)
+	if err != nil {
+		logger.Error("Error creating password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+	sendPasswordReset(user, token)
+}
+
+func sendPasswordReset(user models.User, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	msg := notify.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the following to reset your password:\n\n%s\n\n"+
+			"If you did not request a password reset, you can ignore this message.",
+			user.Name, auth.ResetLink(token)),
+	}
+	if err := notify.Send(ctx, msg); err != nil {
+		logger.Error("Error sending password reset", "user_id", user.ID, "error", err)
+	}
+}
+
+// ResetPasswordHandler sets a new password using a reset token
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := auth.ConsumePasswordReset(req.Token, req.NewPassword, time.Now())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			apierror.Error(w, r, "Invalid or expired token", http.StatusBadRequest)
+		} else {
+			logger.ErrorContext(r.Context(), "Error resetting password", "error", err)
+			apierror.Error(w, r, "Error resetting password", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The actor is the user the token was issued to
+	audit.RecordAs(r, "user", &user.ID, audit.ActionUpdate, "user", user.ID,
+		passwordChange{}, passwordChange{Password: "changed"})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/auth"
+	"data-storage/internal/db"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+var resetTokenPattern = regexp.MustCompile(`https://app\.example\.com/reset\?token=(\S+)`)
+
+// setupReset runs the API with password reset links sent to a mailbox, and returns a
+// function requesting a reset for the email and returning the token of the email sent
+func setupReset(t *testing.T) (a *testAPI, box *mailbox, requestReset func(email string) string) {
+	t.Helper()
+	a = setupAPI(t)
+	withoutLoginLimit(t)
+	auth.InitReset(auth.ResetConfig{TTL: time.Hour, URL: "https://app.example.com/reset?token="})
+	t.Cleanup(func() { auth.InitReset(auth.DefaultResetConfig()) })
+	box = useMailbox(t)
+
+	requestReset = func(email string) string {
+		t.Helper()
+		a.anonymous().must(http.MethodPost, "/auth/forgot-password", nil, handlers.ForgotPasswordRequest{Email: email}, nil)
+		msg := box.next(t)
+		match := resetTokenPattern.FindStringSubmatch(msg.Body)
+		if msg.To != email || match == nil {
+			t.Fatalf("Expected a reset link for %s, got %+v", email, msg)
+		}
+		return match[1]
+	}
+	return a, box, requestReset
+}
+
+// reset sets a new password with the token
+func reset(a *testAPI, token, password string) *apierror.Problem {
+	a.t.Helper()
+	return a.anonymous().call(http.MethodPost, "/auth/reset-password", nil, handlers.ResetPasswordRequest{Token: token, NewPassword: password}, nil)
+}
+
+func TestPasswordReset(t *testing.T) {
+	a, _, requestReset := setupReset(t)
+	newPassword := "another-horse-battery"
+
+	token := requestReset(adminEmail)
+	if problem := reset(a, token, newPassword); problem != nil {
+		t.Fatalf("Error resetting password: %+v", problem)
+	}
+	if problem := a.tryLogin(adminEmail, newPassword); problem != nil {
+		t.Errorf("Expected the new password to work, got %+v", problem)
+	}
+	if problem := a.tryLogin(adminEmail, adminPassword); problem == nil || problem.Code != apierror.CodeInvalidCredentials {
+		t.Errorf("Expected the old password to fail, got %+v", problem)
+	}
+
+	// Tokens are single use
+	if problem := reset(a, token, "third-horse-battery"); problem == nil || problem.Status != http.StatusBadRequest {
+		t.Errorf("Expected a used token to be rejected, got %+v", problem)
+	}
+
+	// A new request invalidates the previous token
+	older := requestReset(adminEmail)
+	newer := requestReset(adminEmail)
+	if problem := reset(a, older, "third-horse-battery"); problem == nil || problem.Status != http.StatusBadRequest {
+		t.Errorf("Expected the older token to be rejected, got %+v", problem)
+	}
+
+	// Expired tokens are rejected
+	err := db.GetDB().Model(&models.PasswordResetToken{}).Where("used_at IS NULL").
+		Update("expires_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatalf("Error expiring token: %v", err)
+	}
+	if problem := reset(a, newer, "third-horse-battery"); problem == nil || problem.Status != http.StatusBadRequest {
+		t.Errorf("Expected an expired token to be rejected, got %+v", problem)
+	}
+	if problem := a.tryLogin(adminEmail, newPassword); problem != nil {
+		t.Errorf("Expected the password to be unchanged, got %+v", problem)
+	}
+}
+
+func TestPasswordReset_ClearsLockout(t *testing.T) {
+	a, _, requestReset := setupReset(t)
+
+	for i := 0; i < 6; i++ {
+		a.tryLogin(adminEmail, "wrong-password")
+	}
+	if problem := a.tryLogin(adminEmail, adminPassword); problem == nil || problem.Code != apierror.CodeAccountLocked {
+		t.Fatalf("Expected the account to be locked, got %+v", problem)
+	}
+
+	if problem := reset(a, requestReset(adminEmail), "another-horse-battery"); problem != nil {
+		t.Fatalf("Error resetting password: %+v", problem)
+	}
+	if problem := a.tryLogin(adminEmail, "another-horse-battery"); problem != nil {
+		t.Errorf("Expected the reset to lift the lockout, got %+v", problem)
+	}
+}
+
+func TestPasswordReset_DoesNotRevealAccounts(t *testing.T) {
+	a, box, requestReset := setupReset(t)
+
+	answer := func(email string) (*apierror.Problem, map[string]string) {
+		var body map[string]string
+		problem := a.anonymous().call(http.MethodPost, "/auth/forgot-password", nil, handlers.ForgotPasswordRequest{Email: email}, &body)
+		return problem, body
+	}
+	unknownProblem, unknownBody := answer("nobody@example.com")
+	knownProblem, knownBody := answer(adminEmail)
+	if unknownProblem != nil || knownProblem != nil || unknownBody["message"] != knownBody["message"] || len(unknownBody) != len(knownBody) {
+		t.Errorf("Expected the same answer for both emails, got %+v %v and %+v %v", unknownProblem, unknownBody, knownProblem, knownBody)
+	}
+
+	// Wait for the known account's email; the unknown one gets none
+	box.next(t)
+	requestReset(adminEmail)
+	if n := box.sentTo("nobody@example.com"); n != 0 {
+		t.Errorf("Expected no email for the unknown address, got %d", n)
+	}
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
-	"data-storage/internal/db"
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/metrics"
 	"data-storage/internal/models"
+	"data-storage/internal/validate"
+
+	"gorm.io/gorm"
 )
 
 // ReadingsHandler is a legacy handler for backward compatibility
@@ -20,14 +25,14 @@ func ReadingsHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		createReading(w, r)
 	default:
-		http.Error(w, "Unsupported request method.", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Unsupported request method.", http.StatusMethodNotAllowed)
 	}
 }
 
 func getAllReadings(w http.ResponseWriter, r *http.Request) {
 	// Redirect to signal values
 	var signalValues []models.SignalValue
-	query := db.GetDB().Preload("Signal").Preload("Signal.Device").Preload("User")
+	query := orgDB(r).Preload("Signal").Preload("Signal.Device").Preload("User").Omit("samples")
 
 	// Limit results
 	limit := r.URL.Query().Get("limit")
@@ -41,13 +46,13 @@ func getAllReadings(w http.ResponseWriter, r *http.Request) {
 
 	result := query.Order("timestamp DESC").Limit(limitInt).Find(&signalValues)
 	if result.Error != nil {
-		http.Error(w, "Database query error", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "records")
 		return
 	}
 
 	readingsBytes, err := json.MarshalIndent(signalValues, "", "\t")
 	if err != nil {
-		http.Error(w, "Error marshaling readings", http.StatusInternalServerError)
+		apierror.Error(w, r, "Error marshaling readings", http.StatusInternalServerError)
 		return
 	}
 
@@ -65,16 +70,31 @@ func createReading(w http.ResponseWriter, r *http.Request) {
 		SignalID     uint     `json:"signal_id"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&readingData)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeBody(w, r, &readingData) {
+		metrics.ValueRejected(metrics.RejectInvalidBody)
 		return
 	}
 
 	// If signal_id is not provided, this is legacy format
 	// We can't create without signal_id in new structure
 	if readingData.SignalID == 0 {
-		http.Error(w, "signal_id is required. Please use /signal-values endpoint", http.StatusBadRequest)
+		metrics.ValueRejected(metrics.RejectMissingSignalID)
+		apierror.Validation(w, r, validate.Errors{{
+			Field:   "signal_id",
+			Code:    validate.CodeRequired,
+			Message: "signal_id is required. Please use /signal-values endpoint",
+		}})
+		return
+	}
+
+	// The signal must belong to the caller's organization
+	var signal models.Signal
+	result := orgDB(r).Select("id", "device_id").First(&signal, readingData.SignalID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			metrics.ValueRejected(metrics.RejectUnknownSignal)
+		}
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
@@ -87,12 +107,16 @@ func createReading(w http.ResponseWriter, r *http.Request) {
 		Timestamp:    time.Now(),
 	}
 
-	result := db.GetDB().Create(&signalValue)
+	result = orgDB(r).Create(&signalValue)
 	if result.Error != nil {
-		log.Printf("Error creating reading: %v", result.Error)
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "reading")
 		return
 	}
+	metrics.ValueIngested(signal.DeviceID, signal.ID)
+
+	if audit.RecordsValueCreates() {
+		audit.Record(r, audit.ActionCreate, "signal_value", signalValue.ID, nil, signalValue)
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(signalValue)
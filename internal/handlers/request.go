@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/auth"
+	"data-storage/internal/validate"
+)
+
+// maxBodyBytes limits request bodies. A waveform value of maxWaveformSamples samples takes
+// about 2 MB of JSON.
+const maxBodyBytes = 4 << 20
+
+// decodeJSON decodes the request body into dst and checks its validation rules, plus the
+// required JSON fields listed. On failure it writes the error response, listing every
+// invalid field, and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, required ...string) bool {
+	if !decodeBody(w, r, dst) {
+		return false
+	}
+	if errs := validate.Struct(dst, required...); len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return false
+	}
+	return true
+}
+
+// decodeBody decodes the request body, of at most maxBodyBytes, into dst. On failure it
+// writes the error response and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	err := json.NewDecoder(r.Body).Decode(dst)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit))
+		return false
+	case err != nil:
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, decodeErrorDetail(err))
+		return false
+	}
+	return true
+}
+
+// decodeErrorDetail describes a JSON decoding error without exposing Go type names
+func decodeErrorDetail(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return "Request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "Malformed JSON: unexpected end of input"
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Sprintf("%s must be a JSON %s", typeErr.Field, jsonType(typeErr.Type.Kind().String()))
+	}
+	return "Invalid request body"
+}
+
+func jsonType(kind string) string {
+	switch kind {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "slice", "array":
+		return "array"
+	case "struct", "map":
+		return "object"
+	case "ptr":
+		return "value of the expected type"
+	}
+	return "number"
+}
+
+// checkPassword reports a password that does not meet the password policy
+func checkPassword(errs *validate.Errors, field, password string) {
+	if err := auth.ValidatePassword(password); err != nil {
+		errs.Add(field, validate.CodeInvalid, err.Error())
+	}
+}
+
+// offsetParam reads the offset query parameter used to page through list results. On an
+// invalid value it writes the error response and returns false.
+func offsetParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	offsetStr := r.URL.Query().Get("offset")
+	if offsetStr == "" {
+		return 0, true
+	}
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		apierror.Validation(w, r, validate.Errors{{
+			Field:   "offset",
+			Code:    validate.CodeInvalid,
+			Message: "offset must be a non-negative integer",
+		}})
+		return 0, false
+	}
+	return offset, true
+}
+
+// limitParam reads the limit query parameter of list results, using defaultLimit when it is
+// missing or not positive and capping it at maxLimit
+func limitParam(r *http.Request, defaultLimit, maxLimit int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// timeParam reads a required query parameter holding an RFC 3339 time or a UTC date
+// (YYYY-MM-DD). On a missing or invalid value it writes the error response and returns false.
+func timeParam(w http.ResponseWriter, r *http.Request, name string) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		apierror.Validation(w, r, validate.Errors{{Field: name, Code: validate.CodeRequired, Message: name + " is required"}})
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		apierror.Validation(w, r, validate.Errors{{Field: name, Code: validate.CodeInvalid, Message: name + " must be an RFC 3339 time or a YYYY-MM-DD date"}})
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// timeRangeParams reads the optional from_date and to_date query parameters, in the formats
+// of timeParam. On an invalid value or range it writes the error response and returns false.
+func timeRangeParams(w http.ResponseWriter, r *http.Request) (from, to *time.Time, ok bool) {
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from_date", &from}, {"to_date", &to}} {
+		if r.URL.Query().Get(p.name) == "" {
+			continue
+		}
+		t, ok := timeParam(w, r, p.name)
+		if !ok {
+			return nil, nil, false
+		}
+		*p.dst = &t
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		apierror.Validation(w, r, validate.Errors{{Field: "to_date", Code: validate.CodeInvalid, Message: "to_date must not be before from_date"}})
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
+// idsParam reads a query parameter holding a comma-separated list of IDs, without duplicates.
+// On an invalid value it writes the error response and returns false.
+func idsParam(w http.ResponseWriter, r *http.Request, name string) ([]uint, bool) {
+	var ids []uint
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return ids, true
+	}
+	for _, s := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+		if err != nil || id == 0 {
+			apierror.Validation(w, r, validate.Errors{{Field: name, Code: validate.CodeInvalid, Message: name + " must be a comma-separated list of IDs"}})
+			return nil, false
+		}
+		if !slices.Contains(ids, uint(id)) {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, true
+}
+
+// durationParam reads an optional query parameter holding a whole number of seconds as a Go
+// duration (30s, 5m, 1h). A missing value is zero; an invalid one is added to errs.
+func durationParam(errs *validate.Errors, r *http.Request, name string) time.Duration {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second || d%time.Second != 0 {
+		errs.Add(name, validate.CodeInvalid, name+" must be a whole number of seconds such as 30s, 5m or 1h")
+	}
+	return d
+}
@@ -3,36 +3,45 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
-	"data-storage/internal/db"
+	"data-storage/internal/apierror"
 	"data-storage/internal/models"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 )
 
-// GetUserByRFIDHandler handles requests to get a user by RFID
+// GetUserByRFIDHandler returns the user of the organization holding a badge, for the
+// authenticated device. The lookup is recorded as a badge scan of the device.
+//
+// Deprecated: devices should scan badges with POST /devices/{id}/badge.
 func GetUserByRFIDHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Only GET method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	vars := mux.Vars(r)
 	rfid, ok := vars["rfid"]
 	if !ok {
-		http.Error(w, "RFID is required", http.StatusBadRequest)
+		apierror.Error(w, r, "RFID is required", http.StatusBadRequest)
+		return
+	}
+	deviceID, err := strconv.ParseUint(r.Header.Get("X-Device-ID"), 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Device authentication required", http.StatusForbidden)
 		return
 	}
 
-	var user models.User
-	result := db.GetDB().Where("rfid = ?", rfid).First(&user)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Database query error", http.StatusInternalServerError)
-		}
+	scan := models.BadgeScan{DeviceID: uint(deviceID), Rfid: rfid, ScannedAt: time.Now()}
+	user, ok := badgeUser(w, r, &scan)
+	if !ok {
+		return
+	}
+	scan.Result = models.BadgeLookup
+	if err := orgDB(r).Create(&scan).Error; err != nil {
+		apierror.Database(w, r, err, "badge scan")
 		return
 	}
 
@@ -41,11 +50,10 @@ func GetUserByRFIDHandler(w http.ResponseWriter, r *http.Request) {
 
 	userBytes, err := json.MarshalIndent(user, "", "\t")
 	if err != nil {
-		http.Error(w, "Error marshaling user data", http.StatusInternalServerError)
+		apierror.Error(w, r, "Error marshaling user data", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(userBytes)
 }
-
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/models"
+	"data-storage/internal/series"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxSeriesPoints limits the buckets of a series, and the points of raw values with their
+// gaps filled
+const maxSeriesPoints = 10000
+
+// SeriesResponse is the values of a signal in a time range, raw or aggregated per bucket
+type SeriesResponse struct {
+	SignalID   uint           `json:"signal_id"`
+	SignalType string         `json:"signal_type"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Bucket     float64        `json:"bucket,omitempty"` // Seconds per bucket; raw values when 0
+	Aggregate  string         `json:"aggregate,omitempty"`
+	Fill       string         `json:"fill,omitempty"`
+	Function   string         `json:"function,omitempty"`
+	Points     []series.Point `json:"points"`
+	Gaps       []series.Gap   `json:"gaps,omitempty"`      // Only with a gap_threshold
+	Truncated  bool           `json:"truncated,omitempty"` // limit raw values were reached; To is the first value left out
+}
+
+// seriesQuery holds the parameters of a series request
+type seriesQuery struct {
+	from, to     time.Time
+	bucket       time.Duration // Zero for raw values
+	aggregate    string
+	fill         string
+	fillValue    float64
+	gapThreshold time.Duration // Zero to leave gaps out
+	function     series.Function
+	limit        int  // Raw values only
+	truncated    bool // The raw values reached the limit, and to was moved back
+}
+
+// errLimitTooSmall is returned when more raw values than the limit share a timestamp
+var errLimitTooSmall = errors.New("more values than the limit share a timestamp")
+
+// seriesOnlyParams are the query parameters that only the series endpoints take
+var seriesOnlyParams = []string{"bucket", "aggregate"}
+
+// parseValueShape reads the fill and function the value lists apply to each page of values.
+// It returns nil without either. On an invalid value, or a parameter only the series
+// endpoints take, it writes the error response and returns false.
+func parseValueShape(w http.ResponseWriter, r *http.Request) (*seriesQuery, bool) {
+	var errs validate.Errors
+	for _, name := range seriesOnlyParams {
+		if r.URL.Query().Has(name) {
+			errs.Add(name, validate.CodeInvalid, name+" is only supported by GET /signals/{signal_id}/series and GET /series")
+		}
+	}
+	q := &seriesQuery{}
+	parseFill(&errs, r, q)
+	if q.gapThreshold > 0 && q.fill == "" {
+		errs.Add("gap_threshold", validate.CodeInvalid, "gap_threshold needs a fill on the value lists; fill=null marks the gaps with empty values")
+	}
+	parseFunction(&errs, r, q)
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return nil, false
+	}
+	if q.fill == "" && q.function.Name == "" {
+		return nil, true
+	}
+	return q, true
+}
+
+// valueShapeSignal loads the signal whose values are shaped and checks the shape applies to
+// it. Otherwise it writes the error response and returns false.
+func (q *seriesQuery) valueShapeSignal(w http.ResponseWriter, r *http.Request, signalID uint) (models.Signal, bool) {
+	var signal models.Signal
+	if result := orgDB(r).First(&signal, signalID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal")
+		return signal, false
+	}
+	return signal, q.supports(w, r, signal)
+}
+
+// shapeValues fills the gaps of a page of values, newest first, and applies the function in
+// time order as shape does for raw series. Filled values have no ID and are marked filled.
+func (q *seriesQuery) shapeValues(signal models.Signal, values []models.SignalValue) ([]models.SignalValue, error) {
+	points := make([]series.Point, len(values))
+	for i, v := range values {
+		value := v.Value
+		if signal.SignalType == "digital" {
+			on := 0.0
+			if v.DigitalValue != nil && *v.DigitalValue {
+				on = 1
+			}
+			value = &on
+		}
+		// A count tells the stored values from the filled ones
+		points[len(values)-1-i] = series.Point{Timestamp: v.Timestamp, Value: value, Count: 1}
+	}
+	points, _, err := q.shape(points)
+	if err != nil {
+		return nil, err
+	}
+
+	shaped := make([]models.SignalValue, 0, len(points))
+	next := 0 // Next stored value, newest first
+	for i := len(points) - 1; i >= 0; i-- {
+		p := points[i]
+		if p.Count > 0 {
+			v := values[next]
+			next++
+			if signal.SignalType != "digital" {
+				v.Value = p.Value
+			}
+			shaped = append(shaped, v)
+			continue
+		}
+		filled := models.SignalValue{SignalID: signal.ID, Signal: values[0].Signal, Timestamp: p.Timestamp, Filled: true}
+		if signal.SignalType == "digital" && p.Value != nil {
+			on := *p.Value != 0
+			filled.DigitalValue = &on
+		} else {
+			filled.Value = p.Value
+		}
+		shaped = append(shaped, filled)
+	}
+	return shaped, nil
+}
+
+// SeriesHandler returns the values of a signal from from_date to to_date for charts: raw, or
+// aggregated per bucket, with empty buckets or gaps filled and gaps longer than gap_threshold
+// marked
+func SeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	signalID, err := strconv.ParseUint(mux.Vars(r)["signal_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
+		return
+	}
+	q, ok := parseSeriesQuery(w, r)
+	if !ok {
+		return
+	}
+
+	var signal models.Signal
+	if result := orgDB(r).First(&signal, signalID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal")
+		return
+	}
+	if !q.supports(w, r, signal) {
+		return
+	}
+
+	points, err := q.load(r, signal)
+	if errors.Is(err, errLimitTooSmall) {
+		apierror.Validation(w, r, validate.Errors{{Field: "limit", Code: validate.CodeTooSmall, Message: fmt.Sprintf("More than %d values share a timestamp; raise the limit", q.limit)}})
+		return
+	}
+	if err != nil {
+		apierror.Database(w, r, err, "signal values")
+		return
+	}
+	points, gaps, err := q.shape(points)
+	if err != nil {
+		apierror.Validation(w, r, validate.Errors{{Field: "gap_threshold", Code: validate.CodeTooLarge, Message: err.Error()}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SeriesResponse{
+		SignalID:   signal.ID,
+		SignalType: signal.SignalType,
+		From:       q.from,
+		To:         q.to,
+		Bucket:     q.bucket.Seconds(),
+		Aggregate:  q.aggregate,
+		Fill:       q.fill,
+		Function:   q.function.Name,
+		Points:     points,
+		Gaps:       gaps,
+		Truncated:  q.truncated,
+	})
+}
+
+// parseSeriesQuery reads the parameters of a series request. On an invalid value it writes
+// the error response and returns false.
+func parseSeriesQuery(w http.ResponseWriter, r *http.Request) (*seriesQuery, bool) {
+	from, ok := timeParam(w, r, "from_date")
+	if !ok {
+		return nil, false
+	}
+	to, ok := timeParam(w, r, "to_date")
+	if !ok {
+		return nil, false
+	}
+
+	params := r.URL.Query()
+	q := &seriesQuery{from: from, to: to, aggregate: params.Get("aggregate"), limit: limitParam(r, 1000, maxSeriesPoints)}
+	var errs validate.Errors
+	if !to.After(from) {
+		errs.Add("to_date", validate.CodeInvalid, "to_date must be after from_date")
+	}
+	q.bucket = durationParam(&errs, r, "bucket")
+
+	if q.bucket > 0 {
+		if q.aggregate == "" {
+			q.aggregate = series.Avg
+		}
+		if !slices.Contains(series.Aggregates, q.aggregate) {
+			errs.Add("aggregate", validate.CodeOneOf, fmt.Sprintf("aggregate must be one of %s", strings.Join(series.Aggregates, ", ")))
+		}
+		if to.After(from) && series.BucketCount(from, to, q.bucket) > maxSeriesPoints {
+			errs.Add("bucket", validate.CodeTooSmall, fmt.Sprintf("The range holds more than %d buckets; use larger buckets", maxSeriesPoints))
+		}
+	} else if q.aggregate != "" {
+		errs.Add("aggregate", validate.CodeInvalid, "aggregate needs a bucket")
+	}
+
+	parseFill(&errs, r, q)
+	parseFunction(&errs, r, q)
+
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return nil, false
+	}
+	return q, true
+}
+
+// parseFill reads the fill of the buckets or gaps and the gap threshold into q, adding invalid
+// values to errs. The bucket must be read first.
+func parseFill(errs *validate.Errors, r *http.Request, q *seriesQuery) {
+	params := r.URL.Query()
+	q.fill = params.Get("fill")
+	q.gapThreshold = durationParam(errs, r, "gap_threshold")
+	if q.fill != "" {
+		if !slices.Contains(series.FillModes, q.fill) {
+			errs.Add("fill", validate.CodeOneOf, fmt.Sprintf("fill must be one of %s", strings.Join(series.FillModes, ", ")))
+		}
+		if q.bucket == 0 && q.gapThreshold == 0 {
+			errs.Add("fill", validate.CodeInvalid, "Filling raw values needs a gap_threshold")
+		}
+	}
+	if value := params.Get("fill_value"); value != "" {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs.Add("fill_value", validate.CodeInvalid, "fill_value must be a number")
+		}
+		q.fillValue = v
+	} else if q.fill == series.FillConstant {
+		errs.Add("fill_value", validate.CodeRequired, "fill_value is required for the constant fill")
+	}
+}
+
+// parseFunction reads the function of the values and its parameters into q, adding invalid
+// values to errs
+func parseFunction(errs *validate.Errors, r *http.Request, q *seriesQuery) {
+	params := r.URL.Query()
+	q.function.Unit = durationParam(errs, r, "unit")
+	if q.function.Name = params.Get("function"); q.function.Name == "" {
+		return
+	}
+	if value := params.Get("window"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil || window <= 0 {
+			errs.Add("window", validate.CodeInvalid, "window must be a positive number of points")
+		}
+		q.function.Window = window
+	}
+	if value := params.Get("alpha"); value != "" {
+		alpha, err := strconv.ParseFloat(value, 64)
+		if err != nil || alpha <= 0 {
+			errs.Add("alpha", validate.CodeInvalid, "alpha must be greater than 0 and at most 1")
+		}
+		q.function.Alpha = alpha
+	}
+	if err := q.function.Validate(); err != nil {
+		errs.Add("function", validate.CodeInvalid, err.Error())
+	}
+}
+
+// supports checks the query applies to the signal: waveforms have no single value, digital
+// states only hold between values and have no rate. Otherwise it writes the error response
+// and returns false.
+func (q *seriesQuery) supports(w http.ResponseWriter, r *http.Request, signal models.Signal) bool {
+	switch {
+	case signal.SignalType == "waveform":
+		apierror.Error(w, r, fmt.Sprintf("Signal %d is a waveform; read its curves from its values", signal.ID), http.StatusUnprocessableEntity)
+		return false
+	case signal.SignalType == "digital" && q.fill != "" && !slices.Contains(series.DigitalFillModes, q.fill):
+		apierror.Validation(w, r, validate.Errors{{Field: "fill", Code: validate.CodeOneOf,
+			Message: fmt.Sprintf("Signal %d is digital; fill must be one of %s", signal.ID, strings.Join(series.DigitalFillModes, ", "))}})
+		return false
+	case signal.SignalType == "digital" && q.function.Name != "":
+		apierror.Validation(w, r, validate.Errors{{Field: "function", Code: validate.CodeInvalid,
+			Message: fmt.Sprintf("Signal %d is digital; functions apply to analogic signals", signal.ID)}})
+		return false
+	}
+	return true
+}
+
+// load reads the raw values, or the aggregate of each bucket with values, in time order.
+// Digital values read as 1 and 0.
+func (q *seriesQuery) load(r *http.Request, signal models.Signal) ([]series.Point, error) {
+	column := valueColumn(signal)
+	values := signalValueQuery(r, signal).Where("timestamp >= ? AND timestamp < ?", q.from, q.to)
+
+	if q.bucket == 0 {
+		var rows []struct {
+			Timestamp time.Time
+			Value     float64
+		}
+		result := values.Select("timestamp, " + column + " AS value").Order("timestamp, id").Limit(q.limit + 1).Scan(&rows)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if len(rows) > q.limit {
+			// End the series before the first value left out, so that fills and gaps stop at
+			// the last value returned and the next request can start from there
+			q.to, q.truncated = rows[q.limit].Timestamp, true
+			for len(rows) > 0 && !rows[len(rows)-1].Timestamp.Before(q.to) {
+				rows = rows[:len(rows)-1]
+			}
+			if len(rows) == 0 {
+				return nil, errLimitTooSmall
+			}
+		}
+		points := make([]series.Point, len(rows))
+		for i, row := range rows {
+			value := row.Value
+			points[i] = series.Point{Timestamp: row.Timestamp, Value: &value}
+		}
+		return points, nil
+	}
+
+	aggregate := "COUNT(*)"
+	if q.aggregate != series.Count {
+		aggregate = q.aggregate + "(" + column + ")"
+	}
+	var rows []struct {
+		Bucket int64
+		Value  *float64
+		Count  int64
+	}
+	seconds := int64(q.bucket / time.Second)
+	result := values.Select(bucketColumn(values)+" AS bucket, "+aggregate+" AS value, COUNT(*) AS count", q.from.Unix(), seconds).
+		Group("bucket").Order("bucket").Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	points := make([]series.Point, len(rows))
+	for i, row := range rows {
+		points[i] = series.Point{Timestamp: q.from.Add(time.Duration(row.Bucket) * q.bucket), Value: row.Value, Count: row.Count}
+	}
+	return points, nil
+}
+
+// shape lays aggregates on the grid of buckets, fills the empty buckets, or the gaps of raw
+// values, finds the gaps and applies the function. Without a fill, empty buckets are left out.
+func (q *seriesQuery) shape(points []series.Point) ([]series.Point, []series.Gap, error) {
+	if q.fill != "" {
+		if q.bucket > 0 {
+			points = series.Buckets(points, q.from, q.to, q.bucket)
+		} else {
+			var err error
+			if points, err = series.Resample(points, q.gapThreshold, maxSeriesPoints); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := series.Fill(points, q.fill, q.fillValue); err != nil {
+			return nil, nil, err
+		}
+	}
+	var gaps []series.Gap
+	if q.gapThreshold > 0 {
+		gaps = series.Gaps(points, q.gapThreshold, q.bucket)
+	}
+	if q.function.Name != "" {
+		points = q.function.Apply(points)
+	}
+	return points, gaps, nil
+}
+
+// bucketColumn returns the expression numbering the bucket of a value, given the Unix time
+// of the first bucket and the seconds per bucket as arguments
+func bucketColumn(tx *gorm.DB) string {
+	if tx.Dialector.Name() == "postgres" {
+		return "CAST(FLOOR((EXTRACT(EPOCH FROM timestamp) - ?) / ?) AS BIGINT)"
+	}
+	return "CAST((CAST(strftime('%s', timestamp) AS INTEGER) - ?) / ? AS INTEGER)"
+}
+
+// valueColumn returns the expression of the value of a signal, with digital values as 1 and 0
+func valueColumn(signal models.Signal) string {
+	if signal.SignalType == "digital" {
+		return "(CASE WHEN digital_value THEN 1.0 ELSE 0.0 END)"
+	}
+	return "value"
+}
+
+// signalValueQuery returns the values of a signal that have a value of its type
+func signalValueQuery(r *http.Request, signal models.Signal) *gorm.DB {
+	query := orgDB(r).Model(&models.SignalValue{}).Where("signal_id = ?", signal.ID)
+	if signal.SignalType == "digital" {
+		return query.Where("digital_value IS NOT NULL")
+	}
+	return query.Where("value IS NOT NULL")
+}
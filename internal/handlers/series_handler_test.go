@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+	"data-storage/internal/series"
+)
+
+// setupSeries creates an analogic signal with the values 10 at 08:00:10, 20 at 08:00:50,
+// 40 at 08:03:30 and 50 at 08:05, and a digital one on from 08:01
+func setupSeries(t *testing.T) (a *testAPI, analog, digital models.Signal, at func(minutes, seconds int) time.Time) {
+	t.Helper()
+	a = setupAPI(t)
+	device := a.device("press")
+	analog = a.signal(models.Signal{DeviceID: device.ID, Name: "temperature", SignalType: "analogic"})
+	digital = a.signal(models.Signal{DeviceID: device.ID, Name: "running", SignalType: "digital"})
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at = func(minutes, seconds int) time.Time {
+		return start.Add(time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second)
+	}
+	for _, v := range []struct {
+		minutes, seconds int
+		value            float64
+	}{{0, 10, 10}, {0, 50, 20}, {3, 30, 40}, {5, 0, 50}} {
+		a.value(analog.ID, v.value, at(v.minutes, v.seconds))
+	}
+	a.state(digital.ID, true, at(1, 0))
+	return a, analog, digital, at
+}
+
+// points formats the values of a series, with - for missing ones and * after filled ones
+func points(points []series.Point) string {
+	p := make([]string, len(points))
+	for i, point := range points {
+		p[i] = "-"
+		if point.Value != nil {
+			p[i] = fmt.Sprintf("%.4g", *point.Value)
+		}
+		if point.Filled {
+			p[i] += "*"
+		}
+	}
+	return strings.Join(p, " ")
+}
+
+func TestSeries(t *testing.T) {
+	a, analog, digital, at := setupSeries(t)
+	path := idPath("/signals/%d/series", analog.ID)
+	minutes := dateRange(at(0, 0), at(5, 0))
+
+	// The value at 08:05 is past the range; without a fill empty buckets are left out
+	for _, tc := range []struct {
+		query url.Values
+		want  string
+	}{
+		{minutes, "10 20 40"},
+		{with(minutes, "limit", "2"), "10 20"},
+		{with(minutes, "bucket", "1m"), "15 40"},
+		{with(minutes, "bucket", "1m", "aggregate", "max"), "20 40"},
+		{with(minutes, "bucket", "1m", "aggregate", "count"), "2 1"},
+		{with(minutes, "bucket", "1m", "fill", "null"), "15 - - 40 -"},
+		{with(minutes, "bucket", "1m", "fill", "previous"), "15 15* 15* 40 40*"},
+		{with(minutes, "bucket", "1m", "fill", "linear"), "15 23.33* 31.67* 40 -"},
+		{with(minutes, "bucket", "1m", "fill", "constant", "fill_value", "-1"), "15 -1* -1* 40 -1*"},
+		// Raw values are filled every gap_threshold within the gaps
+		{with(minutes, "fill", "previous", "gap_threshold", "1m"), "10 20 20* 20* 40"},
+	} {
+		var s handlers.SeriesResponse
+		a.must(http.MethodGet, path, tc.query, nil, &s)
+		if got := points(s.Points); got != tc.want {
+			t.Errorf("%v: expected %q, got %q", tc.query, tc.want, got)
+		}
+	}
+
+	// Raw values stop at the limit, and the series ends at the first value left out rather
+	// than fill a gap up to 08:05
+	var truncated handlers.SeriesResponse
+	a.must(http.MethodGet, path, with(minutes, "limit", "2", "fill", "previous", "gap_threshold", "1m"), nil, &truncated)
+	if got := points(truncated.Points); got != "10 20" || !truncated.Truncated || len(truncated.Gaps) != 0 || !truncated.To.Equal(at(3, 30)) {
+		t.Errorf("Expected the series truncated at 08:03:30, got %q to %v, truncated %v", got, truncated.To, truncated.Truncated)
+	}
+
+	var filled handlers.SeriesResponse
+	a.must(http.MethodGet, path, with(minutes, "bucket", "1m", "fill", "null"), nil, &filled)
+	for i, p := range filled.Points {
+		if want := at(i, 0); !p.Timestamp.Equal(want) {
+			t.Errorf("Bucket %d: expected it to start at %v, got %v", i, want, p.Timestamp)
+		}
+	}
+	if filled.Bucket != 60 || filled.Aggregate != series.Avg || filled.Fill != series.FillNull || filled.Gaps != nil {
+		t.Errorf("Expected 60s buckets of averages and no gaps without a gap_threshold, got %+v", filled)
+	}
+
+	// A gap runs from the end of the last bucket with values, or from the last raw value,
+	// and filled values do not close it
+	for _, tc := range []struct {
+		query      url.Values
+		start, end time.Time
+	}{
+		{with(minutes, "bucket", "1m", "gap_threshold", "1m", "fill", "previous"), at(1, 0), at(3, 0)},
+		{with(minutes, "gap_threshold", "1m"), at(0, 50), at(3, 30)},
+	} {
+		var s handlers.SeriesResponse
+		a.must(http.MethodGet, path, tc.query, nil, &s)
+		if len(s.Gaps) != 1 || !s.Gaps[0].Start.Equal(tc.start) || !s.Gaps[0].End.Equal(tc.end) || s.Gaps[0].Duration != tc.end.Sub(tc.start).Seconds() {
+			t.Errorf("%v: expected a gap from %v to %v, got %+v", tc.query, tc.start, tc.end, s.Gaps)
+		}
+	}
+
+	// Digital values read as 1 and hold with the previous fill
+	var s handlers.SeriesResponse
+	a.must(http.MethodGet, idPath("/signals/%d/series", digital.ID), with(minutes, "bucket", "1m", "fill", "previous"), nil, &s)
+	if got := points(s.Points); got != "- 1 1* 1* 1*" || s.SignalType != "digital" {
+		t.Errorf("Expected the digital state held from 08:01, got %q", got)
+	}
+}
+
+func TestSeries_Rejected(t *testing.T) {
+	a, analog, digital, at := setupSeries(t)
+	minutes := dateRange(at(0, 0), at(5, 0))
+
+	for _, tc := range []struct {
+		signal uint
+		query  url.Values
+		field  string
+	}{
+		{analog.ID, with(minutes, "fill", "linear"), "fill"},
+		{analog.ID, with(minutes, "bucket", "1m", "fill", "spline"), "fill"},
+		{analog.ID, with(minutes, "aggregate", "max"), "aggregate"},
+		{analog.ID, with(minutes, "bucket", "1m", "aggregate", "median"), "aggregate"},
+		{analog.ID, with(minutes, "bucket", "1m", "fill", "constant"), "fill_value"},
+		{analog.ID, dateRange(at(5, 0), at(0, 0)), "to_date"},
+		{analog.ID, with(dateRange(at(0, 0), at(24*60, 0)), "bucket", "1s"), "bucket"},
+		{digital.ID, with(minutes, "bucket", "1m", "fill", "linear"), "fill"},
+	} {
+		if problem := a.call(http.MethodGet, idPath("/signals/%d/series", tc.signal), tc.query, nil, nil); !invalid(problem, tc.field) {
+			t.Errorf("%v: expected a validation error for %s, got %+v", tc.query, tc.field, problem)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/attendance"
+	"data-storage/internal/audit"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// ShiftRequest creates or replaces a shift of the organization's calendar
+type ShiftRequest struct {
+	Name      string `json:"name" validate:"required,max=100"`
+	StartTime string `json:"start_time" validate:"required"` // HH:MM
+	EndTime   string `json:"end_time" validate:"required"`   // HH:MM, at or before start_time for overnight shifts
+	Weekdays  string `json:"weekdays,omitempty"`             // Comma-separated days the shift starts on (mon, tue, ...); every day when empty
+	Timezone  string `json:"timezone,omitempty"`             // IANA time zone, e.g. Europe/Rome; UTC when empty
+	IsActive  *bool  `json:"is_active,omitempty"`            // Inactive shifts are left out of reports; true when omitted
+}
+
+// Validate checks the times, days and time zone
+func (req *ShiftRequest) Validate(errs *validate.Errors) {
+	if req.StartTime != "" {
+		if _, err := attendance.ParseClock(req.StartTime); err != nil {
+			errs.Add("start_time", validate.CodeInvalid, "start_time "+err.Error())
+		}
+	}
+	if req.EndTime != "" {
+		if _, err := attendance.ParseClock(req.EndTime); err != nil {
+			errs.Add("end_time", validate.CodeInvalid, "end_time "+err.Error())
+		}
+	}
+	if _, err := attendance.ParseWeekdays(req.Weekdays); err != nil {
+		errs.Add("weekdays", validate.CodeInvalid, err.Error())
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			errs.Add("timezone", validate.CodeInvalid, "timezone must be an IANA time zone name")
+		}
+	}
+}
+
+// apply copies the request into the shift
+func (req *ShiftRequest) apply(shift *models.Shift) {
+	shift.Name = req.Name
+	shift.StartTime = req.StartTime
+	shift.EndTime = req.EndTime
+	shift.Weekdays = req.Weekdays
+	shift.Timezone = req.Timezone
+	shift.IsActive = req.IsActive == nil || *req.IsActive
+}
+
+// ShiftsHandler lists and creates the shifts of the organization
+func ShiftsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		getShifts(w, r)
+	case "POST":
+		createShift(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ShiftHandler gets, replaces and deletes a shift
+func ShiftHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if shift := pathShift(w, r); shift != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(shift)
+		}
+	case "PUT":
+		updateShift(w, r)
+	case "DELETE":
+		deleteShift(w, r)
+	default:
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pathShift loads the shift of the request path. On failure it writes the error response
+// and returns nil.
+func pathShift(w http.ResponseWriter, r *http.Request) *models.Shift {
+	shiftID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid shift ID", http.StatusBadRequest)
+		return nil
+	}
+	var shift models.Shift
+	if result := orgDB(r).First(&shift, shiftID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shift")
+		return nil
+	}
+	return &shift
+}
+
+func getShifts(w http.ResponseWriter, r *http.Request) {
+	query := orgDB(r)
+	if active := r.URL.Query().Get("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var shifts []models.Shift
+	if result := query.Order("start_time, id").Find(&shifts); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shifts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
+
+func createShift(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	var req ShiftRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var shift models.Shift
+	req.apply(&shift)
+	if result := orgDB(r).Create(&shift); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shift")
+		return
+	}
+
+	audit.Record(r, audit.ActionCreate, "shift", shift.ID, nil, shift)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shift)
+}
+
+func updateShift(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	shift := pathShift(w, r)
+	if shift == nil {
+		return
+	}
+	var req ShiftRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	before := *shift
+	req.apply(shift)
+	if result := orgDB(r).Save(shift); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shift")
+		return
+	}
+
+	audit.Record(r, audit.ActionUpdate, "shift", shift.ID, before, *shift)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shift)
+}
+
+func deleteShift(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	shift := pathShift(w, r)
+	if shift == nil {
+		return
+	}
+
+	if result := orgDB(r).Delete(shift); result.Error != nil {
+		apierror.Database(w, r, result.Error, "shift")
+		return
+	}
+
+	audit.Record(r, audit.ActionDelete, "shift", shift.ID, *shift, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
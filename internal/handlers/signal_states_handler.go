@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/digital"
+	"data-storage/internal/models"
+	"data-storage/internal/series"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+)
+
+// maxStateValues limits the values read for one state or edge request
+const maxStateValues = 100000
+
+// EdgesResponse is the changes of state of a digital signal in a time range
+type EdgesResponse struct {
+	SignalID uint           `json:"signal_id"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Rising   int            `json:"rising"`  // Edges in the range, before edge, limit and offset
+	Falling  int            `json:"falling"` // Edges in the range, before edge, limit and offset
+	Edges    []digital.Edge `json:"edges"`
+}
+
+// StatesResponse is the time a digital signal spent on and off in a time range, with the
+// intervals matching the filters
+type StatesResponse struct {
+	SignalID uint      `json:"signal_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	digital.Summary
+	Bucket    float64            `json:"bucket,omitempty"`  // Seconds per bucket
+	Buckets   []digital.Bucket   `json:"buckets,omitempty"` // Only with a bucket
+	Intervals []digital.Interval `json:"intervals"`
+}
+
+// stateQuery holds the values of a digital signal in a time range, with the state before it
+type stateQuery struct {
+	signal   models.Signal
+	from, to time.Time
+	initial  *bool // Last value before from; nil when unknown
+	samples  []digital.Sample
+}
+
+// SignalEdgesHandler lists the rising and falling edges of a digital signal from from_date
+// to to_date, optionally only those of one kind
+func SignalEdgesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	edge := r.URL.Query().Get("edge")
+	if edge != "" && edge != digital.Rising && edge != digital.Falling {
+		apierror.Validation(w, r, validate.Errors{{Field: "edge", Code: validate.CodeOneOf, Message: "edge must be one of rising, falling"}})
+		return
+	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+	limit := limitParam(r, 1000, maxSeriesPoints)
+	q, ok := loadStates(w, r)
+	if !ok {
+		return
+	}
+
+	response := EdgesResponse{SignalID: q.signal.ID, From: q.from, To: q.to, Edges: []digital.Edge{}}
+	var matching []digital.Edge
+	for _, e := range digital.Edges(q.initial, q.samples) {
+		if e.Edge == digital.Rising {
+			response.Rising++
+		} else {
+			response.Falling++
+		}
+		if edge == "" || e.Edge == edge {
+			matching = append(matching, e)
+		}
+	}
+	if offset < len(matching) {
+		response.Edges = matching[offset:min(offset+limit, len(matching))]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SignalStatesHandler returns the time a digital signal spent on and off from from_date to
+// to_date, its longest runs and, with a bucket, the share of time on per bucket. The listed
+// intervals can be filtered by state and duration; the totals always cover the whole range.
+func SignalStatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var errs validate.Errors
+	var state *bool
+	switch value := r.URL.Query().Get("state"); value {
+	case "":
+	case "on", "off":
+		on := value == "on"
+		state = &on
+	default:
+		errs.Add("state", validate.CodeOneOf, "state must be one of on, off")
+	}
+	minDuration := durationParam(&errs, r, "min_duration")
+	maxDuration := durationParam(&errs, r, "max_duration")
+	if maxDuration > 0 && maxDuration < minDuration {
+		errs.Add("max_duration", validate.CodeInvalid, "max_duration must not be less than min_duration")
+	}
+	bucket := durationParam(&errs, r, "bucket")
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
+	limit := limitParam(r, 1000, maxSeriesPoints)
+	q, ok := loadStates(w, r)
+	if !ok {
+		return
+	}
+	if bucket > 0 && series.BucketCount(q.from, q.to, bucket) > maxSeriesPoints {
+		apierror.Validation(w, r, validate.Errors{{Field: "bucket", Code: validate.CodeTooSmall,
+			Message: fmt.Sprintf("The range holds more than %d buckets; use larger buckets", maxSeriesPoints)}})
+		return
+	}
+
+	intervals := digital.Intervals(q.initial, q.samples, q.from, q.to)
+	response := StatesResponse{
+		SignalID:  q.signal.ID,
+		From:      q.from,
+		To:        q.to,
+		Summary:   digital.Summarize(intervals, q.from, q.to),
+		Intervals: []digital.Interval{},
+	}
+	if bucket > 0 {
+		response.Bucket = bucket.Seconds()
+		response.Buckets = digital.Buckets(intervals, q.from, q.to, bucket)
+	}
+	matching := digital.Filter(intervals, state, minDuration, maxDuration)
+	if offset < len(matching) {
+		response.Intervals = matching[offset:min(offset+limit, len(matching))]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadStates reads the digital signal and its values from from_date to to_date, ending the
+// range now when it reaches the future. Otherwise it writes the error response and returns
+// false.
+func loadStates(w http.ResponseWriter, r *http.Request) (*stateQuery, bool) {
+	signalID, err := strconv.ParseUint(mux.Vars(r)["signal_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
+		return nil, false
+	}
+	from, ok := timeParam(w, r, "from_date")
+	if !ok {
+		return nil, false
+	}
+	to, ok := timeParam(w, r, "to_date")
+	if !ok {
+		return nil, false
+	}
+	if !to.After(from) {
+		apierror.Validation(w, r, validate.Errors{{Field: "to_date", Code: validate.CodeInvalid, Message: "to_date must be after from_date"}})
+		return nil, false
+	}
+	// The last state has not lasted past now; a range in the future is empty
+	if now := time.Now(); to.After(now) {
+		to = now
+		if to.Before(from) {
+			to = from
+		}
+	}
+
+	q := &stateQuery{from: from, to: to}
+	if result := orgDB(r).First(&q.signal, signalID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal")
+		return nil, false
+	}
+	if q.signal.SignalType != "digital" {
+		apierror.Error(w, r, fmt.Sprintf("Signal %d is %s; states apply to digital signals", q.signal.ID, q.signal.SignalType), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	var rows []struct {
+		Timestamp    time.Time
+		DigitalValue bool
+	}
+	result := signalValueQuery(r, q.signal).Select("timestamp, digital_value").
+		Where("timestamp < ?", from).Order("timestamp DESC, id DESC").Limit(1).Scan(&rows)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal values")
+		return nil, false
+	}
+	if len(rows) > 0 {
+		q.initial = &rows[0].DigitalValue
+	}
+
+	rows = nil
+	result = signalValueQuery(r, q.signal).Select("timestamp, digital_value").
+		Where("timestamp >= ? AND timestamp < ?", from, to).Order("timestamp, id").Limit(maxStateValues + 1).Scan(&rows)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal values")
+		return nil, false
+	}
+	if len(rows) > maxStateValues {
+		apierror.Error(w, r, fmt.Sprintf("The range holds more than %d values; narrow the date range", maxStateValues), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	q.samples = make([]digital.Sample, len(rows))
+	for i, row := range rows {
+		q.samples[i] = digital.Sample{Timestamp: row.Timestamp, On: row.DigitalValue}
+	}
+	return q, true
+}
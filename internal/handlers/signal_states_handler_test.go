@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+// setupStates creates a digital signal that is on at 07:50, off at 08:10 and again at 08:20,
+// on at 08:30, off at 08:45 and on at 09:10
+func setupStates(t *testing.T) (a *testAPI, signal models.Signal, at func(hour, minute int) time.Time) {
+	t.Helper()
+	a = setupAPI(t)
+	device := a.device("press-1")
+	signal = a.signal(models.Signal{DeviceID: device.ID, Name: "running", SignalType: "digital"})
+
+	day := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	at = func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	for _, v := range []struct {
+		hour, minute int
+		on           bool
+	}{{7, 50, true}, {8, 10, false}, {8, 20, false}, {8, 30, true}, {8, 45, false}, {9, 10, true}} {
+		a.state(signal.ID, v.on, at(v.hour, v.minute))
+	}
+	return a, signal, at
+}
+
+func TestStates(t *testing.T) {
+	a, signal, at := setupStates(t)
+	path := idPath("/signals/%d/states", signal.ID)
+	hour := dateRange(at(8, 0), at(9, 0))
+
+	var states handlers.StatesResponse
+	a.must(http.MethodGet, path, with(hour, "bucket", "30m"), nil, &states)
+
+	// The state at 08:00 is the one from 07:50; the repeated off at 08:20 is merged and the
+	// last interval lasts past 09:00
+	expected := []struct {
+		on                 bool
+		start, end         time.Time
+		duration           float64
+		startsBefore, open bool
+	}{
+		{true, at(8, 0), at(8, 10), 600, true, false},
+		{false, at(8, 10), at(8, 30), 1200, false, false},
+		{true, at(8, 30), at(8, 45), 900, false, false},
+		{false, at(8, 45), at(9, 0), 900, false, true},
+	}
+	if len(states.Intervals) != len(expected) {
+		t.Fatalf("Expected %d intervals, got %+v", len(expected), states.Intervals)
+	}
+	for i, want := range expected {
+		got := states.Intervals[i]
+		if got.On != want.on || !got.Start.Equal(want.start) || !got.End.Equal(want.end) || got.Duration != want.duration ||
+			got.StartsBefore != want.startsBefore || got.Open != want.open {
+			t.Errorf("Interval %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	if states.OnSeconds != 1500 || states.OffSeconds != 2100 || states.UnknownSeconds != 0 || states.Transitions != 3 {
+		t.Errorf("Expected 1500s on, 2100s off and 3 transitions, got %+v", states.Summary)
+	}
+	if !near(states.OnRatio, 1500.0/3600) {
+		t.Errorf("Expected an on ratio of %v, got %v", 1500.0/3600, states.OnRatio)
+	}
+	if states.LongestOn == nil || !states.LongestOn.Start.Equal(at(8, 30)) || states.LongestOff == nil || states.LongestOff.Duration != 1200 {
+		t.Errorf("Expected the longest runs from 08:30 on and 08:10 off, got %+v and %+v", states.LongestOn, states.LongestOff)
+	}
+	if len(states.Buckets) != 2 || states.Buckets[0].OnSeconds != 600 || states.Buckets[0].OffSeconds != 1200 ||
+		states.Buckets[1].OnSeconds != 900 || states.Buckets[1].OffSeconds != 900 {
+		t.Errorf("Expected the time on and off per half hour, got %+v", states.Buckets)
+	}
+
+	// Filters only apply to the listed intervals
+	var long handlers.StatesResponse
+	a.must(http.MethodGet, path, with(hour, "state", "off", "min_duration", "1000s"), nil, &long)
+	if len(long.Intervals) != 1 || !long.Intervals[0].Start.Equal(at(8, 10)) || long.OnSeconds != 1500 {
+		t.Errorf("Expected only the 08:10 interval and the full totals, got %+v", long)
+	}
+
+	// Before the first value the state is unknown
+	var early handlers.StatesResponse
+	a.must(http.MethodGet, path, dateRange(at(7, 40), at(8, 0)), nil, &early)
+	if early.UnknownSeconds != 600 || len(early.Intervals) != 1 || early.Intervals[0].StartsBefore || !early.Intervals[0].Open {
+		t.Errorf("Expected 600 unknown seconds then an open interval, got %+v", early)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	a, signal, at := setupStates(t)
+	path := idPath("/signals/%d/edges", signal.ID)
+	hour := dateRange(at(8, 0), at(9, 0))
+
+	// The change from the 07:50 state counts; the repeated off at 08:20 is no edge
+	var edges handlers.EdgesResponse
+	a.must(http.MethodGet, path, hour, nil, &edges)
+	if edges.Rising != 1 || edges.Falling != 2 || len(edges.Edges) != 3 {
+		t.Fatalf("Expected 1 rising and 2 falling edges, got %+v", edges)
+	}
+	for i, want := range []struct {
+		at   time.Time
+		kind string
+	}{{at(8, 10), "falling"}, {at(8, 30), "rising"}, {at(8, 45), "falling"}} {
+		if !edges.Edges[i].Timestamp.Equal(want.at) || edges.Edges[i].Edge != want.kind {
+			t.Errorf("Edge %d: expected %s at %v, got %+v", i, want.kind, want.at, edges.Edges[i])
+		}
+	}
+
+	var falling handlers.EdgesResponse
+	a.must(http.MethodGet, path, with(hour, "edge", "falling", "limit", "1", "offset", "1"), nil, &falling)
+	if falling.Falling != 2 || len(falling.Edges) != 1 || !falling.Edges[0].Timestamp.Equal(at(8, 45)) {
+		t.Errorf("Expected the second falling edge, got %+v", falling)
+	}
+}
+
+func TestStates_Rejected(t *testing.T) {
+	a, signal, at := setupStates(t)
+	hour := dateRange(at(8, 0), at(9, 0))
+
+	for _, tc := range []struct {
+		path  string
+		query url.Values
+		field string
+	}{
+		{"/signals/%d/states", with(hour, "state", "maybe"), "state"},
+		{"/signals/%d/states", with(hour, "min_duration", "1h", "max_duration", "1m"), "max_duration"},
+		{"/signals/%d/edges", dateRange(at(9, 0), at(8, 0)), "to_date"},
+	} {
+		if problem := a.call(http.MethodGet, idPath(tc.path, signal.ID), tc.query, nil, nil); !invalid(problem, tc.field) {
+			t.Errorf("%s %v: expected a validation error for %s, got %+v", tc.path, tc.query, tc.field, problem)
+		}
+	}
+
+	analog := a.signal(models.Signal{DeviceID: signal.DeviceID, Name: "torque", SignalType: "analogic"})
+	if problem := a.call(http.MethodGet, idPath("/signals/%d/states", analog.ID), hour, nil, nil); problem == nil || problem.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected states of an analogic signal to be refused, got %+v", problem)
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/models"
+	"data-storage/internal/signalstats"
+	"data-storage/internal/validate"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxCompareSignals limits the signals of one statistics or aligned series request
+const maxCompareSignals = 20
+
+// SignalStats is the statistical summary of the values of a signal. Digital values count as
+// 1 (on) and 0 (off), so their mean is the share of on values.
+type SignalStats struct {
+	SignalID   uint   `json:"signal_id"`
+	Name       string `json:"name"`
+	DeviceID   uint   `json:"device_id"`
+	SignalType string `json:"signal_type"`
+	Unit       string `json:"unit,omitempty"`
+	signalstats.Summary
+	Capability *signalstats.Capability `json:"capability,omitempty"` // Analogic signals with a min_value or max_value
+}
+
+// SignalStatsResponse compares the statistics of signals over a time range
+type SignalStatsResponse struct {
+	From    *time.Time    `json:"from,omitempty"`
+	To      *time.Time    `json:"to,omitempty"`
+	Signals []SignalStats `json:"signals"`
+}
+
+// SignalStatsHandler summarizes the values of a signal, and of the signals listed in compare,
+// between from_date and to_date
+func SignalStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	signalID, err := strconv.ParseUint(mux.Vars(r)["signal_id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
+		return
+	}
+	compare, ok := idsParam(w, r, "compare")
+	if !ok {
+		return
+	}
+	ids := []uint{uint(signalID)}
+	for _, id := range compare {
+		if id != ids[0] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxCompareSignals {
+		apierror.Validation(w, r, validate.Errors{{Field: "compare", Code: validate.CodeTooLarge, Message: fmt.Sprintf("At most %d signals can be compared", maxCompareSignals)}})
+		return
+	}
+	from, to, ok := timeRangeParams(w, r)
+	if !ok {
+		return
+	}
+
+	var signals []models.Signal
+	if result := orgDB(r).Where("id IN ?", ids).Find(&signals); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signals")
+		return
+	}
+	byID := make(map[uint]models.Signal, len(signals))
+	for _, signal := range signals {
+		byID[signal.ID] = signal
+	}
+
+	response := SignalStatsResponse{From: from, To: to, Signals: make([]SignalStats, 0, len(ids))}
+	for _, id := range ids {
+		signal, ok := byID[id]
+		if !ok {
+			apierror.Error(w, r, fmt.Sprintf("Signal %d not found", id), http.StatusNotFound)
+			return
+		}
+		if signal.SignalType == "waveform" {
+			apierror.Error(w, r, fmt.Sprintf("Signal %d is a waveform; use the waveform statistics of its values", id), http.StatusUnprocessableEntity)
+			return
+		}
+		stats, err := signalStats(r, signal, from, to)
+		if err != nil {
+			apierror.Database(w, r, err, "signal values")
+			return
+		}
+		response.Signals = append(response.Signals, stats)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// signalStats computes the summary of a signal in the database. PostgreSQL computes the
+// standard deviation and percentiles itself; other databases, used in tests, rank the values.
+func signalStats(r *http.Request, signal models.Signal, from, to *time.Time) (SignalStats, error) {
+	stats := SignalStats{SignalID: signal.ID, Name: signal.Name, DeviceID: signal.DeviceID, SignalType: signal.SignalType, Unit: signal.Unit}
+	column := valueColumn(signal)
+	values := func() *gorm.DB {
+		query := signalValueQuery(r, signal)
+		if from != nil {
+			query = query.Where("timestamp >= ?", *from)
+		}
+		if to != nil {
+			query = query.Where("timestamp <= ?", *to)
+		}
+		return query
+	}
+
+	var err error
+	if orgDB(r).Dialector.Name() == "postgres" {
+		err = postgresStats(values, column, &stats.Summary)
+	} else {
+		err = rankedStats(values, column, &stats.Summary)
+	}
+	if err != nil || stats.Count == 0 {
+		return stats, err
+	}
+
+	// The first time the extremes were reached
+	for _, extreme := range []struct {
+		order string
+		dst   **signalstats.Extreme
+	}{{"ASC", &stats.Min}, {"DESC", &stats.Max}} {
+		var row struct {
+			Value     float64
+			Timestamp time.Time
+		}
+		result := values().Select(column + " AS value, timestamp").Order(column + " " + extreme.order + ", timestamp ASC").Limit(1).Scan(&row)
+		if result.Error != nil {
+			return stats, result.Error
+		}
+		*extreme.dst = &signalstats.Extreme{Value: row.Value, Timestamp: row.Timestamp}
+	}
+
+	if signal.SignalType == "analogic" && stats.Mean != nil && stats.StdDev != nil {
+		stats.Capability = signalstats.NewCapability(*stats.Mean, *stats.StdDev, signal.MinValue, signal.MaxValue)
+	}
+	return stats, nil
+}
+
+// postgresStats computes the count, mean, standard deviation and percentiles in one query
+func postgresStats(values func() *gorm.DB, column string, summary *signalstats.Summary) error {
+	selects := []string{"COUNT(*) AS count", "AVG(" + column + ") AS mean", "STDDEV_SAMP(" + column + ") AS std_dev"}
+	for i, p := range signalstats.Percentiles {
+		selects = append(selects, fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY %s) AS p%d", p, column, i))
+	}
+	var row struct {
+		Count      int64
+		Mean       *float64
+		StdDev     *float64
+		P0, P1, P2 *float64
+	}
+	if result := values().Select(strings.Join(selects, ", ")).Scan(&row); result.Error != nil {
+		return result.Error
+	}
+	summary.Count, summary.Mean, summary.StdDev = row.Count, row.Mean, row.StdDev
+	summary.P50, summary.P95, summary.P99 = row.P0, row.P1, row.P2
+	return nil
+}
+
+// rankedStats computes the mean and standard deviation from sums, and each percentile from
+// the values ranked around it
+func rankedStats(values func() *gorm.DB, column string, summary *signalstats.Summary) error {
+	var row struct {
+		Count      int64
+		Sum        float64
+		SumSquares float64
+	}
+	result := values().Select("COUNT(*) AS count, COALESCE(SUM(" + column + "), 0) AS sum, COALESCE(SUM(" + column + " * " + column + "), 0) AS sum_squares").Scan(&row)
+	if result.Error != nil || row.Count == 0 {
+		return result.Error
+	}
+	mean := row.Sum / float64(row.Count)
+	summary.Count, summary.Mean = row.Count, &mean
+	if row.Count > 1 {
+		stdDev := math.Sqrt(signalstats.Variance(row.Count, row.Sum, row.SumSquares))
+		summary.StdDev = &stdDev
+	}
+
+	percentiles := make([]float64, len(signalstats.Percentiles))
+	for i, p := range signalstats.Percentiles {
+		lower, upper, weight := signalstats.Rank(row.Count, p)
+		var ranked []float64
+		result := values().Select(column + " AS value").Order(column).Offset(int(lower)).Limit(int(upper-lower) + 1).Scan(&ranked)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(ranked) == 0 {
+			return fmt.Errorf("no value at rank %d", lower)
+		}
+		percentiles[i] = ranked[0]
+		if len(ranked) > 1 {
+			percentiles[i] += weight * (ranked[1] - ranked[0])
+		}
+	}
+	summary.SetPercentiles(percentiles)
+	return nil
+}
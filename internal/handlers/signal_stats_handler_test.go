@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+func TestSignalStats(t *testing.T) {
+	a := setupAPI(t)
+	device := a.device("press-1")
+	lsl, usl := 0.0, 12.0
+	torque := a.signal(models.Signal{DeviceID: device.ID, Name: "torque", SignalType: "analogic", MinValue: &lsl, MaxValue: &usl})
+	running := a.signal(models.Signal{DeviceID: device.ID, Name: "running", SignalType: "digital"})
+
+	// 2, 4, 4, 4, 5, 5, 7, 9 out of order: mean 5, sample variance 32/7; the value after
+	// the range is left out
+	start := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	for i, v := range []float64{5, 9, 4, 2, 7, 4, 5, 4, 12} {
+		a.value(torque.ID, v, at(i))
+	}
+	for i, on := range []bool{true, false, true} {
+		a.state(running.ID, on, at(i))
+	}
+
+	var report handlers.SignalStatsResponse
+	a.must(http.MethodGet, idPath("/signals/%d/stats", torque.ID), with(dateRange(start, at(7)), "compare", strconv.Itoa(int(running.ID))), nil, &report)
+	if len(report.Signals) != 2 || report.Signals[0].SignalID != torque.ID || report.Signals[1].SignalID != running.ID {
+		t.Fatalf("Expected the signal followed by the compared one, got %+v", report.Signals)
+	}
+
+	stats := report.Signals[0]
+	stdDev := math.Sqrt(32.0 / 7)
+	if stats.Count != 8 || !near(stats.Mean, 5) || !near(stats.StdDev, stdDev) {
+		t.Errorf("Expected count 8, mean 5 and stddev %v, got %+v", stdDev, stats.Summary)
+	}
+	// Interpolated between the ranked values, like percentile_cont
+	if !near(stats.P50, 4.5) || !near(stats.P95, 8.3) || !near(stats.P99, 8.86) {
+		t.Errorf("Expected percentiles 4.5, 8.3 and 8.86, got %v, %v, %v", *stats.P50, *stats.P95, *stats.P99)
+	}
+	if stats.Min == nil || stats.Min.Value != 2 || !stats.Min.Timestamp.Equal(at(3)) {
+		t.Errorf("Expected the minimum 2 at 08:03, got %+v", stats.Min)
+	}
+	if stats.Max == nil || stats.Max.Value != 9 || !stats.Max.Timestamp.Equal(at(1)) {
+		t.Errorf("Expected the maximum 9 at 08:01, got %+v", stats.Max)
+	}
+	if stats.Capability == nil || !near(stats.Capability.Cp, 12/(6*stdDev)) || !near(stats.Capability.Cpk, 5/(3*stdDev)) {
+		t.Errorf("Expected Cp %v and Cpk %v, got %+v", 12/(6*stdDev), 5/(3*stdDev), stats.Capability)
+	}
+
+	// Digital values count as 1 and 0 and have no capability
+	digital := report.Signals[1]
+	if digital.Count != 3 || !near(digital.Mean, 2.0/3) || digital.Capability != nil {
+		t.Errorf("Expected a mean of 2/3 without capability, got %+v", digital)
+	}
+
+	// Without a range every value counts; the first time the extreme was reached is reported
+	var all handlers.SignalStatsResponse
+	a.must(http.MethodGet, idPath("/signals/%d/stats", torque.ID), nil, nil, &all)
+	if stats := all.Signals[0]; stats.Count != 9 || stats.Max.Value != 12 || !stats.Max.Timestamp.Equal(at(8)) {
+		t.Errorf("Expected all 9 values with the maximum 12, got %+v", stats.Summary)
+	}
+}
+
+func TestSignalStats_Rejected(t *testing.T) {
+	a := setupAPI(t)
+	device := a.device("press-1")
+	signal := a.signal(models.Signal{DeviceID: device.ID, Name: "torque", SignalType: "analogic"})
+	curve := a.signal(models.Signal{DeviceID: device.ID, Name: "curve", SignalType: "waveform"})
+
+	path := idPath("/signals/%d/stats", signal.ID)
+	many := make([]string, 21)
+	for i := range many {
+		many[i] = strconv.Itoa(i + 100)
+	}
+	for _, tc := range []struct {
+		query url.Values
+		field string
+	}{
+		{url.Values{"compare": {"1,x"}}, "compare"},
+		{url.Values{"compare": {strings.Join(many, ",")}}, "compare"},
+		{url.Values{"from_date": {"yesterday"}}, "from_date"},
+		{url.Values{"from_date": {"2024-06-03"}, "to_date": {"2024-06-02"}}, "to_date"},
+	} {
+		if problem := a.call(http.MethodGet, path, tc.query, nil, nil); !invalid(problem, tc.field) {
+			t.Errorf("%v: expected a validation error for %s, got %+v", tc.query, tc.field, problem)
+		}
+	}
+
+	if problem := a.call(http.MethodGet, idPath("/signals/%d/stats", curve.ID), nil, nil, nil); problem == nil || problem.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected waveform statistics to be refused, got %+v", problem)
+	}
+	if problem := a.call(http.MethodGet, path, url.Values{"compare": {"9999"}}, nil, nil); problem == nil || problem.Status != http.StatusNotFound {
+		t.Errorf("Expected an unknown compared signal to be not found, got %+v", problem)
+	}
+
+	// No values: only the count
+	var report handlers.SignalStatsResponse
+	a.must(http.MethodGet, path, nil, nil, &report)
+	if report.Signals[0].Count != 0 || report.Signals[0].Mean != nil || report.Signals[0].P50 != nil {
+		t.Errorf("Expected an empty summary, got %+v", report)
+	}
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
-	"data-storage/internal/db"
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/metrics"
 	"data-storage/internal/models"
+	"data-storage/internal/ratelimit"
+	"data-storage/internal/validate"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -22,7 +27,7 @@ func SignalValuesHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		CreateSignalValue(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -34,13 +39,33 @@ func SignalValueHandler(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteSignalValue(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func getAllSignalValues(w http.ResponseWriter, r *http.Request) {
+	shape, ok := parseValueShape(w, r)
+	if !ok {
+		return
+	}
+	var signal models.Signal
+	if shape != nil {
+		// A fill or function applies to the values of one signal
+		signalIDs, ok := idsParam(w, r, "signal_id")
+		if !ok {
+			return
+		}
+		if len(signalIDs) != 1 {
+			apierror.Validation(w, r, validate.Errors{{Field: "signal_id", Code: validate.CodeRequired, Message: "A fill or function needs a single signal_id"}})
+			return
+		}
+		if signal, ok = shape.valueShapeSignal(w, r, signalIDs[0]); !ok {
+			return
+		}
+	}
+
 	var signalValues []models.SignalValue
-	query := db.GetDB().Preload("Signal").Preload("Signal.Device").Preload("User")
+	query := withSamples(r, orgDB(r).Preload("Signal").Preload("Signal.Device").Preload("User"))
 
 	// Filter by signal_id
 	if signalID := r.URL.Query().Get("signal_id"); signalID != "" {
@@ -75,13 +100,24 @@ func getAllSignalValues(w http.ResponseWriter, r *http.Request) {
 	if limitInt > 10000 {
 		limitInt = 10000 // Max limit
 	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
 
-	result := query.Order("timestamp DESC").Limit(limitInt).Find(&signalValues)
+	// The ID breaks timestamp ties so pages don't overlap
+	result := query.Order("signal_values.timestamp DESC, signal_values.id DESC").Limit(limitInt).Offset(offset).Find(&signalValues)
 	if result.Error != nil {
-		log.Printf("Error fetching signal values: %v", result.Error)
-		http.Error(w, "Error fetching signal values", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal values")
 		return
 	}
+	if shape != nil {
+		var err error
+		if signalValues, err = shape.shapeValues(signal, signalValues); err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "gap_threshold", Code: validate.CodeTooLarge, Message: err.Error()}})
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(signalValues)
@@ -91,25 +127,20 @@ func getSignalValue(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	valueIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Signal value ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal value ID required", http.StatusBadRequest)
 		return
 	}
 
 	valueID, err := strconv.ParseUint(valueIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal value ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal value ID", http.StatusBadRequest)
 		return
 	}
 
 	var signalValue models.SignalValue
-	result := db.GetDB().Preload("Signal").Preload("Signal.Device").Preload("User").First(&signalValue, valueID)
+	result := orgDB(r).Preload("Signal").Preload("Signal.Device").Preload("User").First(&signalValue, valueID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Signal value not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching signal value: %v", result.Error)
-			http.Error(w, "Error fetching signal value", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "signal value")
 		return
 	}
 
@@ -117,34 +148,65 @@ func getSignalValue(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(signalValue)
 }
 
+// withSamples leaves the samples of waveform values out of a list query unless the request
+// asks for them with include_samples=true; a page of torque curves would be megabytes
+func withSamples(r *http.Request, query *gorm.DB) *gorm.DB {
+	if r.URL.Query().Get("include_samples") == "true" {
+		return query
+	}
+	return query.Omit("samples")
+}
+
 // CreateSignalValue is exported for use in main.go routing
 func CreateSignalValue(w http.ResponseWriter, r *http.Request) {
+	// reject reports an invalid field and counts the rejection
+	reject := func(reason, field, code, message string) {
+		metrics.ValueRejected(reason)
+		apierror.Validation(w, r, validate.Errors{{Field: field, Code: code, Message: message}})
+	}
+
 	var signalValue models.SignalValue
-	if err := json.NewDecoder(r.Body).Decode(&signalValue); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeBody(w, r, &signalValue) {
+		metrics.ValueRejected(metrics.RejectInvalidBody)
 		return
 	}
 
 	// Signal ID is required
 	if signalValue.SignalID == 0 {
-		http.Error(w, "signal_id is required", http.StatusBadRequest)
+		reject(metrics.RejectMissingSignalID, "signal_id", validate.CodeRequired, "signal_id is required")
 		return
 	}
 
 	// Verify signal exists and get device info
 	var signal models.Signal
-	result := db.GetDB().Preload("Device").First(&signal, signalValue.SignalID)
+	result := orgDB(r).Preload("Device").First(&signal, signalValue.SignalID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Signal not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching signal: %v", result.Error)
-			http.Error(w, "Error fetching signal", http.StatusInternalServerError)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			metrics.ValueRejected(metrics.RejectUnknownSignal)
 		}
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
-	// Determine user_id: use provided, fallback to device user, or none
+	// Determine user_id: use provided, fallback to the operator badged in at the device,
+	// then the device user, or none. Devices cannot attribute values to anyone but the
+	// operator badged in at them.
+	operatorID, err := openSessionOperator(r, signal.DeviceID)
+	if err != nil {
+		apierror.Database(w, r, err, "operator session")
+		return
+	}
+	if signalValue.UserID != nil {
+		if !requireOrgMember(w, r, *signalValue.UserID) {
+			return
+		}
+		if r.Header.Get("X-Auth-Type") == "device" && (operatorID == nil || *signalValue.UserID != *operatorID) {
+			reject(metrics.RejectOperatorMismatch, "user_id", validate.CodeInvalid, "user_id must be the operator badged in at the device")
+			return
+		}
+	} else {
+		signalValue.UserID = operatorID
+	}
 	if signalValue.UserID == nil && signal.Device.UserID != nil {
 		signalValue.UserID = signal.Device.UserID
 	}
@@ -158,7 +220,8 @@ func CreateSignalValue(w http.ResponseWriter, r *http.Request) {
 	if authType == "device" && deviceIDStr != "" {
 		authDeviceID, _ := strconv.ParseUint(deviceIDStr, 10, 32)
 		if uint(authDeviceID) != signal.DeviceID {
-			http.Error(w, "Device ID mismatch", http.StatusForbidden)
+			metrics.ValueRejected(metrics.RejectDeviceMismatch)
+			apierror.Error(w, r, "Device ID mismatch", http.StatusForbidden)
 			return
 		}
 	}
@@ -176,96 +239,182 @@ func CreateSignalValue(w http.ResponseWriter, r *http.Request) {
 	// Validate value based on signal type
 	if signal.SignalType == "analogic" {
 		if signalValue.Value == nil {
-			http.Error(w, "value is required for analogic signals", http.StatusBadRequest)
+			reject(metrics.RejectMissingValue, "value", validate.CodeRequired, "value is required for analogic signals")
 			return
 		}
 		// Validate min/max if set
 		if signal.MinValue != nil && *signalValue.Value < *signal.MinValue {
-			http.Error(w, "value below minimum", http.StatusBadRequest)
+			reject(metrics.RejectBelowMinimum, "value", validate.CodeTooSmall,
+				fmt.Sprintf("value must be at least %g", *signal.MinValue))
 			return
 		}
 		if signal.MaxValue != nil && *signalValue.Value > *signal.MaxValue {
-			http.Error(w, "value above maximum", http.StatusBadRequest)
+			reject(metrics.RejectAboveMaximum, "value", validate.CodeTooLarge,
+				fmt.Sprintf("value must be at most %g", *signal.MaxValue))
 			return
 		}
 	} else if signal.SignalType == "digital" {
 		if signalValue.DigitalValue == nil {
-			http.Error(w, "digital_value is required for digital signals", http.StatusBadRequest)
+			reject(metrics.RejectMissingValue, "digital_value", validate.CodeRequired, "digital_value is required for digital signals")
+			return
+		}
+	} else if signal.SignalType == "waveform" {
+		if !validWaveform(signalValue, signal, reject) {
 			return
 		}
 	}
+	if signal.SignalType != "waveform" && (signalValue.Samples != nil || signalValue.SampleInterval != nil) {
+		reject(metrics.RejectInvalidWaveform, "samples", validate.CodeInvalid, "samples are only accepted for waveform signals")
+		return
+	}
 
 	// Set timestamp if not provided
 	if signalValue.Timestamp.IsZero() {
 		signalValue.Timestamp = time.Now()
 	}
 
-	result = db.GetDB().Create(&signalValue)
-	if result.Error != nil {
-		log.Printf("Error creating signal value: %v", result.Error)
-		http.Error(w, "Error creating signal value", http.StatusInternalServerError)
+	// Enforce the device's daily ingestion quota. The quota is consumed in the insert's
+	// transaction, so a value that fails to store doesn't count.
+	now := time.Now()
+	allowed := false
+	err = orgDB(r).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if allowed, err = ratelimit.ConsumeQuota(tx, &signal.Device, now); err != nil || !allowed {
+			return err
+		}
+		return tx.Create(&signalValue).Error
+	})
+	if err != nil {
+		apierror.Database(w, r, err, "signal value")
 		return
 	}
+	if !allowed {
+		retryAfter := int(ratelimit.QuotaResetTime(now).Sub(now).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		metrics.ValueRejected(metrics.RejectQuotaExceeded)
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeQuotaExceeded, "Daily ingestion quota exceeded")
+		return
+	}
+	metrics.ValueIngested(signal.DeviceID, signal.ID)
+
+	if audit.RecordsValueCreates() {
+		audit.Record(r, audit.ActionCreate, "signal_value", signalValue.ID, nil, signalValue)
+	}
 
 	// Reload with relations
-	db.GetDB().Preload("Signal").Preload("Signal.Device").Preload("User").First(&signalValue, signalValue.ID)
+	orgDB(r).Preload("Signal").Preload("Signal.Device").Preload("User").First(&signalValue, signalValue.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(signalValue)
 }
 
+// maxWaveformSamples limits the samples of one waveform value
+const maxWaveformSamples = 100000
+
+// validWaveform checks the samples and sample interval of a waveform value, and that every
+// sample is within the signal's range. It reports the first problem through reject.
+func validWaveform(value models.SignalValue, signal models.Signal, reject func(reason, field, code, message string)) bool {
+	switch {
+	case len(value.Samples) == 0:
+		reject(metrics.RejectMissingValue, "samples", validate.CodeRequired, "samples are required for waveform signals")
+		return false
+	case len(value.Samples) > maxWaveformSamples:
+		reject(metrics.RejectInvalidWaveform, "samples", validate.CodeTooLong,
+			fmt.Sprintf("samples must have at most %d items", maxWaveformSamples))
+		return false
+	case value.SampleInterval == nil:
+		reject(metrics.RejectMissingValue, "sample_interval", validate.CodeRequired, "sample_interval is required for waveform signals")
+		return false
+	case *value.SampleInterval <= 0:
+		reject(metrics.RejectInvalidWaveform, "sample_interval", validate.CodeTooSmall, "sample_interval must be positive")
+		return false
+	}
+	for i, sample := range value.Samples {
+		if signal.MinValue != nil && sample < *signal.MinValue {
+			reject(metrics.RejectBelowMinimum, "samples", validate.CodeTooSmall,
+				fmt.Sprintf("sample %d must be at least %g", i, *signal.MinValue))
+			return false
+		}
+		if signal.MaxValue != nil && sample > *signal.MaxValue {
+			reject(metrics.RejectAboveMaximum, "samples", validate.CodeTooLarge,
+				fmt.Sprintf("sample %d must be at most %g", i, *signal.MaxValue))
+			return false
+		}
+	}
+	return true
+}
+
 func deleteSignalValue(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	valueIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Signal value ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal value ID required", http.StatusBadRequest)
 		return
 	}
 
 	valueID, err := strconv.ParseUint(valueIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal value ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal value ID", http.StatusBadRequest)
+		return
+	}
+
+	// Load the signal value first so the audit log keeps its last state
+	var signalValue models.SignalValue
+	result := orgDB(r).First(&signalValue, valueID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal value")
 		return
 	}
 
-	result := db.GetDB().Delete(&models.SignalValue{}, valueID)
+	result = orgDB(r).Delete(&signalValue)
 	if result.Error != nil {
-		log.Printf("Error deleting signal value: %v", result.Error)
-		http.Error(w, "Error deleting signal value", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal value")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Signal value not found", http.StatusNotFound)
+		apierror.Error(w, r, "Signal value not found", http.StatusNotFound)
 		return
 	}
 
+	audit.Record(r, audit.ActionDelete, "signal_value", signalValue.ID, signalValue, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // SignalValuesBySignalHandler gets signal values for a specific signal
 func SignalValuesBySignalHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	vars := mux.Vars(r)
 	signalIDStr, ok := vars["signal_id"]
 	if !ok {
-		http.Error(w, "Signal ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal ID required", http.StatusBadRequest)
 		return
 	}
 
 	signalID, err := strconv.ParseUint(signalIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
 		return
 	}
+	shape, ok := parseValueShape(w, r)
+	if !ok {
+		return
+	}
+	var signal models.Signal
+	if shape != nil {
+		if signal, ok = shape.valueShapeSignal(w, r, uint(signalID)); !ok {
+			return
+		}
+	}
 
 	var signalValues []models.SignalValue
-	query := db.GetDB().Where("signal_id = ?", signalID).Preload("Signal").Preload("User")
+	query := withSamples(r, orgDB(r).Where("signal_id = ?", signalID).Preload("Signal").Preload("User"))
 
 	// Date range filters
 	if fromDate := r.URL.Query().Get("from_date"); fromDate != "" {
@@ -284,15 +433,23 @@ func SignalValuesBySignalHandler(w http.ResponseWriter, r *http.Request) {
 	if limitInt > 10000 {
 		limitInt = 10000
 	}
+	offset, ok := offsetParam(w, r)
+	if !ok {
+		return
+	}
 
-	result := query.Order("timestamp DESC").Limit(limitInt).Find(&signalValues)
+	result := query.Order("timestamp DESC, id DESC").Limit(limitInt).Offset(offset).Find(&signalValues)
 	if result.Error != nil {
-		log.Printf("Error fetching signal values: %v", result.Error)
-		http.Error(w, "Error fetching signal values", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal values")
 		return
 	}
+	if shape != nil {
+		if signalValues, err = shape.shapeValues(signal, signalValues); err != nil {
+			apierror.Validation(w, r, validate.Errors{{Field: "gap_threshold", Code: validate.CodeTooLarge, Message: err.Error()}})
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(signalValues)
 }
-
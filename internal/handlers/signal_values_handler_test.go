@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"data-storage/internal/models"
+)
+
+// values formats the values of a list, with - for missing ones and * after filled ones
+func values(list []models.SignalValue) string {
+	v := make([]string, len(list))
+	for i, value := range list {
+		v[i] = "-"
+		if value.Value != nil {
+			v[i] = fmt.Sprintf("%.4g", *value.Value)
+		}
+		if value.Filled {
+			v[i] += "*"
+		}
+	}
+	return strings.Join(v, " ")
+}
+
+func TestValues_Function(t *testing.T) {
+	a, analog, _, _ := setupSeries(t)
+	path := idPath("/signals/%d/values", analog.ID)
+
+	// Values are listed newest first, and the function applies to each page in time order
+	for _, tc := range []struct {
+		path  string
+		query url.Values
+		want  string
+	}{
+		{path, url.Values{}, "50 40 20 10"},
+		{path, url.Values{"function": {"difference"}}, "10 20 10 -"},
+		{path, url.Values{"function": {"difference"}, "limit": {"2"}}, "10 -"},
+		{path, url.Values{"function": {"difference"}, "limit": {"2"}, "offset": {"1"}}, "20 -"},
+		{path, url.Values{"function": {"rate"}, "unit": {"1m"}}, "6.667 7.5 15 -"},
+		{path, url.Values{"function": {"moving_average"}, "window": {"2"}}, "45 30 15 10"},
+		{"/signal-values", url.Values{"signal_id": {fmt.Sprint(analog.ID)}, "function": {"integral"}, "unit": {"1m"}}, "157.5 90 10 0"},
+	} {
+		var list []models.SignalValue
+		a.must(http.MethodGet, tc.path, tc.query, nil, &list)
+		if got := values(list); got != tc.want {
+			t.Errorf("GET %s?%s: expected %q, got %q", tc.path, tc.query.Encode(), tc.want, got)
+		}
+	}
+}
+
+func TestValues_Fill(t *testing.T) {
+	a, analog, _, at := setupSeries(t)
+	path := idPath("/signals/%d/values", analog.ID)
+	gaps := url.Values{"gap_threshold": {"1m"}}
+
+	// The gaps from 08:00:50 to 08:03:30 and from 08:03:30 to 08:05 get a value a minute
+	for _, tc := range []struct {
+		path  string
+		query url.Values
+		want  string
+	}{
+		{path, with(gaps, "fill", "previous"), "50 40* 40 20* 20* 20 10"},
+		{path, with(gaps, "fill", "null"), "50 -* 40 -* -* 20 10"},
+		{path, with(gaps, "fill", "constant", "fill_value", "0"), "50 0* 40 0* 0* 20 10"},
+		{path, with(gaps, "fill", "previous", "function", "difference"), "10 0* 20 0* 0* 10 -"},
+		{path, with(gaps, "fill", "previous", "limit", "2"), "50 40* 40"},
+		{"/signal-values", with(gaps, "fill", "linear", "signal_id", fmt.Sprint(analog.ID)), "50 46.67* 40 35* 27.5* 20 10"},
+	} {
+		var list []models.SignalValue
+		a.must(http.MethodGet, tc.path, tc.query, nil, &list)
+		if got := values(list); got != tc.want {
+			t.Errorf("GET %s?%s: expected %q, got %q", tc.path, tc.query.Encode(), tc.want, got)
+		}
+	}
+
+	var list []models.SignalValue
+	a.must(http.MethodGet, path, with(gaps, "fill", "previous"), nil, &list)
+	if filled := list[1]; filled.ID != 0 || !filled.Timestamp.Equal(at(4, 30)) || filled.SignalID != analog.ID {
+		t.Errorf("Expected a value filled without an ID at 08:04:30, got %+v", filled)
+	}
+	if stored := list[2]; stored.ID == 0 || stored.Filled {
+		t.Errorf("Expected the stored value at 08:03:30, got %+v", stored)
+	}
+}
+
+func TestValues_Rejected(t *testing.T) {
+	a, analog, digital, _ := setupSeries(t)
+	path := idPath("/signals/%d/values", analog.ID)
+
+	for _, tc := range []struct {
+		path  string
+		query url.Values
+		field string
+	}{
+		// Buckets are left to the series endpoints
+		{path, url.Values{"bucket": {"1m"}}, "bucket"},
+		{path, url.Values{"aggregate": {"max"}}, "aggregate"},
+		{path, url.Values{"fill": {"previous"}}, "fill"},
+		{path, url.Values{"fill": {"spline"}, "gap_threshold": {"5m"}}, "fill"},
+		{path, url.Values{"fill": {"constant"}, "gap_threshold": {"5m"}}, "fill_value"},
+		{path, url.Values{"gap_threshold": {"5m"}}, "gap_threshold"},
+		{path, url.Values{"function": {"spline"}}, "function"},
+		{path, url.Values{"function": {"moving_average"}}, "function"},
+		{path, url.Values{"function": {"rate"}, "unit": {"1ms"}}, "unit"},
+		{idPath("/signals/%d/values", digital.ID), url.Values{"function": {"rate"}}, "function"},
+		{idPath("/signals/%d/values", digital.ID), url.Values{"fill": {"linear"}, "gap_threshold": {"5m"}}, "fill"},
+		{"/signal-values", url.Values{"fill": {"previous"}, "gap_threshold": {"5m"}}, "signal_id"},
+		{"/signal-values", url.Values{"function": {"rate"}}, "signal_id"},
+		{"/signal-values", url.Values{"function": {"rate"}, "signal_id": {fmt.Sprintf("%d,%d", analog.ID, digital.ID)}}, "signal_id"},
+	} {
+		if problem := a.call(http.MethodGet, tc.path, tc.query, nil, nil); !invalid(problem, tc.field) {
+			t.Errorf("GET %s?%s: expected a validation error for %s, got %+v", tc.path, tc.query.Encode(), tc.field, problem)
+		}
+	}
+}
@@ -2,15 +2,15 @@
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 
-	"data-storage/internal/db"
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
 	"data-storage/internal/models"
+	"data-storage/internal/validate"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 )
 
 // SignalsHandler handles signal configuration CRUD operations
@@ -21,7 +21,7 @@ func SignalsHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		createSignal(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -35,13 +35,13 @@ func SignalHandler(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteSignal(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func getAllSignals(w http.ResponseWriter, r *http.Request) {
 	var signals []models.Signal
-	query := db.GetDB().Preload("Device")
+	query := orgDB(r).Preload("Device")
 
 	// Filter by device_id
 	if deviceID := r.URL.Query().Get("device_id"); deviceID != "" {
@@ -66,8 +66,7 @@ func getAllSignals(w http.ResponseWriter, r *http.Request) {
 
 	result := query.Order("created_at DESC").Find(&signals)
 	if result.Error != nil {
-		log.Printf("Error fetching signals: %v", result.Error)
-		http.Error(w, "Error fetching signals", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signals")
 		return
 	}
 
@@ -79,25 +78,20 @@ func getSignal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	signalIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Signal ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal ID required", http.StatusBadRequest)
 		return
 	}
 
 	signalID, err := strconv.ParseUint(signalIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
 		return
 	}
 
 	var signal models.Signal
-	result := db.GetDB().Preload("Device").First(&signal, signalID)
+	result := orgDB(r).Preload("Device").First(&signal, signalID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Signal not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching signal: %v", result.Error)
-			http.Error(w, "Error fetching signal", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
@@ -107,27 +101,15 @@ func getSignal(w http.ResponseWriter, r *http.Request) {
 
 func createSignal(w http.ResponseWriter, r *http.Request) {
 	var signal models.Signal
-	if err := json.NewDecoder(r.Body).Decode(&signal); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Device ID is required
-	if signal.DeviceID == 0 {
-		http.Error(w, "device_id is required", http.StatusBadRequest)
+	if !decodeJSON(w, r, &signal, "device_id", "name") {
 		return
 	}
 
 	// Verify device exists
 	var device models.Device
-	result := db.GetDB().First(&device, signal.DeviceID)
+	result := orgDB(r).First(&device, signal.DeviceID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Device not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching device: %v", result.Error)
-			http.Error(w, "Error fetching device", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "device")
 		return
 	}
 
@@ -142,27 +124,16 @@ func createSignal(w http.ResponseWriter, r *http.Request) {
 		signal.IsActive = true
 	}
 
-	// Validate signal_type
-	if signal.SignalType != "digital" && signal.SignalType != "analogic" {
-		http.Error(w, "signal_type must be 'digital' or 'analogic'", http.StatusBadRequest)
-		return
-	}
-
-	// Validate direction
-	if signal.Direction != "input" && signal.Direction != "output" {
-		http.Error(w, "direction must be 'input' or 'output'", http.StatusBadRequest)
-		return
-	}
-
-	result = db.GetDB().Create(&signal)
+	result = orgDB(r).Create(&signal)
 	if result.Error != nil {
-		log.Printf("Error creating signal: %v", result.Error)
-		http.Error(w, "Error creating signal", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
+	audit.Record(r, audit.ActionCreate, "signal", signal.ID, nil, signal)
+
 	// Reload with relations
-	db.GetDB().Preload("Device").First(&signal, signal.ID)
+	orgDB(r).Preload("Device").First(&signal, signal.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -173,49 +144,38 @@ func updateSignal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	signalIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Signal ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal ID required", http.StatusBadRequest)
 		return
 	}
 
 	signalID, err := strconv.ParseUint(signalIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
 		return
 	}
 
 	var signal models.Signal
-	result := db.GetDB().First(&signal, signalID)
+	result := orgDB(r).First(&signal, signalID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "Signal not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error fetching signal", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
 	var updateData models.Signal
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &updateData) {
 		return
 	}
 
+	before := signal
+
 	// Update fields
 	if updateData.Name != "" {
 		signal.Name = updateData.Name
 	}
 	if updateData.SignalType != "" {
-		if updateData.SignalType != "digital" && updateData.SignalType != "analogic" {
-			http.Error(w, "signal_type must be 'digital' or 'analogic'", http.StatusBadRequest)
-			return
-		}
 		signal.SignalType = updateData.SignalType
 	}
 	if updateData.Direction != "" {
-		if updateData.Direction != "input" && updateData.Direction != "output" {
-			http.Error(w, "direction must be 'input' or 'output'", http.StatusBadRequest)
-			return
-		}
 		signal.Direction = updateData.Direction
 	}
 	if updateData.SensorName != "" {
@@ -239,13 +199,20 @@ func updateSignal(w http.ResponseWriter, r *http.Request) {
 	// is_active can be explicitly set
 	signal.IsActive = updateData.IsActive
 
-	result = db.GetDB().Save(&signal)
+	// The range may now combine a new bound with the stored one
+	if errs := validate.Struct(&signal); len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+
+	result = orgDB(r).Save(&signal)
 	if result.Error != nil {
-		log.Printf("Error updating signal: %v", result.Error)
-		http.Error(w, "Error updating signal", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
+	audit.Record(r, audit.ActionUpdate, "signal", signal.ID, before, signal)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(signal)
 }
@@ -254,53 +221,62 @@ func deleteSignal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	signalIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "Signal ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Signal ID required", http.StatusBadRequest)
 		return
 	}
 
 	signalID, err := strconv.ParseUint(signalIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid signal ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid signal ID", http.StatusBadRequest)
+		return
+	}
+
+	// Load the signal first so the audit log keeps its last state
+	var signal models.Signal
+	result := orgDB(r).First(&signal, signalID)
+	if result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
-	result := db.GetDB().Delete(&models.Signal{}, signalID)
+	result = orgDB(r).Delete(&signal)
 	if result.Error != nil {
-		log.Printf("Error deleting signal: %v", result.Error)
-		http.Error(w, "Error deleting signal", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "signal")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Signal not found", http.StatusNotFound)
+		apierror.Error(w, r, "Signal not found", http.StatusNotFound)
 		return
 	}
 
+	audit.Record(r, audit.ActionDelete, "signal", signal.ID, signal, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // DeviceSignalsHandler gets signal configurations for a specific device
 func DeviceSignalsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	vars := mux.Vars(r)
 	deviceIDStr, ok := vars["device_id"]
 	if !ok {
-		http.Error(w, "Device ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "Device ID required", http.StatusBadRequest)
 		return
 	}
 
 	deviceID, err := strconv.ParseUint(deviceIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid device ID", http.StatusBadRequest)
 		return
 	}
 
 	var signals []models.Signal
-	query := db.GetDB().Where("device_id = ?", deviceID).Preload("Device")
+	query := orgDB(r).Where("device_id = ?", deviceID).Preload("Device")
 
 	// Apply filters
 	if signalType := r.URL.Query().Get("signal_type"); signalType != "" {
@@ -312,8 +288,7 @@ func DeviceSignalsHandler(w http.ResponseWriter, r *http.Request) {
 
 	result := query.Order("created_at DESC").Find(&signals)
 	if result.Error != nil {
-		log.Printf("Error fetching device signals: %v", result.Error)
-		http.Error(w, "Error fetching device signals", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "device signals")
 		return
 	}
 
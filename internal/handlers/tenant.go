@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+
+	"gorm.io/gorm"
+)
+
+// orgDB returns a database handle scoped to the organization of the authenticated request.
+// Queries through it only see, and creates are assigned to, that organization.
+func orgDB(r *http.Request) *gorm.DB {
+	return db.GetDB().WithContext(r.Context())
+}
+
+// requireOrgAdmin rejects requests from users who are not admins of the active organization
+func requireOrgAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-Auth-Type") != "user" || r.Header.Get("X-Org-Role") != models.RoleAdmin {
+		apierror.Error(w, r, "Organization admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireOrgMember rejects a user_id that is not a member of the active organization. Users
+// of other organizations are not found through orgDB.
+func requireOrgMember(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	err := orgDB(r).Select("id").First(&models.User{}, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Validation(w, r, validate.Errors{{Field: "user_id", Code: validate.CodeInvalid, Message: "user_id is not a member of the organization"}})
+		return false
+	}
+	if err != nil {
+		apierror.Database(w, r, err, "user")
+		return false
+	}
+	return true
+}
@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
-	"data-storage/internal/db"
+	"data-storage/internal/apierror"
 	"data-storage/internal/models"
 
 	"github.com/gorilla/mux"
@@ -13,7 +13,7 @@ import (
 
 func UserReadingsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Only GET method is allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -21,27 +21,27 @@ func UserReadingsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["user_id"]
 	if !ok {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		apierror.Error(w, r, "User ID is required", http.StatusBadRequest)
 		return
 	}
 
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
-	// Query database for signal values belonging to the user
+	// Signal values belonging to the user, in the organization
 	var signalValues []models.SignalValue
-	result := db.GetDB().Where("user_id = ?", uint(userID)).Preload("Signal").Preload("Signal.Device").Order("timestamp DESC").Find(&signalValues)
+	result := orgDB(r).Where("user_id = ?", uint(userID)).Omit("samples").Preload("Signal").Preload("Signal.Device").Order("timestamp DESC").Find(&signalValues)
 	if result.Error != nil {
-		http.Error(w, "Database query error", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "records")
 		return
 	}
 
 	signalsBytes, err := json.MarshalIndent(signalValues, "", "\t")
 	if err != nil {
-		http.Error(w, "Error marshaling signal values", http.StatusInternalServerError)
+		apierror.Error(w, r, "Error marshaling signal values", http.StatusInternalServerError)
 		return
 	}
 
@@ -2,17 +2,67 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"data-storage/internal/apierror"
+	"data-storage/internal/audit"
+	"data-storage/internal/auth"
 	"data-storage/internal/db"
 	"data-storage/internal/models"
+	"data-storage/internal/validate"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
+// CreateUserRequest creates a user in the caller's organization
+type CreateUserRequest struct {
+	Name      string `json:"name" validate:"required,max=255"`
+	Email     string `json:"email" validate:"email"`
+	Password  string `json:"password"`
+	Categoria string `json:"categoria"`
+	Matricula string `json:"matricula"`
+	Rfid      string `json:"rfid"`
+	Role      string `json:"role" validate:"oneof=admin member viewer"` // Role in the current organization, defaults to "member"
+}
+
+func (req *CreateUserRequest) Validate(errs *validate.Errors) {
+	// Users that can log in need a password; badge-only operators may have none
+	if req.Email != "" && req.Password == "" {
+		errs.Add("password", validate.CodeRequired, "password is required when email is set")
+	}
+	if req.Password != "" {
+		checkPassword(errs, "password", req.Password)
+	}
+}
+
+// UpdateUserRequest changes the fields that are set
+type UpdateUserRequest struct {
+	Name      string `json:"name" validate:"max=255"`
+	Email     string `json:"email" validate:"email"`
+	Password  string `json:"password"`
+	Categoria string `json:"categoria"`
+	Matricula string `json:"matricula"`
+	Rfid      string `json:"rfid"`
+	IsActive  *bool  `json:"is_active"`
+
+	CurrentPassword string `json:"current_password"` // Required to change your own email
+}
+
+func (req *UpdateUserRequest) Validate(errs *validate.Errors) {
+	if req.Password != "" {
+		checkPassword(errs, "password", req.Password)
+	}
+}
+
+// passwordChange makes password updates visible (redacted) in audit log diffs
+type passwordChange struct {
+	models.User
+	Password string `json:"password,omitempty"`
+}
+
 func UsersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
@@ -20,23 +70,22 @@ func UsersHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		createUser(w, r)
 	default:
-		http.Error(w, "Unsupported request method.", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Unsupported request method.", http.StatusMethodNotAllowed)
 	}
 }
 
 func getAllUsers(w http.ResponseWriter, r *http.Request) {
 	var users []models.User
-	result := db.GetDB().Find(&users)
+	result := orgDB(r).Find(&users)
 	if result.Error != nil {
-		log.Printf("Database query error: %v", result.Error)
-		http.Error(w, "Database query error", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "records")
 		return
 	}
 
 	usersBytes, err := json.MarshalIndent(users, "", "\t")
 	if err != nil {
-		log.Printf("Error marshaling users: %v", err)
-		http.Error(w, "Error marshaling users", http.StatusInternalServerError)
+		logger.ErrorContext(r.Context(), "Error marshaling users", "error", err)
+		apierror.Error(w, r, "Error marshaling users", http.StatusInternalServerError)
 		return
 	}
 
@@ -44,23 +93,31 @@ func getAllUsers(w http.ResponseWriter, r *http.Request) {
 	w.Write(usersBytes)
 }
 
+// belongsElsewhere reports whether the user is also a member of organizations other than the
+// request's. Such users are shared, so an organization admin may not edit or delete them.
+func belongsElsewhere(r *http.Request, userID uint) (bool, error) {
+	var count int64
+	err := db.GetDB().Model(&models.Membership{}).
+		Where("user_id = ? AND organization_id <> ?", userID, r.Header.Get("X-Org-ID")).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func createUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	var userData struct {
-		Name      string `json:"name"`
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		Categoria string `json:"categoria"`
-		Matricula string `json:"matricula"`
-		Rfid      string `json:"rfid"`
+	if !requireOrgAdmin(w, r) {
+		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&userData)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var user models.User
+	var userData CreateUserRequest
+	if !decodeJSON(w, r, &userData) {
 		return
 	}
 
+	if userData.Role == "" {
+		userData.Role = models.RoleMember
+	}
+
 	user.Name = userData.Name
 	user.Email = userData.Email
 	user.Categoria = userData.Categoria
@@ -70,19 +127,26 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	// Hash password if provided
 	if userData.Password != "" {
 		if err := user.SetPassword(userData.Password); err != nil {
-			log.Printf("Error hashing password: %v", err)
-			http.Error(w, "Error processing password", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "Error hashing password", "error", err)
+			apierror.Error(w, r, "Error processing password", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	result := db.GetDB().Create(&user)
-	if result.Error != nil {
-		log.Printf("Error creating user: %v", result.Error)
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	// New users join the organization they were created in
+	err := orgDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{UserID: user.ID, Role: userData.Role}).Error
+	})
+	if err != nil {
+		apierror.Database(w, r, err, "user")
 		return
 	}
 
+	audit.Record(r, audit.ActionCreate, "user", user.ID, nil, user)
+
 	// Clear password hash from response
 	user.PasswordHash = ""
 
@@ -101,7 +165,7 @@ func UserHandler(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		deleteUser(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -109,25 +173,20 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "User ID required", http.StatusBadRequest)
 		return
 	}
 
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
 	var user models.User
-	result := db.GetDB().Preload("Devices").First(&user, userID)
+	result := orgDB(r).Preload("Devices").First(&user, userID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error fetching user: %v", result.Error)
-			http.Error(w, "Error fetching user", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "user")
 		return
 	}
 
@@ -142,42 +201,63 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "User ID required", http.StatusBadRequest)
 		return
 	}
 
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
 	var user models.User
-	result := db.GetDB().First(&user, userID)
+	result := orgDB(r).First(&user, userID)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error fetching user", http.StatusInternalServerError)
-		}
+		apierror.Database(w, r, result.Error, "user")
 		return
 	}
 
-	var updateData struct {
-		Name      string `json:"name"`
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		Categoria string `json:"categoria"`
-		Matricula string `json:"matricula"`
-		Rfid      string `json:"rfid"`
-		IsActive  *bool  `json:"is_active"`
+	// Users may edit themselves; admins may edit users that only belong to their organization
+	self := r.Header.Get("X-User-ID") == userIDStr
+	if !self {
+		if !requireOrgAdmin(w, r) {
+			return
+		}
+		shared, err := belongsElsewhere(r, user.ID)
+		if err != nil {
+			apierror.Database(w, r, err, "user")
+			return
+		}
+		if shared {
+			apierror.Error(w, r, "User belongs to other organizations and can only be edited by themselves", http.StatusForbidden)
+			return
+		}
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var updateData UpdateUserRequest
+	if !decodeJSON(w, r, &updateData) {
 		return
 	}
 
+	// A session token alone must not be enough to take over the account or reactivate it
+	if self {
+		if updateData.Password != "" {
+			apierror.Validation(w, r, validate.Errors{{Field: "password", Code: validate.CodeInvalid,
+				Message: "Change your own password with POST /auth/change-password"}})
+			return
+		}
+		if updateData.IsActive != nil && !requireOrgAdmin(w, r) {
+			return
+		}
+		// The email receives password reset links, so changing it needs the password too
+		if updateData.Email != "" && updateData.Email != user.Email && !confirmPassword(w, r, &user, updateData.CurrentPassword) {
+			return
+		}
+	}
+
+	before := passwordChange{User: user}
+
 	// Update fields
 	if updateData.Name != "" {
 		user.Name = updateData.Name
@@ -199,19 +279,24 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	if updateData.Password != "" {
 		if err := user.SetPassword(updateData.Password); err != nil {
-			log.Printf("Error hashing password: %v", err)
-			http.Error(w, "Error processing password", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "Error hashing password", "error", err)
+			apierror.Error(w, r, "Error processing password", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	result = db.GetDB().Save(&user)
+	result = orgDB(r).Save(&user)
 	if result.Error != nil {
-		log.Printf("Error updating user: %v", result.Error)
-		http.Error(w, "Error updating user", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "user")
 		return
 	}
 
+	after := passwordChange{User: user}
+	if updateData.Password != "" {
+		after.Password = "changed"
+	}
+	audit.Record(r, audit.ActionUpdate, "user", user.ID, before, after)
+
 	// Clear password hash
 	user.PasswordHash = ""
 
@@ -219,32 +304,89 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// confirmPassword checks the user's current password for a sensitive change. A wrong
+// password counts as a failed login.
+func confirmPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	if password == "" {
+		apierror.Validation(w, r, validate.Errors{{Field: "current_password", Code: validate.CodeRequired,
+			Message: "current_password is required to change your email"}})
+		return false
+	}
+
+	now := time.Now()
+	if wait := auth.AccountLockedFor(user, now); wait > 0 {
+		writeLockedOut(w, r, wait)
+		return false
+	}
+	if !user.CheckPassword(password) {
+		if err := auth.RecordAccountFailure(user, now); err != nil {
+			logger.ErrorContext(r.Context(), "Error recording failed login", "error", err)
+		}
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Current password is incorrect")
+		return false
+	}
+	return true
+}
+
 func deleteUser(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["id"]
 	if !ok {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+		apierror.Error(w, r, "User ID required", http.StatusBadRequest)
 		return
 	}
 
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		apierror.Error(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
-	result := db.GetDB().Delete(&models.User{}, userID)
+	// Load the user first so the audit log keeps its last state
+	var user models.User
+	result := orgDB(r).First(&user, userID)
 	if result.Error != nil {
-		log.Printf("Error deleting user: %v", result.Error)
-		http.Error(w, "Error deleting user", http.StatusInternalServerError)
+		apierror.Database(w, r, result.Error, "user")
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Users shared with other organizations only leave this one
+	shared, err := belongsElsewhere(r, user.ID)
+	if err != nil {
+		apierror.Database(w, r, err, "user")
+		return
+	}
+	if shared {
+		removeMember(w, r, user.ID)
 		return
 	}
 
+	// The user was found through the organization scope and has no other memberships,
+	// so the delete can run unscoped; scoped, it would stop matching once the membership is gone
+	var rowsAffected int64
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&user)
+		rowsAffected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		apierror.Database(w, r, err, "user")
+		return
+	}
+
+	if rowsAffected == 0 {
+		apierror.Error(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+
+	audit.Record(r, audit.ActionDelete, "user", user.ID, user, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
-
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+)
+
+func TestUsers_SelfEditNeedsCurrentPassword(t *testing.T) {
+	a := setupAPI(t)
+	member := a.user(handlers.CreateUserRequest{Name: "Member", Email: "member@example.com", Password: adminPassword})
+	self := a.login("member@example.com", adminPassword)
+	path := idPath("/users/%d", member.ID)
+	update := func(api *testAPI, req handlers.UpdateUserRequest) (models.User, *apierror.Problem) {
+		t.Helper()
+		var user models.User
+		problem := api.call(http.MethodPut, path, nil, req, &user)
+		return user, problem
+	}
+
+	if _, problem := update(self, handlers.UpdateUserRequest{Password: "another-horse-battery"}); problem == nil || problem.Status != http.StatusBadRequest {
+		t.Errorf("Expected a self-edit of the password to be rejected, got %+v", problem)
+	}
+	active := true
+	if _, problem := update(self, handlers.UpdateUserRequest{IsActive: &active}); problem == nil || problem.Status != http.StatusForbidden {
+		t.Errorf("Expected members not to change is_active, got %+v", problem)
+	}
+	if updated, problem := update(self, handlers.UpdateUserRequest{Name: "Renamed"}); problem != nil || updated.Name != "Renamed" {
+		t.Errorf("Expected members to edit their other fields, got %+v, %+v", updated, problem)
+	}
+	if problem := a.tryLogin("member@example.com", adminPassword); problem != nil {
+		t.Errorf("Expected the password to be unchanged, got %+v", problem)
+	}
+
+	// The email receives reset links, so a session token alone can't change it
+	if _, problem := update(self, handlers.UpdateUserRequest{Email: "attacker@example.com"}); problem == nil || problem.Code != apierror.CodeValidation {
+		t.Errorf("Expected an email change without the password to be rejected, got %+v", problem)
+	}
+	if _, problem := update(self, handlers.UpdateUserRequest{Email: "attacker@example.com", CurrentPassword: "wrong-password"}); problem == nil || problem.Code != apierror.CodeInvalidCredentials {
+		t.Errorf("Expected an email change with a wrong password to be rejected, got %+v", problem)
+	}
+	if updated, problem := update(self, handlers.UpdateUserRequest{Email: "member2@example.com", CurrentPassword: adminPassword}); problem != nil || updated.Email != "member2@example.com" {
+		t.Errorf("Expected the email change with the password to succeed, got %+v, %+v", updated, problem)
+	}
+	if _, problem := update(a, handlers.UpdateUserRequest{Email: "member3@example.com"}); problem != nil {
+		t.Errorf("Expected admins to change other users' email, got %+v", problem)
+	}
+}
+
+func TestUsers_DeactivatedUserLosesAccess(t *testing.T) {
+	a := setupAPI(t)
+	member := a.user(handlers.CreateUserRequest{Name: "Member", Email: "member@example.com", Password: adminPassword})
+	session := a.login("member@example.com", adminPassword)
+	session.must(http.MethodGet, "/devices", nil, nil, nil)
+
+	// The token is still valid, but the user no longer is
+	inactive := false
+	a.must(http.MethodPut, idPath("/users/%d", member.ID), nil, handlers.UpdateUserRequest{IsActive: &inactive}, nil)
+	if problem := session.call(http.MethodGet, "/devices", nil, nil, nil); problem == nil || problem.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the deactivated user's token to be rejected, got %+v", problem)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+	"data-storage/internal/waveform"
+
+	"github.com/gorilla/mux"
+)
+
+// WaveformResponse is the curve of a waveform value, downsampled for display
+type WaveformResponse struct {
+	SignalValueID  uint             `json:"signal_value_id"`
+	SignalID       uint             `json:"signal_id"`
+	Timestamp      time.Time        `json:"timestamp"`
+	SampleInterval float64          `json:"sample_interval"` // Seconds between samples
+	Samples        int              `json:"samples"`         // Number of stored samples
+	Method         string           `json:"method,omitempty"`
+	Points         []waveform.Point `json:"points"`
+}
+
+// WaveformStatsResponse summarizes a waveform value
+type WaveformStatsResponse struct {
+	SignalValueID uint      `json:"signal_value_id"`
+	SignalID      uint      `json:"signal_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	waveform.Stats
+}
+
+// pathWaveform loads the waveform value of the request path. On failure it writes the error
+// response and returns nil.
+func pathWaveform(w http.ResponseWriter, r *http.Request) *models.SignalValue {
+	valueID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		apierror.Error(w, r, "Invalid signal value ID", http.StatusBadRequest)
+		return nil
+	}
+	var value models.SignalValue
+	if result := orgDB(r).First(&value, valueID); result.Error != nil {
+		apierror.Database(w, r, result.Error, "signal value")
+		return nil
+	}
+	if value.SampleInterval == nil || len(value.Samples) == 0 {
+		apierror.Error(w, r, "The signal value is not a waveform", http.StatusUnprocessableEntity)
+		return nil
+	}
+	return &value
+}
+
+// WaveformHandler returns the samples of a waveform value, reduced to at most max_points
+// points with the chosen method
+func WaveformHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	var errs validate.Errors
+	maxPoints := 0
+	if value := params.Get("max_points"); value != "" {
+		var err error
+		if maxPoints, err = strconv.Atoi(value); err != nil || maxPoints < 0 {
+			errs.Add("max_points", validate.CodeInvalid, "max_points must be a non-negative integer")
+		}
+	}
+	method := params.Get("method")
+	if method != "" && !slices.Contains(waveform.Methods, method) {
+		errs.Add("method", validate.CodeOneOf, "method must be one of "+strings.Join(waveform.Methods, ", "))
+	}
+	if len(errs) > 0 {
+		apierror.Validation(w, r, errs)
+		return
+	}
+
+	value := pathWaveform(w, r)
+	if value == nil {
+		return
+	}
+	points, err := waveform.Downsample(value.Samples, *value.SampleInterval, maxPoints, method)
+	if err != nil {
+		apierror.Validation(w, r, validate.Errors{{Field: "max_points", Code: validate.CodeTooSmall, Message: err.Error()}})
+		return
+	}
+	if len(points) == len(value.Samples) {
+		method = ""
+	} else if method == "" {
+		method = waveform.LTTB
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WaveformResponse{
+		SignalValueID:  value.ID,
+		SignalID:       value.SignalID,
+		Timestamp:      value.Timestamp,
+		SampleInterval: *value.SampleInterval,
+		Samples:        len(value.Samples),
+		Method:         method,
+		Points:         points,
+	})
+}
+
+// WaveformStatsHandler returns the peak, minimum, mean, final value and area of a waveform value
+func WaveformStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apierror.Error(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	value := pathWaveform(w, r)
+	if value == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WaveformStatsResponse{
+		SignalValueID: value.ID,
+		SignalID:      value.SignalID,
+		Timestamp:     value.Timestamp,
+		Stats:         waveform.Compute(value.Samples, *value.SampleInterval),
+	})
+}
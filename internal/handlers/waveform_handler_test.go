@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/handlers"
+	"data-storage/internal/models"
+	"data-storage/internal/waveform"
+)
+
+// setupWaveform creates a waveform signal accepting samples up to 1000, and an analogic one
+func setupWaveform(t *testing.T) (a *testAPI, curve, torque models.Signal) {
+	t.Helper()
+	a = setupAPI(t)
+	device := a.device("spindle-1")
+	maxValue := 1000.0
+	curve = a.signal(models.Signal{DeviceID: device.ID, Name: "curve", SignalType: "waveform", MaxValue: &maxValue})
+	torque = a.signal(models.Signal{DeviceID: device.ID, Name: "torque", SignalType: "analogic"})
+	return a, curve, torque
+}
+
+func TestWaveform(t *testing.T) {
+	a, curve, _ := setupWaveform(t)
+
+	// A sawtooth from 0 to 99, ten times over, with a spike of 500 at 0.25s
+	samples := make([]float64, 1000)
+	for i := range samples {
+		samples[i] = float64(i % 100)
+	}
+	samples[250] = 500
+	interval := 0.001
+	timestamp := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	created := a.createValue(valueBody{SignalID: curve.ID, Samples: samples, SampleInterval: &interval, Timestamp: &timestamp})
+
+	// The samples are stored compressed and read back exactly
+	var value models.SignalValue
+	a.must(http.MethodGet, idPath("/signal-values/%d", created.ID), nil, nil, &value)
+	if len(value.Samples) != len(samples) || value.Samples[250] != 500 || value.Samples[999] != 99 || *value.SampleInterval != interval {
+		t.Errorf("Expected the samples back, got %d samples every %v", len(value.Samples), value.SampleInterval)
+	}
+	var listed []models.SignalValue
+	a.must(http.MethodGet, idPath("/signals/%d/values", curve.ID), nil, nil, &listed)
+	if len(listed) != 1 || listed[0].Samples != nil {
+		t.Errorf("Expected the list to leave the samples out, got %+v", listed)
+	}
+	a.must(http.MethodGet, idPath("/signals/%d/values", curve.ID), url.Values{"include_samples": {"true"}}, nil, &listed)
+	if len(listed) != 1 || len(listed[0].Samples) != len(samples) {
+		t.Errorf("Expected the list to include the samples when asked, got %d values", len(listed))
+	}
+
+	path := idPath("/signal-values/%d/waveform", created.ID)
+	var full handlers.WaveformResponse
+	a.must(http.MethodGet, path, nil, nil, &full)
+	if full.Samples != 1000 || len(full.Points) != 1000 || full.Method != "" || !full.Timestamp.Equal(timestamp) ||
+		full.Points[250].Offset != 0.25 || full.Points[250].Value != 500 {
+		t.Errorf("Expected every sample at its offset, got %d points with method %q", len(full.Points), full.Method)
+	}
+
+	for _, tc := range []struct {
+		method    string
+		maxPoints int
+	}{{"", 50}, {waveform.LTTB, 50}, {waveform.MinMax, 20}, {waveform.Average, 10}} {
+		query := url.Values{"max_points": {strconv.Itoa(tc.maxPoints)}}
+		if tc.method != "" {
+			query.Set("method", tc.method)
+		}
+		var reduced handlers.WaveformResponse
+		a.must(http.MethodGet, path, query, nil, &reduced)
+		method := tc.method
+		if method == "" {
+			method = waveform.LTTB
+		}
+		if reduced.Samples != 1000 || len(reduced.Points) == 0 || len(reduced.Points) > tc.maxPoints || reduced.Method != method {
+			t.Errorf("%s: expected at most %d points, got %d with method %q", tc.method, tc.maxPoints, len(reduced.Points), reduced.Method)
+		}
+		// Averages smooth the spike away; the other methods keep it
+		peak := 0.0
+		for _, p := range reduced.Points {
+			peak = max(peak, p.Value)
+		}
+		if tc.method != waveform.Average && peak != 500 {
+			t.Errorf("%s: expected the spike to be kept, got a peak of %v", tc.method, peak)
+		}
+	}
+
+	var stats handlers.WaveformStatsResponse
+	a.must(http.MethodGet, path+"/stats", nil, nil, &stats)
+	if stats.SignalValueID != created.ID || stats.Samples != 1000 || stats.Peak != 500 || stats.PeakOffset != 0.25 ||
+		stats.Min != 0 || stats.MinOffset != 0 || stats.Final != 99 || !near(&stats.Mean, 49.95) || !near(&stats.Duration, 0.999) {
+		t.Errorf("Expected the peak of 500 at 0.25s and a mean of 49.95, got %+v", stats.Stats)
+	}
+
+	// Area by the trapezoidal rule: (0+2)/2*0.5 + (2+4)/2*0.5
+	interval = 0.5
+	small := a.createValue(valueBody{SignalID: curve.ID, Samples: []float64{0, 2, 4}, SampleInterval: &interval})
+	a.must(http.MethodGet, idPath("/signal-values/%d/waveform/stats", small.ID), nil, nil, &stats)
+	if stats.Area != 2 || stats.Duration != 1 {
+		t.Errorf("Expected an area of 2 over 1s, got %+v", stats.Stats)
+	}
+}
+
+func TestWaveform_Rejected(t *testing.T) {
+	a, curve, torque := setupWaveform(t)
+
+	interval, zero, value := 0.01, 0.0, 12.0
+	for _, tc := range []struct {
+		name  string
+		value valueBody
+		field string
+	}{
+		{"no samples", valueBody{SignalID: curve.ID, SampleInterval: &interval}, "samples"},
+		{"no interval", valueBody{SignalID: curve.ID, Samples: []float64{1, 2}}, "sample_interval"},
+		{"zero interval", valueBody{SignalID: curve.ID, Samples: []float64{1, 2}, SampleInterval: &zero}, "sample_interval"},
+		{"above maximum", valueBody{SignalID: curve.ID, Samples: []float64{1, 2000}, SampleInterval: &interval}, "samples"},
+		{"analogic signal", valueBody{SignalID: torque.ID, Value: &value, Samples: []float64{1, 2}, SampleInterval: &interval}, "samples"},
+	} {
+		if problem := a.call(http.MethodPost, "/signal-values", nil, tc.value, nil); !invalid(problem, tc.field) {
+			t.Errorf("%s: expected a validation error for %s, got %+v", tc.name, tc.field, problem)
+		}
+	}
+
+	// The body of the largest waveform fits in the limit; larger bodies are refused unread
+	samples := make([]float64, 100000)
+	for i := range samples {
+		samples[i] = 999.9999999999
+	}
+	a.createValue(valueBody{SignalID: curve.ID, Samples: samples, SampleInterval: &interval})
+	samples = append(samples, samples...)
+	samples = append(samples, samples...)
+	for _, tc := range []struct {
+		path string
+		body any
+	}{
+		{"/signal-values", valueBody{SignalID: curve.ID, Samples: samples, SampleInterval: &interval}},
+		{"/devices", models.Device{Name: strings.Repeat("press", 1<<20)}},
+	} {
+		if problem := a.call(http.MethodPost, tc.path, nil, tc.body, nil); problem == nil || problem.Status != http.StatusRequestEntityTooLarge || problem.Code != apierror.CodePayloadTooLarge {
+			t.Errorf("POST %s: expected the body to be too large, got %+v", tc.path, problem)
+		}
+	}
+
+	created := a.createValue(valueBody{SignalID: curve.ID, Samples: []float64{1, 2, 3, 4, 5}, SampleInterval: &interval})
+	for _, tc := range []struct {
+		query url.Values
+		field string
+	}{
+		{url.Values{"max_points": {"-1"}}, "max_points"},
+		{url.Values{"max_points": {"many"}}, "max_points"},
+		{url.Values{"method": {"spline"}}, "method"},
+		{url.Values{"max_points": {"2"}, "method": {"lttb"}}, "max_points"},
+	} {
+		if problem := a.call(http.MethodGet, idPath("/signal-values/%d/waveform", created.ID), tc.query, nil, nil); !invalid(problem, tc.field) {
+			t.Errorf("%v: expected a validation error for %s, got %+v", tc.query, tc.field, problem)
+		}
+	}
+
+	scalar := a.value(torque.ID, value, time.Now())
+	if problem := a.call(http.MethodGet, idPath("/signal-values/%d/waveform/stats", scalar.ID), nil, nil, nil); problem == nil || problem.Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected the stats of a scalar value to be refused, got %+v", problem)
+	}
+	if problem := a.call(http.MethodGet, "/signal-values/9999/waveform", nil, nil, nil); problem == nil || problem.Status != http.StatusNotFound {
+		t.Errorf("Expected an unknown value to be not found, got %+v", problem)
+	}
+}
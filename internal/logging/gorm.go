@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger writes GORM logs through the "db" subsystem logger. Failed queries are logged
+// as errors, queries slower than the threshold as warnings and all others at debug level.
+type GormLogger struct {
+	logger        *slog.Logger
+	slowThreshold time.Duration
+	sqlParams     bool
+}
+
+// NewGormLogger returns a GORM logger using the current configuration
+func NewGormLogger() *GormLogger {
+	return &GormLogger{
+		logger:        Logger("db"),
+		slowThreshold: config.SlowQueryThreshold,
+		sqlParams:     config.SQLParams,
+	}
+}
+
+// LogMode is a no-op: the level is configured through LOG_LEVELS (e.g. "db=debug")
+func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// Trace logs a finished query
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+
+	var level slog.Level
+	var msg string
+	switch {
+	case failed:
+		level, msg = slog.LevelError, "query failed"
+	case slow:
+		level, msg = slog.LevelWarn, "slow query"
+	default:
+		level, msg = slog.LevelDebug, "query"
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if failed {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter keeps query parameters out of logged SQL unless LOG_SQL_PARAMS is enabled
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.sqlParams {
+		return sql, params
+	}
+	return sql, nil
+}
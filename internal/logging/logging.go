@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config controls log output and levels
+type Config struct {
+	Format string     `yaml:"format" env:"LOG_FORMAT"` // "json" or "text"
+	Level  slog.Level `yaml:"level" env:"LOG_LEVEL"`   // Default level for every subsystem
+	// Levels overrides the level per subsystem (e.g. "db", "http", "auth"); LOG_LEVELS is "db=warn,http=debug"
+	Levels map[string]slog.Level `yaml:"levels" env:"LOG_LEVELS"`
+	// SlowQueryThreshold logs queries taking longer as warnings; 0 disables slow query logging
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD"`
+	// SQLParams includes query parameters in logged SQL; they may contain personal data or secrets
+	SQLParams bool      `yaml:"sql_params" env:"LOG_SQL_PARAMS"`
+	Output    io.Writer `yaml:"-"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Format:             "json",
+		Level:              slog.LevelInfo,
+		Levels:             map[string]slog.Level{},
+		SlowQueryThreshold: 200 * time.Millisecond,
+	}
+}
+
+var (
+	config = DefaultConfig()
+
+	// root is the handler that formats and writes records
+	root atomic.Pointer[slog.Handler]
+
+	levelsMu sync.Mutex
+	levels   = map[string]*slog.LevelVar{}
+)
+
+func init() {
+	var h slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	root.Store(&h)
+}
+
+// Init applies the configuration and makes the "app" logger the slog and log package default
+func Init(cfg Config) {
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+
+	// Levels are filtered per subsystem, so the root handler accepts everything
+	opts := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var h slog.Handler
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(cfg.Output, opts)
+	} else {
+		h = slog.NewJSONHandler(cfg.Output, opts)
+	}
+	root.Store(&h)
+
+	levelsMu.Lock()
+	config = cfg
+	for subsystem, level := range levels {
+		level.Set(levelFor(subsystem))
+	}
+	levelsMu.Unlock()
+
+	slog.SetDefault(Logger("app"))
+}
+
+// SlowQueryThreshold returns the configured slow query threshold
+func SlowQueryThreshold() time.Duration {
+	return config.SlowQueryThreshold
+}
+
+func levelFor(subsystem string) slog.Level {
+	if level, ok := config.Levels[subsystem]; ok {
+		return level
+	}
+	return config.Level
+}
+
+func levelVar(subsystem string) *slog.LevelVar {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	level, ok := levels[subsystem]
+	if !ok {
+		level = &slog.LevelVar{}
+		level.Set(levelFor(subsystem))
+		levels[subsystem] = level
+	}
+	return level
+}
+
+// Logger returns the logger of a subsystem. Its records carry a "subsystem" attribute and
+// the request attributes of the context passed to the *Context logging methods.
+// Loggers may be created before Init; they pick up the configuration when it is applied.
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&handler{
+		level: levelVar(subsystem),
+		build: func(h slog.Handler) slog.Handler {
+			return h.WithAttrs([]slog.Attr{slog.String("subsystem", subsystem)})
+		},
+	})
+}
+
+// handler filters by subsystem level and adds request attributes before handing records
+// to the root handler
+type handler struct {
+	level *slog.LevelVar
+	// build applies the logger's attributes and groups to the root handler
+	build func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := requestAttrs(ctx); len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.build(*root.Load()).Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	build := h.build
+	return &handler{level: h.level, build: func(base slog.Handler) slog.Handler {
+		return build(base).WithAttrs(attrs)
+	}}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	build := h.build
+	return &handler{level: h.level, build: func(base slog.Handler) slog.Handler {
+		return build(base).WithGroup(name)
+	}}
+}
+
+// requestInfo holds the attributes of a request. It is shared by everything handling the
+// request, so attributes added by the auth middleware also appear in the access log.
+type requestInfo struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries request attributes for log records
+func NewContext(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestInfo{attrs: attrs})
+}
+
+// AddAttrs attaches attributes (e.g. the authenticated user) to every later log record of
+// the request. It does nothing for contexts not created by NewContext.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	info, ok := ctx.Value(contextKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	info.attrs = append(info.attrs, attrs...)
+	info.mu.Unlock()
+}
+
+func requestAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	info, ok := ctx.Value(contextKey{}).(*requestInfo)
+	if !ok {
+		return nil
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return append([]slog.Attr(nil), info.attrs...)
+}
+
+// RequestID returns the ID of the request the context belongs to
+func RequestID(ctx context.Context) string {
+	for _, attr := range requestAttrs(ctx) {
+		if attr.Key == "request_id" {
+			return attr.Value.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture initializes logging with JSON output into a buffer and returns the decoded records
+func capture(t *testing.T, cfg Config) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	cfg.Format = "json"
+	cfg.Output = &buf
+	Init(cfg)
+	t.Cleanup(func() { Init(Config{Format: "json", Level: slog.LevelInfo}) })
+
+	return func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("Invalid JSON log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func TestLogger_SubsystemLevels(t *testing.T) {
+	// Created before Init to check loggers pick up later configuration
+	dbLogger := Logger("db")
+	records := capture(t, Config{Level: slog.LevelWarn, Levels: map[string]slog.Level{"db": slog.LevelDebug}})
+
+	dbLogger.Debug("db debug")
+	Logger("api").Info("api info")
+	Logger("api").Warn("api warn")
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 records, got %v", got)
+	}
+	if got[0]["msg"] != "db debug" || got[0]["subsystem"] != "db" {
+		t.Errorf("Unexpected first record: %v", got[0])
+	}
+	if got[1]["msg"] != "api warn" || got[1]["subsystem"] != "api" {
+		t.Errorf("Unexpected second record: %v", got[1])
+	}
+}
+
+func TestMiddleware_RequestID(t *testing.T) {
+	records := capture(t, Config{Level: slog.LevelInfo})
+
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		AddAttrs(r.Context(), slog.Uint64("user_id", 7))
+		Logger("api").InfoContext(r.Context(), "handled")
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest("POST", "/devices", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "abc-123" || rec.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected the client request ID to be reused, got %q and %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("Expected handler and access log records, got %v", got)
+	}
+	for _, record := range got {
+		if record["request_id"] != "abc-123" || record["user_id"] != float64(7) {
+			t.Errorf("Expected request attributes on %v", record)
+		}
+	}
+	if got[1]["msg"] != "request" || got[1]["status"] != float64(http.StatusCreated) {
+		t.Errorf("Unexpected access log: %v", got[1])
+	}
+
+	// Invalid IDs are replaced
+	req = httptest.NewRequest("GET", "/devices", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(RequestIDHeader); id == "bad id\n" || !validRequestID.MatchString(id) {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+}
+
+func TestGormLogger_Trace(t *testing.T) {
+	records := capture(t, Config{
+		Level:              slog.LevelInfo,
+		SlowQueryThreshold: 100 * time.Millisecond,
+	})
+	l := NewGormLogger()
+	sql := func() (string, int64) { return "SELECT 1", 1 }
+	ctx := context.Background()
+
+	l.Trace(ctx, time.Now(), sql, nil)
+	l.Trace(ctx, time.Now().Add(-time.Second), sql, nil)
+	l.Trace(ctx, time.Now(), sql, errors.New("boom"))
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("Expected fast queries to be skipped at info level, got %v", got)
+	}
+	if got[0]["msg"] != "slow query" || got[0]["level"] != "WARN" || got[0]["sql"] != "SELECT 1" {
+		t.Errorf("Unexpected slow query record: %v", got[0])
+	}
+	if got[1]["msg"] != "query failed" || got[1]["error"] != "boom" {
+		t.Errorf("Unexpected failed query record: %v", got[1])
+	}
+
+	if _, params := l.ParamsFilter(ctx, "SELECT ?", "secret"); params != nil {
+		t.Errorf("Expected parameters to be dropped, got %v", params)
+	}
+}
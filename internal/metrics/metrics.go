@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/apierror"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "data_storage"
+
+// Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+// Config controls access to the metrics endpoint
+type Config struct {
+	// Token, when set, must be sent by scrapers as a bearer token
+	Token string `yaml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+var config Config
+
+// Init sets the metrics configuration; call it before building the handler
+func Init(cfg Config) {
+	config = cfg
+}
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	ingestedValues = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingested_values_total",
+		Help:      "Signal values stored, by device and signal.",
+	}, []string{"device_id", "signal_id"})
+
+	validationRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_rejections_total",
+		Help:      "Signal values rejected during ingestion, by reason.",
+	}, []string{"reason"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Failed authentications, by type.",
+	}, []string{"type"})
+)
+
+// Validation rejection reasons
+const (
+	RejectInvalidBody      = "invalid_body"
+	RejectMissingSignalID  = "missing_signal_id"
+	RejectUnknownSignal    = "unknown_signal"
+	RejectDeviceMismatch   = "device_mismatch"
+	RejectMissingValue     = "missing_value"
+	RejectBelowMinimum     = "below_minimum"
+	RejectAboveMaximum     = "above_maximum"
+	RejectQuotaExceeded    = "quota_exceeded"
+	RejectInvalidWaveform  = "invalid_waveform"
+	RejectOperatorMismatch = "operator_mismatch"
+)
+
+// Auth failure types
+const (
+	AuthMissingHeader      = "missing_header"
+	AuthMalformedHeader    = "malformed_header"
+	AuthInvalidToken       = "invalid_token"
+	AuthInactiveUser       = "inactive_user"
+	AuthInvalidDeviceToken = "invalid_device_token"
+	AuthInvalidDeviceCert  = "invalid_device_certificate"
+	AuthNoOrganization     = "no_organization"
+	AuthInvalidCredentials = "invalid_credentials"
+	AuthLockedOut          = "locked_out"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		ingestedValues,
+		validationRejections,
+		authFailures,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of the database
+func RegisterDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, "postgres"))
+}
+
+// ValueIngested counts a stored signal value
+func ValueIngested(deviceID, signalID uint) {
+	ingestedValues.WithLabelValues(formatID(deviceID), formatID(signalID)).Inc()
+}
+
+// ValueRejected counts a signal value rejected for the given reason
+func ValueRejected(reason string) {
+	validationRejections.WithLabelValues(reason).Inc()
+}
+
+// AuthFailed counts a failed authentication of the given type
+func AuthFailed(failureType string) {
+	authFailures.WithLabelValues(failureType).Inc()
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// methods are the request methods kept as labels; any other method is labelled "other"
+// so clients can't grow the label set
+var methods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Middleware records request counts and latencies of next, which serves the router, possibly
+// behind other middleware such as rate limiting. Requests are labelled with the route template
+// of the router they match (e.g. /devices/{id}) rather than the raw path, to keep cardinality
+// bounded. Requests matching no route, 404s and 405s, are labelled "unmatched"; Router.Use
+// would never see them.
+func Middleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		method := r.Method
+		if !methods[method] {
+			method = "other"
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Handler serves the metrics. When a token is configured, scrapers must send it as a bearer token.
+func Handler() http.Handler {
+	token := config.Token
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			apierror.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_LabelsRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+	})
+	handler := Middleware(r, r)
+
+	for _, path := range []string{"/devices/1", "/devices/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	got := testutil.ToFloat64(httpRequests.WithLabelValues("/devices/{id}", "GET", "404"))
+	if got != 2 {
+		t.Errorf("Expected 2 requests for the route template, got %v", got)
+	}
+}
+
+func TestMiddleware_CountsUnmatched(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	handler := Middleware(r, r)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/devices", nil))
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("unmatched", "GET", "404")); got != 1 {
+		t.Errorf("Expected 1 unmatched 404, got %v", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("unmatched", "DELETE", "405")); got != 1 {
+		t.Errorf("Expected 1 unmatched 405, got %v", got)
+	}
+}
+
+func TestMiddleware_LabelsUnknownMethodsOther(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/methods", func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(r, r)
+
+	for _, method := range []string{"FOO", "BAR", "GET"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/methods", nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/methods", "other", "200")); got != 2 {
+		t.Errorf("Expected 2 requests labelled other, got %v", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/methods", "GET", "200")); got != 1 {
+		t.Errorf("Expected 1 GET request, got %v", got)
+	}
+}
+
+func TestMiddleware_CountsRequestsRejectedByInnerMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {})
+	limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	Middleware(r, limited).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/limited", nil))
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/limited", "GET", "429")); got != 1 {
+		t.Errorf("Expected the rejected request to be counted, got %v", got)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	ValueIngested(3, 7)
+	ValueIngested(3, 7)
+	ValueRejected(RejectAboveMaximum)
+	AuthFailed(AuthInvalidToken)
+
+	if got := testutil.ToFloat64(ingestedValues.WithLabelValues("3", "7")); got != 2 {
+		t.Errorf("Expected 2 ingested values, got %v", got)
+	}
+	if got := testutil.ToFloat64(validationRejections.WithLabelValues(RejectAboveMaximum)); got != 1 {
+		t.Errorf("Expected 1 rejection, got %v", got)
+	}
+	if got := testutil.ToFloat64(authFailures.WithLabelValues(AuthInvalidToken)); got != 1 {
+		t.Errorf("Expected 1 auth failure, got %v", got)
+	}
+}
+
+func TestHandler_Token(t *testing.T) {
+	Init(Config{Token: "secret"})
+	t.Cleanup(func() { Init(Config{}) })
+	handler := Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with token, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "data_storage_http_requests_total") {
+		t.Error("Expected request metrics in the output")
+	}
+}
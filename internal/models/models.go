@@ -3,24 +3,75 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"data-storage/internal/validate"
+	"data-storage/internal/waveform"
+
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Organization is a tenant (e.g. a customer plant) that owns users, devices and signals
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id,omitempty"`
+	Name      string    `gorm:"not null" json:"name"`
+	Slug      string    `gorm:"size:100;not null;uniqueIndex" json:"slug"`
+	IsActive  bool      `gorm:"default:true" json:"is_active,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Membership roles
+const (
+	RoleAdmin  = "admin"  // Manages members, invitations and devices of the organization
+	RoleMember = "member" // Reads and writes organization data
+	RoleViewer = "viewer" // Read-only access
 )
 
+// Membership grants a user a role in an organization
+type Membership struct {
+	ID             uint          `gorm:"primaryKey" json:"id,omitempty"`
+	OrganizationID uint          `gorm:"not null;uniqueIndex:idx_membership_org_user" json:"organization_id"`
+	Organization   *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	UserID         uint          `gorm:"not null;uniqueIndex:idx_membership_org_user;index" json:"user_id"`
+	User           *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role           string        `gorm:"size:20;not null;default:'member';check:role IN ('admin','member','viewer')" json:"role"`
+	CreatedAt      time.Time     `json:"created_at,omitempty"`
+	UpdatedAt      time.Time     `json:"updated_at,omitempty"`
+}
+
+// OrgInvitation invites an email address to join an organization.
+// Only the SHA-256 hash of the invitation token is stored.
+type OrgInvitation struct {
+	ID             uint       `gorm:"primaryKey" json:"id,omitempty"`
+	OrganizationID uint       `gorm:"not null;index" json:"organization_id"`
+	Email          string     `gorm:"not null;index" json:"email"`
+	Role           string     `gorm:"size:20;not null" json:"role"`
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	InvitedByID    *uint      `json:"invited_by_id,omitempty"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at,omitempty"`
+}
+
 // User represents an authenticated user
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id,omitempty"`
-	Name         string    `gorm:"not null" json:"name"`
-	Email        string    `gorm:"uniqueIndex" json:"email,omitempty"`
-	PasswordHash string    `gorm:"column:password_hash" json:"-"` // Never return in JSON
-	Categoria    string    `json:"categoria,omitempty"`
-	Matricula    string    `json:"matricula,omitempty"`
-	Rfid         string    `gorm:"uniqueIndex" json:"rfid,omitempty"`
-	IsActive     bool      `gorm:"default:true" json:"is_active,omitempty"`
-	Devices      []Device  `gorm:"foreignKey:UserID" json:"devices,omitempty"`
-	CreatedAt    time.Time `json:"created_at,omitempty"`
-	UpdatedAt    time.Time `json:"updated_at,omitempty"`
+	ID                  uint       `gorm:"primaryKey" json:"id,omitempty"`
+	Name                string     `gorm:"not null" json:"name"`
+	Email               string     `gorm:"uniqueIndex" json:"email,omitempty"`
+	PasswordHash        string     `gorm:"column:password_hash" json:"-"` // Never return in JSON
+	Categoria           string     `json:"categoria,omitempty"`
+	Matricula           string     `json:"matricula,omitempty"`
+	Rfid                string     `gorm:"uniqueIndex" json:"rfid,omitempty"`
+	IsActive            bool       `gorm:"default:true" json:"is_active,omitempty"`
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	Devices             []Device   `gorm:"foreignKey:UserID" json:"devices,omitempty"`
+	CreatedAt           time.Time  `json:"created_at,omitempty"`
+	UpdatedAt           time.Time  `json:"updated_at,omitempty"`
 }
 
 // SetPassword hashes and sets the user's password
@@ -39,54 +90,226 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// PasswordResetToken is a single-use token for resetting a forgotten password.
+// Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id,omitempty"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RequestIP string     `json:"request_ip,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+}
+
 // Device represents an IoT device
 type Device struct {
-	ID          uint      `gorm:"primaryKey" json:"id,omitempty"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `json:"description,omitempty"`
-	DeviceType  string    `json:"device_type,omitempty"`
-	Location    string    `json:"location,omitempty"`
-	UserID      *uint     `gorm:"index" json:"user_id,omitempty"` // Optional
-	User        *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	AuthToken   string    `gorm:"uniqueIndex;not null" json:"auth_token,omitempty"`
-	IsActive    bool      `gorm:"default:true" json:"is_active,omitempty"`
-	Signals     []Signal  `gorm:"foreignKey:DeviceID" json:"signals,omitempty"`
-	CreatedAt   time.Time `json:"created_at,omitempty"`
-	UpdatedAt   time.Time `json:"updated_at,omitempty"`
-}
-
-// Signal represents a signal configuration (input/output, analogic/digital)
+	ID                 uint      `gorm:"primaryKey" json:"id,omitempty"`
+	Name               string    `gorm:"not null" json:"name" validate:"max=255"`
+	Description        string    `json:"description,omitempty"`
+	DeviceType         string    `json:"device_type,omitempty"`
+	Location           string    `json:"location,omitempty"`
+	OrganizationID     *uint     `gorm:"index" json:"organization_id,omitempty"`
+	UserID             *uint     `gorm:"index" json:"user_id,omitempty"` // Optional
+	User               *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	AuthToken          string    `gorm:"uniqueIndex;not null" json:"auth_token,omitempty"`
+	IsActive           bool      `gorm:"default:true" json:"is_active,omitempty"`
+	RateLimitPerMinute *int      `json:"rate_limit_per_minute,omitempty" validate:"min=0"` // Overrides the global device rate limit; 0 restores it. Set by org admins.
+	DailyQuota         *int64    `json:"daily_quota,omitempty" validate:"min=0"`           // Overrides the global daily ingestion quota; 0 restores it. Set by org admins.
+	Signals            []Signal  `gorm:"foreignKey:DeviceID" json:"signals,omitempty"`
+	CreatedAt          time.Time `json:"created_at,omitempty"`
+	UpdatedAt          time.Time `json:"updated_at,omitempty"`
+}
+
+// DeviceUsage tracks how many signal values a device ingested on a given day (UTC)
+type DeviceUsage struct {
+	ID         uint      `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID   uint      `gorm:"not null;uniqueIndex:idx_device_usage_day" json:"device_id"`
+	Day        string    `gorm:"size:10;not null;uniqueIndex:idx_device_usage_day" json:"day"` // YYYY-MM-DD
+	ValueCount int64     `gorm:"not null;default:0" json:"value_count"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+// DeviceCertificate is a TLS client certificate a device authenticates with, identified by
+// the SHA-256 fingerprint of its DER encoding. Certificates are revoked rather than deleted.
+type DeviceCertificate struct {
+	ID               uint       `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID         uint       `gorm:"not null;index" json:"device_id"`
+	OrganizationID   *uint      `gorm:"index" json:"organization_id,omitempty"`
+	Fingerprint      string     `gorm:"size:64;not null;uniqueIndex" json:"fingerprint"` // Lower-case hex SHA-256
+	Subject          string     `json:"subject,omitempty"`
+	Issuer           string     `json:"issuer,omitempty"`
+	SerialNumber     string     `json:"serial_number,omitempty"`
+	Issued           bool       `gorm:"not null;default:false" json:"issued"` // Issued by the built-in CA
+	NotBefore        *time.Time `json:"not_before,omitempty"`                 // Unknown when only the fingerprint was registered
+	NotAfter         *time.Time `json:"not_after,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at,omitempty"`
+}
+
+// Badge scan results
+const (
+	BadgeSessionStarted = "session_started" // An operator session was opened
+	BadgeSessionEnded   = "session_ended"   // The operator's open session was closed
+	BadgeSessionOpen    = "session_open"    // A login while the operator's session is already open
+	BadgeUnknown        = "unknown"         // No user of the organization has the RFID
+	BadgeInactive       = "inactive"        // The user is deactivated
+	BadgeNoSession      = "no_session"      // A logout without an open session of the user
+	BadgeLookup         = "lookup"          // A lookup of the badge's user, leaving sessions as they are
+)
+
+// BadgeScan records every RFID badge scanned at a device, including rejected ones
+type BadgeScan struct {
+	ID             uint      `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID       uint      `gorm:"not null;index" json:"device_id"`
+	OrganizationID *uint     `gorm:"index" json:"organization_id,omitempty"`
+	Rfid           string    `gorm:"not null" json:"rfid"`
+	UserID         *uint     `gorm:"index" json:"user_id,omitempty"` // Nil for unknown badges
+	Result         string    `gorm:"size:20;not null" json:"result"`
+	SessionID      *uint     `json:"session_id,omitempty"` // The session opened or closed by the scan
+	ScannedAt      time.Time `gorm:"not null;index" json:"scanned_at"`
+}
+
+// Operator session end reasons
+const (
+	SessionEndedBadge    = "badge"    // The operator badged out
+	SessionEndedReplaced = "replaced" // Another operator badged in
+)
+
+// OperatorSession is the time an operator is badged in at a device. A device has at most one
+// open session; signal values it sends meanwhile are attributed to the operator.
+type OperatorSession struct {
+	ID             uint       `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID       uint       `gorm:"not null;index;uniqueIndex:idx_operator_sessions_open,where:ended_at IS NULL" json:"device_id"`
+	Device         *Device    `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
+	OrganizationID *uint      `gorm:"index" json:"organization_id,omitempty"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	User           *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	StartedAt      time.Time  `gorm:"not null" json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"` // Nil while the session is open
+	EndReason      string     `gorm:"size:20" json:"end_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at,omitempty"`
+}
+
+// Shift is a recurring work shift of an organization's calendar, e.g. 06:00 to 14:00 from
+// Monday to Friday. A shift ending at or before its start time ends on the next day.
+type Shift struct {
+	ID             uint      `gorm:"primaryKey" json:"id,omitempty"`
+	OrganizationID *uint     `gorm:"index" json:"organization_id,omitempty"`
+	Name           string    `gorm:"not null" json:"name"`
+	StartTime      string    `gorm:"size:5;not null" json:"start_time"` // HH:MM
+	EndTime        string    `gorm:"size:5;not null" json:"end_time"`   // HH:MM
+	Weekdays       string    `json:"weekdays,omitempty"`                // Days the shift starts on, e.g. "mon,tue"; every day when empty
+	Timezone       string    `json:"timezone,omitempty"`                // IANA time zone of the times, UTC when empty
+	IsActive       bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt      time.Time `json:"created_at,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at,omitempty"`
+}
+
+// Cycle results
+const (
+	CyclePass = "pass"
+	CycleFail = "fail"
+)
+
+// Cycle is one assembly cycle of a station, e.g. a tightening: when it ran, the value it had
+// to reach and the value it reached, and whether the part passed
+type Cycle struct {
+	ID              uint      `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID        uint      `gorm:"not null;index:idx_cycles_device_started" json:"device_id"`
+	Device          *Device   `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
+	OrganizationID  *uint     `gorm:"index" json:"organization_id,omitempty"`
+	UserID          *uint     `gorm:"index" json:"user_id,omitempty"` // Operator
+	User            *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	StartedAt       time.Time `gorm:"not null;index:idx_cycles_device_started" json:"started_at"`
+	EndedAt         time.Time `gorm:"not null" json:"ended_at"`
+	CycleTime       float64   `gorm:"not null" json:"cycle_time"`  // Seconds from start to end
+	TargetCycleTime *float64  `json:"target_cycle_time,omitempty"` // Ideal cycle time in seconds
+	SetValue        *float64  `json:"set_value,omitempty"`         // Target value, e.g. the torque setpoint
+	Value           *float64  `json:"value,omitempty"`             // Achieved value
+	MotionWaste     *float64  `json:"motion_waste,omitempty"`      // Seconds of non-value-adding motion
+	Result          string    `gorm:"size:10;not null;index;check:result IN ('pass','fail')" json:"result"`
+	Metadata        JSONB     `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt       time.Time `json:"created_at,omitempty"`
+}
+
+// Signal represents a signal configuration (input/output, analogic/digital/waveform)
 type Signal struct {
-	ID          uint          `gorm:"primaryKey" json:"id,omitempty"`
-	DeviceID    uint          `gorm:"not null;index" json:"device_id"`
-	Device      Device        `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
-	Name        string        `gorm:"not null" json:"name"`
-	SignalType  string        `gorm:"not null;default:'analogic';check:signal_type IN ('digital','analogic')" json:"signal_type"`
-	Direction   string        `gorm:"not null;default:'input';check:direction IN ('input','output')" json:"direction"`
-	SensorName  string        `json:"sensor_name,omitempty"`
-	Description string        `json:"description,omitempty"`
-	Unit        string        `json:"unit,omitempty"`
-	MinValue    *float64      `json:"min_value,omitempty"`
-	MaxValue    *float64      `json:"max_value,omitempty"`
-	Metadata    JSONB         `gorm:"type:jsonb" json:"metadata,omitempty"`
-	IsActive    bool          `gorm:"default:true" json:"is_active,omitempty"`
-	Values      []SignalValue `gorm:"foreignKey:SignalID" json:"values,omitempty"`
-	CreatedAt   time.Time     `json:"created_at,omitempty"`
-	UpdatedAt   time.Time     `json:"updated_at,omitempty"`
+	ID             uint          `gorm:"primaryKey" json:"id,omitempty"`
+	DeviceID       uint          `gorm:"not null;index" json:"device_id"`
+	Device         Device        `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
+	OrganizationID *uint         `gorm:"index" json:"organization_id,omitempty"` // Always the device's organization
+	Name           string        `gorm:"not null" json:"name" validate:"max=255"`
+	SignalType     string        `gorm:"not null;default:'analogic';check:chk_signals_signal_type_v2,signal_type IN ('digital','analogic','waveform')" json:"signal_type" validate:"oneof=digital analogic waveform"`
+	Direction      string        `gorm:"not null;default:'input';check:direction IN ('input','output')" json:"direction" validate:"oneof=input output"`
+	SensorName     string        `json:"sensor_name,omitempty"`
+	Description    string        `json:"description,omitempty"`
+	Unit           string        `json:"unit,omitempty"`
+	MinValue       *float64      `json:"min_value,omitempty"`
+	MaxValue       *float64      `json:"max_value,omitempty"`
+	Metadata       JSONB         `gorm:"type:jsonb" json:"metadata,omitempty"`
+	IsActive       bool          `gorm:"default:true" json:"is_active,omitempty"`
+	Values         []SignalValue `gorm:"foreignKey:SignalID" json:"values,omitempty"`
+	CreatedAt      time.Time     `json:"created_at,omitempty"`
+	UpdatedAt      time.Time     `json:"updated_at,omitempty"`
+}
+
+// Validate checks the value range of the signal
+func (s *Signal) Validate(errs *validate.Errors) {
+	if s.MinValue != nil && s.MaxValue != nil && *s.MinValue > *s.MaxValue {
+		errs.Add("min_value", validate.CodeInvalid, "min_value must not be greater than max_value")
+	}
+}
+
+// BeforeCreate copies the organization from the signal's device when it is not set
+func (s *Signal) BeforeCreate(tx *gorm.DB) error {
+	if s.OrganizationID != nil || s.DeviceID == 0 {
+		return nil
+	}
+	var device Device
+	err := tx.Session(&gorm.Session{NewDB: true}).Select("id", "organization_id").First(&device, s.DeviceID).Error
+	if err != nil {
+		return err
+	}
+	s.OrganizationID = device.OrganizationID
+	return nil
 }
 
 // SignalValue represents an actual data point/reading for a signal
 type SignalValue struct {
-	ID           uint      `gorm:"primaryKey" json:"id,omitempty"`
-	SignalID     uint      `gorm:"not null;index" json:"signal_id"`
-	Signal       Signal    `gorm:"foreignKey:SignalID" json:"signal,omitempty"`
-	UserID       *uint     `gorm:"index" json:"user_id,omitempty"` // Optional, can fallback to device user
-	User         *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Timestamp    time.Time `gorm:"default:CURRENT_TIMESTAMP;index" json:"timestamp"`
-	Value        *float64  `json:"value,omitempty"`        // For analogic signals
-	DigitalValue *bool     `json:"digital_value,omitempty"` // For digital signals
-	Metadata     JSONB     `gorm:"type:jsonb" json:"metadata,omitempty"`
-	CreatedAt    time.Time `json:"created_at,omitempty"`
+	ID             uint      `gorm:"primaryKey" json:"id,omitempty"`
+	SignalID       uint      `gorm:"not null;index" json:"signal_id"`
+	Signal         Signal    `gorm:"foreignKey:SignalID" json:"signal,omitempty"`
+	UserID         *uint     `gorm:"index" json:"user_id,omitempty"` // Optional, can fallback to device user
+	User           *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Timestamp      time.Time `gorm:"default:CURRENT_TIMESTAMP;index" json:"timestamp"`
+	Value          *float64  `json:"value,omitempty"`           // For analogic signals
+	DigitalValue   *bool     `json:"digital_value,omitempty"`   // For digital signals
+	Samples        Waveform  `json:"samples,omitempty"`         // For waveform signals, in order
+	SampleInterval *float64  `json:"sample_interval,omitempty"` // Seconds between waveform samples
+	Metadata       JSONB     `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt      time.Time `json:"created_at,omitempty"`
+	Filled         bool      `gorm:"-" json:"filled,omitempty"` // Filled into a gap of a value list, not stored
+}
+
+// AuditLog records a create/update/delete made through the API. Entries form a
+// hash chain: each Hash covers the entry and the previous entry's hash.
+type AuditLog struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Timestamp      time.Time `gorm:"not null;index" json:"timestamp"`
+	OrganizationID *uint     `gorm:"index" json:"organization_id,omitempty"`
+	ActorType      string    `gorm:"size:20;not null;index:idx_audit_actor" json:"actor_type"` // "user", "device", "anonymous" or "admin"
+	ActorID        *uint     `gorm:"index:idx_audit_actor" json:"actor_id,omitempty"`
+	Action         string    `gorm:"size:20;not null" json:"action"`
+	ResourceType   string    `gorm:"size:50;not null;index:idx_audit_resource" json:"resource_type"`
+	ResourceID     uint      `gorm:"index:idx_audit_resource" json:"resource_id"`
+	Changes        JSONB     `gorm:"type:jsonb" json:"changes,omitempty"`
+	IP             string    `gorm:"size:64" json:"ip,omitempty"`
+	PrevHash       string    `gorm:"size:64" json:"prev_hash"`
+	Hash           string    `gorm:"size:64;not null" json:"hash"`
 }
 
 // JSONB is a custom type for PostgreSQL JSONB
@@ -113,3 +336,37 @@ func (j *JSONB) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, j)
 }
 
+// Waveform holds the samples of a waveform signal value, stored in the compact binary
+// encoding of the waveform package
+type Waveform []float64
+
+// Value implements the driver.Valuer interface
+func (w Waveform) Value() (driver.Value, error) {
+	if w == nil {
+		return nil, nil
+	}
+	return waveform.Encode(w)
+}
+
+// Scan implements the sql.Scanner interface
+func (w *Waveform) Scan(value interface{}) error {
+	if value == nil {
+		*w = nil
+		return nil
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported waveform column type %T", value)
+	}
+	samples, err := waveform.Decode(data)
+	if err != nil {
+		return err
+	}
+	*w = samples
+	return nil
+}
+
+// GormDataType stores waveforms as binary columns (bytea in PostgreSQL)
+func (Waveform) GormDataType() string {
+	return string(schema.Bytes)
+}
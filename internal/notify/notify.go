@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"data-storage/internal/logging"
+)
+
+var logger = logging.Logger("notify")
+
+// Message is a notification addressed to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to users (e.g. password reset links)
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures the notifier implementation
+type Config struct {
+	Driver string `yaml:"driver" env:"NOTIFIER"` // "smtp" or "log"; "log" is for local testing and refused in production
+
+	// SMTP settings
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	From         string `yaml:"from" env:"SMTP_FROM"`
+
+	// Log settings: messages are appended to this file, or written to the log when empty
+	LogFile string `yaml:"log_file" env:"NOTIFIER_LOG_FILE"`
+}
+
+func DefaultConfig() Config {
+	return Config{Driver: "log", SMTPPort: 587}
+}
+
+// New builds the notifier selected by the config
+func New(cfg Config) (Notifier, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.From == "" {
+			return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM are required for the smtp notifier")
+		}
+		return &SMTPNotifier{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	case "log":
+		return &LogNotifier{Path: cfg.LogFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Driver)
+	}
+}
+
+var notifier Notifier = &LogNotifier{}
+
+// Init sets the notifier used by Send
+func Init(n Notifier) {
+	notifier = n
+}
+
+// Send delivers the message with the configured notifier
+func Send(ctx context.Context, msg Message) error {
+	return notifier.Send(ctx, msg)
+}
+
+// SMTPNotifier sends messages as plain text email
+type SMTPNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	body, err := n.message(msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail has no context support, so honor cancellation before dialing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(addr, auth, n.From, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
+
+// message builds the email. Line breaks in a header value would start new headers, so they
+// are refused in the recipient and MIME-encoded in the subject.
+func (n *SMTPNotifier) message(msg Message, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return nil, fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	body := strings.Join([]string{
+		"From: " + n.From,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+	return []byte(body), nil
+}
+
+// LogNotifier writes messages to a file or the application log, for local testing
+type LogNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	if n.Path == "" {
+		logger.InfoContext(ctx, "Notification", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening notification log: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "--- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
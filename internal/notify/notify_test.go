@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogNotifier_WritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	n := &LogNotifier{Path: path}
+
+	err := n.Send(context.Background(), Message{To: "user@example.com", Subject: "Password reset", Body: "token-123"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	for _, expected := range []string{"To: user@example.com", "Subject: Password reset", "token-123"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Log should contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{Driver: "smtp"}); err == nil {
+		t.Error("SMTP notifier without host should fail")
+	}
+	if _, err := New(Config{Driver: "pigeon"}); err == nil {
+		t.Error("Unknown driver should fail")
+	}
+
+	n, err := New(Config{Driver: "smtp", SMTPHost: "mail.example.com", SMTPPort: 587, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, ok := n.(*SMTPNotifier); !ok {
+		t.Errorf("Expected *SMTPNotifier, got %T", n)
+	}
+}
+
+func TestSMTPNotifier_HeaderInjection(t *testing.T) {
+	n := &SMTPNotifier{From: "noreply@example.com"}
+
+	if _, err := n.message(Message{To: "user@example.com\r\nBcc: attacker@example.com", Subject: "Hi"}, time.Now()); err == nil {
+		t.Error("Recipient with a line break should be refused")
+	}
+
+	body, err := n.message(Message{To: "user@example.com", Subject: "Invitation to Plant\r\nBcc: attacker@example.com", Body: "Hello"}, time.Now())
+	if err != nil {
+		t.Fatalf("message failed: %v", err)
+	}
+	header, _, _ := strings.Cut(string(body), "\r\n\r\n")
+	for _, line := range strings.Split(header, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("Subject should not start a new header, got:\n%s", header)
+		}
+	}
+	if !strings.Contains(header, "Subject: =?utf-8?q?") {
+		t.Errorf("Expected an encoded subject, got:\n%s", header)
+	}
+
+	body, err = n.message(Message{To: "user@example.com", Subject: "Password reset"}, time.Now())
+	if err != nil || !strings.Contains(string(body), "\r\nSubject: Password reset\r\n") {
+		t.Errorf("Plain subjects should be unchanged, got %v:\n%s", err, body)
+	}
+}
@@ -0,0 +1,169 @@
+// Package oee computes the overall equipment effectiveness of stations from their assembly
+// cycles: the share of planned production time spent running cycles (availability), the
+// ideal cycle time over the actual one (performance) and the share of good parts (quality).
+package oee
+
+import (
+	"fmt"
+	"time"
+
+	"data-storage/internal/attendance"
+	"data-storage/internal/models"
+)
+
+// Report groupings
+const (
+	ByDevice = "device" // A row per device over the whole range
+	ByShift  = "shift"  // A row per device and shift occurrence
+)
+
+// Totals are the cycles of a device that started within planned production time
+type Totals struct {
+	PlannedSeconds     float64 `json:"planned_seconds"`
+	RunSeconds         float64 `json:"run_seconds"`   // Sum of the cycle times
+	IdealSeconds       float64 `json:"ideal_seconds"` // Sum of the ideal cycle times
+	Cycles             int64   `json:"cycles"`
+	GoodCycles         int64   `json:"good_cycles"`
+	MotionWasteSeconds float64 `json:"motion_waste_seconds"`
+	WithoutIdeal       int64   `json:"cycles_without_ideal,omitempty"` // Cycles with no ideal cycle time; performance is unknown
+}
+
+// Add adds other to the totals
+func (t *Totals) Add(other Totals) {
+	t.PlannedSeconds += other.PlannedSeconds
+	t.RunSeconds += other.RunSeconds
+	t.IdealSeconds += other.IdealSeconds
+	t.Cycles += other.Cycles
+	t.GoodCycles += other.GoodCycles
+	t.MotionWasteSeconds += other.MotionWasteSeconds
+	t.WithoutIdeal += other.WithoutIdeal
+}
+
+// Ratios are the OEE factors, each nil when it cannot be computed. Values above 1 mean
+// overlapping cycles or an ideal cycle time that is too slow.
+type Ratios struct {
+	Availability *float64 `json:"availability"`
+	Performance  *float64 `json:"performance"`
+	Quality      *float64 `json:"quality"`
+	OEE          *float64 `json:"oee"`
+}
+
+// Ratios returns availability, performance, quality and their product. Without cycles
+// during planned time the OEE is 0, whatever performance and quality would have been.
+func (t Totals) Ratios() Ratios {
+	ratio := func(n, d float64) *float64 {
+		r := n / d
+		return &r
+	}
+	var r Ratios
+	if t.PlannedSeconds > 0 {
+		r.Availability = ratio(t.RunSeconds, t.PlannedSeconds)
+	}
+	if t.Cycles > 0 && t.RunSeconds > 0 && t.WithoutIdeal == 0 {
+		r.Performance = ratio(t.IdealSeconds, t.RunSeconds)
+	}
+	if t.Cycles > 0 {
+		r.Quality = ratio(float64(t.GoodCycles), float64(t.Cycles))
+	}
+	switch {
+	case r.Availability != nil && r.Performance != nil && r.Quality != nil:
+		r.OEE = ratio(*r.Availability**r.Performance**r.Quality, 1)
+	case t.PlannedSeconds > 0 && t.Cycles == 0:
+		r.OEE = ratio(0, 1)
+	}
+	return r
+}
+
+// Period is a span of planned production time: a shift occurrence, or the whole report
+// range when the organization has no shifts
+type Period struct {
+	Shift      *models.Shift
+	Start, End time.Time
+}
+
+// Periods returns the shift windows clipped to [from, to), or the whole range when there
+// are no schedules. Periods never overlap, so every cycle and second of planned time counts
+// once: time in overlapping shifts belongs to the one that started first, and a shift
+// entirely within an earlier one has no period.
+func Periods(schedules []*attendance.Schedule, from, to time.Time) []Period {
+	if len(schedules) == 0 {
+		return []Period{{Start: from, End: to}}
+	}
+	var periods []Period
+	covered := from // End of the time already in a period
+	for _, w := range attendance.Windows(schedules, from, to) {
+		start, end := w.Start, w.End
+		if start.Before(covered) {
+			start = covered
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			periods = append(periods, Period{Shift: w.Shift, Start: start, End: end})
+			covered = end
+		}
+	}
+	return periods
+}
+
+// Row is the OEE of a device, over the whole range or one shift occurrence
+type Row struct {
+	DeviceID   uint       `json:"device_id"`
+	Device     string     `json:"device"`
+	ShiftID    uint       `json:"shift_id,omitempty"`
+	Shift      string     `json:"shift,omitempty"`
+	ShiftStart *time.Time `json:"shift_start,omitempty"`
+	ShiftEnd   *time.Time `json:"shift_end,omitempty"`
+	Totals
+	Ratios
+}
+
+// Report accumulates the totals of devices per period
+type Report struct {
+	byShift bool
+	rows    []*Row
+	index   map[string]*Row
+}
+
+// NewReport returns an empty report grouped by ByDevice (the default when empty) or ByShift
+func NewReport(groupBy string) (*Report, error) {
+	switch groupBy {
+	case "", ByDevice:
+		return &Report{index: make(map[string]*Row)}, nil
+	case ByShift:
+		return &Report{byShift: true, index: make(map[string]*Row)}, nil
+	}
+	return nil, fmt.Errorf("group_by must be one of %s, %s", ByDevice, ByShift)
+}
+
+// Add adds the totals of a device in a period. Every device should be added for every period,
+// even without cycles, so that its planned time counts.
+func (r *Report) Add(device models.Device, period Period, totals Totals) {
+	key := fmt.Sprint(device.ID)
+	if r.byShift {
+		key += "/" + period.Start.Format(time.RFC3339)
+	}
+	row, ok := r.index[key]
+	if !ok {
+		row = &Row{DeviceID: device.ID, Device: device.Name}
+		if r.byShift && period.Shift != nil {
+			start, end := period.Start, period.End
+			row.ShiftID, row.Shift = period.Shift.ID, period.Shift.Name
+			row.ShiftStart, row.ShiftEnd = &start, &end
+		}
+		r.index[key] = row
+		r.rows = append(r.rows, row)
+	}
+	row.Totals.Add(totals)
+}
+
+// Rows returns the rows in the order they were first added, with their ratios
+func (r *Report) Rows() []Row {
+	rows := make([]Row, len(r.rows))
+	for i, row := range r.rows {
+		rows[i] = *row
+		rows[i].Ratios = row.Totals.Ratios()
+	}
+	return rows
+}
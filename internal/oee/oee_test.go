@@ -0,0 +1,122 @@
+package oee
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"data-storage/internal/attendance"
+	"data-storage/internal/models"
+)
+
+func near(r *float64, want float64) bool {
+	return r != nil && math.Abs(*r-want) < 1e-9
+}
+
+func TestRatios(t *testing.T) {
+	// 8 hours planned, 6 hours running 300 cycles of an ideal 60 seconds, 285 good
+	totals := Totals{PlannedSeconds: 8 * 3600, RunSeconds: 6 * 3600, IdealSeconds: 300 * 60, Cycles: 300, GoodCycles: 285}
+	r := totals.Ratios()
+	if !near(r.Availability, 0.75) || !near(r.Performance, 18000.0/21600) || !near(r.Quality, 0.95) {
+		t.Errorf("Unexpected ratios %v %v %v", *r.Availability, *r.Performance, *r.Quality)
+	}
+	if !near(r.OEE, 0.75*18000.0/21600*0.95) {
+		t.Errorf("Unexpected OEE %v", *r.OEE)
+	}
+
+	// Cycles without an ideal cycle time leave the performance and OEE unknown
+	totals.WithoutIdeal = 1
+	if r := totals.Ratios(); r.Performance != nil || r.OEE != nil || r.Quality == nil {
+		t.Errorf("Expected unknown performance, got %+v", r)
+	}
+
+	// An idle station has an OEE of 0
+	if r := (Totals{PlannedSeconds: 3600}).Ratios(); !near(r.Availability, 0) || !near(r.OEE, 0) || r.Quality != nil {
+		t.Errorf("Expected an OEE of 0, got %+v", r)
+	}
+	if r := (Totals{}).Ratios(); r.Availability != nil || r.OEE != nil {
+		t.Errorf("Expected no ratios without planned time, got %+v", r)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	if periods := Periods(nil, from, to); len(periods) != 1 || !periods[0].Start.Equal(from) || !periods[0].End.Equal(to) {
+		t.Errorf("Expected the whole range without shifts, got %v", periods)
+	}
+
+	night, err := attendance.NewSchedule(models.Shift{ID: 1, Name: "Night", StartTime: "22:00", EndTime: "06:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	periods := Periods([]*attendance.Schedule{night}, from, to)
+	if len(periods) != 2 {
+		t.Fatalf("Expected the end of one night and the start of the next, got %v", periods)
+	}
+	if periods[0].End.Sub(periods[0].Start) != 6*time.Hour || periods[1].End.Sub(periods[1].Start) != 2*time.Hour {
+		t.Errorf("Expected periods clipped to the range, got %v", periods)
+	}
+}
+
+func TestPeriods_Overlapping(t *testing.T) {
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	schedule := func(id uint, start, end string) *attendance.Schedule {
+		s, err := attendance.NewSchedule(models.Shift{ID: id, Name: start, StartTime: start, EndTime: end})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// Day 06-14 and Late 12-20 overlap from 12 to 14; Break 08-09 lies within Day
+	schedules := []*attendance.Schedule{schedule(1, "06:00", "14:00"), schedule(2, "12:00", "20:00"), schedule(3, "08:00", "09:00")}
+	periods := Periods(schedules, from, to)
+	if len(periods) != 2 {
+		t.Fatalf("Expected a period for Day and Late only, got %v", periods)
+	}
+	at := func(hour int) time.Time { return from.Add(time.Duration(hour) * time.Hour) }
+	if periods[0].Shift.ID != 1 || !periods[0].Start.Equal(at(6)) || !periods[0].End.Equal(at(14)) {
+		t.Errorf("Expected Day to keep the overlap, got %v", periods[0])
+	}
+	if periods[1].Shift.ID != 2 || !periods[1].Start.Equal(at(14)) || !periods[1].End.Equal(at(20)) {
+		t.Errorf("Expected Late to start when Day ends, got %v", periods[1])
+	}
+}
+
+func TestReport(t *testing.T) {
+	if _, err := NewReport("operator"); err == nil {
+		t.Error("Expected an unknown grouping to be rejected")
+	}
+
+	shift := &models.Shift{ID: 1, Name: "Day"}
+	start := time.Date(2024, 3, 4, 6, 0, 0, 0, time.UTC)
+	monday := Period{Shift: shift, Start: start, End: start.Add(8 * time.Hour)}
+	tuesday := Period{Shift: shift, Start: start.Add(24 * time.Hour), End: start.Add(32 * time.Hour)}
+	press := models.Device{ID: 1, Name: "press"}
+	hour := func(cycles, good int64) Totals {
+		return Totals{PlannedSeconds: 8 * 3600, RunSeconds: 3600, IdealSeconds: 3600, Cycles: cycles, GoodCycles: good}
+	}
+
+	for _, tc := range []struct {
+		groupBy string
+		rows    int
+	}{{ByDevice, 1}, {ByShift, 2}} {
+		report, _ := NewReport(tc.groupBy)
+		report.Add(press, monday, hour(10, 10))
+		report.Add(press, tuesday, hour(10, 5))
+		rows := report.Rows()
+		if len(rows) != tc.rows {
+			t.Fatalf("%s: expected %d rows, got %d", tc.groupBy, tc.rows, len(rows))
+		}
+		if tc.groupBy == ByDevice {
+			if r := rows[0]; r.Cycles != 20 || r.ShiftStart != nil || !near(r.Quality, 0.75) || !near(r.Availability, 0.125) {
+				t.Errorf("Unexpected device row %+v", r)
+			}
+		} else if r := rows[1]; r.Shift != "Day" || !r.ShiftStart.Equal(tuesday.Start) || !near(r.Quality, 0.5) {
+			t.Errorf("Unexpected shift row %+v", r)
+		}
+	}
+}
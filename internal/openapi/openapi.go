@@ -0,0 +1,253 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.0.3"
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// SecurityRequirement names a security scheme that an operation accepts
+type SecurityRequirement map[string][]string
+
+// PathItem holds the operations of one path by method
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security"` // Empty for public operations
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Schema is the subset of the OpenAPI schema object produced from Go types
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // bool or *Schema
+}
+
+// Operation returns the operation for a method, or nil
+func (p *PathItem) Operation(method string) *Operation {
+	if slot := p.slot(method); slot != nil {
+		return *slot
+	}
+	return nil
+}
+
+func (p *PathItem) slot(method string) **Operation {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		return &p.Get
+	case http.MethodPut:
+		return &p.Put
+	case http.MethodPost:
+		return &p.Post
+	case http.MethodDelete:
+		return &p.Delete
+	}
+	return nil
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// PathParams returns the parameter names of a route template such as /orgs/{id}/members/{user_id}
+func PathParams(path string) []string {
+	var names []string
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// Builder assembles a Document. Schemas of Go types are generated on first use and
+// registered as components.
+type Builder struct {
+	doc     *Document
+	schemas *schemaRegistry
+}
+
+func NewBuilder(info Info) *Builder {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+	return &Builder{doc: doc, schemas: newSchemaRegistry(doc.Components.Schemas)}
+}
+
+// AddTag documents a group of operations
+func (b *Builder) AddTag(name, description string) {
+	b.doc.Tags = append(b.doc.Tags, Tag{Name: name, Description: description})
+}
+
+// AddSecurityScheme registers a scheme that operations can reference by name
+func (b *Builder) AddSecurityScheme(name string, scheme *SecurityScheme) {
+	b.doc.Components.SecuritySchemes[name] = scheme
+}
+
+// Schema returns the schema of the Go type of v. Named structs are registered as
+// components and referenced.
+func (b *Builder) Schema(v interface{}) *Schema {
+	return b.schemas.of(v)
+}
+
+// SetSchema registers a hand-written component schema and returns a reference to it
+func (b *Builder) SetSchema(name string, schema *Schema) *Schema {
+	b.doc.Components.Schemas[name] = schema
+	return Ref(name)
+}
+
+// Add registers an operation. Path parameters missing from op.Parameters are added as
+// integer parameters. It panics when the operation is already defined, so a duplicated
+// entry in a route table fails at startup.
+func (b *Builder) Add(method, path string, op *Operation) {
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		b.doc.Paths[path] = item
+	}
+	slot := item.slot(method)
+	if slot == nil {
+		panic(fmt.Sprintf("openapi: unsupported method %s %s", method, path))
+	}
+	if *slot != nil {
+		panic(fmt.Sprintf("openapi: operation %s %s defined twice", method, path))
+	}
+
+	for _, name := range PathParams(path) {
+		if !hasParam(op.Parameters, name, "path") {
+			op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "integer"}})
+		}
+	}
+	if op.OperationID == "" {
+		op.OperationID = operationID(method, path)
+	}
+	if op.Security == nil {
+		op.Security = []SecurityRequirement{}
+	}
+	*slot = op
+}
+
+// Document returns the assembled document
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+// Has reports whether the document defines an operation for the method and path
+func (d *Document) Has(method, path string) bool {
+	item, ok := d.Paths[path]
+	return ok && item.Operation(method) != nil
+}
+
+// Ref returns a reference to a component schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// JSON wraps a schema as an application/json content map
+func JSON(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+func hasParam(params []Parameter, name, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// operationID derives an ID such as getOrgsIdMembers from the method and path
+func operationID(method, path string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.'
+	}) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type node struct {
+	base
+	Name     string            `json:"name" validate:"required,max=10"`
+	Kind     string            `json:"kind" validate:"oneof=a b"`
+	Weight   *float64          `json:"weight,omitempty" validate:"min=0"`
+	Secret   string            `json:"-"`
+	Parent   *node             `json:"parent,omitempty"`
+	Children []node            `json:"children"`
+	Labels   map[string]string `json:"labels"`
+}
+
+func TestSchema_FromStruct(t *testing.T) {
+	b := NewBuilder(Info{Title: "test", Version: "1"})
+	if ref := b.Schema(node{}); ref.Ref != "#/components/schemas/node" {
+		t.Fatalf("Expected a reference to node, got %+v", ref)
+	}
+
+	s := b.Document().Components.Schemas["node"]
+	if s == nil {
+		t.Fatal("Expected node to be registered")
+	}
+	for _, name := range []string{"id", "created_at", "name", "kind", "weight", "parent", "children", "labels"} {
+		if s.Properties[name] == nil {
+			t.Errorf("Expected property %s", name)
+		}
+	}
+	if s.Properties["Secret"] != nil || s.Properties["base"] != nil {
+		t.Errorf("Expected skipped and embedded fields to be absent: %v", s.Properties)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "name" {
+		t.Errorf("Expected name to be required, got %v", s.Required)
+	}
+	if p := s.Properties["name"]; p.MaxLength == nil || *p.MaxLength != 10 {
+		t.Errorf("Expected maxLength 10, got %+v", p)
+	}
+	if p := s.Properties["kind"]; len(p.Enum) != 2 {
+		t.Errorf("Expected an enum, got %+v", p)
+	}
+	if p := s.Properties["weight"]; !p.Nullable || p.Minimum == nil || p.Type != "number" {
+		t.Errorf("Expected a nullable number with a minimum, got %+v", p)
+	}
+	if p := s.Properties["created_at"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("Expected a date-time string, got %+v", p)
+	}
+	if p := s.Properties["children"]; p.Type != "array" || p.Items.Ref != "#/components/schemas/node" {
+		t.Errorf("Expected an array of node references, got %+v", p)
+	}
+}
+
+func TestAdd_PathParams(t *testing.T) {
+	b := NewBuilder(Info{Title: "test", Version: "1"})
+	b.Add("DELETE", "/orgs/{id}/members/{user_id}", &Operation{})
+
+	doc := b.Document()
+	if !doc.Has("DELETE", "/orgs/{id}/members/{user_id}") || doc.Has("GET", "/orgs/{id}/members/{user_id}") {
+		t.Fatal("Unexpected operations")
+	}
+	op := doc.Paths["/orgs/{id}/members/{user_id}"].Delete
+	if len(op.Parameters) != 2 || op.Parameters[1].Name != "user_id" || !op.Parameters[1].Required {
+		t.Errorf("Expected both path parameters, got %+v", op.Parameters)
+	}
+	if op.OperationID != "deleteOrgsIdMembersUserId" {
+		t.Errorf("Unexpected operation ID %s", op.OperationID)
+	}
+	if op.Security == nil {
+		t.Error("Expected public operations to have an empty security list")
+	}
+}
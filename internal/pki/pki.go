@@ -0,0 +1,262 @@
+// Package pki runs the built-in certificate authority that issues device client
+// certificates, and identifies certificates by the SHA-256 fingerprint of their DER encoding.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config locates the device CA. Without a certificate and key no certificates are issued,
+// but devices can still register certificates from another CA by fingerprint.
+type Config struct {
+	CertFile string `yaml:"cert_file" env:"DEVICE_CA_CERT"`
+	KeyFile  string `yaml:"key_file" env:"DEVICE_CA_KEY"`
+	// Validity is the default lifetime of issued certificates
+	Validity time.Duration `yaml:"validity" env:"DEVICE_CERT_VALIDITY"`
+}
+
+func DefaultConfig() Config {
+	return Config{Validity: 365 * 24 * time.Hour}
+}
+
+// ErrNoCA is returned when issuing without a configured CA
+var ErrNoCA = errors.New("no device CA is configured")
+
+// CA signs device client certificates
+type CA struct {
+	Cert     *x509.Certificate
+	key      crypto.Signer
+	validity time.Duration
+}
+
+var ca *CA
+
+// Init loads the CA named in the configuration, if any
+func Init(cfg Config) error {
+	ca = nil
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil
+	}
+	loaded, err := LoadCA(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	loaded.validity = cfg.Validity
+	ca = loaded
+	return nil
+}
+
+// Authority returns the configured CA, or ErrNoCA
+func Authority() (*CA, error) {
+	if ca == nil {
+		return nil, ErrNoCA
+	}
+	return ca, nil
+}
+
+// LoadCA reads a PEM certificate and private key. The certificate must be a CA.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA key: %w", err)
+	}
+	cert, err := ParseCertificate(string(certPEM))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("the CA certificate is not a CA")
+	}
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CA key: %w", err)
+	}
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, errors.New("the CA key does not match the CA certificate")
+	}
+	return &CA{Cert: cert, key: key, validity: DefaultConfig().Validity}, nil
+}
+
+// GenerateCA creates a self-signed CA certificate and its key, both PEM encoded
+func GenerateCA(commonName string, validity time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = EncodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// Issue signs a client certificate for the public key. A zero validity uses the configured
+// default; certificates never outlive the CA.
+func (c *CA) Issue(commonName string, pub crypto.PublicKey, validity time.Duration) (*x509.Certificate, error) {
+	if validity <= 0 {
+		validity = c.validity
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(c.Cert.NotAfter) {
+		notAfter = c.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.Cert, pub, c.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CertificatePEM returns the PEM encoding of the CA certificate
+func (c *CA) CertificatePEM() string {
+	return string(EncodeCertificate(c.Cert))
+}
+
+// Fingerprint returns the lower-case hex SHA-256 digest of the certificate
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint accepts a SHA-256 fingerprint in hex, optionally separated by colons
+// as printed by openssl, and returns it in the form of Fingerprint
+func NormalizeFingerprint(s string) (string, error) {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if len(s) != 2*sha256.Size {
+		return "", errors.New("a SHA-256 fingerprint has 64 hex digits")
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", errors.New("the fingerprint is not hexadecimal")
+	}
+	return s, nil
+}
+
+// ParseCertificate decodes the first PEM certificate of data
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseCSR decodes a PEM certificate signing request and checks its signature
+func ParseCSR(data string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, errors.New("no PEM certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// GenerateKey creates an ECDSA P-256 key
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// EncodeCertificate returns the PEM encoding of a certificate
+func EncodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// EncodeKey returns the PKCS #8 PEM encoding of a private key
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parseKey decodes a PKCS #8, EC or PKCS #1 PEM private key
+func parseKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// serialNumber returns a random 128-bit certificate serial number
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
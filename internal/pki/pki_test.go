@@ -0,0 +1,111 @@
+package pki
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCA generates a CA and writes it to a temporary directory
+func writeCA(t *testing.T, validity time.Duration) Config {
+	t.Helper()
+	certPEM, keyPEM, err := GenerateCA("Test CA", validity)
+	if err != nil {
+		t.Fatalf("Error generating CA: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := Config{CertFile: filepath.Join(dir, "ca.pem"), KeyFile: filepath.Join(dir, "ca.key"), Validity: 30 * 24 * time.Hour}
+	if err := os.WriteFile(cfg.CertFile, certPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestCA_Issue(t *testing.T) {
+	if err := Init(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authority(); err != ErrNoCA {
+		t.Errorf("Expected ErrNoCA without configuration, got %v", err)
+	}
+
+	cfg := writeCA(t, 365*24*time.Hour)
+	if err := Init(cfg); err != nil {
+		t.Fatalf("Error loading CA: %v", err)
+	}
+	t.Cleanup(func() { Init(Config{}) })
+	ca, err := Authority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Issue("device-7", key.Public(), 0)
+	if err != nil {
+		t.Fatalf("Error issuing certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "device-7" {
+		t.Errorf("Unexpected subject %s", cert.Subject)
+	}
+	if lifetime := time.Until(cert.NotAfter); lifetime < 29*24*time.Hour || lifetime > 30*24*time.Hour {
+		t.Errorf("Expected the configured 30 day validity, got %v", lifetime)
+	}
+
+	// The certificate chains to the CA for client authentication only
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("Expected a valid client certificate: %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("Expected the certificate to be unusable for servers")
+	}
+
+	// Certificates never outlive the CA
+	long, err := ca.Issue("device-8", key.Public(), 10*365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !long.NotAfter.Equal(ca.Cert.NotAfter) {
+		t.Errorf("Expected the validity to end with the CA's at %v, got %v", ca.Cert.NotAfter, long.NotAfter)
+	}
+
+	// A round trip through PEM keeps the fingerprint
+	parsed, err := ParseCertificate(string(EncodeCertificate(cert)))
+	if err != nil || Fingerprint(parsed) != Fingerprint(cert) || len(Fingerprint(cert)) != 64 {
+		t.Errorf("Expected the same 64 digit fingerprint after parsing, got %v", err)
+	}
+}
+
+func TestLoadCA_MismatchedKey(t *testing.T) {
+	first := writeCA(t, time.Hour)
+	second := writeCA(t, time.Hour)
+	if _, err := LoadCA(first.CertFile, second.KeyFile); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected a key mismatch error, got %v", err)
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	hex := strings.Repeat("AB", 32)
+	colons := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+	for _, input := range []string{hex, colons, " " + strings.ToLower(hex) + "\n"} {
+		got, err := NormalizeFingerprint(input)
+		if err != nil || got != strings.ToLower(hex) {
+			t.Errorf("NormalizeFingerprint(%q) = %q, %v", input, got, err)
+		}
+	}
+	for _, input := range []string{"", "abcd", strings.Repeat("zz", 32)} {
+		if _, err := NormalizeFingerprint(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"time"
+
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuotaStatus describes a device's ingestion usage for the current day
+type QuotaStatus struct {
+	DeviceID  uint                 `json:"device_id"`
+	Day       string               `json:"day"`
+	Used      int64                `json:"used"`
+	Quota     int64                `json:"quota"`               // 0 means unlimited
+	Remaining *int64               `json:"remaining,omitempty"` // Omitted when unlimited
+	ResetsAt  time.Time            `json:"resets_at"`
+	History   []models.DeviceUsage `json:"history,omitempty"`
+}
+
+// quotaDay returns the UTC day key used to bucket usage
+func quotaDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// QuotaResetTime returns the start of the next UTC day
+func QuotaResetTime(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// DeviceQuota returns the effective daily quota for a device. An override of 0 means the
+// global quota; only the global setting can disable it.
+func DeviceQuota(device *models.Device) int64 {
+	if device.DailyQuota != nil && *device.DailyQuota > 0 {
+		return *device.DailyQuota
+	}
+	return config.DeviceDailyQuota
+}
+
+// ConsumeQuota records one ingested value for the device in tx. It returns false
+// without recording anything when the device already reached its quota. Run it in the
+// transaction that stores the value so a failed insert gives the quota back.
+func ConsumeQuota(tx *gorm.DB, device *models.Device, now time.Time) (bool, error) {
+	quota := DeviceQuota(device)
+	day := quotaDay(now)
+
+	// Make sure today's row exists so the conditional update below has something to increment
+	usage := models.DeviceUsage{DeviceID: device.ID, Day: day}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+		return false, err
+	}
+
+	query := tx.Model(&models.DeviceUsage{}).Where("device_id = ? AND day = ?", device.ID, day)
+	if quota > 0 {
+		query = query.Where("value_count < ?", quota)
+	}
+
+	result := query.UpdateColumn("value_count", gorm.Expr("value_count + ?", 1))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetQuotaStatus returns today's usage for the device and the last historyDays of usage
+func GetQuotaStatus(device *models.Device, now time.Time, historyDays int) (*QuotaStatus, error) {
+	day := quotaDay(now)
+	status := &QuotaStatus{
+		DeviceID: device.ID,
+		Day:      day,
+		Quota:    DeviceQuota(device),
+		ResetsAt: QuotaResetTime(now),
+	}
+
+	var usage models.DeviceUsage
+	err := db.GetDB().Where("device_id = ? AND day = ?", device.ID, day).First(&usage).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	status.Used = usage.ValueCount
+
+	if status.Quota > 0 {
+		remaining := status.Quota - status.Used
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.Remaining = &remaining
+	}
+
+	if historyDays > 0 {
+		since := quotaDay(now.AddDate(0, 0, -historyDays))
+		err = db.GetDB().Where("device_id = ? AND day > ?", device.ID, since).
+			Order("day DESC").Find(&status.History).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,250 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/auth"
+	"data-storage/internal/background"
+	"data-storage/internal/db"
+	"data-storage/internal/logging"
+	"data-storage/internal/models"
+)
+
+// Config holds the rate limit and quota settings
+type Config struct {
+	DevicePerMinute  int   `yaml:"device_per_minute" env:"RATE_LIMIT_DEVICE_PER_MINUTE"` // Requests per minute for each device token (0 disables)
+	UserPerMinute    int   `yaml:"user_per_minute" env:"RATE_LIMIT_USER_PER_MINUTE"`     // Requests per minute for each user token (0 disables)
+	IPPerMinute      int   `yaml:"ip_per_minute" env:"RATE_LIMIT_IP_PER_MINUTE"`         // Requests per minute for each client IP (0 disables)
+	LoginPerMinute   int   `yaml:"login_per_minute" env:"RATE_LIMIT_LOGIN_PER_MINUTE"`   // Login attempts per minute for each client IP (0 disables)
+	DeviceDailyQuota int64 `yaml:"device_daily_quota" env:"DEVICE_DAILY_QUOTA"`          // Signal values per device per day (0 disables)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DevicePerMinute: 600,
+		UserPerMinute:   300,
+		IPPerMinute:     1200,
+		LoginPerMinute:  10,
+	}
+}
+
+var (
+	config  Config
+	limiter = NewLimiter()
+	logger  = logging.Logger("ratelimit")
+)
+
+// Init replaces the active configuration and resets all buckets
+func Init(cfg Config) {
+	config = cfg
+	limiter = NewLimiter()
+	deviceLimits.reset()
+}
+
+// GetConfig returns the active configuration
+func GetConfig() Config {
+	return config
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is an in-memory token bucket limiter keyed by an arbitrary string
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket identified by key. The bucket holds up to
+// perMinute tokens and refills continuously. When no token is available it
+// returns false and the time until the next token.
+func (l *Limiter) Allow(key string, perMinute int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	capacity := float64(perMinute)
+	ratePerSecond := capacity / 60
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(capacity, b.tokens+elapsed*ratePerSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / ratePerSecond * float64(time.Second))
+	return false, wait
+}
+
+// Cleanup removes buckets that have not been used for maxIdle
+func (l *Limiter) Cleanup(maxIdle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-maxIdle)
+	for key, b := range l.buckets {
+		if b.last.Before(cutoff) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// StartCleanup periodically drops idle buckets so the map does not grow without bound.
+// It stops at shutdown.
+func StartCleanup(interval time.Duration) {
+	background.Every(interval, func(time.Time) {
+		limiter.Cleanup(interval)
+	})
+}
+
+// deviceLimitCache caches per-device rate limit overrides to avoid a query per request
+type deviceLimitCache struct {
+	mu      sync.Mutex
+	entries map[uint]deviceLimitEntry
+}
+
+type deviceLimitEntry struct {
+	perMinute int
+	expires   time.Time
+}
+
+const deviceLimitTTL = time.Minute
+
+var deviceLimits = &deviceLimitCache{entries: make(map[uint]deviceLimitEntry)}
+
+func (c *deviceLimitCache) reset() {
+	c.mu.Lock()
+	c.entries = make(map[uint]deviceLimitEntry)
+	c.mu.Unlock()
+}
+
+func (c *deviceLimitCache) invalidate(deviceID uint) {
+	c.mu.Lock()
+	delete(c.entries, deviceID)
+	c.mu.Unlock()
+}
+
+func (c *deviceLimitCache) get(deviceID uint) int {
+	c.mu.Lock()
+	entry, ok := c.entries[deviceID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.perMinute
+	}
+
+	perMinute := config.DevicePerMinute
+	var device models.Device
+	if err := db.GetDB().Select("id", "rate_limit_per_minute").First(&device, deviceID).Error; err == nil {
+		if device.RateLimitPerMinute != nil && *device.RateLimitPerMinute > 0 {
+			perMinute = *device.RateLimitPerMinute
+		}
+	}
+
+	c.mu.Lock()
+	c.entries[deviceID] = deviceLimitEntry{perMinute: perMinute, expires: time.Now().Add(deviceLimitTTL)}
+	c.mu.Unlock()
+	return perMinute
+}
+
+// InvalidateDeviceLimit drops the cached rate limit of a device, so a changed
+// rate_limit_per_minute applies to its next request
+func InvalidateDeviceLimit(deviceID uint) {
+	deviceLimits.invalidate(deviceID)
+}
+
+// reject writes a 429 response with a Retry-After header
+func reject(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	apierror.Error(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// Middleware: LimitByIP limits requests per client IP
+func LimitByIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.Allow("ip:"+auth.ClientIP(r), config.IPPerMinute); !ok {
+			reject(w, r, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Middleware: LimitLogin limits login attempts per client IP
+func LimitLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.Allow("login:"+auth.ClientIP(r), config.LoginPerMinute); !ok {
+			reject(w, r, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Middleware: LimitByClient limits requests per authenticated device or user.
+// It must run after one of the auth middlewares.
+func LimitByClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		var perMinute int
+
+		switch r.Header.Get("X-Auth-Type") {
+		case "device":
+			deviceID, err := strconv.ParseUint(r.Header.Get("X-Device-ID"), 10, 32)
+			if err != nil {
+				next(w, r)
+				return
+			}
+			key = "device:" + strconv.FormatUint(deviceID, 10)
+			perMinute = deviceLimits.get(uint(deviceID))
+		case "user":
+			key = "user:" + r.Header.Get("X-User-ID")
+			perMinute = config.UserPerMinute
+		default:
+			next(w, r)
+			return
+		}
+
+		if ok, wait := limiter.Allow(key, perMinute); !ok {
+			reject(w, r, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Handler wraps a whole router with the per-IP limit
+func Handler(next http.Handler) http.Handler {
+	return LimitByIP(next.ServeHTTP)
+}
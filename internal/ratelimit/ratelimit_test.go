@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"data-storage/internal/models"
+)
+
+func TestLimiter_AllowAndRefill(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+
+	// Bucket starts full with perMinute tokens
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("device:1", 3); !ok {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("device:1", 3)
+	if ok {
+		t.Fatal("Fourth request should be rejected")
+	}
+	if wait <= 0 || wait > 20*time.Second {
+		t.Errorf("Expected wait of up to 20s, got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("device:2", 3); !ok {
+		t.Error("Different key should not be limited")
+	}
+
+	// One token is refilled every 20 seconds at 3 per minute
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("device:1", 3); !ok {
+		t.Error("Request should be allowed after refill")
+	}
+}
+
+func TestLimiter_DisabledWhenZero(t *testing.T) {
+	l := NewLimiter()
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("user:1", 0); !ok {
+			t.Fatal("Zero limit should disable limiting")
+		}
+	}
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+
+	l.Allow("ip:10.0.0.1", 10)
+	now = now.Add(time.Hour)
+	l.Allow("ip:10.0.0.2", 10)
+	l.Cleanup(10 * time.Minute)
+
+	if _, ok := l.buckets["ip:10.0.0.1"]; ok {
+		t.Error("Idle bucket should be removed")
+	}
+	if _, ok := l.buckets["ip:10.0.0.2"]; !ok {
+		t.Error("Active bucket should be kept")
+	}
+}
+
+func TestQuotaResetTime(t *testing.T) {
+	now := time.Date(2024, 3, 31, 18, 30, 0, 0, time.UTC)
+	expected := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	if got := QuotaResetTime(now); !got.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDeviceQuota_ZeroOverrideUsesDefault(t *testing.T) {
+	Init(Config{DeviceDailyQuota: 1000})
+	t.Cleanup(func() { Init(DefaultConfig()) })
+
+	zero, custom := int64(0), int64(50)
+	for _, tc := range []struct {
+		override *int64
+		expected int64
+	}{{nil, 1000}, {&zero, 1000}, {&custom, 50}} {
+		if got := DeviceQuota(&models.Device{DailyQuota: tc.override}); got != tc.expected {
+			t.Errorf("Expected quota %d, got %d", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package series
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Functions applied to the points of a series
+const (
+	Difference    = "difference"     // Change from the previous value
+	Derivative    = "derivative"     // Change per unit of time
+	Increase      = "increase"       // Change of a counter, counting a drop as a reset to zero
+	Rate          = "rate"           // Increase per unit of time
+	Integral      = "integral"       // Cumulative area under the values, in value × unit
+	MovingAverage = "moving_average" // Mean of the last window values
+	EMA           = "ema"            // Exponential moving average with smoothing factor alpha
+)
+
+// Functions lists the supported functions
+var Functions = []string{Difference, Derivative, Increase, Rate, Integral, MovingAverage, EMA}
+
+// maxWindow limits the points of a moving average
+const maxWindow = 1000
+
+// Function transforms the values of a series
+type Function struct {
+	Name   string
+	Unit   time.Duration // Time unit of Derivative, Rate and Integral; a second when zero
+	Window int           // Points averaged by MovingAverage, or the span of EMA when Alpha is zero
+	Alpha  float64       // Smoothing factor of EMA, in (0, 1]
+}
+
+// Validate checks the function and the parameters it needs
+func (f Function) Validate() error {
+	if !slices.Contains(Functions, f.Name) {
+		return fmt.Errorf("function must be one of %s", strings.Join(Functions, ", "))
+	}
+	if f.Unit < 0 {
+		return errors.New("unit must be positive")
+	}
+	if f.Window < 0 || f.Window > maxWindow {
+		return fmt.Errorf("window must be between 1 and %d", maxWindow)
+	}
+	if f.Alpha < 0 || f.Alpha > 1 {
+		return errors.New("alpha must be greater than 0 and at most 1")
+	}
+	switch f.Name {
+	case MovingAverage:
+		if f.Window == 0 {
+			return errors.New("moving_average needs a window")
+		}
+	case EMA:
+		if f.Alpha == 0 && f.Window == 0 {
+			return errors.New("ema needs an alpha or a window")
+		}
+	}
+	return nil
+}
+
+// Apply returns the points with the function of their values. Points without a value stay
+// empty and are skipped: the next value is compared with the last one before them. Functions
+// of the change leave the first value empty.
+func (f Function) Apply(points []Point) []Point {
+	unit := f.Unit
+	if unit == 0 {
+		unit = time.Second
+	}
+	alpha := f.Alpha
+	if alpha == 0 {
+		alpha = 2 / float64(f.Window+1)
+	}
+
+	result := make([]Point, len(points))
+	copy(result, points)
+	var last *Point // Last point with a value
+	var integral, ema float64
+	var window []float64
+	for i := range points {
+		p := &points[i]
+		if p.Value == nil {
+			continue
+		}
+		v := *p.Value
+		var out *float64
+		set := func(x float64) { out = &x }
+
+		switch f.Name {
+		case Difference, Derivative, Increase, Rate:
+			if last == nil {
+				break
+			}
+			delta := v - *last.Value
+			if delta < 0 && (f.Name == Increase || f.Name == Rate) {
+				// The counter was reset and counted up from zero since
+				delta = v
+			}
+			if f.Name == Derivative || f.Name == Rate {
+				elapsed := p.Timestamp.Sub(last.Timestamp)
+				if elapsed <= 0 {
+					break
+				}
+				delta = delta * float64(unit) / float64(elapsed)
+			}
+			set(delta)
+		case Integral:
+			if last != nil {
+				// Trapezoidal rule
+				integral += (v + *last.Value) / 2 * float64(p.Timestamp.Sub(last.Timestamp)) / float64(unit)
+			}
+			set(integral)
+		case MovingAverage:
+			window = append(window, v)
+			if len(window) > f.Window {
+				window = window[1:]
+			}
+			var sum float64
+			for _, x := range window {
+				sum += x
+			}
+			set(sum / float64(len(window)))
+		case EMA:
+			if last == nil {
+				ema = v
+			} else {
+				ema = alpha*v + (1-alpha)*ema
+			}
+			set(ema)
+		}
+		result[i].Value = out
+		last = p
+	}
+	return result
+}
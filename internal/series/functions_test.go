@@ -0,0 +1,83 @@
+package series
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// counter is an energy meter read every minute, rebooted between minutes 3 and 4
+func counter() []Point {
+	return []Point{at(0, 100), at(1, 160), at(2, 220), at(3, 250), at(4, 30), at(6, 150)}
+}
+
+func near(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFunction_Apply(t *testing.T) {
+	tests := []struct {
+		f    Function
+		want []float64
+	}{
+		{Function{Name: Difference}, []float64{-1, 60, 60, 30, -220, 120}},
+		{Function{Name: Increase}, []float64{-1, 60, 60, 30, 30, 120}},
+		{Function{Name: Rate, Unit: time.Minute}, []float64{-1, 60, 60, 30, 30, 60}},
+		{Function{Name: Derivative}, []float64{-1, 1, 1, 0.5, -220.0 / 60, 1}},
+		{Function{Name: MovingAverage, Window: 2}, []float64{100, 130, 190, 235, 140, 90}},
+	}
+	for _, tt := range tests {
+		if err := tt.f.Validate(); err != nil {
+			t.Fatalf("%s: %v", tt.f.Name, err)
+		}
+		if got := values(tt.f.Apply(counter())); !near(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.f.Name, tt.want, got)
+		}
+	}
+
+	// A kilowatt over two hours, read at uneven intervals, is 2 kWh
+	power := []Point{at(0, 1), at(30, 1), at(120, 1)}
+	if got := values(Function{Name: Integral, Unit: time.Hour}.Apply(power)); !near(got, []float64{0, 0.5, 2}) {
+		t.Errorf("integral: expected 0, 0.5 and 2, got %v", got)
+	}
+
+	// Window 3 smooths with alpha 0.5
+	ema := Function{Name: EMA, Window: 3}.Apply([]Point{at(0, 0), at(1, 8), at(2, 8)})
+	if got := values(ema); !near(got, []float64{0, 4, 6}) {
+		t.Errorf("ema: expected 0, 4 and 6, got %v", got)
+	}
+}
+
+func TestFunction_ApplySkipsEmptyPoints(t *testing.T) {
+	points := Buckets([]Point{at(0, 10), at(2, 16)}, start, start.Add(3*time.Minute), time.Minute)
+	got := Function{Name: Derivative, Unit: time.Minute}.Apply(points)
+	if got[1].Value != nil || got[2].Value == nil || *got[2].Value != 3 {
+		t.Errorf("Expected the empty bucket to stay empty and the change to span it, got %v", values(got))
+	}
+	if *points[2].Value != 16 {
+		t.Error("Expected the points not to be modified")
+	}
+}
+
+func TestFunction_Validate(t *testing.T) {
+	for _, f := range []Function{
+		{Name: "median"},
+		{Name: MovingAverage},
+		{Name: MovingAverage, Window: maxWindow + 1},
+		{Name: EMA},
+		{Name: EMA, Alpha: 1.5},
+		{Name: Rate, Unit: -time.Second},
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", f)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package series shapes the values of a signal for charts: it lays aggregates on a regular
+// grid of buckets, fills the buckets and gaps without values and finds the gaps.
+package series
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Aggregates of the values in a bucket
+const (
+	Avg   = "avg"
+	Min   = "min"
+	Max   = "max"
+	Sum   = "sum"
+	Count = "count"
+)
+
+// Aggregates lists the supported aggregates
+var Aggregates = []string{Avg, Min, Max, Sum, Count}
+
+// Fill modes for buckets, or gaps, without values
+const (
+	FillNull     = "null"     // Left empty, so charts break the line
+	FillPrevious = "previous" // The last value before, holding it like a step
+	FillLinear   = "linear"   // Interpolated between the values around
+	FillConstant = "constant" // A fixed value
+)
+
+// FillModes lists the fill modes
+var FillModes = []string{FillNull, FillPrevious, FillLinear, FillConstant}
+
+// DigitalFillModes lists the fill modes of digital signals, whose states only hold
+var DigitalFillModes = []string{FillNull, FillPrevious}
+
+// Point is a value of a series, or the aggregate of a bucket starting at Timestamp. Value
+// is nil for an empty bucket or a gap left unfilled.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     *float64  `json:"value"`
+	Count     int64     `json:"count,omitempty"`  // Values aggregated in the bucket
+	Filled    bool      `json:"filled,omitempty"` // The value was filled in, not measured
+}
+
+// Gap is a span without values longer than the gap threshold
+type Gap struct {
+	Start    time.Time `json:"start"` // Time of the last value, or end of the last bucket, before the gap
+	End      time.Time `json:"end"`   // Time of the next value or bucket
+	Duration float64   `json:"duration"`
+}
+
+// Buckets lays the aggregated points on the grid of buckets of the given size from from to
+// to, adding empty points for buckets without values
+func Buckets(points []Point, from, to time.Time, size time.Duration) []Point {
+	byStart := make(map[int64]Point, len(points))
+	for _, p := range points {
+		byStart[p.Timestamp.UnixNano()] = p
+	}
+	var grid []Point
+	for start := from; start.Before(to); start = start.Add(size) {
+		p, ok := byStart[start.UnixNano()]
+		if !ok {
+			p = Point{Timestamp: start}
+		}
+		grid = append(grid, p)
+	}
+	return grid
+}
+
+// BucketCount returns the number of buckets of the given size from from to to
+func BucketCount(from, to time.Time, size time.Duration) int64 {
+	if size <= 0 || !to.After(from) {
+		return 0
+	}
+	n := int64(to.Sub(from) / size)
+	if from.Add(time.Duration(n) * size).Before(to) {
+		n++
+	}
+	return n
+}
+
+// Resample inserts empty points every threshold within the gaps between points more than
+// threshold apart, for Fill to fill in. It returns an error when that would exceed maxPoints.
+func Resample(points []Point, threshold time.Duration, maxPoints int) ([]Point, error) {
+	if threshold <= 0 || len(points) == 0 {
+		return points, nil
+	}
+	resampled := make([]Point, 0, len(points))
+	for i, p := range points {
+		if i > 0 {
+			for t := points[i-1].Timestamp.Add(threshold); t.Before(p.Timestamp); t = t.Add(threshold) {
+				resampled = append(resampled, Point{Timestamp: t})
+				if len(resampled)+len(points)-i > maxPoints {
+					return nil, fmt.Errorf("filling the gaps would return more than %d points", maxPoints)
+				}
+			}
+		}
+		resampled = append(resampled, p)
+	}
+	return resampled, nil
+}
+
+// Fill fills in the points without a value, other than measured ones, with mode. Previous
+// and linear leave points empty before the first value, and linear after the last.
+func Fill(points []Point, mode string, constant float64) error {
+	if !slices.Contains(FillModes, mode) {
+		return fmt.Errorf("fill must be one of %s", strings.Join(FillModes, ", "))
+	}
+	if mode == FillNull {
+		return nil
+	}
+	set := func(i int, v float64) {
+		points[i].Value = &v
+		points[i].Filled = true
+	}
+	last := -1 // Index of the last point with a value
+	for i, p := range points {
+		if p.Value != nil {
+			if mode == FillLinear && last >= 0 && i-last > 1 {
+				v0, v1 := *points[last].Value, *p.Value
+				span := float64(p.Timestamp.Sub(points[last].Timestamp))
+				for j := last + 1; j < i; j++ {
+					set(j, v0+(v1-v0)*float64(points[j].Timestamp.Sub(points[last].Timestamp))/span)
+				}
+			}
+			last = i
+			continue
+		}
+		if p.Count > 0 {
+			continue
+		}
+		switch mode {
+		case FillPrevious:
+			if last >= 0 {
+				set(i, *points[last].Value)
+			}
+		case FillConstant:
+			set(i, constant)
+		}
+	}
+	return nil
+}
+
+// Gaps returns the spans longer than threshold between consecutive measured points. For
+// buckets of the given size a gap starts at the end of the last bucket with values; for raw
+// values size is 0.
+func Gaps(points []Point, threshold, size time.Duration) []Gap {
+	gaps := []Gap{}
+	var last *Point
+	for i := range points {
+		p := &points[i]
+		if p.Filled || (p.Value == nil && p.Count == 0) {
+			continue
+		}
+		if last != nil {
+			start := last.Timestamp.Add(size)
+			if d := p.Timestamp.Sub(start); d > threshold {
+				gaps = append(gaps, Gap{Start: start, End: p.Timestamp, Duration: d.Seconds()})
+			}
+		}
+		last = p
+	}
+	return gaps
+}
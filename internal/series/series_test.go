@@ -0,0 +1,114 @@
+package series
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+func at(minutes int, value float64) Point {
+	return Point{Timestamp: start.Add(time.Duration(minutes) * time.Minute), Value: &value, Count: 1}
+}
+
+// values returns the values of points, with -1 for empty ones
+func values(points []Point) []float64 {
+	vs := make([]float64, len(points))
+	for i, p := range points {
+		vs[i] = -1
+		if p.Value != nil {
+			vs[i] = *p.Value
+		}
+	}
+	return vs
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuckets(t *testing.T) {
+	grid := Buckets([]Point{at(0, 1), at(3, 4)}, start, start.Add(5*time.Minute), time.Minute)
+	if got := values(grid); !equal(got, []float64{1, -1, -1, 4, -1}) {
+		t.Errorf("Expected 5 buckets with 2 values, got %v", got)
+	}
+	if n := BucketCount(start, start.Add(90*time.Second), time.Minute); n != 2 {
+		t.Errorf("Expected a partial last bucket, got %d buckets", n)
+	}
+}
+
+func TestFill(t *testing.T) {
+	grid := func() []Point {
+		return Buckets([]Point{at(1, 2), at(4, 8)}, start, start.Add(6*time.Minute), time.Minute)
+	}
+	tests := []struct {
+		mode string
+		want []float64
+	}{
+		{FillNull, []float64{-1, 2, -1, -1, 8, -1}},
+		{FillPrevious, []float64{-1, 2, 2, 2, 8, 8}},
+		{FillLinear, []float64{-1, 2, 4, 6, 8, -1}},
+		{FillConstant, []float64{0.5, 2, 0.5, 0.5, 8, 0.5}},
+	}
+	for _, tt := range tests {
+		points := grid()
+		if err := Fill(points, tt.mode, 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if got := values(points); !equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.mode, tt.want, got)
+		}
+		if tt.mode != FillNull && (!points[2].Filled || points[1].Filled) {
+			t.Errorf("%s: expected only filled points to be marked", tt.mode)
+		}
+	}
+	if err := Fill(grid(), "spline", 0); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+func TestResample(t *testing.T) {
+	points, err := Resample([]Point{at(0, 0), at(1, 1), at(5, 5)}, 90*time.Second, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty points at 2:30 and 4:00 in the gap from 1 to 5
+	if len(points) != 5 || points[2].Timestamp != start.Add(150*time.Second) || points[3].Value != nil {
+		t.Fatalf("Expected 2 points in the gap, got %+v", points)
+	}
+	Fill(points, FillLinear, 0)
+	if got := values(points); !equal(got, []float64{0, 1, 2.5, 4, 5}) {
+		t.Errorf("Expected the gap to be interpolated, got %v", got)
+	}
+
+	if _, err := Resample([]Point{at(0, 0), at(600, 1)}, time.Second, 1000); err == nil {
+		t.Error("Expected too many points to be rejected")
+	}
+}
+
+func TestGaps(t *testing.T) {
+	raw := []Point{at(0, 1), at(1, 1), at(11, 1), at(12, 1)}
+	gaps := Gaps(raw, 5*time.Minute, 0)
+	if len(gaps) != 1 || gaps[0].Start != start.Add(time.Minute) || gaps[0].Duration != 600 {
+		t.Errorf("Expected a 10 minute gap, got %+v", gaps)
+	}
+
+	// Filled buckets do not close a gap
+	grid := Buckets([]Point{at(0, 1), at(4, 1)}, start, start.Add(5*time.Minute), time.Minute)
+	Fill(grid, FillPrevious, 0)
+	gaps = Gaps(grid, 2*time.Minute, time.Minute)
+	if len(gaps) != 1 || gaps[0].Start != start.Add(time.Minute) || gaps[0].End != start.Add(4*time.Minute) {
+		t.Errorf("Expected a gap from the end of the first bucket, got %+v", gaps)
+	}
+	if gaps := Gaps(grid, 3*time.Minute, time.Minute); len(gaps) != 0 {
+		t.Errorf("Expected gaps of exactly the threshold to be left out, got %+v", gaps)
+	}
+}
@@ -0,0 +1,97 @@
+// Package signalstats describes the values of a signal over a time range: their distribution
+// and the process capability against the signal's range, taken as the specification limits.
+package signalstats
+
+import (
+	"math"
+	"time"
+)
+
+// Percentiles reported in a summary
+var Percentiles = []float64{0.5, 0.95, 0.99}
+
+// Extreme is the minimum or maximum value of a signal and when it was first reached
+type Extreme struct {
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Summary is the distribution of the values of a signal. Fields other than Count are nil
+// without values; StdDev needs at least two.
+type Summary struct {
+	Count  int64    `json:"count"`
+	Mean   *float64 `json:"mean"`
+	StdDev *float64 `json:"stddev"` // Sample standard deviation
+	Min    *Extreme `json:"min"`
+	Max    *Extreme `json:"max"`
+	P50    *float64 `json:"p50"`
+	P95    *float64 `json:"p95"`
+	P99    *float64 `json:"p99"`
+}
+
+// SetPercentiles sets P50, P95 and P99 from values in the order of Percentiles
+func (s *Summary) SetPercentiles(values []float64) {
+	fields := []**float64{&s.P50, &s.P95, &s.P99}
+	for i := range fields {
+		if i < len(values) {
+			v := values[i]
+			*fields[i] = &v
+		}
+	}
+}
+
+// Variance returns the sample variance of count values from their sum and sum of squares,
+// for databases without a variance function
+func Variance(count int64, sum, sumSquares float64) float64 {
+	if count < 2 {
+		return 0
+	}
+	n := float64(count)
+	variance := (sumSquares - sum*sum/n) / (n - 1)
+	// Rounding can make the variance of constant values slightly negative
+	return math.Max(variance, 0)
+}
+
+// Rank returns the positions of the values around percentile p of count sorted values and
+// the weight of the upper one, interpolating linearly like PostgreSQL's percentile_cont
+func Rank(count int64, p float64) (lower, upper int64, weight float64) {
+	if count == 0 {
+		return 0, 0, 0
+	}
+	position := p * float64(count-1)
+	lower = int64(math.Floor(position))
+	upper = int64(math.Ceil(position))
+	return lower, upper, position - float64(lower)
+}
+
+// Capability is the process capability of a signal against its specification limits. The
+// indices use the standard deviation of the whole range, so they are strictly the process
+// performance indices Pp and Ppk.
+type Capability struct {
+	LSL *float64 `json:"lsl"` // Lower specification limit, the signal's minimum value
+	USL *float64 `json:"usl"` // Upper specification limit, the signal's maximum value
+	Cp  *float64 `json:"cp"`  // Spread of the limits over six standard deviations; needs both limits
+	Cpk *float64 `json:"cpk"` // Distance of the mean to the nearest limit over three standard deviations
+}
+
+// NewCapability returns the capability of values with the given mean and standard deviation.
+// It returns nil without limits or when the standard deviation is zero.
+func NewCapability(mean, stdDev float64, lsl, usl *float64) *Capability {
+	if (lsl == nil && usl == nil) || stdDev <= 0 {
+		return nil
+	}
+	c := &Capability{LSL: lsl, USL: usl}
+	cpk := math.Inf(1)
+	if usl != nil {
+		cpk = (*usl - mean) / (3 * stdDev)
+	}
+	if lsl != nil {
+		cpk = math.Min(cpk, (mean-*lsl)/(3*stdDev))
+	}
+	c.Cpk = &cpk
+	if lsl != nil && usl != nil {
+		cp := (*usl - *lsl) / (6 * stdDev)
+		c.Cp = &cp
+	}
+	return c
+}
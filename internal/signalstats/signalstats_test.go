@@ -0,0 +1,69 @@
+package signalstats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVariance(t *testing.T) {
+	// 2, 4, 4, 4, 5, 5, 7, 9: sample variance 32/7
+	if v := Variance(8, 40, 232); math.Abs(v-32.0/7) > 1e-12 {
+		t.Errorf("Expected %v, got %v", 32.0/7, v)
+	}
+	if v := Variance(1, 3, 9); v != 0 {
+		t.Errorf("Expected 0 for a single value, got %v", v)
+	}
+	if v := Variance(3, 0.3, 0.03); v != 0 {
+		t.Errorf("Expected 0 for constant values, got %v", v)
+	}
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		count        int64
+		p            float64
+		lower, upper int64
+		weight       float64
+	}{
+		{5, 0.5, 2, 2, 0},
+		{4, 0.5, 1, 2, 0.5},
+		{101, 0.95, 95, 95, 0},
+		{1, 0.99, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		lower, upper, weight := Rank(tt.count, tt.p)
+		if lower != tt.lower || upper != tt.upper || math.Abs(weight-tt.weight) > 1e-9 {
+			t.Errorf("Rank(%d, %v): expected %d, %d, %v, got %d, %d, %v", tt.count, tt.p, tt.lower, tt.upper, tt.weight, lower, upper, weight)
+		}
+	}
+}
+
+func TestNewCapability(t *testing.T) {
+	lsl, usl := 10.0, 16.0
+	c := NewCapability(14, 0.5, &lsl, &usl)
+	if c == nil || c.Cp == nil || *c.Cp != 2 || c.Cpk == nil || math.Abs(*c.Cpk-4.0/3) > 1e-12 {
+		t.Fatalf("Expected Cp 2 and Cpk 1.33, got %+v", c)
+	}
+
+	// One-sided limits give Cpk only
+	c = NewCapability(14, 0.5, nil, &usl)
+	if c == nil || c.Cp != nil || c.Cpk == nil || math.Abs(*c.Cpk-4.0/3) > 1e-12 {
+		t.Errorf("Expected Cpk 1.33 without Cp, got %+v", c)
+	}
+	c = NewCapability(9, 0.5, &lsl, nil)
+	if c == nil || c.Cpk == nil || math.Abs(*c.Cpk+2.0/3) > 1e-12 {
+		t.Errorf("Expected a negative Cpk for a mean outside the limits, got %+v", c)
+	}
+
+	if NewCapability(14, 0.5, nil, nil) != nil || NewCapability(14, 0, &lsl, &usl) != nil {
+		t.Error("Expected no capability without limits or spread")
+	}
+}
+
+func TestSetPercentiles(t *testing.T) {
+	var s Summary
+	s.SetPercentiles([]float64{1, 2, 3})
+	if s.P50 == nil || *s.P50 != 1 || *s.P95 != 2 || *s.P99 != 3 {
+		t.Errorf("Expected 1, 2 and 3, got %+v", s)
+	}
+}
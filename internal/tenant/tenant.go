@@ -0,0 +1,136 @@
+package tenant
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type contextKey struct{}
+
+// WithOrganization returns a context whose database queries are scoped to the organization
+func WithOrganization(ctx context.Context, orgID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, orgID)
+}
+
+// OrganizationFrom returns the organization the context is scoped to
+func OrganizationFrom(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	orgID, ok := ctx.Value(contextKey{}).(uint)
+	return orgID, ok && orgID != 0
+}
+
+// subqueryScopes scopes tables that have no organization_id column through their parent
+var subqueryScopes = map[string]string{
+	"users":         "users.id IN (SELECT user_id FROM memberships WHERE organization_id = ?)",
+	"signal_values": "signal_values.signal_id IN (SELECT id FROM signals WHERE organization_id = ?)",
+	"device_usages": "device_usages.device_id IN (SELECT id FROM devices WHERE organization_id = ?)",
+}
+
+// Register installs callbacks that restrict queries, updates and deletes to the organization
+// in the statement context and assign it to created rows. Statements without an
+// organization in their context are left untouched.
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:scope_query", scope); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:scope_row", scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:scope_update", scope); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:scope_delete", scope); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:before_create").Register("tenant:assign", assign)
+}
+
+func scope(tx *gorm.DB) {
+	stmt := tx.Statement
+	orgID, ok := OrganizationFrom(stmt.Context)
+	if !ok || stmt.Schema == nil {
+		return
+	}
+
+	if field := stmt.Schema.LookUpField("OrganizationID"); field != nil {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: stmt.Table, Name: field.DBName}, Value: orgID},
+		}})
+		return
+	}
+	if sql, ok := subqueryScopes[stmt.Table]; ok {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: sql, Vars: []interface{}{orgID}},
+		}})
+	}
+}
+
+// assign sets OrganizationID on created rows, overriding anything sent by the client
+func assign(tx *gorm.DB) {
+	stmt := tx.Statement
+	orgID, ok := OrganizationFrom(stmt.Context)
+	if !ok || stmt.Schema == nil {
+		return
+	}
+	field := stmt.Schema.LookUpField("OrganizationID")
+	if field == nil {
+		return
+	}
+
+	set := func(value reflect.Value) {
+		if err := field.Set(stmt.Context, reflect.Indirect(value), orgID); err != nil {
+			tx.AddError(err)
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			set(stmt.ReflectValue.Index(i))
+		}
+	case reflect.Struct:
+		set(stmt.ReflectValue)
+	}
+}
+
+// Config controls organization invitations
+type Config struct {
+	InvitationTTL time.Duration `yaml:"invitation_ttl" env:"ORG_INVITATION_TTL"`
+	// InvitationURL is the accept page link sent to invitees; "{token}" is replaced with the token.
+	// When empty only the token itself is sent.
+	InvitationURL string `yaml:"invitation_url" env:"ORG_INVITATION_URL"`
+}
+
+func DefaultConfig() Config {
+	return Config{InvitationTTL: 7 * 24 * time.Hour}
+}
+
+var config = DefaultConfig()
+
+// Init sets the invitation configuration
+func Init(cfg Config) {
+	config = cfg
+}
+
+// InvitationTTL returns how long invitations stay valid
+func InvitationTTL() time.Duration {
+	return config.InvitationTTL
+}
+
+// InvitationLink returns what is sent to the invitee to accept an invitation
+func InvitationLink(token string) string {
+	if config.InvitationURL == "" {
+		return token
+	}
+	if strings.Contains(config.InvitationURL, "{token}") {
+		return strings.ReplaceAll(config.InvitationURL, "{token}", token)
+	}
+	return config.InvitationURL + token
+}
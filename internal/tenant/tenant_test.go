@@ -0,0 +1,120 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"data-storage/internal/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatalf("Error registering callbacks: %v", err)
+	}
+	err = db.AutoMigrate(&models.Organization{}, &models.Membership{}, &models.User{},
+		&models.Device{}, &models.Signal{}, &models.SignalValue{})
+	if err != nil {
+		t.Fatalf("Error migrating: %v", err)
+	}
+	return db
+}
+
+func TestCreateAssignsOrganization(t *testing.T) {
+	db := setupDB(t)
+	ctx := WithOrganization(context.Background(), 1)
+
+	// A client-supplied organization is overridden
+	other := uint(2)
+	device := models.Device{Name: "d1", AuthToken: "t1", OrganizationID: &other}
+	if err := db.WithContext(ctx).Create(&device).Error; err != nil {
+		t.Fatalf("Error creating device: %v", err)
+	}
+	if device.OrganizationID == nil || *device.OrganizationID != 1 {
+		t.Errorf("Expected organization 1, got %v", device.OrganizationID)
+	}
+
+	// Signals created without a context inherit their device's organization
+	signal := models.Signal{DeviceID: device.ID, Name: "s1"}
+	if err := db.Create(&signal).Error; err != nil {
+		t.Fatalf("Error creating signal: %v", err)
+	}
+	if signal.OrganizationID == nil || *signal.OrganizationID != 1 {
+		t.Errorf("Expected signal organization 1, got %v", signal.OrganizationID)
+	}
+}
+
+func TestQueriesAreScoped(t *testing.T) {
+	db := setupDB(t)
+	org1 := WithOrganization(context.Background(), 1)
+	org2 := WithOrganization(context.Background(), 2)
+
+	devices := []models.Device{{Name: "a", AuthToken: "ta"}, {Name: "b", AuthToken: "tb"}}
+	db.WithContext(org1).Create(&devices[0])
+	db.WithContext(org2).Create(&devices[1])
+	signal := models.Signal{DeviceID: devices[1].ID, Name: "s"}
+	db.Create(&signal)
+	db.Create(&models.SignalValue{SignalID: signal.ID})
+
+	user := models.User{Name: "u", Rfid: "r1"}
+	db.Create(&user)
+	db.Create(&models.Membership{OrganizationID: 2, UserID: user.ID, Role: models.RoleMember})
+
+	tests := []struct {
+		name  string
+		model interface{}
+		org1  int64
+		org2  int64
+	}{
+		{"devices", &models.Device{}, 1, 1},
+		{"signals", &models.Signal{}, 0, 1},
+		{"signal values", &models.SignalValue{}, 0, 1},
+		{"users", &models.User{}, 0, 1},
+	}
+	for _, tt := range tests {
+		var n1, n2 int64
+		db.WithContext(org1).Model(tt.model).Count(&n1)
+		db.WithContext(org2).Model(tt.model).Count(&n2)
+		if n1 != tt.org1 || n2 != tt.org2 {
+			t.Errorf("%s: expected %d/%d, got %d/%d", tt.name, tt.org1, tt.org2, n1, n2)
+		}
+	}
+
+	// Statements without an organization are not scoped
+	var total int64
+	db.Model(&models.Device{}).Count(&total)
+	if total != 2 {
+		t.Errorf("Expected 2 devices unscoped, got %d", total)
+	}
+
+	// Updates and deletes cannot reach other organizations
+	result := db.WithContext(org1).Delete(&models.Device{}, devices[1].ID)
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Errorf("Expected cross-organization delete to affect nothing, got %d (%v)", result.RowsAffected, result.Error)
+	}
+	result = db.WithContext(org1).Model(&models.Signal{}).Where("id = ?", signal.ID).Update("name", "x")
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Errorf("Expected cross-organization update to affect nothing, got %d (%v)", result.RowsAffected, result.Error)
+	}
+}
+
+func TestInvitationLink(t *testing.T) {
+	defer Init(config)
+
+	Init(Config{})
+	if got := InvitationLink("abc"); got != "abc" {
+		t.Errorf("Expected bare token, got %q", got)
+	}
+	Init(Config{InvitationURL: "https://app/invite?token={token}"})
+	if got := InvitationLink("abc"); got != "https://app/invite?token=abc" {
+		t.Errorf("Unexpected link %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Field error codes
+const (
+	CodeRequired = "required"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeTooSmall = "too_small"
+	CodeTooLarge = "too_large"
+	CodeEmail    = "invalid_email"
+	CodeOneOf    = "not_allowed"
+	CodeInvalid  = "invalid"
+)
+
+// FieldError describes why one request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors collects every invalid field of a request
+type Errors []FieldError
+
+// Add records an error for a field; used for checks that cannot be expressed as tags
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Error joins the field messages
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator is implemented by requests with rules that cannot be expressed as tags, such
+// as rules involving several fields. Struct calls it after checking the tags.
+type Validator interface {
+	Validate(errs *Errors)
+}
+
+// Struct checks the `validate` tags of a struct (or pointer to struct) and returns all
+// violations. Fields are reported by their JSON name. Supported rules, separated by commas:
+//
+//	required      the value must not be zero (nil, "", 0, false)
+//	min=N, max=N  length for strings and slices, value for numbers
+//	email         the string must be an email address
+//	oneof=a b c   the value must be one of the space-separated options
+//
+// Rules other than required are skipped for zero values, so optional fields are only
+// checked when they are set. Nested structs are not validated.
+//
+// required lists additional JSON fields that must be set, for types shared by requests with
+// different required fields (e.g. a model decoded on create and on partial update).
+func Struct(v interface{}, required ...string) Errors {
+	errs := checkTags(v, required)
+	if validator, ok := v.(Validator); ok {
+		validator.Validate(&errs)
+	}
+	return errs
+}
+
+func checkTags(v interface{}, required []string) Errors {
+	var errs Errors
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errs
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errs
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonName(field)
+		tag := field.Tag.Get("validate")
+		isRequired := hasRule(tag, "required") || contains(required, name)
+		if tag == "" && !isRequired {
+			continue
+		}
+
+		value := rv.Field(i)
+		if value.IsZero() {
+			if isRequired {
+				errs.Add(name, CodeRequired, name+" is required")
+			}
+			continue
+		}
+		for value.Kind() == reflect.Pointer {
+			value = value.Elem()
+		}
+
+		if tag == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if fe, ok := check(name, value, rule); !ok {
+				errs = append(errs, fe)
+			}
+		}
+	}
+	return errs
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func hasRule(tag, rule string) bool {
+	return contains(strings.Split(tag, ","), rule)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func check(name string, value reflect.Value, rule string) (FieldError, bool) {
+	key, arg, _ := strings.Cut(rule, "=")
+	switch key {
+	case "required":
+		return FieldError{}, true
+
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: invalid %s rule %q on %s", key, rule, name))
+		}
+		size, isLength := measure(value)
+		unit := "items"
+		if value.Kind() == reflect.String {
+			unit = "characters"
+		}
+		switch {
+		case key == "min" && size < limit && isLength:
+			return FieldError{name, CodeTooShort, fmt.Sprintf("%s must have at least %s %s", name, arg, unit)}, false
+		case key == "max" && size > limit && isLength:
+			return FieldError{name, CodeTooLong, fmt.Sprintf("%s must have at most %s %s", name, arg, unit)}, false
+		case key == "min" && size < limit:
+			return FieldError{name, CodeTooSmall, fmt.Sprintf("%s must be at least %s", name, arg)}, false
+		case key == "max" && size > limit:
+			return FieldError{name, CodeTooLarge, fmt.Sprintf("%s must be at most %s", name, arg)}, false
+		}
+		return FieldError{}, true
+
+	case "email":
+		s := value.String()
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			return FieldError{name, CodeEmail, name + " must be a valid email address"}, false
+		}
+		return FieldError{}, true
+
+	case "oneof":
+		options := strings.Fields(arg)
+		s := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if s == option {
+				return FieldError{}, true
+			}
+		}
+		return FieldError{name, CodeOneOf, fmt.Sprintf("%s must be one of %s", name, strings.Join(options, ", "))}, false
+	}
+	panic(fmt.Sprintf("validate: unknown rule %q on %s", rule, name))
+}
+
+// measure returns the length of strings and slices (isLength) or the value of numbers
+func measure(value reflect.Value) (size float64, isLength bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false
+	}
+	return 0, false
+}
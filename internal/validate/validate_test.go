@@ -0,0 +1,77 @@
+package validate
+
+import (
+	"testing"
+)
+
+type testRequest struct {
+	Name     string   `json:"name" validate:"required,max=5"`
+	Email    string   `json:"email" validate:"email"`
+	Role     string   `json:"role" validate:"oneof=admin member"`
+	Limit    *int     `json:"limit" validate:"min=0,max=10"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Password string   `json:"password"`
+	Note     string   `json:"note,omitempty"`
+}
+
+func (req *testRequest) Validate(errs *Errors) {
+	if req.Email != "" && req.Password == "" {
+		errs.Add("password", CodeRequired, "password is required when email is set")
+	}
+}
+
+func codes(errs Errors) map[string]string {
+	m := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		m[fe.Field] = fe.Code
+	}
+	return m
+}
+
+func TestStruct_ReportsAllErrors(t *testing.T) {
+	limit := -1
+	errs := Struct(&testRequest{
+		Email: "not an email",
+		Role:  "owner",
+		Limit: &limit,
+		Tags:  []string{"a", "b", "c"},
+	})
+
+	want := map[string]string{
+		"name":     CodeRequired,
+		"email":    CodeEmail,
+		"role":     CodeOneOf,
+		"limit":    CodeTooSmall,
+		"tags":     CodeTooLong,
+		"password": CodeRequired,
+	}
+	got := codes(errs)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d errors, got %v", len(want), errs)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("Expected %s for %s, got %q", code, field, got[field])
+		}
+	}
+}
+
+func TestStruct_OptionalFieldsSkippedWhenEmpty(t *testing.T) {
+	zero := 0
+	errs := Struct(&testRequest{Name: "abc", Limit: &zero})
+	if len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+
+	errs = Struct(&testRequest{Name: "abcdef", Email: "user@example.com", Password: "x"})
+	if got := codes(errs); len(got) != 1 || got["name"] != CodeTooLong {
+		t.Errorf("Expected only a too_long error for name, got %v", errs)
+	}
+}
+
+func TestStruct_RequiredFieldsArgument(t *testing.T) {
+	errs := Struct(&testRequest{Name: "abc"}, "note")
+	if got := codes(errs); len(got) != 1 || got["note"] != CodeRequired {
+		t.Errorf("Expected note to be required, got %v", errs)
+	}
+}
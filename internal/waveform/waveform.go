@@ -0,0 +1,245 @@
+// Package waveform stores and analyses array signal values, e.g. the torque curve of one
+// tightening: samples taken at a fixed interval.
+package waveform
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// formatXORFlate is the only encoding: the IEEE 754 bits of each sample XORed with those
+// of the previous sample, little-endian, compressed with DEFLATE
+const formatXORFlate = 1
+
+// Encode returns the compact binary form of the samples. Consecutive samples of a smooth
+// curve share their sign, exponent and leading mantissa bits, so their XOR is mostly zero
+// bytes and compresses well.
+func Encode(samples []float64) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(formatXORFlate)
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 8*len(samples))
+	var prev uint64
+	for i, sample := range samples {
+		bits := math.Float64bits(sample)
+		binary.LittleEndian.PutUint64(raw[8*i:], bits^prev)
+		prev = bits
+	}
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode returns the samples of data produced by Encode
+func Decode(data []byte) ([]float64, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty waveform data")
+	}
+	if data[0] != formatXORFlate {
+		return nil, fmt.Errorf("unknown waveform format %d", data[0])
+	}
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(data[1:])))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing waveform: %w", err)
+	}
+	if len(raw)%8 != 0 {
+		return nil, errors.New("truncated waveform data")
+	}
+	samples := make([]float64, len(raw)/8)
+	var prev uint64
+	for i := range samples {
+		bits := binary.LittleEndian.Uint64(raw[8*i:]) ^ prev
+		samples[i] = math.Float64frombits(bits)
+		prev = bits
+	}
+	return samples, nil
+}
+
+// Stats summarizes a waveform. Offsets are seconds from the first sample.
+type Stats struct {
+	Samples    int     `json:"samples"`
+	Duration   float64 `json:"duration"` // Seconds from the first to the last sample
+	Peak       float64 `json:"peak"`     // Largest sample
+	PeakOffset float64 `json:"peak_offset"`
+	Min        float64 `json:"min"`
+	MinOffset  float64 `json:"min_offset"`
+	Mean       float64 `json:"mean"`
+	Final      float64 `json:"final"` // Last sample
+	Area       float64 `json:"area"`  // Integral over time by the trapezoidal rule, in unit-seconds
+}
+
+// Compute returns the statistics of the samples taken every interval seconds
+func Compute(samples []float64, interval float64) Stats {
+	if len(samples) == 0 {
+		return Stats{}
+	}
+	stats := Stats{
+		Samples:  len(samples),
+		Duration: float64(len(samples)-1) * interval,
+		Peak:     samples[0],
+		Min:      samples[0],
+		Final:    samples[len(samples)-1],
+	}
+	var sum float64
+	for i, sample := range samples {
+		sum += sample
+		if sample > stats.Peak {
+			stats.Peak, stats.PeakOffset = sample, float64(i)*interval
+		}
+		if sample < stats.Min {
+			stats.Min, stats.MinOffset = sample, float64(i)*interval
+		}
+		if i > 0 {
+			stats.Area += (samples[i-1] + sample) / 2 * interval
+		}
+	}
+	stats.Mean = sum / float64(len(samples))
+	return stats
+}
+
+// Point is a sample, or the representative of a bucket of samples, at an offset in seconds
+// from the first sample
+type Point struct {
+	Offset float64 `json:"offset"`
+	Value  float64 `json:"value"`
+}
+
+// Downsampling methods
+const (
+	LTTB    = "lttb"    // Largest-Triangle-Three-Buckets, keeps the visual shape
+	MinMax  = "minmax"  // The minimum and maximum of each bucket, keeps the peaks
+	Average = "average" // The mean of each bucket
+)
+
+// Methods lists the downsampling methods
+var Methods = []string{LTTB, MinMax, Average}
+
+// Downsample reduces the samples to at most maxPoints points. All samples are returned when
+// there are not more than maxPoints, or maxPoints is 0.
+func Downsample(samples []float64, interval float64, maxPoints int, method string) ([]Point, error) {
+	if maxPoints < 0 {
+		return nil, errors.New("the number of points must not be negative")
+	}
+	if maxPoints == 0 || len(samples) <= maxPoints {
+		points := make([]Point, len(samples))
+		for i, sample := range samples {
+			points[i] = Point{float64(i) * interval, sample}
+		}
+		return points, nil
+	}
+
+	switch method {
+	case LTTB, "":
+		if maxPoints < 3 {
+			return nil, errors.New("lttb needs at least 3 points")
+		}
+		return lttb(samples, interval, maxPoints), nil
+	case MinMax:
+		if maxPoints < 2 {
+			return nil, errors.New("minmax needs at least 2 points")
+		}
+		return minMax(samples, interval, maxPoints/2), nil
+	case Average:
+		return average(samples, interval, maxPoints), nil
+	}
+	return nil, fmt.Errorf("unknown method %q", method)
+}
+
+// bucket returns the bounds of bucket i of n over length samples
+func bucket(i, n, length int) (start, end int) {
+	return i * length / n, (i + 1) * length / n
+}
+
+// lttb keeps the first and last samples and, from each bucket in between, the sample
+// forming the largest triangle with the previously kept sample and the next bucket's mean
+func lttb(samples []float64, interval float64, maxPoints int) []Point {
+	points := make([]Point, 0, maxPoints)
+	points = append(points, Point{0, samples[0]})
+
+	inner := samples[1 : len(samples)-1]
+	buckets := maxPoints - 2
+	kept := 0 // Index of the last kept sample
+	for b := 0; b < buckets; b++ {
+		start, end := bucket(b, buckets, len(inner))
+
+		// Mean of the next bucket, or the last sample after the final bucket
+		nextX, nextY := float64(len(samples)-1), samples[len(samples)-1]
+		if b+1 < buckets {
+			nextStart, nextEnd := bucket(b+1, buckets, len(inner))
+			nextX, nextY = 0, 0
+			for i := nextStart; i < nextEnd; i++ {
+				nextX += float64(i + 1)
+				nextY += inner[i]
+			}
+			nextX /= float64(nextEnd - nextStart)
+			nextY /= float64(nextEnd - nextStart)
+		}
+
+		best, bestArea := start, -1.0
+		for i := start; i < end; i++ {
+			x := float64(i + 1)
+			area := math.Abs((float64(kept)-nextX)*(inner[i]-samples[kept]) - (float64(kept)-x)*(nextY-samples[kept]))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		kept = best + 1
+		points = append(points, Point{float64(kept) * interval, samples[kept]})
+	}
+
+	last := len(samples) - 1
+	return append(points, Point{float64(last) * interval, samples[last]})
+}
+
+// minMax keeps the minimum and maximum of each bucket, in the order they occur
+func minMax(samples []float64, interval float64, buckets int) []Point {
+	points := make([]Point, 0, 2*buckets)
+	for b := 0; b < buckets; b++ {
+		start, end := bucket(b, buckets, len(samples))
+		lo, hi := start, start
+		for i := start + 1; i < end; i++ {
+			if samples[i] < samples[lo] {
+				lo = i
+			}
+			if samples[i] > samples[hi] {
+				hi = i
+			}
+		}
+		first, second := lo, hi
+		if hi < lo {
+			first, second = hi, lo
+		}
+		points = append(points, Point{float64(first) * interval, samples[first]})
+		if second != first {
+			points = append(points, Point{float64(second) * interval, samples[second]})
+		}
+	}
+	return points
+}
+
+// average replaces each bucket with its mean at the bucket's mean offset
+func average(samples []float64, interval float64, buckets int) []Point {
+	points := make([]Point, 0, buckets)
+	for b := 0; b < buckets; b++ {
+		start, end := bucket(b, buckets, len(samples))
+		var sum float64
+		for i := start; i < end; i++ {
+			sum += samples[i]
+		}
+		n := float64(end - start)
+		points = append(points, Point{float64(start+end-1) / 2 * interval, sum / n})
+	}
+	return points
+}
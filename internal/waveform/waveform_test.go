@@ -0,0 +1,126 @@
+package waveform
+
+import (
+	"math"
+	"testing"
+)
+
+// torque returns a tightening curve: a ramp to a sharp peak of 40 at 80% of the samples,
+// followed by the relaxation after the tool stops
+func torque(n int) []float64 {
+	samples := make([]float64, n)
+	peak := n * 8 / 10
+	for i := range samples {
+		if i <= peak {
+			samples[i] = math.Round(40*math.Pow(float64(i)/float64(peak), 2)*1000) / 1000
+		} else {
+			samples[i] = 5 + math.Round(30*math.Exp(-float64(i-peak)/10)*1000)/1000
+		}
+	}
+	return samples
+}
+
+func TestEncodeDecode(t *testing.T) {
+	samples := torque(5000)
+	samples[10] = math.Inf(1)
+	samples[11] = math.Copysign(0, -1)
+
+	data, err := Encode(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= 8*len(samples) {
+		t.Errorf("Expected less than %d bytes, got %d", 8*len(samples), len(data))
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(decoded))
+	}
+	for i := range samples {
+		if math.Float64bits(decoded[i]) != math.Float64bits(samples[i]) {
+			t.Fatalf("Sample %d: expected %v, got %v", i, samples[i], decoded[i])
+		}
+	}
+
+	if empty, err := Encode(nil); err != nil {
+		t.Error(err)
+	} else if decoded, err := Decode(empty); err != nil || len(decoded) != 0 {
+		t.Errorf("Expected no samples, got %v (%v)", decoded, err)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, data := range [][]byte{nil, {2, 0}, {formatXORFlate, 0xff, 0xff}} {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("Expected an error for %v", data)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	stats := Compute([]float64{0, 2, 4, 3, 1}, 0.5)
+	want := Stats{Samples: 5, Duration: 2, Peak: 4, PeakOffset: 1, Min: 0, MinOffset: 0, Mean: 2, Final: 1, Area: 4.75}
+	if stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	if stats := Compute(nil, 1); stats != (Stats{}) {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	samples := torque(1000)
+	peak := 0
+	for i, sample := range samples {
+		if sample > samples[peak] {
+			peak = i
+		}
+	}
+
+	all, err := Downsample(samples[:10], 0.01, 0, "")
+	if err != nil || len(all) != 10 || all[9].Offset != 0.09 {
+		t.Errorf("Expected every sample, got %v (%v)", all, err)
+	}
+
+	for _, method := range Methods {
+		points, err := Downsample(samples, 0.001, 100, method)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if len(points) == 0 || len(points) > 100 {
+			t.Errorf("%s: expected at most 100 points, got %d", method, len(points))
+		}
+		for i := 1; i < len(points); i++ {
+			if points[i].Offset <= points[i-1].Offset {
+				t.Errorf("%s: offsets are not increasing at point %d", method, i)
+				break
+			}
+		}
+		if method == Average {
+			continue
+		}
+		// LTTB and min-max keep the peak
+		found := false
+		for _, p := range points {
+			found = found || p.Value == samples[peak]
+		}
+		if !found {
+			t.Errorf("%s: the peak %v was dropped", method, samples[peak])
+		}
+	}
+
+	points, _ := Downsample(samples, 0.001, 100, LTTB)
+	if points[0].Offset != 0 || points[len(points)-1].Offset != 0.999 {
+		t.Errorf("Expected LTTB to keep the first and last samples, got %v and %v", points[0], points[len(points)-1])
+	}
+
+	if _, err := Downsample(samples, 0.001, 100, "median"); err == nil {
+		t.Error("Expected an unknown method to be rejected")
+	}
+	if _, err := Downsample(samples, 0.001, 2, LTTB); err == nil {
+		t.Error("Expected LTTB to need 3 points")
+	}
+}
@@ -0,0 +1,15 @@
+-- Per-device rate limit and daily quota overrides
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS rate_limit_per_minute INTEGER;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS daily_quota BIGINT;
+
+-- Daily ingestion usage per device (day is a UTC date formatted YYYY-MM-DD)
+CREATE TABLE IF NOT EXISTS device_usages (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    day VARCHAR(10) NOT NULL,
+    value_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_usage_day ON device_usages(device_id, day);
@@ -0,0 +1,64 @@
+-- Multi-tenant organizations: users join organizations through memberships,
+-- devices and signals belong to exactly one organization
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member', 'viewer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_membership_org_user ON memberships(organization_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships(user_id);
+
+-- Invitations by email (only the SHA-256 hash of the token is stored)
+CREATE TABLE IF NOT EXISTS org_invitations (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_invitations_organization_id ON org_invitations(organization_id);
+CREATE INDEX IF NOT EXISTS idx_org_invitations_email ON org_invitations(email);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+ALTER TABLE signals ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS organization_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_devices_organization_id ON devices(organization_id);
+CREATE INDEX IF NOT EXISTS idx_signals_organization_id ON signals(organization_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_organization_id ON audit_logs(organization_id);
+
+-- Move existing data into a default organization (only on first migration)
+DO $$
+DECLARE
+    default_org INTEGER;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM organizations) THEN
+        INSERT INTO organizations (name, slug) VALUES ('Default', 'default') RETURNING id INTO default_org;
+
+        UPDATE devices SET organization_id = default_org WHERE organization_id IS NULL;
+        UPDATE signals SET organization_id =
+            (SELECT organization_id FROM devices WHERE devices.id = signals.device_id)
+            WHERE organization_id IS NULL;
+
+        INSERT INTO memberships (organization_id, user_id, role)
+            SELECT default_org, id, 'admin' FROM users;
+    END IF;
+END $$;
@@ -0,0 +1,21 @@
+-- Client certificates authenticating devices over mutual TLS, identified by the
+-- SHA-256 fingerprint of their DER encoding
+CREATE TABLE IF NOT EXISTS device_certificates (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    organization_id INTEGER REFERENCES organizations(id),
+    fingerprint VARCHAR(64) NOT NULL,
+    subject TEXT,
+    issuer TEXT,
+    serial_number TEXT,
+    issued BOOLEAN NOT NULL DEFAULT FALSE,
+    not_before TIMESTAMPTZ,
+    not_after TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    revocation_reason TEXT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_certificates_fingerprint ON device_certificates(fingerprint);
+CREATE INDEX IF NOT EXISTS idx_device_certificates_device_id ON device_certificates(device_id);
+CREATE INDEX IF NOT EXISTS idx_device_certificates_organization_id ON device_certificates(organization_id);
@@ -0,0 +1,34 @@
+-- RFID badge scans at devices, including rejected ones
+CREATE TABLE IF NOT EXISTS badge_scans (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    organization_id INTEGER REFERENCES organizations(id),
+    rfid TEXT NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    result VARCHAR(20) NOT NULL,
+    session_id INTEGER,
+    scanned_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_badge_scans_device_id ON badge_scans(device_id);
+CREATE INDEX IF NOT EXISTS idx_badge_scans_organization_id ON badge_scans(organization_id);
+CREATE INDEX IF NOT EXISTS idx_badge_scans_user_id ON badge_scans(user_id);
+CREATE INDEX IF NOT EXISTS idx_badge_scans_scanned_at ON badge_scans(scanned_at);
+
+-- Operators badged in at devices; a device has at most one open session
+CREATE TABLE IF NOT EXISTS operator_sessions (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    organization_id INTEGER REFERENCES organizations(id),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ,
+    end_reason VARCHAR(20),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_operator_sessions_device_id ON operator_sessions(device_id);
+CREATE INDEX IF NOT EXISTS idx_operator_sessions_organization_id ON operator_sessions(organization_id);
+CREATE INDEX IF NOT EXISTS idx_operator_sessions_user_id ON operator_sessions(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_operator_sessions_open ON operator_sessions(device_id) WHERE ended_at IS NULL;
@@ -0,0 +1,9 @@
+-- Waveform signals: array values such as the torque curve of one tightening
+ALTER TABLE signals DROP CONSTRAINT IF EXISTS signals_signal_type_check;
+ALTER TABLE signals DROP CONSTRAINT IF EXISTS chk_signals_signal_type;
+ALTER TABLE signals DROP CONSTRAINT IF EXISTS chk_signals_signal_type_v2;
+ALTER TABLE signals ADD CONSTRAINT chk_signals_signal_type_v2 CHECK (signal_type IN ('digital', 'analogic', 'waveform'));
+
+-- Samples are float64s XORed with their predecessor and DEFLATE-compressed, see internal/waveform
+ALTER TABLE signal_values ADD COLUMN IF NOT EXISTS samples BYTEA;
+ALTER TABLE signal_values ADD COLUMN IF NOT EXISTS sample_interval DOUBLE PRECISION;
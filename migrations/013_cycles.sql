@@ -0,0 +1,22 @@
+-- Assembly cycles of stations, the basis of OEE reports
+CREATE TABLE IF NOT EXISTS cycles (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    organization_id INTEGER REFERENCES organizations(id),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ NOT NULL,
+    cycle_time DOUBLE PRECISION NOT NULL,
+    target_cycle_time DOUBLE PRECISION,
+    set_value DOUBLE PRECISION,
+    value DOUBLE PRECISION,
+    motion_waste DOUBLE PRECISION,
+    result VARCHAR(10) NOT NULL CHECK (result IN ('pass', 'fail')),
+    metadata JSONB,
+    created_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_cycles_device_started ON cycles(device_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_cycles_organization_id ON cycles(organization_id);
+CREATE INDEX IF NOT EXISTS idx_cycles_user_id ON cycles(user_id);
+CREATE INDEX IF NOT EXISTS idx_cycles_result ON cycles(result);
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AuditFilter narrows audit log queries; zero fields are ignored. Entries are returned
+// newest first.
+type AuditFilter struct {
+	ActorType    string // "user", "device" or "anonymous"
+	ActorID      uint
+	Action       string
+	ResourceType string
+	ResourceID   uint
+	From         time.Time // Inclusive
+	To           time.Time // Inclusive
+	Limit        int       // Page size; the API defaults to 100 and allows up to 1000
+	Offset       int
+}
+
+func (f AuditFilter) query() url.Values {
+	q := url.Values{}
+	setString(q, "actor_type", f.ActorType)
+	setUint(q, "actor_id", f.ActorID)
+	setString(q, "action", f.Action)
+	setString(q, "resource_type", f.ResourceType)
+	setUint(q, "resource_id", f.ResourceID)
+	setTime(q, "from_date", f.From)
+	setTime(q, "to_date", f.To)
+	setInt(q, "limit", f.Limit)
+	setInt(q, "offset", f.Offset)
+	return q
+}
+
+// ListAuditLogs returns one page of audit entries; see AuditLogs to iterate over all.
+// Requires the organization admin role.
+func (c *Client) ListAuditLogs(ctx context.Context, filter AuditFilter) ([]AuditLog, error) {
+	return list[AuditLog](ctx, c, request{method: http.MethodGet, path: "/audit", query: filter.query()})
+}
+
+// AuditLogs iterates over every audit entry matching the filter. Iteration stops at the
+// first error.
+func (c *Client) AuditLogs(ctx context.Context, filter AuditFilter) iter.Seq2[AuditLog, error] {
+	return paginate(filter.Limit, maxAuditPerPage, filter.Offset, func(limit, offset int) ([]AuditLog, error) {
+		filter.Limit, filter.Offset = limit, offset
+		return c.ListAuditLogs(ctx, filter)
+	}, func(entry AuditLog) uint { return entry.ID })
+}
+
+// VerifyAuditLog checks the audit hash chain. Requires the organization admin role.
+func (c *Client) VerifyAuditLog(ctx context.Context) (*AuditVerifyResult, error) {
+	return call[AuditVerifyResult](ctx, c, request{method: http.MethodGet, path: "/audit/verify"})
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Login authenticates as a user. The credentials are kept so the client can log in again
+// when the token expires. organizationID selects the active organization; 0 uses the
+// user's oldest one.
+func (c *Client) Login(ctx context.Context, email, password string, organizationID uint) (*LoginResponse, error) {
+	resp, err := c.login(ctx, LoginRequest{Email: email, Password: password, OrganizationID: organizationID})
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.credentials = &credentials{email: email, password: password, organizationID: resp.organizationID()}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *Client) login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
+	var resp LoginResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: "/auth/login", body: req, out: &resp, public: true})
+	if err != nil {
+		return nil, err
+	}
+	c.useToken(&resp)
+	return &resp, nil
+}
+
+// useToken switches to the token of a login response, keeping its organization for
+// later logins
+func (c *Client) useToken(resp *LoginResponse) {
+	c.setToken(resp.Token)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.credentials != nil {
+		c.credentials.organizationID = resp.organizationID()
+	}
+}
+
+func (resp *LoginResponse) organizationID() uint {
+	if resp.Organization == nil {
+		return 0
+	}
+	return resp.Organization.ID
+}
+
+// SwitchOrganization switches the client to another organization of the current user
+func (c *Client) SwitchOrganization(ctx context.Context, organizationID uint) (*LoginResponse, error) {
+	var resp LoginResponse
+	body := map[string]uint{"organization_id": organizationID}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/switch-org", body: body, out: &resp}); err != nil {
+		return nil, err
+	}
+	c.useToken(&resp)
+	return &resp, nil
+}
+
+// AcceptInvitation joins an organization and switches the client to it
+func (c *Client) AcceptInvitation(ctx context.Context, req AcceptInvitationRequest) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/accept-invitation", body: req, out: &resp, public: true}); err != nil {
+		return nil, err
+	}
+	c.useToken(&resp)
+	return &resp, nil
+}
+
+// ChangePassword changes the current user's password. A client logged in with
+// credentials uses the new password for later logins.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	body := map[string]string{"current_password": currentPassword, "new_password": newPassword}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/change-password", body: body}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.credentials != nil {
+		c.credentials.password = newPassword
+	}
+	return nil
+}
+
+// ForgotPassword asks for a password reset email. It succeeds whether or not the email
+// belongs to a user.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	body := map[string]string{"email": email}
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/forgot-password", body: body, public: true})
+}
+
+// ResetPassword sets a new password with the token of a reset email
+func (c *Client) ResetPassword(ctx context.Context, token, newPassword string) error {
+	body := map[string]string{"token": token, "new_password": newPassword}
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/reset-password", body: body, public: true})
+}
+
+// RegisterDevice creates a device and returns its auth token, for use with WithDeviceToken
+func (c *Client) RegisterDevice(ctx context.Context, req RegisterDeviceRequest) (*RegisterDeviceResponse, error) {
+	var resp RegisterDeviceResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/auth/register-device", body: req, out: &resp}); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Healthy calls the liveness probe
+func (c *Client) Healthy(ctx context.Context) (*Health, error) {
+	var health Health
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/healthz", out: &health, public: true}); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Ready calls the readiness probe; it fails while the API cannot serve requests
+func (c *Client) Ready(ctx context.Context) (*Health, error) {
+	var health Health
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/readyz", out: &health, public: true, noRetry: true}); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned by Add after Close
+var ErrBatcherClosed = errors.New("client: batcher closed")
+
+// ErrBufferFull is returned by Add when MaxBuffered values are waiting, e.g. while the API
+// is unreachable. The caller decides whether to drop or keep the value.
+var ErrBufferFull = errors.New("client: batch buffer full")
+
+// BatchOptions configures a Batcher. Zero fields use the defaults.
+type BatchOptions struct {
+	Size        int                                // Values buffered before they are sent (default 100)
+	Interval    time.Duration                      // Longest time a value waits to be sent (default 1s)
+	Concurrency int                                // Values sent in parallel (default 4)
+	MaxBuffered int                                // Values held before Add fails (default 10 × Size)
+	OnError     func(value SignalValue, err error) // Called for every value that could not be stored
+}
+
+// Batcher buffers signal values and sends them in the background, for gateways that
+// read many signals. Values are sent when Size are buffered, every Interval, and on
+// Flush or Close. Each value is still a separate request with the client's retries.
+type Batcher struct {
+	client *Client
+	opts   BatchOptions
+	ctx    context.Context
+
+	mu      sync.Mutex
+	buffer  []SignalValue
+	closed  bool
+	flushMu sync.Mutex // One flush at a time keeps requests within Concurrency
+	full    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewBatcher starts a batcher. Background sends use ctx; cancel it or call Close to stop.
+func (c *Client) NewBatcher(ctx context.Context, opts BatchOptions) *Batcher {
+	if opts.Size <= 0 {
+		opts.Size = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.MaxBuffered <= 0 {
+		opts.MaxBuffered = 10 * opts.Size
+	}
+
+	b := &Batcher{
+		client:  c,
+		opts:    opts,
+		ctx:     ctx,
+		full:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add buffers a value to be sent
+func (b *Batcher) Add(value SignalValue) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBatcherClosed
+	}
+	if len(b.buffer) >= b.opts.MaxBuffered {
+		return ErrBufferFull
+	}
+	b.buffer = append(b.buffer, value)
+	if len(b.buffer) >= b.opts.Size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Buffered returns the number of values waiting to be sent
+func (b *Batcher) Buffered() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.buffer)
+}
+
+// Flush sends the buffered values now. It returns the errors of the values that could not
+// be stored, which are also passed to OnError.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	values := b.buffer
+	b.buffer = nil
+	b.mu.Unlock()
+	if len(values) == 0 {
+		return nil
+	}
+
+	var (
+		errsMu sync.Mutex
+		errs   []error
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, b.opts.Concurrency)
+	for _, value := range values {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(value SignalValue) {
+			defer func() { <-sem; wg.Done() }()
+			if _, err := b.client.CreateSignalValue(ctx, value); err != nil {
+				if b.opts.OnError != nil {
+					b.opts.OnError(value, err)
+				}
+				errsMu.Lock()
+				errs = append(errs, fmt.Errorf("signal %d at %s: %w", value.SignalID, value.Timestamp.Format(time.RFC3339), err))
+				errsMu.Unlock()
+			}
+		}(value)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close stops the background sends and flushes the remaining values
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	<-b.stopped
+	return b.Flush(ctx)
+}
+
+func (b *Batcher) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		// Errors are reported through OnError
+		b.Flush(b.ctx)
+	}
+}
@@ -0,0 +1,441 @@
+// Package client is the Go client for the data storage API.
+//
+// A client authenticates either as a user or as a device:
+//
+//	c := client.New("https://api.example.com", client.WithCredentials("ops@example.com", "secret"))
+//	devices, err := c.ListDevices(ctx, client.DeviceFilter{})
+//
+//	gw := client.New("https://api.example.com", client.WithDeviceToken(token))
+//	_, err = gw.CreateSignalValue(ctx, client.SignalValue{SignalID: 7, Value: &v})
+//
+// With credentials, the client logs in on first use and again shortly before the token
+// expires or when the API rejects it. Idempotent requests are retried with exponential
+// backoff on network errors, rate limiting and unavailability; creates are only retried
+// when the API rejected them before processing (rate limiting).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshMargin is how long before expiry a user token is renewed
+const refreshMargin = time.Minute
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per request, including the first; 1 disables retries
+	BaseDelay   time.Duration // Delay before the first retry, doubled on every retry
+	MaxDelay    time.Duration // Upper bound of a delay; longer Retry-After waits are not retried
+}
+
+// DefaultRetryPolicy is used unless WithRetry is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+	userAgent  string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time // Zero when unknown (device tokens)
+	credentials *credentials
+
+	loginMu sync.Mutex // Serializes logins so concurrent requests share one new token
+}
+
+// credentials are kept to log in again when the user token expires
+type credentials struct {
+	email          string
+	password       string
+	organizationID uint
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithCredentials makes the client log in as a user and renew its token as needed
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.credentials = &credentials{email: email, password: password}
+	}
+}
+
+// WithToken authenticates with an existing user token. It is not renewed.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.setToken(token)
+	}
+}
+
+// WithDeviceToken authenticates as a device, for ingestion gateways
+func WithDeviceToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or a transport
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		c.retry = policy
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns a client for the API at baseURL (e.g. "https://api.example.com")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+		userAgent:  "data-storage-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the current token, e.g. to hand a user token to another process
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.tokenExpiry = tokenExpiry(token)
+}
+
+// authToken returns the token for a request, logging in first when the client has
+// credentials and no token that is valid for at least refreshMargin
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiry, creds := c.token, c.tokenExpiry, c.credentials
+	c.mu.Unlock()
+
+	if creds == nil || (token != "" && (expiry.IsZero() || time.Until(expiry) > refreshMargin)) {
+		return token, nil
+	}
+	return c.relogin(ctx, token)
+}
+
+// relogin logs in with the stored credentials unless another request already replaced
+// the stale token
+func (c *Client) relogin(ctx context.Context, stale string) (string, error) {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	c.mu.Lock()
+	token, creds := c.token, c.credentials
+	c.mu.Unlock()
+	if token != stale {
+		return token, nil
+	}
+
+	resp, err := c.login(ctx, LoginRequest{Email: creds.email, Password: creds.password, OrganizationID: creds.organizationID})
+	if err != nil {
+		return "", fmt.Errorf("logging in: %w", err)
+	}
+	return resp.Token, nil
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it. Device tokens are not
+// JWTs and have no expiry.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// request describes one API call
+type request struct {
+	method  string
+	path    string
+	query   url.Values
+	body    interface{}
+	out     interface{} // Decoded from successful responses unless nil
+	public  bool        // Sent without a token
+	noRetry bool        // Failures are returned at once, e.g. for probes
+}
+
+func (c *Client) do(ctx context.Context, req request) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	idempotent := req.method != http.MethodPost
+	maxAttempts := c.retry.MaxAttempts
+	if req.noRetry {
+		maxAttempts = 1
+	}
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		token := ""
+		if !req.public {
+			var err error
+			if token, err = c.authToken(ctx); err != nil {
+				return err
+			}
+		}
+
+		resp, err := c.send(ctx, req, body, token)
+		if err != nil {
+			// The request may have been processed, so only idempotent calls are repeated
+			if !idempotent || attempt >= maxAttempts || ctx.Err() != nil {
+				return err
+			}
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 300 {
+			return decodeResponse(resp, req.out)
+		}
+		apiErr := readError(resp)
+
+		// An expired or revoked token is renewed once
+		if resp.StatusCode == http.StatusUnauthorized && !req.public && !refreshed && c.hasCredentials() {
+			refreshed = true
+			if _, err := c.relogin(ctx, token); err != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+
+		if !c.shouldRetry(apiErr, idempotent) || attempt >= maxAttempts {
+			return apiErr
+		}
+		delay := c.backoff(attempt)
+		if apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > c.retry.MaxDelay {
+				return apiErr
+			}
+			delay = apiErr.RetryAfter
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte, token string) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.credentials != nil
+}
+
+// shouldRetry reports whether a failed response may succeed when repeated. Rate limited
+// requests were rejected before processing and are safe to repeat; exhausted quotas and
+// locked accounts are not worth waiting for.
+func (c *Client) shouldRetry(err *Error, idempotent bool) bool {
+	switch err.StatusCode {
+	case http.StatusTooManyRequests:
+		return err.Code != CodeQuotaExceeded && err.Code != CodeAccountLocked
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// backoff returns the delay before retry n: exponential with jitter, capped at MaxDelay
+func (c *Client) backoff(n int) time.Duration {
+	delay := c.retry.BaseDelay << (n - 1)
+	if delay <= 0 || delay > c.retry.MaxDelay {
+		delay = c.retry.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// readError builds an Error from a problem response, or from the status alone when the
+// body is not a problem (e.g. from a proxy)
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	apiErr := &Error{}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Code == "" {
+		apiErr = &Error{Title: http.StatusText(resp.StatusCode), Detail: strings.TrimSpace(string(data))}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int           `json:"status"`
+	Code       string        `json:"code"` // Machine-readable, see the Code constants
+	Title      string        `json:"title"`
+	Detail     string        `json:"detail"`
+	RequestID  string        `json:"request_id"`
+	Errors     []FieldError  `json:"errors"` // Invalid fields of validation errors
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("api: %d %s", e.StatusCode, e.Title)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if len(e.Errors) > 0 {
+		fields := make([]string, len(e.Errors))
+		for i, fe := range e.Errors {
+			fields[i] = fe.Message
+		}
+		msg += ": " + strings.Join(fields, "; ")
+	}
+	return msg
+}
+
+// HasCode reports whether err is an API error with the given code
+func HasCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// call sends a request and decodes the successful response into a new T
+func call[T any](ctx context.Context, c *Client, req request) (*T, error) {
+	var out T
+	req.out = &out
+	if err := c.do(ctx, req); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// list sends a request whose response is a JSON array
+func list[T any](ctx context.Context, c *Client, req request) ([]T, error) {
+	var out []T
+	req.out = &out
+	if err := c.do(ctx, req); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// idPath formats a path with IDs, e.g. idPath("/orgs/%d/members/%d", orgID, userID)
+func idPath(format string, ids ...uint) string {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"data-storage/internal/api"
+	"data-storage/internal/db"
+	"data-storage/internal/models"
+	"data-storage/internal/ratelimit"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testEmail    = "admin@example.com"
+	testPassword = "correct-horse-battery"
+)
+
+// setupServer runs the API handlers on an in-memory database with one admin user
+func setupServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard, TranslateError: true})
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	sqlDB, _ := database.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Setup(database); err != nil {
+		t.Fatalf("Error setting up database: %v", err)
+	}
+	ratelimit.Init(ratelimit.DefaultConfig())
+
+	org := models.Organization{Name: "Plant", Slug: "plant"}
+	user := models.User{Name: "Admin", Email: testEmail, Rfid: "admin-badge"}
+	if err := user.SetPassword(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	membership := models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: models.RoleAdmin}
+	if err := database.Create(&membership).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(api.NewRouter())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func fastRetry() Option {
+	return WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+}
+
+func TestClient_UserWorkflow(t *testing.T) {
+	server := setupServer(t)
+	ctx := context.Background()
+	c := New(server.URL, WithCredentials(testEmail, testPassword))
+
+	device, err := c.CreateDevice(ctx, Device{Name: "press-1", Location: "hall A"})
+	if err != nil {
+		t.Fatalf("Error creating device: %v", err)
+	}
+	if c.Token() == "" {
+		t.Error("Expected the client to log in on first use")
+	}
+
+	min, max := 0.0, 100.0
+	signal, err := c.CreateSignal(ctx, Signal{DeviceID: device.ID, Name: "temperature", SignalType: SignalAnalogic, MinValue: &min, MaxValue: &max})
+	if err != nil {
+		t.Fatalf("Error creating signal: %v", err)
+	}
+
+	start := time.Now().Add(-time.Hour).UTC()
+	for i := 0; i < 7; i++ {
+		value := float64(i)
+		_, err := c.CreateSignalValue(ctx, SignalValue{SignalID: signal.ID, Value: &value, Timestamp: start.Add(time.Duration(i) * time.Minute)})
+		if err != nil {
+			t.Fatalf("Error creating value %d: %v", i, err)
+		}
+	}
+
+	// Pages of 3 values, newest first
+	var got []float64
+	for value, err := range c.SignalValues(ctx, SignalValueFilter{SignalID: signal.ID, Limit: 3}) {
+		if err != nil {
+			t.Fatalf("Error iterating values: %v", err)
+		}
+		got = append(got, *value.Value)
+	}
+	if len(got) != 7 || got[0] != 6 || got[6] != 0 {
+		t.Errorf("Expected values 6 to 0, got %v", got)
+	}
+
+	// A value a minute is a derivative of 1 per minute, but for the oldest of the page
+	derivative, err := c.ListValuesOfSignal(ctx, signal.ID, SignalValueFilter{Limit: 3, Shape: SeriesOptions{Function: FunctionDerivative, Unit: time.Minute}})
+	if err != nil || len(derivative) != 3 || derivative[0].Value == nil || *derivative[0].Value != 1 || derivative[2].Value != nil {
+		t.Errorf("Expected derivatives of 1 per minute, got %v, %v", derivative, err)
+	}
+
+	// Validation errors list the invalid fields
+	tooHigh := 150.0
+	_, err = c.CreateSignalValue(ctx, SignalValue{SignalID: signal.ID, Value: &tooHigh})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeValidation || len(apiErr.Errors) != 1 || apiErr.Errors[0].Field != "value" {
+		t.Errorf("Expected a validation error for value, got %v", err)
+	}
+
+	if _, err := c.GetDevice(ctx, 9999); !IsNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	users, err := c.ListUsers(ctx)
+	if err != nil || len(users) != 1 || users[0].Email != testEmail {
+		t.Fatalf("Expected the admin as the only user, got %v, %v", users, err)
+	}
+	user := users[0]
+
+	// The legacy readings of a user are only served to the user's organization
+	if _, err := c.ListUserReadings(ctx, user.ID); err != nil {
+		t.Errorf("Error listing user readings: %v", err)
+	}
+	if _, err := New(server.URL).ListUserReadings(ctx, user.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous user readings to be unauthorized, got %v", err)
+	}
+
+	orgs, err := c.ListOrganizations(ctx)
+	if err != nil || len(orgs) != 1 || orgs[0].Role != RoleAdmin {
+		t.Errorf("Expected one organization with the admin role, got %v, %v", orgs, err)
+	}
+}
+
+func TestClient_DeviceTokenAndBatcher(t *testing.T) {
+	server := setupServer(t)
+	ctx := context.Background()
+	admin := New(server.URL, WithCredentials(testEmail, testPassword))
+
+	registered, err := admin.RegisterDevice(ctx, RegisterDeviceRequest{Name: "gateway"})
+	if err != nil {
+		t.Fatalf("Error registering device: %v", err)
+	}
+	signal, err := admin.CreateSignal(ctx, Signal{DeviceID: registered.Device.ID, Name: "running", SignalType: SignalDigital})
+	if err != nil {
+		t.Fatalf("Error creating signal: %v", err)
+	}
+
+	gateway := New(server.URL, WithDeviceToken(registered.AuthToken))
+	if _, err := gateway.ListDevices(ctx, DeviceFilter{}); err == nil {
+		t.Error("Expected device tokens to be rejected on user endpoints")
+	}
+
+	var failed atomic.Int32
+	batcher := gateway.NewBatcher(ctx, BatchOptions{
+		Size:     5,
+		Interval: time.Hour,
+		OnError:  func(SignalValue, error) { failed.Add(1) },
+	})
+	for i := 0; i < 12; i++ {
+		on := i%2 == 0
+		if err := batcher.Add(SignalValue{SignalID: signal.ID, DigitalValue: &on}); err != nil {
+			t.Fatalf("Error adding value: %v", err)
+		}
+	}
+	if err := batcher.Close(ctx); err != nil {
+		t.Fatalf("Error closing batcher: %v", err)
+	}
+	if err := batcher.Add(SignalValue{SignalID: signal.ID}); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("Expected ErrBatcherClosed, got %v", err)
+	}
+
+	values, err := admin.ListValuesOfSignal(ctx, signal.ID, SignalValueFilter{})
+	if err != nil {
+		t.Fatalf("Error listing values: %v", err)
+	}
+	if len(values) != 12 || failed.Load() != 0 {
+		t.Errorf("Expected 12 stored values and no failures, got %d and %d", len(values), failed.Load())
+	}
+}
+
+func TestClient_RenewsToken(t *testing.T) {
+	server := setupServer(t)
+	ctx := context.Background()
+	c := New(server.URL, WithCredentials(testEmail, testPassword))
+
+	// A rejected token is replaced by logging in again
+	c.setToken("revoked")
+	if _, err := c.ListUsers(ctx); err != nil {
+		t.Fatalf("Expected the request to succeed after logging in again: %v", err)
+	}
+	token := c.Token()
+	if token == "revoked" {
+		t.Fatal("Expected a new token")
+	}
+
+	// A token about to expire is replaced before the request
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(10*time.Second).Unix())))
+	c.setToken("header." + payload + ".signature")
+	if _, err := c.ListUsers(ctx); err != nil {
+		t.Fatalf("Error listing users: %v", err)
+	}
+	if c.Token() == "header."+payload+".signature" {
+		t.Error("Expected the expiring token to be renewed")
+	}
+
+	// Without credentials the error is returned
+	anonymous := New(server.URL, WithToken("revoked"))
+	if _, err := anonymous.ListUsers(ctx); !HasCode(err, CodeUnauthorized) {
+		t.Errorf("Expected unauthorized, got %v", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		code := int(status.Load())
+		if n < 3 && code != 0 {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(code)
+			problemCode := "unavailable"
+			if code == http.StatusTooManyRequests {
+				problemCode = r.URL.Query().Get("code")
+			}
+			fmt.Fprintf(w, `{"status":%d,"code":%q}`, code, problemCode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":1,"name":"press-1"}`)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		method  string
+		status  int
+		code    string
+		wantErr bool
+		calls   int32
+	}{
+		{"idempotent unavailable", http.MethodGet, http.StatusServiceUnavailable, "", false, 3},
+		{"create unavailable", http.MethodPost, http.StatusServiceUnavailable, "", true, 1},
+		{"create rate limited", http.MethodPost, http.StatusTooManyRequests, CodeRateLimited, false, 3},
+		{"quota exceeded", http.MethodGet, http.StatusTooManyRequests, CodeQuotaExceeded, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			status.Store(int32(tt.status))
+			c := New(server.URL, WithToken("token"), fastRetry())
+
+			var device Device
+			err := c.do(ctx, request{method: tt.method, path: "/devices/1", query: map[string][]string{"code": {tt.code}}, out: &device})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("Expected %d calls, got %d", tt.calls, calls.Load())
+			}
+		})
+	}
+}
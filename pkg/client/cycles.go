@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CycleFilter narrows ListCycles; zero fields are ignored. Cycles are returned newest first.
+type CycleFilter struct {
+	DeviceID uint
+	UserID   uint
+	Result   string    // CyclePass or CycleFail
+	From     time.Time // Inclusive, on the start of the cycle
+	To       time.Time // Inclusive, on the start of the cycle
+	Limit    int       // Page size; the API defaults to 1000 and allows up to 10000
+	Offset   int
+}
+
+func (f CycleFilter) query() url.Values {
+	q := url.Values{}
+	setUint(q, "device_id", f.DeviceID)
+	setUint(q, "user_id", f.UserID)
+	setString(q, "result", f.Result)
+	setTime(q, "from_date", f.From)
+	setTime(q, "to_date", f.To)
+	setInt(q, "limit", f.Limit)
+	setInt(q, "offset", f.Offset)
+	return q
+}
+
+// ListCycles returns one page of assembly cycles
+func (c *Client) ListCycles(ctx context.Context, filter CycleFilter) ([]Cycle, error) {
+	return list[Cycle](ctx, c, request{method: http.MethodGet, path: "/cycles", query: filter.query()})
+}
+
+// GetCycle gets an assembly cycle
+func (c *Client) GetCycle(ctx context.Context, id uint) (*Cycle, error) {
+	return call[Cycle](ctx, c, request{method: http.MethodGet, path: idPath("/cycles/%d", id)})
+}
+
+// CreateCycle records an assembly cycle. Devices may leave DeviceID zero; EndedAt defaults
+// to the time the API receives it.
+func (c *Client) CreateCycle(ctx context.Context, cycle Cycle) (*Cycle, error) {
+	return call[Cycle](ctx, c, request{method: http.MethodPost, path: "/cycles", body: newCycle(cycle)})
+}
+
+// DeleteCycle deletes an assembly cycle
+func (c *Client) DeleteCycle(ctx context.Context, id uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/cycles/%d", id)})
+}
+
+// cycleBody is the body of a new cycle, without the fields the API sets
+type cycleBody struct {
+	DeviceID        uint       `json:"device_id,omitempty"`
+	UserID          *uint      `json:"user_id,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	TargetCycleTime *float64   `json:"target_cycle_time,omitempty"`
+	SetValue        *float64   `json:"set_value,omitempty"`
+	Value           *float64   `json:"value,omitempty"`
+	MotionWaste     *float64   `json:"motion_waste,omitempty"`
+	Result          string     `json:"result"`
+	Metadata        JSONB      `json:"metadata,omitempty"`
+}
+
+func newCycle(cycle Cycle) cycleBody {
+	body := cycleBody{
+		DeviceID:        cycle.DeviceID,
+		UserID:          cycle.UserID,
+		StartedAt:       cycle.StartedAt,
+		TargetCycleTime: cycle.TargetCycleTime,
+		SetValue:        cycle.SetValue,
+		Value:           cycle.Value,
+		MotionWaste:     cycle.MotionWaste,
+		Result:          cycle.Result,
+		Metadata:        cycle.Metadata,
+	}
+	if !cycle.EndedAt.IsZero() {
+		body.EndedAt = &cycle.EndedAt
+	}
+	return body
+}
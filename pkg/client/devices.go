@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DeviceFilter narrows ListDevices; zero fields are ignored
+type DeviceFilter struct {
+	UserID uint
+	Active *bool
+}
+
+func (f DeviceFilter) query() url.Values {
+	q := url.Values{}
+	setUint(q, "user_id", f.UserID)
+	setBool(q, "active", f.Active)
+	return q
+}
+
+// ListDevices lists the devices of the current organization
+func (c *Client) ListDevices(ctx context.Context, filter DeviceFilter) ([]Device, error) {
+	return list[Device](ctx, c, request{method: http.MethodGet, path: "/devices", query: filter.query()})
+}
+
+// GetDevice gets a device with its signals
+func (c *Client) GetDevice(ctx context.Context, id uint) (*Device, error) {
+	return call[Device](ctx, c, request{method: http.MethodGet, path: idPath("/devices/%d", id)})
+}
+
+// CreateDevice creates a device; the API generates its auth token
+func (c *Client) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	return call[Device](ctx, c, request{method: http.MethodPost, path: "/devices", body: device})
+}
+
+// UpdateDevice changes the fields set in device
+func (c *Client) UpdateDevice(ctx context.Context, id uint, device Device) (*Device, error) {
+	return call[Device](ctx, c, request{method: http.MethodPut, path: idPath("/devices/%d", id), body: device})
+}
+
+// DeleteDevice deletes a device
+func (c *Client) DeleteDevice(ctx context.Context, id uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/devices/%d", id)})
+}
+
+// DeviceQuota returns today's ingestion usage of a device and the usage of the past days
+func (c *Client) DeviceQuota(ctx context.Context, id uint, days int) (*QuotaStatus, error) {
+	q := url.Values{"days": {strconv.Itoa(days)}}
+	return call[QuotaStatus](ctx, c, request{method: http.MethodGet, path: idPath("/devices/%d/quota", id), query: q})
+}
+
+// MoveDevice moves a device and its signals to another organization
+func (c *Client) MoveDevice(ctx context.Context, id, organizationID uint) (*Device, error) {
+	body := map[string]uint{"organization_id": organizationID}
+	return call[Device](ctx, c, request{method: http.MethodPost, path: idPath("/devices/%d/move", id), body: body})
+}
+
+func setUint(q url.Values, key string, v uint) {
+	if v != 0 {
+		q.Set(key, strconv.FormatUint(uint64(v), 10))
+	}
+}
+
+func setBool(q url.Values, key string, v *bool) {
+	if v != nil {
+		q.Set(key, strconv.FormatBool(*v))
+	}
+}
+
+func setString(q url.Values, key, v string) {
+	if v != "" {
+		q.Set(key, v)
+	}
+}
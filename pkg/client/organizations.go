@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListOrganizations lists the current user's organizations and roles
+func (c *Client) ListOrganizations(ctx context.Context) ([]OrganizationWithRole, error) {
+	return list[OrganizationWithRole](ctx, c, request{method: http.MethodGet, path: "/orgs"})
+}
+
+// GetOrganization gets an organization of the current user
+func (c *Client) GetOrganization(ctx context.Context, id uint) (*OrganizationWithRole, error) {
+	return call[OrganizationWithRole](ctx, c, request{method: http.MethodGet, path: idPath("/orgs/%d", id)})
+}
+
+// CreateOrganization creates an organization with the current user as admin
+func (c *Client) CreateOrganization(ctx context.Context, req OrganizationRequest) (*OrganizationWithRole, error) {
+	return call[OrganizationWithRole](ctx, c, request{method: http.MethodPost, path: "/orgs", body: req})
+}
+
+// UpdateOrganization renames an organization
+func (c *Client) UpdateOrganization(ctx context.Context, id uint, req OrganizationRequest) (*OrganizationWithRole, error) {
+	return call[OrganizationWithRole](ctx, c, request{method: http.MethodPut, path: idPath("/orgs/%d", id), body: req})
+}
+
+// ListMembers lists the members of an organization
+func (c *Client) ListMembers(ctx context.Context, organizationID uint) ([]Membership, error) {
+	return list[Membership](ctx, c, request{method: http.MethodGet, path: idPath("/orgs/%d/members", organizationID)})
+}
+
+// SetMemberRole changes the role of a member
+func (c *Client) SetMemberRole(ctx context.Context, organizationID, userID uint, role string) (*Membership, error) {
+	body := map[string]string{"role": role}
+	return call[Membership](ctx, c, request{method: http.MethodPut, path: idPath("/orgs/%d/members/%d", organizationID, userID), body: body})
+}
+
+// RemoveMember removes a user from an organization
+func (c *Client) RemoveMember(ctx context.Context, organizationID, userID uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/orgs/%d/members/%d", organizationID, userID)})
+}
+
+// ListInvitations lists the pending invitations of an organization
+func (c *Client) ListInvitations(ctx context.Context, organizationID uint) ([]Invitation, error) {
+	return list[Invitation](ctx, c, request{method: http.MethodGet, path: idPath("/orgs/%d/invitations", organizationID)})
+}
+
+// Invite sends an invitation to an email; role defaults to member when empty
+func (c *Client) Invite(ctx context.Context, organizationID uint, email, role string) (*Invitation, error) {
+	body := map[string]string{"email": email}
+	if role != "" {
+		body["role"] = role
+	}
+	return call[Invitation](ctx, c, request{method: http.MethodPost, path: idPath("/orgs/%d/invitations", organizationID), body: body})
+}
+
+// RevokeInvitation deletes a pending invitation
+func (c *Client) RevokeInvitation(ctx context.Context, organizationID, invitationID uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/orgs/%d/invitations/%d", organizationID, invitationID)})
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// SignalFilter narrows ListSignals; zero fields are ignored
+type SignalFilter struct {
+	DeviceID   uint
+	SignalType string // SignalDigital or SignalAnalogic
+	Direction  string // DirectionInput or DirectionOutput
+	Active     *bool
+}
+
+func (f SignalFilter) query() url.Values {
+	q := url.Values{}
+	setUint(q, "device_id", f.DeviceID)
+	setString(q, "signal_type", f.SignalType)
+	setString(q, "direction", f.Direction)
+	setBool(q, "active", f.Active)
+	return q
+}
+
+// ListSignals lists signal configurations
+func (c *Client) ListSignals(ctx context.Context, filter SignalFilter) ([]Signal, error) {
+	return list[Signal](ctx, c, request{method: http.MethodGet, path: "/signals", query: filter.query()})
+}
+
+// ListDeviceSignals lists the signals of a device; DeviceID and Active of the filter are ignored
+func (c *Client) ListDeviceSignals(ctx context.Context, deviceID uint, filter SignalFilter) ([]Signal, error) {
+	q := url.Values{}
+	setString(q, "signal_type", filter.SignalType)
+	setString(q, "direction", filter.Direction)
+	return list[Signal](ctx, c, request{method: http.MethodGet, path: idPath("/devices/%d/signals", deviceID), query: q})
+}
+
+// GetSignal gets a signal configuration
+func (c *Client) GetSignal(ctx context.Context, id uint) (*Signal, error) {
+	return call[Signal](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d", id)})
+}
+
+// CreateSignal creates a signal configuration on a device
+func (c *Client) CreateSignal(ctx context.Context, signal Signal) (*Signal, error) {
+	return call[Signal](ctx, c, request{method: http.MethodPost, path: "/signals", body: signal})
+}
+
+// UpdateSignal changes the fields set in signal
+func (c *Client) UpdateSignal(ctx context.Context, id uint, signal Signal) (*Signal, error) {
+	return call[Signal](ctx, c, request{method: http.MethodPut, path: idPath("/signals/%d", id), body: signal})
+}
+
+// DeleteSignal deletes a signal configuration
+func (c *Client) DeleteSignal(ctx context.Context, id uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/signals/%d", id)})
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"time"
+
+	"data-storage/internal/apierror"
+	"data-storage/internal/models"
+	"data-storage/internal/validate"
+)
+
+// Records are the API models, so values decoded by the client are the same structs the
+// server stores
+type (
+	User         = models.User
+	Device       = models.Device
+	DeviceUsage  = models.DeviceUsage
+	Signal       = models.Signal
+	SignalValue  = models.SignalValue
+	Cycle        = models.Cycle
+	Organization = models.Organization
+	Membership   = models.Membership
+	Invitation   = models.OrgInvitation
+	AuditLog     = models.AuditLog
+	JSONB        = models.JSONB
+	FieldError   = validate.FieldError
+)
+
+// Signal types, directions, cycle results and organization roles
+const (
+	SignalDigital  = "digital"
+	SignalAnalogic = "analogic"
+	SignalWaveform = "waveform"
+
+	DirectionInput  = "input"
+	DirectionOutput = "output"
+
+	CyclePass = models.CyclePass
+	CycleFail = models.CycleFail
+
+	RoleAdmin  = models.RoleAdmin
+	RoleMember = models.RoleMember
+	RoleViewer = models.RoleViewer
+)
+
+// Error codes, see Error.Code
+const (
+	CodeValidation         = apierror.CodeValidation
+	CodeInvalidCredentials = apierror.CodeInvalidCredentials
+	CodeUnauthorized       = apierror.CodeUnauthorized
+	CodeForbidden          = apierror.CodeForbidden
+	CodeNotFound           = apierror.CodeNotFound
+	CodeDuplicate          = apierror.CodeDuplicate
+	CodeReference          = apierror.CodeReference
+	CodeRateLimited        = apierror.CodeRateLimited
+	CodeAccountLocked      = apierror.CodeAccountLocked
+	CodeQuotaExceeded      = apierror.CodeQuotaExceeded
+)
+
+type LoginRequest struct {
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	OrganizationID uint   `json:"organization_id,omitempty"` // Defaults to the user's oldest organization
+}
+
+type LoginResponse struct {
+	Token        string        `json:"token"`
+	User         User          `json:"user"`
+	Organization *Organization `json:"organization,omitempty"`
+	Role         string        `json:"role,omitempty"`
+}
+
+type RegisterDeviceRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	DeviceType  string `json:"device_type,omitempty"`
+	Location    string `json:"location,omitempty"`
+}
+
+type RegisterDeviceResponse struct {
+	Device    Device `json:"device"`
+	AuthToken string `json:"auth_token"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name,omitempty"`     // Required when no account exists for the invited email
+	Password string `json:"password,omitempty"` // The existing account's password, or the new account's
+}
+
+type CreateUserRequest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Categoria string `json:"categoria,omitempty"`
+	Matricula string `json:"matricula,omitempty"`
+	Rfid      string `json:"rfid,omitempty"`
+	Role      string `json:"role,omitempty"` // Role in the current organization, defaults to member
+}
+
+// UpdateUserRequest changes the fields that are set
+type UpdateUserRequest struct {
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Categoria string `json:"categoria,omitempty"`
+	Matricula string `json:"matricula,omitempty"`
+	Rfid      string `json:"rfid,omitempty"`
+	IsActive  *bool  `json:"is_active,omitempty"`
+
+	CurrentPassword string `json:"current_password,omitempty"` // Required to change your own email
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name,omitempty"`
+	Slug string `json:"slug,omitempty"` // Derived from the name when empty
+}
+
+// OrganizationWithRole is an organization and the current user's role in it
+type OrganizationWithRole struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// QuotaStatus is a device's ingestion quota usage
+type QuotaStatus struct {
+	DeviceID  uint          `json:"device_id"`
+	Day       string        `json:"day"`
+	Used      int64         `json:"used"`
+	Quota     int64         `json:"quota"`               // 0 means unlimited
+	Remaining *int64        `json:"remaining,omitempty"` // Nil when unlimited
+	ResetsAt  time.Time     `json:"resets_at"`
+	History   []DeviceUsage `json:"history,omitempty"`
+}
+
+// AuditVerifyResult is the outcome of an audit hash chain check
+type AuditVerifyResult struct {
+	Valid bool `json:"valid"`
+}
+
+// Health is the body of the health probes
+type Health struct {
+	Status string `json:"status"`
+}
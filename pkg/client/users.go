@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListUsers lists the users of the current organization
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	return list[User](ctx, c, request{method: http.MethodGet, path: "/users"})
+}
+
+// GetUser gets a user of the current organization
+func (c *Client) GetUser(ctx context.Context, id uint) (*User, error) {
+	return call[User](ctx, c, request{method: http.MethodGet, path: idPath("/users/%d", id)})
+}
+
+// CreateUser creates a user and adds it to the current organization
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	return call[User](ctx, c, request{method: http.MethodPost, path: "/users", body: req})
+}
+
+// UpdateUser changes the fields set in req. Users can't change their own password or
+// is_active with it; see ChangePassword.
+func (c *Client) UpdateUser(ctx context.Context, id uint, req UpdateUserRequest) (*User, error) {
+	return call[User](ctx, c, request{method: http.MethodPut, path: idPath("/users/%d", id), body: req})
+}
+
+// DeleteUser deletes a user
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/users/%d", id)})
+}
+
+// GetUserByRFID finds the active user of the device's organization holding a badge. It needs
+// a device token, and the lookup is recorded as a badge scan of the device.
+//
+// Deprecated: devices scan badges with POST /devices/{id}/badge.
+func (c *Client) GetUserByRFID(ctx context.Context, rfid string) (*User, error) {
+	return call[User](ctx, c, request{method: http.MethodGet, path: "/users/rfid/" + url.PathEscape(rfid)})
+}
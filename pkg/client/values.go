@@ -0,0 +1,495 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-storage/internal/digital"
+	"data-storage/internal/series"
+	"data-storage/internal/signalstats"
+	"data-storage/internal/waveform"
+)
+
+// Page sizes of iterators: the default when the filter has no limit, and the largest the
+// API returns for values and audit entries
+const (
+	defaultPageSize  = 1000
+	maxValuesPerPage = 10000
+	maxAuditPerPage  = 1000
+)
+
+// SignalValueFilter narrows signal value queries; zero fields are ignored. Values are
+// returned newest first.
+type SignalValueFilter struct {
+	SignalID uint
+	DeviceID uint
+	UserID   uint
+	From     time.Time // Inclusive
+	To       time.Time // Inclusive
+	Limit    int       // Page size; the API defaults to 1000 and allows up to 10000
+	Offset   int
+
+	IncludeSamples bool // Include the samples of waveform values, left out by default
+
+	// Shape fills the gaps between the values of a page longer than GapThreshold with values
+	// marked Filled, and replaces each value with the Function of the page's values in time
+	// order. It needs a single SignalID; Bucket, Aggregate and Limit only apply to series.
+	Shape SeriesOptions
+}
+
+func (f SignalValueFilter) query() url.Values {
+	q := url.Values{}
+	setUint(q, "signal_id", f.SignalID)
+	setUint(q, "device_id", f.DeviceID)
+	setUint(q, "user_id", f.UserID)
+	setTime(q, "from_date", f.From)
+	setTime(q, "to_date", f.To)
+	setInt(q, "limit", f.Limit)
+	setInt(q, "offset", f.Offset)
+	setIncludeSamples(q, f.IncludeSamples)
+	f.Shape.setShape(q)
+	return q
+}
+
+// ListSignalValues returns one page of the stored signal values; see SignalValues to iterate
+// over all, and GetSeries for buckets
+func (c *Client) ListSignalValues(ctx context.Context, filter SignalValueFilter) ([]SignalValue, error) {
+	return list[SignalValue](ctx, c, request{method: http.MethodGet, path: "/signal-values", query: filter.query()})
+}
+
+// SignalValues iterates over every value matching the filter, fetching pages of
+// filter.Limit values from filter.Offset on. Iteration stops at the first error. The fill of
+// filter.Shape is ignored, as filled values would throw off the paging.
+//
+//	for value, err := range c.SignalValues(ctx, client.SignalValueFilter{SignalID: 7}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *Client) SignalValues(ctx context.Context, filter SignalValueFilter) iter.Seq2[SignalValue, error] {
+	filter.Shape.Fill, filter.Shape.GapThreshold = "", 0
+	return paginate(filter.Limit, maxValuesPerPage, filter.Offset, func(limit, offset int) ([]SignalValue, error) {
+		filter.Limit, filter.Offset = limit, offset
+		return c.ListSignalValues(ctx, filter)
+	}, func(v SignalValue) uint { return v.ID })
+}
+
+// ListValuesOfSignal returns one page of the stored values of a signal. Only the date range,
+// limit, offset, IncludeSamples and Shape of the filter apply; see GetSeries for buckets.
+func (c *Client) ListValuesOfSignal(ctx context.Context, signalID uint, filter SignalValueFilter) ([]SignalValue, error) {
+	q := url.Values{}
+	setTime(q, "from_date", filter.From)
+	setTime(q, "to_date", filter.To)
+	setInt(q, "limit", filter.Limit)
+	setInt(q, "offset", filter.Offset)
+	setIncludeSamples(q, filter.IncludeSamples)
+	filter.Shape.setShape(q)
+	return list[SignalValue](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d/values", signalID), query: q})
+}
+
+// GetSignalValue gets a signal value
+func (c *Client) GetSignalValue(ctx context.Context, id uint) (*SignalValue, error) {
+	return call[SignalValue](ctx, c, request{method: http.MethodGet, path: idPath("/signal-values/%d", id)})
+}
+
+// CreateSignalValue records a value. Analogic signals need Value, digital signals
+// DigitalValue and waveform signals Samples and SampleInterval; Timestamp defaults to the
+// time the API receives it.
+func (c *Client) CreateSignalValue(ctx context.Context, value SignalValue) (*SignalValue, error) {
+	return call[SignalValue](ctx, c, request{method: http.MethodPost, path: "/signal-values", body: newValue(value)})
+}
+
+// DeleteSignalValue deletes a signal value
+func (c *Client) DeleteSignalValue(ctx context.Context, id uint) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: idPath("/signal-values/%d", id)})
+}
+
+// Waveform downsampling methods, see GetWaveform
+const (
+	WaveformLTTB    = waveform.LTTB
+	WaveformMinMax  = waveform.MinMax
+	WaveformAverage = waveform.Average
+)
+
+// Waveform is the curve of a waveform value
+type Waveform struct {
+	SignalValueID  uint             `json:"signal_value_id"`
+	SignalID       uint             `json:"signal_id"`
+	Timestamp      time.Time        `json:"timestamp"`
+	SampleInterval float64          `json:"sample_interval"` // Seconds between samples
+	Samples        int              `json:"samples"`         // Number of stored samples
+	Method         string           `json:"method,omitempty"`
+	Points         []waveform.Point `json:"points"`
+}
+
+// WaveformStats summarizes a waveform value
+type WaveformStats struct {
+	SignalValueID uint      `json:"signal_value_id"`
+	SignalID      uint      `json:"signal_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	waveform.Stats
+}
+
+// GetWaveform returns the curve of a waveform value, downsampled to at most maxPoints
+// points with method (WaveformLTTB when empty). A maxPoints of 0 returns every sample.
+func (c *Client) GetWaveform(ctx context.Context, id uint, maxPoints int, method string) (*Waveform, error) {
+	q := url.Values{}
+	setInt(q, "max_points", maxPoints)
+	setString(q, "method", method)
+	return call[Waveform](ctx, c, request{method: http.MethodGet, path: idPath("/signal-values/%d/waveform", id), query: q})
+}
+
+// GetWaveformStats returns the peak, minimum, mean, final value and area of a waveform value
+func (c *Client) GetWaveformStats(ctx context.Context, id uint) (*WaveformStats, error) {
+	return call[WaveformStats](ctx, c, request{method: http.MethodGet, path: idPath("/signal-values/%d/waveform/stats", id)})
+}
+
+// SignalStats is the statistical summary of the values of a signal. Digital values count as
+// 1 and 0; Capability is set for analogic signals with a MinValue or MaxValue.
+type SignalStats struct {
+	SignalID   uint   `json:"signal_id"`
+	Name       string `json:"name"`
+	DeviceID   uint   `json:"device_id"`
+	SignalType string `json:"signal_type"`
+	Unit       string `json:"unit,omitempty"`
+	signalstats.Summary
+	Capability *signalstats.Capability `json:"capability,omitempty"`
+}
+
+// SignalStatsReport compares the statistics of signals over a time range
+type SignalStatsReport struct {
+	From    *time.Time    `json:"from,omitempty"`
+	To      *time.Time    `json:"to,omitempty"`
+	Signals []SignalStats `json:"signals"`
+}
+
+// GetSignalStats summarizes the values of a signal, followed by the compared signals, from
+// from to to (both inclusive, ignored when zero). At most 20 signals can be summarized at once.
+func (c *Client) GetSignalStats(ctx context.Context, signalID uint, from, to time.Time, compare ...uint) (*SignalStatsReport, error) {
+	q := url.Values{}
+	setTime(q, "from_date", from)
+	setTime(q, "to_date", to)
+	if len(compare) > 0 {
+		q.Set("compare", joinIDs(compare))
+	}
+	return call[SignalStatsReport](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d/stats", signalID), query: q})
+}
+
+// Series aggregates, fill modes and functions, see SeriesOptions
+const (
+	AggregateAvg   = series.Avg
+	AggregateMin   = series.Min
+	AggregateMax   = series.Max
+	AggregateSum   = series.Sum
+	AggregateCount = series.Count
+
+	FillNull     = series.FillNull
+	FillPrevious = series.FillPrevious
+	FillLinear   = series.FillLinear
+	FillConstant = series.FillConstant
+
+	FunctionDifference    = series.Difference
+	FunctionDerivative    = series.Derivative
+	FunctionIncrease      = series.Increase
+	FunctionRate          = series.Rate
+	FunctionIntegral      = series.Integral
+	FunctionMovingAverage = series.MovingAverage
+	FunctionEMA           = series.EMA
+)
+
+// SeriesOptions shape the values of a series; zero fields are ignored. Durations are whole
+// seconds.
+type SeriesOptions struct {
+	Bucket       time.Duration // Aggregate per bucket; raw values when zero
+	Aggregate    string        // AggregateAvg by default
+	Fill         string        // Fill empty buckets, or gaps of raw values every GapThreshold
+	FillValue    float64       // Value of FillConstant
+	GapThreshold time.Duration // Mark spans without values longer than this as gaps
+	Limit        int           // Raw values; the API defaults to 1000 and allows up to 10000
+
+	// Function of the values, applied after aggregation and filling, with its parameters
+	Function string
+	Unit     time.Duration // Time unit of derivatives, rates and integrals; a second by default
+	Window   int           // Values averaged by FunctionMovingAverage, or the span of FunctionEMA
+	Alpha    float64       // Smoothing factor of FunctionEMA, in (0, 1]
+}
+
+// Series is the values of a signal in a time range, raw or aggregated per bucket
+type Series struct {
+	SignalID   uint           `json:"signal_id"`
+	SignalType string         `json:"signal_type"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Bucket     float64        `json:"bucket,omitempty"` // Seconds per bucket
+	Aggregate  string         `json:"aggregate,omitempty"`
+	Fill       string         `json:"fill,omitempty"`
+	Function   string         `json:"function,omitempty"`
+	Points     []series.Point `json:"points"`
+	Gaps       []series.Gap   `json:"gaps,omitempty"`
+	Truncated  bool           `json:"truncated,omitempty"` // Limit raw values were reached; To is the first value left out
+}
+
+// GetSeries returns the values of a signal from from (inclusive) to to (exclusive) for charts.
+// Digital values read as 1 and 0.
+func (c *Client) GetSeries(ctx context.Context, signalID uint, from, to time.Time, opts SeriesOptions) (*Series, error) {
+	q := opts.query(from, to)
+	setInt(q, "limit", opts.Limit)
+	return call[Series](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d/series", signalID), query: q})
+}
+
+func (o SeriesOptions) query(from, to time.Time) url.Values {
+	q := url.Values{}
+	setTime(q, "from_date", from)
+	setTime(q, "to_date", to)
+	setDuration(q, "bucket", o.Bucket)
+	setString(q, "aggregate", o.Aggregate)
+	o.setShape(q)
+	return q
+}
+
+// setShape sets the fill and function parameters, which the value lists also take
+func (o SeriesOptions) setShape(q url.Values) {
+	setString(q, "fill", o.Fill)
+	if o.Fill == FillConstant {
+		q.Set("fill_value", strconv.FormatFloat(o.FillValue, 'g', -1, 64))
+	}
+	setDuration(q, "gap_threshold", o.GapThreshold)
+	setString(q, "function", o.Function)
+	setDuration(q, "unit", o.Unit)
+	setInt(q, "window", o.Window)
+	if o.Alpha != 0 {
+		q.Set("alpha", strconv.FormatFloat(o.Alpha, 'g', -1, 64))
+	}
+}
+
+// AlignedSignal is a column of an aligned series
+type AlignedSignal struct {
+	SignalID   uint         `json:"signal_id"`
+	Name       string       `json:"name"`
+	DeviceID   uint         `json:"device_id"`
+	Device     string       `json:"device"`
+	SignalType string       `json:"signal_type"`
+	Unit       string       `json:"unit,omitempty"`
+	Column     string       `json:"column"`
+	Gaps       []series.Gap `json:"gaps,omitempty"`
+}
+
+// AlignedRow is a bucket of an aligned series, with a value per signal in the order of the
+// signals; nil when the signal has no value in the bucket
+type AlignedRow struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Values    []*float64 `json:"values"`
+}
+
+// AlignedSeries is the values of several signals aggregated on the same buckets
+type AlignedSeries struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Bucket    float64         `json:"bucket"`
+	Aggregate string          `json:"aggregate"`
+	Fill      string          `json:"fill,omitempty"`
+	Function  string          `json:"function,omitempty"`
+	Signals   []AlignedSignal `json:"signals"`
+	Rows      []AlignedRow    `json:"rows"`
+}
+
+// GetAlignedSeries aggregates up to 20 signals on the same buckets of opts.Bucket, which is
+// required, and joins them on the bucket time. Limit is ignored.
+func (c *Client) GetAlignedSeries(ctx context.Context, signalIDs []uint, from, to time.Time, opts SeriesOptions) (*AlignedSeries, error) {
+	q := opts.query(from, to)
+	q.Set("signal_ids", joinIDs(signalIDs))
+	return call[AlignedSeries](ctx, c, request{method: http.MethodGet, path: "/series", query: q})
+}
+
+// Edge kinds of GetEdges
+const (
+	EdgeRising  = digital.Rising
+	EdgeFalling = digital.Falling
+)
+
+// StatesOptions filter the intervals of GetStates and add buckets; zero fields are ignored.
+// Durations are whole seconds.
+type StatesOptions struct {
+	State       string        // "on" or "off"
+	MinDuration time.Duration // List intervals lasting at least this
+	MaxDuration time.Duration // List intervals lasting at most this
+	Bucket      time.Duration // Also return the time on and off per bucket
+	Limit       int           // The API defaults to 1000 and allows up to 10000
+	Offset      int
+}
+
+// States is the time a digital signal spent on and off in a time range
+type States struct {
+	SignalID uint      `json:"signal_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	digital.Summary
+	Bucket    float64            `json:"bucket,omitempty"`
+	Buckets   []digital.Bucket   `json:"buckets,omitempty"`
+	Intervals []digital.Interval `json:"intervals"`
+}
+
+// GetStates returns the time a digital signal spent on and off from from (inclusive) to to
+// (exclusive), its longest runs and the intervals matching opts
+func (c *Client) GetStates(ctx context.Context, signalID uint, from, to time.Time, opts StatesOptions) (*States, error) {
+	q := url.Values{}
+	setTime(q, "from_date", from)
+	setTime(q, "to_date", to)
+	setString(q, "state", opts.State)
+	setDuration(q, "min_duration", opts.MinDuration)
+	setDuration(q, "max_duration", opts.MaxDuration)
+	setDuration(q, "bucket", opts.Bucket)
+	setInt(q, "limit", opts.Limit)
+	setInt(q, "offset", opts.Offset)
+	return call[States](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d/states", signalID), query: q})
+}
+
+// Edges is the changes of state of a digital signal in a time range
+type Edges struct {
+	SignalID uint           `json:"signal_id"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Rising   int            `json:"rising"`
+	Falling  int            `json:"falling"`
+	Edges    []digital.Edge `json:"edges"`
+}
+
+// GetEdges lists the edges of a digital signal from from (inclusive) to to (exclusive), only
+// those of kind when it is not empty. limit and offset are ignored when zero.
+func (c *Client) GetEdges(ctx context.Context, signalID uint, from, to time.Time, kind string, limit, offset int) (*Edges, error) {
+	q := url.Values{}
+	setTime(q, "from_date", from)
+	setTime(q, "to_date", to)
+	setString(q, "edge", kind)
+	setInt(q, "limit", limit)
+	setInt(q, "offset", offset)
+	return call[Edges](ctx, c, request{method: http.MethodGet, path: idPath("/signals/%d/edges", signalID), query: q})
+}
+
+func joinIDs(ids []uint) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(s, ",")
+}
+
+// valueBody is the body of a new signal value. SignalValue embeds its signal as a struct,
+// which would be sent as an empty object.
+type valueBody struct {
+	SignalID       uint       `json:"signal_id"`
+	UserID         *uint      `json:"user_id,omitempty"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	Value          *float64   `json:"value,omitempty"`
+	DigitalValue   *bool      `json:"digital_value,omitempty"`
+	Samples        []float64  `json:"samples,omitempty"`
+	SampleInterval *float64   `json:"sample_interval,omitempty"`
+	Metadata       JSONB      `json:"metadata,omitempty"`
+}
+
+func newValue(v SignalValue) valueBody {
+	body := valueBody{
+		SignalID:       v.SignalID,
+		UserID:         v.UserID,
+		Value:          v.Value,
+		DigitalValue:   v.DigitalValue,
+		Samples:        v.Samples,
+		SampleInterval: v.SampleInterval,
+		Metadata:       v.Metadata,
+	}
+	if !v.Timestamp.IsZero() {
+		body.Timestamp = &v.Timestamp
+	}
+	return body
+}
+
+// ListReadings lists signal values through the legacy readings endpoint.
+//
+// Deprecated: use ListSignalValues.
+func (c *Client) ListReadings(ctx context.Context, limit int) ([]SignalValue, error) {
+	q := url.Values{}
+	setInt(q, "limit", limit)
+	return list[SignalValue](ctx, c, request{method: http.MethodGet, path: "/readings", query: q})
+}
+
+// CreateReading records a value through the legacy readings endpoint.
+//
+// Deprecated: use CreateSignalValue.
+func (c *Client) CreateReading(ctx context.Context, value SignalValue) (*SignalValue, error) {
+	body := map[string]interface{}{"signal_id": value.SignalID, "value": value.Value, "digital_value": value.DigitalValue}
+	if value.UserID != nil {
+		body["user_id"] = *value.UserID
+	}
+	return call[SignalValue](ctx, c, request{method: http.MethodPost, path: "/readings", body: body})
+}
+
+// ListUserReadings lists the signal values of a user through the legacy endpoint.
+//
+// Deprecated: use ListSignalValues with a UserID filter.
+func (c *Client) ListUserReadings(ctx context.Context, userID uint) ([]SignalValue, error) {
+	return list[SignalValue](ctx, c, request{method: http.MethodGet, path: idPath("/readings/%d", userID)})
+}
+
+// paginate iterates over the pages returned by fetch until a page is shorter than the
+// page size, which is capped at the largest page the API returns. Entries inserted while
+// iterating shift later pages, so entries already yielded are skipped by ID.
+func paginate[T any](pageSize, maxPageSize, offset int, fetch func(limit, offset int) ([]T, error), id func(T) uint) iter.Seq2[T, error] {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+	return func(yield func(T, error) bool) {
+		seen := make(map[uint]struct{})
+		for {
+			page, err := fetch(pageSize, offset)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, entry := range page {
+				if _, dup := seen[id(entry)]; dup {
+					continue
+				}
+				seen[id(entry)] = struct{}{}
+				if !yield(entry, nil) {
+					return
+				}
+			}
+			if len(page) < pageSize {
+				return
+			}
+			offset += len(page)
+		}
+	}
+}
+
+func setIncludeSamples(q url.Values, include bool) {
+	if include {
+		q.Set("include_samples", "true")
+	}
+}
+
+func setInt(q url.Values, key string, v int) {
+	if v != 0 {
+		q.Set(key, strconv.Itoa(v))
+	}
+}
+
+func setDuration(q url.Values, key string, d time.Duration) {
+	if d != 0 {
+		q.Set(key, d.String())
+	}
+}
+
+func setTime(q url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		q.Set(key, t.UTC().Format(time.RFC3339Nano))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"data-storage/internal/auth"
+	"data-storage/internal/config"
 	"data-storage/internal/db"
 	"data-storage/internal/models"
 
@@ -22,8 +23,11 @@ func main() {
 	}
 
 	// Initialize database
-	dbConfig := db.LoadConfigFromEnv()
-	database, err := db.InitDB(dbConfig)
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	database, err := db.InitDB(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -36,8 +40,15 @@ func main() {
 	database.Exec("TRUNCATE TABLE signals CASCADE")
 	database.Exec("TRUNCATE TABLE devices CASCADE")
 	database.Exec("TRUNCATE TABLE users CASCADE")
+	database.Exec("TRUNCATE TABLE memberships, org_invitations, organizations CASCADE")
+
+	// 1. Create an organization and a test user administering it
+	org := models.Organization{Name: "Test Organization", Slug: "test-organization", IsActive: true}
+	if result := database.Create(&org); result.Error != nil {
+		log.Fatalf("Failed to create organization: %v", result.Error)
+	}
+	log.Printf("✓ Created organization: %s (ID: %d)", org.Name, org.ID)
 
-	// 1. Create a test user
 	user := models.User{
 		Name:      "Test User",
 		Email:     "test@example.com",
@@ -57,6 +68,11 @@ func main() {
 	}
 	log.Printf("✓ Created user: %s (ID: %d, Email: %s, Password: password123)", user.Name, user.ID, user.Email)
 
+	result = database.Create(&models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: models.RoleAdmin})
+	if result.Error != nil {
+		log.Fatalf("Failed to create membership: %v", result.Error)
+	}
+
 	// 2. Create devices
 	devices := []models.Device{
 		{
@@ -91,6 +107,7 @@ func main() {
 			log.Fatalf("Failed to generate device token: %v", err)
 		}
 		devices[i].AuthToken = authToken
+		devices[i].OrganizationID = &org.ID
 
 		result := database.Create(&devices[i])
 		if result.Error != nil {